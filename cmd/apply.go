@@ -3,18 +3,22 @@ package cmd
 import (
 	"context"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"k8s.io/client-go/kubernetes"
 
+	initdatacmd "github.com/confidential-devhub/cococtl/cmd/initdata"
 	"github.com/confidential-devhub/cococtl/pkg/cluster"
 	"github.com/confidential-devhub/cococtl/pkg/config"
 	"github.com/confidential-devhub/cococtl/pkg/initdata"
 	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 	"github.com/confidential-devhub/cococtl/pkg/manifest"
 	"github.com/confidential-devhub/cococtl/pkg/secrets"
 	"github.com/confidential-devhub/cococtl/pkg/sidecar"
@@ -68,6 +72,11 @@ var (
 	sidecarSkipAutoSANs bool
 	sidecarPortForward  int
 	namespaceFlag       string
+	registerInitdata    bool
+	bindResourcePolicy  bool
+	generatePolicy      bool
+	policyPreset        string
+	initdataAlgorithm   string
 )
 
 func init() {
@@ -89,6 +98,14 @@ func init() {
 	applyCmd.Flags().IntVar(&sidecarPortForward, "sidecar-port-forward", 0, "Port to forward from primary container (requires --sidecar)")
 	applyCmd.Flags().StringVarP(&namespaceFlag, "namespace", "n", "", "Namespace for operations (overrides manifest and kubeconfig)")
 	applyCmd.Flags().BoolVar(&enableInitData, "enable-initdata", true, "Generate initdata annotation")
+	applyCmd.Flags().BoolVar(&registerInitdata, "register-initdata-digest", false, "Register the expected initdata measurement with Trustee as a reference value")
+	applyCmd.Flags().BoolVar(&generatePolicy, "generate-policy", false, "Generate a restrictive Kata agent policy from the workload spec and embed it in initdata")
+	applyCmd.Flags().StringVar(&policyPreset, "policy-preset", "", "Built-in Kata agent policy to embed instead of kata_agent_policy (see 'kubectl coco initdata create --list-policy-presets')")
+	applyCmd.MarkFlagsMutuallyExclusive("generate-policy", "policy-preset")
+	_ = applyCmd.RegisterFlagCompletionFunc("policy-preset", initdatacmd.CompletePolicyPresets)
+	applyCmd.Flags().StringVar(&initdataAlgorithm, "initdata-algorithm", "", "Initdata digest algorithm: sha256, sha384 or sha512 (default from config, else sha384 for TDX/SNP and sha256 otherwise)")
+	_ = applyCmd.RegisterFlagCompletionFunc("initdata-algorithm", initdatacmd.CompleteAlgorithms)
+	applyCmd.Flags().BoolVar(&bindResourcePolicy, "bind-resource-policy", false, "Restrict the app's KBS resources to its initdata measurement in the Trustee resource policy")
 }
 
 func runApply(cmd *cobra.Command, _ []string) error {
@@ -113,6 +130,11 @@ func runApply(cmd *cobra.Command, _ []string) error {
 	if manifestFile == "" {
 		return fmt.Errorf("required flag(s) \"filename\" not set")
 	}
+	if policyPreset != "" {
+		if _, err := initdata.LoadPolicyPreset(policyPreset); err != nil {
+			return err
+		}
+	}
 
 	// Load configuration
 	if configPath == "" {
@@ -139,6 +161,12 @@ func runApply(cmd *cobra.Command, _ []string) error {
 		rc = cfg.RuntimeClass
 	}
 
+	// Determine the initdata digest algorithm: flag, then config, then TEE default
+	cfg.Initdata.Algorithm, err = initdata.ResolveAlgorithm(initdataAlgorithm, cfg.Initdata.Algorithm, rc)
+	if err != nil {
+		return err
+	}
+
 	// Handle remote files
 	actualManifestFile := manifestFile
 	var tempFile string
@@ -281,6 +309,10 @@ func transformManifest(ctx context.Context, m *manifest.Manifest, cfg *config.Co
 		clientset = client.Clientset
 	}
 
+	// kbsResources collects the KBS resource paths the workload reads, for
+	// --bind-resource-policy.
+	var kbsResources []string
+
 	// 1. Set RuntimeClass
 	fmt.Printf("  - Setting runtimeClassName: %s\n", rc)
 	if err := m.SetRuntimeClass(rc); err != nil {
@@ -289,9 +321,11 @@ func transformManifest(ctx context.Context, m *manifest.Manifest, cfg *config.Co
 
 	// 2. Convert secrets if enabled
 	if convertSecrets {
-		if err := handleSecrets(ctx, m, skipApply, clientset, clientErr); err != nil {
+		secretPaths, err := handleSecrets(ctx, m, skipApply, clientset, clientErr)
+		if err != nil {
 			return fmt.Errorf("failed to convert secrets: %w", err)
 		}
+		kbsResources = append(kbsResources, secretPaths...)
 	} else {
 		// Just warn about secrets
 		secretRefs := m.GetSecretRefs()
@@ -306,17 +340,37 @@ func transformManifest(ctx context.Context, m *manifest.Manifest, cfg *config.Co
 	var imagePullSecretsInfo []initdata.ImagePullSecretInfo
 	if convertSecrets {
 		var err error
-		imagePullSecretsInfo, err = handleImagePullSecrets(ctx, m, skipApply, clientset, clientErr)
+		imagePullSecretsInfo, err = handleImagePullSecrets(ctx, cfg, m, resolvedNamespace, skipApply, manifestFile, client, clientErr)
 		if err != nil {
 			return fmt.Errorf("failed to handle imagePullSecrets: %w", err)
 		}
+		for _, ips := range imagePullSecretsInfo {
+			uri, err := kbsuri.New(ips.Namespace, ips.SecretName, ips.Key)
+			if err != nil {
+				return err
+			}
+			kbsResources = append(kbsResources, uri.Path())
+		}
 	}
+	imagePaths, err := imageResourcePaths(cfg, len(imagePullSecretsInfo) > 0)
+	if err != nil {
+		return err
+	}
+	kbsResources = append(kbsResources, imagePaths...)
+
+	// Workloads running images from 'image encrypt' need the guest to fetch the decryption key
+	encryptedImageKeys, err := handleEncryptedImages(m, cfg, enableInitData)
+	if err != nil {
+		return fmt.Errorf("failed to check encrypted images: %w", err)
+	}
+	kbsResources = append(kbsResources, encryptedImageKeys...)
 
 	// 4. Add initContainer if requested
 	if addInitContainer {
 		if err := handleInitContainer(m, cfg); err != nil {
 			return fmt.Errorf("failed to add initContainer: %w", err)
 		}
+		kbsResources = append(kbsResources, trustee.AttestationStatusPath)
 	}
 
 	// 5. Inject sidecar if enabled
@@ -346,12 +400,24 @@ func transformManifest(ctx context.Context, m *manifest.Manifest, cfg *config.Co
 		// Get Trustee namespace from config (where KBS is deployed)
 		trusteeNamespace := cfg.GetTrusteeNamespace()
 
+		// Generate and upload the sidecar configuration document (or save to file in skip-apply mode)
+		fmt.Println("  - Setting up sidecar configuration")
+		if err := handleSidecarConfig(ctx, cfg, appName, namespace, trusteeNamespace, skipApply, manifestFile, client); err != nil {
+			return fmt.Errorf("failed to setup sidecar configuration: %w", err)
+		}
+
 		// Generate and upload server certificate (or save to file in skip-apply mode)
 		fmt.Println("  - Setting up sidecar server certificate")
 		if err := handleSidecarServerCert(ctx, cfg, appName, namespace, trusteeNamespace, skipApply, manifestFile, client); err != nil {
 			return fmt.Errorf("failed to setup sidecar server certificate: %w", err)
 		}
 
+		sidecarPaths, err := sidecarResourcePaths(cfg, appName, namespace)
+		if err != nil {
+			return err
+		}
+		kbsResources = append(kbsResources, sidecarPaths...)
+
 		fmt.Println("  - Injecting secure access sidecar container")
 		if err := sidecar.Inject(m, cfg, appName, namespace); err != nil {
 			return fmt.Errorf("failed to inject sidecar: %w", err)
@@ -360,15 +426,53 @@ func transformManifest(ctx context.Context, m *manifest.Manifest, cfg *config.Co
 
 	// 6. Generate and add initdata annotation
 	if enableInitData {
+		var agentPolicy string
+		switch {
+		case generatePolicy:
+			var err error
+			agentPolicy, err = generateAgentPolicy(m, cfg)
+			if err != nil {
+				return err
+			}
+		case policyPreset != "":
+			var err error
+			agentPolicy, err = initdata.LoadPolicyPreset(policyPreset)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("  - Using Kata agent policy preset: %s\n", policyPreset)
+		}
+
 		fmt.Println("  - Generating initdata annotation")
-		initdataValue, err := initdata.Generate(cfg, imagePullSecretsInfo)
+		initdataRaw, err := initdata.GenerateRawWithPolicy(cfg, "", imagePullSecretsInfo, agentPolicy)
 		if err != nil {
 			return fmt.Errorf("failed to generate initdata: %w", err)
 		}
+		initdataValue, err := initdata.Encode(initdataRaw)
+		if err != nil {
+			return fmt.Errorf("failed to generate initdata: %w", err)
+		}
+		for _, warning := range initdata.CheckAnnotationSize(initdataValue, rc) {
+			fmt.Printf("  ⚠ Warning: %s\n", warning)
+		}
 
-		if err := m.SetAnnotation("io.katacontainers.config.hypervisor.cc_init_data", initdataValue); err != nil {
+		if err := m.SetAnnotation(initdata.AnnotationKey, initdataValue); err != nil {
 			return fmt.Errorf("failed to set initdata annotation: %w", err)
 		}
+
+		if registerInitdata {
+			if err := handleInitdataReferenceValue(ctx, cfg, rc, initdataRaw, skipApply, client); err != nil {
+				return fmt.Errorf("failed to register initdata reference value: %w", err)
+			}
+		}
+
+		if bindResourcePolicy {
+			if err := handleResourcePolicy(ctx, cfg, m, rc, resolvedNamespace, initdataRaw, kbsResources, skipApply, manifestFile, client); err != nil {
+				return fmt.Errorf("failed to bind resource policy: %w", err)
+			}
+		}
+	} else if bindResourcePolicy || generatePolicy || policyPreset != "" {
+		return fmt.Errorf("--bind-resource-policy, --generate-policy and --policy-preset require initdata (--enable-initdata)")
 	} else {
 		fmt.Println("  - Skipping initdata annotation generation (--enable-initdata is set to false)")
 	}
@@ -427,11 +531,11 @@ func handleInitContainer(m *manifest.Manifest, cfg *config.CocoConfig) error {
 	return nil
 }
 
-func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, clientset kubernetes.Interface, clientErr error) error {
+func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, clientset kubernetes.Interface, clientErr error) ([]string, error) {
 	// 1. Detect all secret references
 	allSecretRefs, err := secrets.DetectSecrets(m.GetData())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Filter out imagePullSecrets - they should NOT be converted to sealed secrets
@@ -451,7 +555,7 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 	}
 
 	if len(secretRefs) == 0 {
-		return nil // No secrets to convert
+		return nil, nil // No secrets to convert
 	}
 
 	fmt.Printf("  - Found %d K8s secret(s) to convert\n", len(secretRefs))
@@ -472,12 +576,12 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 		fmt.Printf("  - Resolving %d secret(s) offline (explicit keys in manifest)\n", len(offlineRefs))
 		offlineSecrets, err := secrets.InspectSecrets(ctx, nil, offlineRefs)
 		if err != nil {
-			return fmt.Errorf("failed to resolve offline secrets: %w", err)
+			return nil, fmt.Errorf("failed to resolve offline secrets: %w", err)
 		}
 		offlineKeys := secrets.ToSecretKeys(offlineSecrets)
 		offlineSealed, err := secrets.ConvertSecrets(offlineRefs, offlineKeys)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		allSealedSecrets = append(allSealedSecrets, offlineSealed...)
 	}
@@ -486,17 +590,17 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 	if len(clusterRefs) > 0 {
 		fmt.Printf("  - %d secret(s) require cluster access for key enumeration\n", len(clusterRefs))
 		if clientErr != nil {
-			return secretsClusterUnreachableError(clusterRefs, clientErr)
+			return nil, secretsClusterUnreachableError(clusterRefs, clientErr)
 		}
 
 		clusterSecrets, err := secrets.InspectSecrets(ctx, clientset, clusterRefs)
 		if err != nil {
-			return secretsClusterQueryError(clusterRefs, err)
+			return nil, secretsClusterQueryError(clusterRefs, err)
 		}
 		clusterKeys := secrets.ToSecretKeys(clusterSecrets)
 		clusterSealed, err := secrets.ConvertSecrets(clusterRefs, clusterKeys)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		allSealedSecrets = append(allSealedSecrets, clusterSealed...)
 	}
@@ -511,7 +615,7 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 		var yamlContent string
 		sealedSecretNames, yamlContent, err = secrets.GenerateSealedSecretsYAML(allSealedSecrets)
 		if err != nil {
-			return fmt.Errorf("failed to generate sealed secret YAML: %w", err)
+			return nil, fmt.Errorf("failed to generate sealed secret YAML: %w", err)
 		}
 
 		// Save to file
@@ -523,7 +627,7 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 		sealedSecretsPath := baseName + "-sealed-secrets.yaml"
 
 		if err := os.WriteFile(sealedSecretsPath, []byte(yamlContent), 0600); err != nil {
-			return fmt.Errorf("failed to write sealed secrets file: %w", err)
+			return nil, fmt.Errorf("failed to write sealed secrets file: %w", err)
 		}
 
 		fmt.Printf("  - Sealed secrets saved to: %s\n", sealedSecretsPath)
@@ -532,14 +636,14 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 		fmt.Println("  - Creating K8s sealed secrets in cluster")
 		sealedSecretNames, err = secrets.CreateSealedSecrets(allSealedSecrets)
 		if err != nil {
-			return fmt.Errorf("failed to create sealed secrets: %w", err)
+			return nil, fmt.Errorf("failed to create sealed secrets: %w", err)
 		}
 	}
 
 	// 5. Update manifest to use sealed secret names
 	fmt.Println("  - Updating manifest to use sealed secrets")
 	if err := updateManifestSecretNames(m, sealedSecretNames); err != nil {
-		return err
+		return nil, err
 	}
 
 	// 6. Generate Trustee secrets file (directly consumable by 'kbs populate -f')
@@ -551,13 +655,21 @@ func handleSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, cl
 	trusteeConfigPath := baseName + "-trustee-secrets.yaml"
 
 	if err := secrets.GenerateTrusteeConfig(allSealedSecrets, trusteeConfigPath); err != nil {
-		return fmt.Errorf("failed to generate Trustee config: %w", err)
+		return nil, fmt.Errorf("failed to generate Trustee config: %w", err)
 	}
 
 	// 7. Print instructions pointing to kbs populate
 	secrets.PrintTrusteeInstructions(allSealedSecrets, trusteeConfigPath)
 
-	return nil
+	paths := make([]string, 0, len(allSealedSecrets))
+	for _, ss := range allSealedSecrets {
+		uri, err := kbsuri.Parse(ss.ResourceURI)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, uri.Path())
+	}
+	return paths, nil
 }
 
 // updateManifestSecretNames replaces all secret references with sealed secret names
@@ -586,12 +698,19 @@ func applyWithKubectl(ctx context.Context, manifestPath string) error {
 	return nil
 }
 
-// handleImagePullSecrets detects imagePullSecrets from the manifest, inspects their
-// keys from the cluster, and returns ImagePullSecretInfo for initdata generation.
-// Falls back to the default service account if no imagePullSecrets are in the manifest.
-// Uploading secrets to KBS is not done here; use 'cococtl kbs populate' instead.
-func handleImagePullSecrets(ctx context.Context, m *manifest.Manifest, skipApply bool, clientset kubernetes.Interface, clientErr error) ([]initdata.ImagePullSecretInfo, error) {
-	// Detect imagePullSecrets in manifest, with fallback to default service account
+// handleImagePullSecrets detects imagePullSecrets from the manifest, merges the
+// registry credentials of all of them into a single .dockerconfigjson and uploads
+// it to KBS (or saves it next to the manifest when skipApply is true).
+// Falls back to the pod's service account if no imagePullSecrets are in the manifest.
+// CDH accepts a single authenticated_registry_credentials_uri, so the returned
+// slice holds one entry pointing at the combined credentials.
+func handleImagePullSecrets(ctx context.Context, cfg *config.CocoConfig, m *manifest.Manifest, namespace string, skipApply bool, manifestPath string, client *k8s.Client, clientErr error) ([]initdata.ImagePullSecretInfo, error) {
+	var clientset kubernetes.Interface
+	if client != nil {
+		clientset = client.Clientset
+	}
+
+	// Detect imagePullSecrets in manifest, with fallback to the service account
 	// Pass clientset for SA fallback (nil if client creation failed — fallback is skipped)
 	imagePullSecretRefs, err := secrets.DetectImagePullSecretsWithServiceAccount(ctx, clientset, m.GetData())
 	if err != nil {
@@ -604,14 +723,6 @@ func handleImagePullSecrets(ctx context.Context, m *manifest.Manifest, skipApply
 
 	fmt.Printf("  - Found %d imagePullSecret(s)\n", len(imagePullSecretRefs))
 
-	// CDH only supports a single authenticated_registry_credentials_uri
-	// If multiple imagePullSecrets are present, use only the first one
-	if len(imagePullSecretRefs) > 1 {
-		fmt.Printf("  ⚠ Warning: Multiple imagePullSecrets detected, but CDH supports only one\n")
-		fmt.Printf("    Using only the first imagePullSecret: %s\n", imagePullSecretRefs[0].Name)
-		imagePullSecretRefs = imagePullSecretRefs[:1]
-	}
-
 	// Ensure client is available for secret inspection
 	if clientErr != nil {
 		if skipApply {
@@ -623,7 +734,7 @@ func handleImagePullSecrets(ctx context.Context, m *manifest.Manifest, skipApply
 		return nil, fmt.Errorf("failed to create Kubernetes client: %w\n\nTo fix:\n  1. Ensure kubeconfig is properly configured and can access the cluster\n  2. Create the imagePullSecrets in the cluster first, then run this command\n  3. Or disable secret conversion with --convert-secrets=false", clientErr)
 	}
 
-	// Inspect K8s secrets to get keys
+	// Fetch the secrets: their contents are merged, not just their keys
 	inspectedSecrets, err := secrets.InspectSecrets(ctx, clientset, imagePullSecretRefs)
 	if err != nil {
 		if skipApply {
@@ -633,37 +744,370 @@ func handleImagePullSecrets(ctx context.Context, m *manifest.Manifest, skipApply
 		return nil, fmt.Errorf("failed to inspect imagePullSecrets: %w\n\nTo fix:\n  1. Ensure kubeconfig is properly configured and can access the cluster\n  2. Create the imagePullSecrets in the cluster first, then run this command\n  3. Or disable secret conversion with --convert-secrets=false", err)
 	}
 
-	// Convert to SecretKeys format
-	inspectedKeys := secrets.ToSecretKeys(inspectedSecrets)
-
-	// Build ImagePullSecretInfo for initdata
-	var imagePullSecretsInfo []initdata.ImagePullSecretInfo
+	// Collect the credential documents in listing order, so the first secret
+	// wins when several carry credentials for the same registry
+	var sources []trustee.RegistryAuthSource
 	for _, ref := range imagePullSecretRefs {
-		secretKeys, ok := inspectedKeys[ref.Name]
+		secret, ok := inspectedSecrets[ref.Name]
 		if !ok {
 			continue
 		}
-
-		// For each key in the imagePullSecret, create an entry
-		for _, key := range secretKeys.Keys {
-			// Use GetKBSKeyName to ensure consistent key name handling
-			// This handles both .dockercfg -> .dockerconfigjson conversion
-			// and stripping leading dots for KBS URI compatibility
-			kbsKey := trustee.GetKBSKeyName(key)
-
-			imagePullSecretsInfo = append(imagePullSecretsInfo, initdata.ImagePullSecretInfo{
-				Namespace:  secretKeys.Namespace,
-				SecretName: ref.Name,
-				Key:        kbsKey,
+		keys := make([]string, 0, len(secret.Data))
+		for key := range secret.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sources = append(sources, trustee.RegistryAuthSource{
+				Secret: ref.Name,
+				Key:    key,
+				Data:   secret.Data[key],
 			})
 		}
 	}
 
+	authJSON, warnings, err := trustee.MergeDockerConfigs(sources)
+	for _, w := range warnings {
+		fmt.Printf("  ⚠ Warning: %s\n", w)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	appName := m.GetName()
+	if appName == "" {
+		return nil, fmt.Errorf("manifest must have metadata.name to store registry credentials in KBS")
+	}
+	info := initdata.ImagePullSecretInfo{
+		Namespace:  namespace,
+		SecretName: trustee.RegistryAuthSecretName(appName),
+		Key:        trustee.RegistryAuthKey,
+	}
+	uri, err := kbsuri.New(info.Namespace, info.SecretName, info.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KBS URI for registry credentials: %w", err)
+	}
+	fmt.Printf("  - Merged registry credentials from %d imagePullSecret(s) into %s\n", len(inspectedSecrets), uri)
+
 	// Note: We keep imagePullSecrets in the manifest as CRI-O still needs them for image pulls.
 	// The authenticated_registry_credentials_uri in initdata is used by guest components.
-	// Use 'cococtl kbs populate -f <trustee-secrets.yaml>' to upload imagePullSecrets to KBS.
+	if skipApply {
+		ext := filepath.Ext(manifestPath)
+		if ext == "" {
+			ext = ".yaml"
+		}
+		authPath := strings.TrimSuffix(manifestPath, ext) + "-registry-auth.json"
+		if err := os.WriteFile(authPath, authJSON, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write registry credentials file: %w", err)
+		}
+		fmt.Printf("  - Registry credentials saved to: %s (Trustee upload skipped)\n", authPath)
+		fmt.Println("    Upload them with:")
+		fmt.Printf("      kubectl coco kbs populate --path %s --resource-file %s\n", uri.Path(), authPath)
+		return []initdata.ImagePullSecretInfo{info}, nil
+	}
+
+	trusteeNamespace := cfg.GetTrusteeNamespace()
+	fmt.Printf("  - Uploading registry credentials to Trustee KBS (namespace: %s)...\n", trusteeNamespace)
+	kbsClient, stopForward, err := trustee.NewClientWithPortForward(ctx, client.Config, client.Clientset, trusteeNamespace, cfg.KBSAuthDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to KBS: %w", err)
+	}
+	defer stopForward()
+	if err := trustee.UploadResource(ctx, kbsClient, uri.Path(), authJSON); err != nil {
+		return nil, fmt.Errorf("failed to upload registry credentials to KBS: %w", err)
+	}
+
+	return []initdata.ImagePullSecretInfo{info}, nil
+}
+
+// handleEncryptedImages looks up the workload's images among those recorded by
+// 'image encrypt' and checks that the guest can decrypt them: the Confidential
+// Data Hub fetches the key from the KBS configured in initdata, so initdata must
+// be enabled. It returns the KBS resource paths of the decryption keys.
+func handleEncryptedImages(m *manifest.Manifest, cfg *config.CocoConfig, enableInitData bool) ([]string, error) {
+	if len(cfg.EncryptedImages) == 0 {
+		return nil, nil
+	}
+	podSpec, err := m.GetPodSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, image := range podImages(podSpec) {
+		keyURI, ok := cfg.EncryptedImages[image]
+		if !ok {
+			continue
+		}
+		uri, err := kbsuri.Parse(keyURI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid decryption key URI for %s in config: %w", image, err)
+		}
+		if !enableInitData {
+			return nil, fmt.Errorf("image %s is encrypted and its key (%s) is fetched from the KBS configured in initdata; enable initdata (--enable-initdata)", image, uri)
+		}
+		fmt.Printf("  - Image %s is encrypted; decryption key: %s\n", image, uri)
+		paths = append(paths, uri.Path())
+	}
+	return paths, nil
+}
+
+// podImages returns the images of the containers and init containers in a pod spec.
+func podImages(podSpec map[string]interface{}) []string {
+	var images []string
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _ := podSpec[field].([]interface{})
+		for _, c := range containers {
+			container, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if image, _ := container["image"].(string); image != "" {
+				images = append(images, image)
+			}
+		}
+	}
+	return images
+}
+
+// generateAgentPolicy derives the Kata agent policy from the transformed pod
+// spec, so injected init and sidecar containers are covered too.
+func generateAgentPolicy(m *manifest.Manifest, cfg *config.CocoConfig) (string, error) {
+	fmt.Println("  - Generating Kata agent policy from the workload spec")
+	if cfg.KataAgentPolicy != "" {
+		fmt.Printf("  ⚠ Warning: --generate-policy overrides kata_agent_policy (%s) from config\n", cfg.KataAgentPolicy)
+	}
+	podSpec, err := m.GetPodSpec()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate agent policy: %w", err)
+	}
+	policy, warnings, err := initdata.GenerateAgentPolicy(podSpec)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate agent policy: %w", err)
+	}
+	for _, w := range warnings {
+		fmt.Printf("  ⚠ Warning: %s; pin it (image@sha256:...) so the policy fixes the image content\n", w)
+	}
+	fmt.Println("    Environment variables set by the images are denied unless listed in the container env")
+	return policy, nil
+}
+
+// initdataMeasurements returns the hex-encoded measurement the TEE will report
+// for the raw initdata. The TEE is derived from the RuntimeClass; when that is
+// not possible the measurements for all fallback TEEs are returned.
+func initdataMeasurements(raw []byte, rc string, fallback []initdata.TEE) (map[initdata.TEE]string, error) {
+	digest, _, err := initdata.DigestOf(raw)
+	if err != nil {
+		return nil, err
+	}
 
-	return imagePullSecretsInfo, nil
+	tees := fallback
+	if tee, ok := initdata.TEEFromRuntimeClass(rc); ok {
+		tees = []initdata.TEE{tee}
+	}
+	measurements := make(map[initdata.TEE]string, len(tees))
+	for _, tee := range tees {
+		measurement, err := initdata.ExpectedMeasurement(digest, tee)
+		if err != nil {
+			return nil, err
+		}
+		measurements[tee] = hex.EncodeToString(measurement)
+	}
+	return measurements, nil
+}
+
+// handleInitdataReferenceValue computes the measurement the TEE will report for
+// the generated initdata and registers it with Trustee as a reference value, or
+// prints the command to do so when skipApply is true. When the TEE cannot be
+// derived from the RuntimeClass, the measurements for all TEEs are registered.
+func handleInitdataReferenceValue(ctx context.Context, cfg *config.CocoConfig, rc string, raw []byte, skipApply bool, k8sClient *k8s.Client) error {
+	measurements, err := initdataMeasurements(raw, rc, initdata.ValidTEEs)
+	if err != nil {
+		return err
+	}
+	values := make([]string, 0, len(measurements))
+	for _, tee := range initdata.ValidTEEs {
+		if v, ok := measurements[tee]; ok {
+			values = append(values, v)
+		}
+	}
+
+	if skipApply {
+		fmt.Println("  - Initdata reference value not registered (--skip-apply). Register it with:")
+		fmt.Printf("      kubectl coco kbs reference-values add %s %s\n", initdata.ReferenceValueName, strings.Join(values, " "))
+		return nil
+	}
+
+	if k8sClient == nil {
+		return fmt.Errorf("kubernetes client is required for reference value registration")
+	}
+	trusteeNamespace := cfg.GetTrusteeNamespace()
+	fmt.Printf("  - Registering initdata reference value with Trustee (namespace: %s)...\n", trusteeNamespace)
+	kbsClient, stopForward, err := trustee.NewClientWithPortForward(ctx, k8sClient.Config, k8sClient.Clientset, trusteeNamespace, cfg.KBSAuthDir)
+	if err != nil {
+		return fmt.Errorf("failed to connect to KBS: %w", err)
+	}
+	defer stopForward()
+	if err := trustee.AddReferenceValues(ctx, kbsClient, initdata.ReferenceValueName, values); err != nil {
+		return err
+	}
+	fmt.Printf("  - Registered %s reference value %s\n", initdata.ReferenceValueName, strings.Join(values, ", "))
+	return nil
+}
+
+// handleResourcePolicy restricts the workload's KBS resources to TEEs reporting
+// its initdata measurement. The generated rules are merged into the resource
+// policy enforced by Trustee, or saved next to the manifest when skipApply is true.
+func handleResourcePolicy(ctx context.Context, cfg *config.CocoConfig, m *manifest.Manifest, rc, namespace string, raw []byte, resources []string, skipApply bool, manifestPath string, k8sClient *k8s.Client) error {
+	if len(resources) == 0 {
+		fmt.Println("  - No KBS resources referenced by the workload; resource policy unchanged")
+		return nil
+	}
+
+	// Only TDX and SNP report the initdata measurement as an attestation claim.
+	measurements, err := initdataMeasurements(raw, rc, []initdata.TEE{initdata.TEETDX, initdata.TEESNP})
+	if err != nil {
+		return err
+	}
+	binding := trustee.ResourceBinding{
+		App:          namespace + "/" + m.GetName(),
+		Resources:    resources,
+		Measurements: measurements,
+	}
+
+	if skipApply {
+		policy, _, err := trustee.MergeResourcePolicy("", binding)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(manifestPath)
+		if ext == "" {
+			ext = ".yaml"
+		}
+		policyPath := strings.TrimSuffix(manifestPath, ext) + "-resource-policy.rego"
+		if err := os.WriteFile(policyPath, []byte(policy), 0600); err != nil {
+			return fmt.Errorf("failed to write resource policy file: %w", err)
+		}
+		fmt.Printf("  - Resource policy saved to: %s (Trustee upload skipped)\n", policyPath)
+		fmt.Println("    It only contains the rules for this app; merge it into the current policy")
+		fmt.Println("    ('kubectl coco kbs policy get --type resource') before uploading with:")
+		fmt.Printf("      kubectl coco kbs policy set --type resource %s\n", policyPath)
+		return nil
+	}
+
+	if k8sClient == nil {
+		return fmt.Errorf("kubernetes client is required for resource policy upload")
+	}
+	trusteeNamespace := cfg.GetTrusteeNamespace()
+	fmt.Printf("  - Binding %d KBS resource(s) to the initdata measurement (namespace: %s)...\n", len(resources), trusteeNamespace)
+	kbsClient, stopForward, err := trustee.NewClientWithPortForward(ctx, k8sClient.Config, k8sClient.Clientset, trusteeNamespace, cfg.KBSAuthDir)
+	if err != nil {
+		return fmt.Errorf("failed to connect to KBS: %w", err)
+	}
+	defer stopForward()
+
+	replacedAllowAll, err := trustee.BindResources(ctx, k8sClient.Clientset, trusteeNamespace, kbsClient, binding)
+	if err != nil {
+		return err
+	}
+	if replacedAllowAll {
+		fmt.Println("  ⚠ Warning: the resource policy allowed every resource by default; it now denies")
+		fmt.Println("    resources that no rule allows. Bind other workloads with --bind-resource-policy")
+		fmt.Println("    or add rules with 'kubectl coco kbs policy set --type resource'.")
+	}
+	fmt.Printf("  - Resource policy updated for %s\n", binding.App)
+	return nil
+}
+
+// imageResourcePaths returns the KBS resource paths of the image pull settings
+// that the generated cdh.toml takes from the config, including the keys the
+// image security policy verifies signatures with. The registry credentials of
+// imagePullSecrets replace registry_cred_uri. URIs of other schemes are not
+// fetched from KBS and are skipped.
+func imageResourcePaths(cfg *config.CocoConfig, hasImagePullSecrets bool) ([]string, error) {
+	uris := append([]string{cfg.ContainerPolicyURI, cfg.RegistryConfigURI}, cfg.ContainerPolicyKeys...)
+	if !hasImagePullSecrets {
+		uris = append(uris, cfg.RegistryCredURI)
+	}
+	var paths []string
+	for _, u := range uris {
+		if !strings.HasPrefix(u, kbsuri.Scheme+"://") {
+			continue
+		}
+		uri, err := kbsuri.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, uri.Path())
+	}
+	return paths, nil
+}
+
+// sidecarResourcePaths returns the KBS resource paths the sidecar reads at startup.
+func sidecarResourcePaths(cfg *config.CocoConfig, appName, namespace string) ([]string, error) {
+	serverCertURI, serverKeyURI, _ := sidecar.GenerateCertURIs(appName, namespace)
+	uris := []string{
+		sidecar.GenerateConfigURI(appName, namespace),
+		serverCertURI,
+		serverKeyURI,
+		cfg.Sidecar.ClientCAURI,
+	}
+	paths := []string{trustee.AttestationStatusPath}
+	for _, u := range uris {
+		uri, err := kbsuri.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, uri.Path())
+	}
+	return paths, nil
+}
+
+// handleSidecarConfig generates the sidecar configuration document from the [sidecar]
+// section of the config and either uploads it to Trustee KBS or saves it next to the
+// manifest (when skipApply is true). The sidecar fetches it at startup via CONFIG_URI.
+func handleSidecarConfig(ctx context.Context, cfg *config.CocoConfig, appName, namespace, trusteeNamespace string, skipApply bool, manifestPath string, k8sClient *k8s.Client) error {
+	configDoc, err := sidecar.GenerateConfig(cfg, appName, namespace)
+	if err != nil {
+		return err
+	}
+
+	configURI, err := kbsuri.Parse(sidecar.GenerateConfigURI(appName, namespace))
+	if err != nil {
+		return err
+	}
+	configPath := configURI.Path()
+
+	if !skipApply {
+		// Normal mode: upload to Trustee KBS via port-forward
+		if k8sClient == nil {
+			return fmt.Errorf("kubernetes client is required for sidecar config upload to KBS")
+		}
+		fmt.Printf("  - Uploading sidecar configuration to Trustee KBS (namespace: %s)...\n", trusteeNamespace)
+		kbsClient, stopForward, err := trustee.NewClientWithPortForward(ctx, k8sClient.Config, k8sClient.Clientset, trusteeNamespace, cfg.KBSAuthDir)
+		if err != nil {
+			return fmt.Errorf("failed to connect to KBS: %w", err)
+		}
+		defer stopForward()
+		if err := trustee.UploadResources(ctx, kbsClient, map[string][]byte{configPath: configDoc}); err != nil {
+			return fmt.Errorf("failed to upload sidecar configuration to KBS: %w", err)
+		}
+		fmt.Printf("  - Sidecar configuration uploaded to %s\n", configURI)
+		return nil
+	}
+
+	// Skip-apply mode: save the document next to the manifest
+	ext := filepath.Ext(manifestPath)
+	if ext == "" {
+		ext = ".yaml"
+	}
+	configFilePath := strings.TrimSuffix(manifestPath, ext) + "-sidecar-config.json"
+	if err := os.WriteFile(configFilePath, configDoc, 0600); err != nil {
+		return fmt.Errorf("failed to write sidecar configuration file: %w", err)
+	}
+	fmt.Printf("  - Sidecar configuration saved to: %s (Trustee upload skipped)\n", configFilePath)
+	fmt.Printf("  - Upload it with: kubectl coco kbs populate --path %s --resource-file %s\n", configPath, configFilePath)
+	return nil
 }
 
 // handleSidecarServerCert generates and uploads a server certificate for the sidecar.
@@ -753,8 +1197,17 @@ func handleSidecarServerCert(ctx context.Context, cfg *config.CocoConfig, appNam
 	}
 
 	// Build KBS resource paths for certificate storage
-	serverCertPath := namespace + "/sidecar-tls-" + appName + "/server-cert"
-	serverKeyPath := namespace + "/sidecar-tls-" + appName + "/server-key"
+	serverCertURI, serverKeyURI, _ := sidecar.GenerateCertURIs(appName, namespace)
+	certURI, err := kbsuri.Parse(serverCertURI)
+	if err != nil {
+		return err
+	}
+	keyURI, err := kbsuri.Parse(serverKeyURI)
+	if err != nil {
+		return err
+	}
+	serverCertPath := certURI.Path()
+	serverKeyPath := keyURI.Path()
 
 	if !skipApply {
 		// Normal mode: upload to Trustee KBS via port-forward
@@ -774,7 +1227,7 @@ func handleSidecarServerCert(ctx context.Context, cfg *config.CocoConfig, appNam
 		if err := trustee.UploadResources(ctx, kbsClient, resources); err != nil {
 			return fmt.Errorf("failed to upload server certificate to KBS: %w", err)
 		}
-		fmt.Printf("  - Server certificate uploaded to kbs:///%s and kbs:///%s\n", serverCertPath, serverKeyPath)
+		fmt.Printf("  - Server certificate uploaded to %s and %s\n", certURI, keyURI)
 	} else {
 		// Skip-apply mode: save certs to file instead of uploading
 		certFilePath, err := saveSidecarCertsToYAML(manifestPath, serverCert, appName, namespace)
@@ -782,7 +1235,7 @@ func handleSidecarServerCert(ctx context.Context, cfg *config.CocoConfig, appNam
 			return err
 		}
 		fmt.Printf("  - Sidecar certificate saved to: %s (Trustee upload skipped)\n", certFilePath)
-		fmt.Printf("  - KBS resource paths: kbs:///%s and kbs:///%s\n", serverCertPath, serverKeyPath)
+		fmt.Printf("  - KBS resource paths: %s and %s\n", certURI, keyURI)
 	}
 
 	return nil
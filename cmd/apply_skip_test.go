@@ -8,7 +8,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/confidential-devhub/cococtl/pkg/config"
 	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/manifest"
 	"github.com/confidential-devhub/cococtl/pkg/secrets"
 	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
 	"gopkg.in/yaml.v3"
@@ -364,3 +366,156 @@ func TestSkipApply_SecretRefSplitting(t *testing.T) {
 		t.Errorf("First cluster ref should be 'envfrom-secret', got %q", clusterRefs[0].Name)
 	}
 }
+
+// TestSkipApply_InitdataReferenceValue verifies that --register-initdata-digest in
+// skip-apply mode needs no cluster access and only prints the registration command.
+func TestSkipApply_InitdataReferenceValue(t *testing.T) {
+	raw := []byte("version = \"0.1.0\"\nalgorithm = \"sha256\"\n\n[data]\n")
+	if err := handleInitdataReferenceValue(t.Context(), nil, "kata-qemu-snp", raw, true, nil); err != nil {
+		t.Fatalf("handleInitdataReferenceValue() error = %v", err)
+	}
+	if err := handleInitdataReferenceValue(t.Context(), nil, "kata-cc", []byte("not toml ="), true, nil); err == nil {
+		t.Error("handleInitdataReferenceValue() expected error for invalid initdata")
+	}
+}
+
+// TestSkipApply_ResourcePolicyFileSaving verifies that --bind-resource-policy in
+// skip-apply mode saves the generated rules next to the manifest.
+func TestSkipApply_ResourcePolicyFileSaving(t *testing.T) {
+	tmpDir := t.TempDir()
+	manifestPath := filepath.Join(tmpDir, "app.yaml")
+	podYAML := "apiVersion: v1\nkind: Pod\nmetadata:\n  name: test-app\nspec:\n  containers:\n  - name: app\n    image: nginx\n"
+	if err := os.WriteFile(manifestPath, []byte(podYAML), 0600); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	raw := []byte("version = \"0.1.0\"\nalgorithm = \"sha384\"\n\n[data]\n")
+	resources := []string{"test-ns/db-secret/password"}
+	if err := handleResourcePolicy(t.Context(), nil, m, "kata-qemu-tdx", "test-ns", raw, resources, true, manifestPath, nil); err != nil {
+		t.Fatalf("handleResourcePolicy() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, "app-resource-policy.rego"))
+	if err != nil {
+		t.Fatalf("resource policy file not written: %v", err)
+	}
+	policy := string(data)
+	for _, want := range []string{"default allow := false", "# BEGIN cococtl app test-ns/test-app", `"test-ns/db-secret/password"`, `["tdx"]`} {
+		if !strings.Contains(policy, want) {
+			t.Errorf("resource policy missing %q:\n%s", want, policy)
+		}
+	}
+	if strings.Contains(policy, `["snp"]`) {
+		t.Errorf("resource policy should only bind the TEE of the RuntimeClass:\n%s", policy)
+	}
+}
+
+// TestSkipApply_GenerateAgentPolicy verifies that --generate-policy derives the
+// agent policy from the pod template of a workload.
+func TestSkipApply_GenerateAgentPolicy(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "deploy.yaml")
+	deployYAML := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: nginx@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+`
+	if err := os.WriteFile(manifestPath, []byte(deployYAML), 0600); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+
+	policy, err := generateAgentPolicy(m, &config.CocoConfig{})
+	if err != nil {
+		t.Fatalf("generateAgentPolicy() error = %v", err)
+	}
+	if !strings.Contains(policy, `"name": "web"`) || !strings.Contains(policy, "default CreateContainerRequest := false") {
+		t.Errorf("generated policy does not restrict containers to the spec:\n%s", policy)
+	}
+}
+
+// TestSkipApply_EncryptedImages verifies that images recorded by 'image encrypt'
+// require initdata and contribute their decryption key to the KBS resources.
+func TestSkipApply_EncryptedImages(t *testing.T) {
+	manifestPath := filepath.Join(t.TempDir(), "pod.yaml")
+	podYAML := `apiVersion: v1
+kind: Pod
+metadata:
+  name: app
+spec:
+  initContainers:
+  - name: setup
+    image: busybox
+  containers:
+  - name: app
+    image: quay.io/myorg/app:encrypted
+`
+	if err := os.WriteFile(manifestPath, []byte(podYAML), 0600); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+	m, err := manifest.Load(manifestPath)
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	cfg := &config.CocoConfig{EncryptedImages: map[string]string{
+		"quay.io/myorg/app:encrypted": "kbs:///default/image-kek/app",
+		"quay.io/myorg/other:enc":     "kbs:///default/image-kek/other",
+	}}
+
+	paths, err := handleEncryptedImages(m, cfg, true)
+	if err != nil {
+		t.Fatalf("handleEncryptedImages() error = %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "default/image-kek/app" {
+		t.Errorf("handleEncryptedImages() = %v, want [default/image-kek/app]", paths)
+	}
+
+	if _, err := handleEncryptedImages(m, cfg, false); err == nil || !strings.Contains(err.Error(), "initdata") {
+		t.Errorf("handleEncryptedImages() without initdata error = %v, want initdata error", err)
+	}
+}
+
+func TestImageResourcePaths(t *testing.T) {
+	cfg := &config.CocoConfig{
+		ContainerPolicyURI:  "kbs:///default/security-policy/default",
+		ContainerPolicyKeys: []string{"kbs:///default/cosign-public-key/quay.io_myorg"},
+		RegistryCredURI:     "kbs:///default/registry/auth",
+		RegistryConfigURI:   "kbs:///default/registry/config",
+	}
+	paths, err := imageResourcePaths(cfg, false)
+	if err != nil {
+		t.Fatalf("imageResourcePaths() error = %v", err)
+	}
+	want := "default/security-policy/default,default/registry/config,default/cosign-public-key/quay.io_myorg,default/registry/auth"
+	if strings.Join(paths, ",") != want {
+		t.Errorf("imageResourcePaths() = %v, want %s", paths, want)
+	}
+
+	// imagePullSecrets replace registry_cred_uri in cdh.toml.
+	paths, err = imageResourcePaths(cfg, true)
+	if err != nil || strings.Contains(strings.Join(paths, ","), "registry/auth") {
+		t.Errorf("imageResourcePaths() with imagePullSecrets = %v, %v", paths, err)
+	}
+
+	cfg = &config.CocoConfig{RegistryConfigURI: "file:///etc/containers/registries.conf"}
+	if paths, err := imageResourcePaths(cfg, true); err != nil || len(paths) != 0 {
+		t.Errorf("imageResourcePaths() with non-KBS URI = %v, %v", paths, err)
+	}
+
+	cfg.RegistryCredURI = "kbs:///default/registry"
+	if _, err := imageResourcePaths(cfg, false); err == nil {
+		t.Error("imageResourcePaths() expected error for invalid KBS URI")
+	}
+}
@@ -0,0 +1,174 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/cmd/kbs"
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/imagecrypt"
+	"github.com/confidential-devhub/cococtl/pkg/imagepolicy"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+)
+
+// keyResourceType is the KBS resource type under which image encryption keys are stored.
+const keyResourceType = "image-kek"
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt <oci-layout-dir>",
+	Short: "Encrypt an OCI image layout with a key held in KBS",
+	Long: `Encrypt every layer of an OCI image layout with a freshly generated key,
+upload the key to KBS, and record the image in the CoCo config so that
+'kubectl coco apply' can check that workloads using it are set up to decrypt it.
+
+Layers are encrypted in the ocicrypt format. Each layer key is wrapped with the
+KBS key for the attestation-agent key provider, so the Confidential Data Hub in
+the guest fetches the key from KBS after attestation and decrypts the image.
+The key is stored at kbs:///default/image-kek/<image> unless --key-path is given.
+
+The encrypted layout is written to --output; push it with skopeo, e.g.
+'skopeo copy oci:<output> docker://<image>'. Export an image to an OCI layout
+with 'skopeo copy docker://<source> oci:<dir>'.
+
+Examples:
+  kubectl coco image encrypt ./app-oci -o ./app-oci-enc --image quay.io/myorg/app:encrypted
+  kubectl coco image encrypt ./app-oci -o ./app-oci-enc --image quay.io/myorg/app:encrypted --key-path default/image-kek/app
+  kubectl coco image encrypt ./app-oci -o ./app-oci-enc --image quay.io/myorg/app:encrypted --skip-upload --key-file app.key`,
+	Args: cobra.ExactArgs(1),
+	RunE: runEncrypt,
+}
+
+var (
+	encryptOutput     string
+	encryptImage      string
+	encryptKeyPath    string
+	encryptSkipUpload bool
+	encryptKeyFile    string
+	encryptConfigPath string
+	encryptConn       kbs.Connection
+)
+
+func init() {
+	encryptCmd.Flags().StringVarP(&encryptOutput, "output", "o", "", "Directory for the encrypted OCI layout (must not exist or be empty)")
+	encryptCmd.Flags().StringVar(&encryptImage, "image", "", "Image reference the encrypted image will be pushed as, e.g. quay.io/myorg/app:encrypted")
+	encryptCmd.Flags().StringVar(&encryptKeyPath, "key-path", "", "KBS resource path for the key in 'repository/type/tag' format (default: default/image-kek/<image>)")
+	encryptCmd.Flags().BoolVar(&encryptSkipUpload, "skip-upload", false, "Do not upload the key to KBS; save it to --key-file instead")
+	encryptCmd.Flags().StringVar(&encryptKeyFile, "key-file", "", "File to save the key to (required with --skip-upload)")
+	encryptCmd.Flags().StringVar(&encryptConfigPath, "config", "", "Path to CoCo config file to update (default: ~/.kube/coco-config.toml)")
+	kbs.AddConnectionFlags(encryptCmd, &encryptConn)
+	_ = encryptCmd.MarkFlagRequired("output")
+	_ = encryptCmd.MarkFlagRequired("image")
+}
+
+// decryptionKeyURI returns the KBS URI of the key for image, honouring an explicit path.
+func decryptionKeyURI(image, keyPath string) (kbsuri.ResourceURI, error) {
+	if keyPath != "" {
+		uri, err := kbsuri.ParsePath(keyPath)
+		if err != nil {
+			return kbsuri.ResourceURI{}, fmt.Errorf("invalid --key-path: %w", err)
+		}
+		return uri, nil
+	}
+	uri, err := kbsuri.New("default", keyResourceType, imagepolicy.KeyResourceTag(image))
+	if err != nil {
+		return kbsuri.ResourceURI{}, fmt.Errorf("cannot derive a KBS path from image %q (use --key-path): %w", image, err)
+	}
+	return uri, nil
+}
+
+// recordEncryptedImage stores the decryption key URI of image in the CoCo config.
+// It returns false when the config file does not exist.
+func recordEncryptedImage(configPath, image, uri string) (bool, error) {
+	if _, err := kbsuri.Parse(uri); err != nil {
+		return false, fmt.Errorf("invalid decryption key URI for %s: %w", image, err)
+	}
+	if configPath == "" {
+		var err error
+		configPath, err = config.GetConfigPath()
+		if err != nil {
+			return false, fmt.Errorf("failed to determine config path: %w", err)
+		}
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load config from %s: %w", configPath, err)
+	}
+	if cfg.EncryptedImages == nil {
+		cfg.EncryptedImages = make(map[string]string)
+	}
+	cfg.EncryptedImages[image] = uri
+	if err := cfg.Save(configPath); err != nil {
+		return false, fmt.Errorf("failed to save config to %q: %w", configPath, err)
+	}
+	return true, nil
+}
+
+func runEncrypt(cmd *cobra.Command, args []string) error {
+	layoutDir := args[0]
+	if encryptSkipUpload && encryptKeyFile == "" {
+		return fmt.Errorf("--skip-upload requires --key-file")
+	}
+	keyURI, err := decryptionKeyURI(encryptImage, encryptKeyPath)
+	if err != nil {
+		return err
+	}
+
+	key, err := imagecrypt.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	// Store the key before encrypting, so an encrypted image never exists
+	// without a way to decrypt it.
+	if encryptSkipUpload {
+		if err := os.WriteFile(encryptKeyFile, key, 0600); err != nil {
+			return fmt.Errorf("failed to write key file: %w", err)
+		}
+		fmt.Printf("  ✓ Key saved to %s (KBS upload skipped)\n", encryptKeyFile)
+	} else {
+		ctx := cmd.Context()
+		kbsClient, stopForward, err := kbs.Connect(ctx, &encryptConn)
+		if err != nil {
+			return err
+		}
+		defer stopForward()
+		if err := kbsClient.SetResource(ctx, keyURI.Path(), key); err != nil {
+			return fmt.Errorf("failed to upload key to %s: %w", keyURI, err)
+		}
+		fmt.Printf("  ✓ Key uploaded to %s\n", keyURI)
+	}
+
+	result, err := imagecrypt.EncryptLayout(layoutDir, encryptOutput, key, keyURI.String())
+	if err != nil {
+		return fmt.Errorf("failed to encrypt %s: %w", layoutDir, err)
+	}
+	fmt.Printf("  ✓ Encrypted %d layer(s) in %d manifest(s) to %s\n", result.Layers, result.Manifests, encryptOutput)
+	if result.Skipped > 0 {
+		fmt.Printf("  ⚠ Warning: %d layer(s) were already encrypted and left unchanged\n", result.Skipped)
+	}
+
+	recorded, err := recordEncryptedImage(encryptConfigPath, encryptImage, keyURI.String())
+	if err != nil {
+		return err
+	}
+	if recorded {
+		fmt.Printf("  ✓ Recorded %s as encrypted in config\n", encryptImage)
+	} else {
+		fmt.Println("  ⚠ Warning: CoCo config not found; run 'kubectl coco init' and add:")
+		fmt.Printf("      [encrypted_images]\n      %q = %q\n", encryptImage, keyURI.String())
+	}
+
+	fmt.Println("\nNext steps:")
+	if encryptSkipUpload {
+		fmt.Printf("  kubectl coco kbs populate --path %s --resource-file %s\n", keyURI.Path(), encryptKeyFile)
+	}
+	fmt.Printf("  skopeo copy oci:%s docker://%s\n", encryptOutput, encryptImage)
+	return nil
+}
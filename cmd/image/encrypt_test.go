@@ -0,0 +1,63 @@
+package image
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+)
+
+func TestDecryptionKeyURI(t *testing.T) {
+	uri, err := decryptionKeyURI("quay.io/myorg/app:encrypted", "")
+	if err != nil {
+		t.Fatalf("decryptionKeyURI() error = %v", err)
+	}
+	if got := uri.String(); got != "kbs:///default/image-kek/quay.io_myorg_app_encrypted" {
+		t.Errorf("decryptionKeyURI() = %q", got)
+	}
+
+	uri, err = decryptionKeyURI("quay.io/myorg/app:encrypted", "apps/keys/app")
+	if err != nil {
+		t.Fatalf("decryptionKeyURI() error = %v", err)
+	}
+	if got := uri.Path(); got != "apps/keys/app" {
+		t.Errorf("decryptionKeyURI() path = %q, want apps/keys/app", got)
+	}
+
+	if _, err := decryptionKeyURI("quay.io/app", "not-a-path"); err == nil {
+		t.Error("decryptionKeyURI() expected error for an invalid --key-path")
+	}
+}
+
+func TestRecordEncryptedImage(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "coco-config.toml")
+
+	recorded, err := recordEncryptedImage(configPath, "quay.io/myorg/app:enc", "kbs:///default/image-kek/app")
+	if err != nil || recorded {
+		t.Fatalf("recordEncryptedImage() on missing config = (%v, %v), want (false, nil)", recorded, err)
+	}
+
+	if err := config.DefaultConfig().Save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	images := map[string]string{
+		"quay.io/myorg/app:enc": "kbs:///default/image-kek/app",
+		"quay.io/myorg/db:enc":  "kbs:///default/image-kek/db",
+	}
+	for image, uri := range images {
+		if _, err := recordEncryptedImage(configPath, image, uri); err != nil {
+			t.Fatalf("recordEncryptedImage(%s) error = %v", image, err)
+		}
+	}
+	if _, err := recordEncryptedImage(configPath, "quay.io/myorg/web:enc", "kbs:///default/image-kek/web:enc"); err == nil {
+		t.Error("recordEncryptedImage() expected error for an invalid KBS URI")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.EncryptedImages) != 2 || cfg.EncryptedImages["quay.io/myorg/app:enc"] != "kbs:///default/image-kek/app" {
+		t.Errorf("EncryptedImages = %v", cfg.EncryptedImages)
+	}
+}
@@ -0,0 +1,18 @@
+// Package image provides the image subcommand group for cococtl.
+package image
+
+import "github.com/spf13/cobra"
+
+// ImageCmd is the root command for container image operations.
+var ImageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "Prepare container images for Confidential Containers",
+	Long: `Commands for preparing container images that only attested TEEs can run.
+
+Available subcommands:
+  encrypt  Encrypt an OCI image layout with a key held in KBS`,
+}
+
+func init() {
+	ImageCmd.AddCommand(encryptCmd)
+}
@@ -0,0 +1,259 @@
+package imagepolicy
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/cmd/kbs"
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/imagepolicy"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+)
+
+// policyResourceType is the KBS resource type under which image policies are stored.
+const policyResourceType = "security-policy"
+
+var createCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Build an image signature policy and upload it with its keys to KBS",
+	Long: `Build a containers-policy.json that requires images from the given registries
+or repositories to be signed, upload the policy and the public keys to KBS, and
+set container_policy_uri in the CoCo config so that 'kubectl coco apply' writes
+image_security_policy_uri into the generated cdh.toml.
+
+Keys are detected automatically: PEM public keys are treated as cosign/sigstore
+keys, PGP public keys (armored or binary) as GPG keys. They are stored at
+kbs:///<repository>/cosign-public-key/<scope> or kbs:///<repository>/gpg-public-key/<scope>,
+and the policy at kbs:///<repository>/security-policy/<name>. The key URIs are
+recorded as container_policy_keys so that 'apply --bind-resource-policy' also
+releases the keys to the workload.
+
+Images matching no scope are rejected unless --default-policy accept is given.
+
+Examples:
+  kubectl coco image-policy create --require-signature quay.io/myorg=cosign.pub
+  kubectl coco image-policy create --require-signature quay.io/myorg=cosign.pub \
+    --require-signature registry.example.com/team=team.gpg --allow-unsigned docker.io/library/busybox
+  kubectl coco image-policy create --require-signature ghcr.io/me=cosign.pub --skip-upload -o policy.json`,
+	Args: cobra.NoArgs,
+	RunE: runCreate,
+}
+
+var (
+	createRequireSignature []string
+	createAllowUnsigned    []string
+	createDefaultPolicy    string
+	createRepository       string
+	createName             string
+	createOutput           string
+	createSkipUpload       bool
+	createConfigPath       string
+	createConn             kbs.Connection
+)
+
+func init() {
+	createCmd.Flags().StringArrayVar(&createRequireSignature, "require-signature", nil, "Require signatures for images under a scope, as 'registry[/repository]=key-file' (repeatable)")
+	createCmd.Flags().StringArrayVar(&createAllowUnsigned, "allow-unsigned", nil, "Accept unsigned images under a scope, as 'registry[/repository]' (repeatable)")
+	createCmd.Flags().StringVar(&createDefaultPolicy, "default-policy", "reject", "Policy for images matching no scope: reject or accept")
+	createCmd.Flags().StringVar(&createRepository, "repository", "default", "KBS repository for the policy and keys")
+	createCmd.Flags().StringVar(&createName, "name", "default", "Name (KBS tag) of the policy resource")
+	createCmd.Flags().StringVarP(&createOutput, "output", "o", "", "Also write the policy to this file")
+	createCmd.Flags().BoolVar(&createSkipUpload, "skip-upload", false, "Do not upload to KBS; print the commands to do so (requires --output)")
+	createCmd.Flags().StringVar(&createConfigPath, "config", "", "Path to CoCo config file to update (default: ~/.kube/coco-config.toml)")
+	kbs.AddConnectionFlags(createCmd, &createConn)
+	_ = createCmd.MarkFlagRequired("require-signature")
+}
+
+// imagePolicyBundle is a generated policy together with the KBS resources it references.
+type imagePolicyBundle struct {
+	policyURI kbsuri.ResourceURI
+	policy    []byte
+	// keys maps KBS resource paths to key file contents.
+	keys map[string][]byte
+	// keyFiles maps KBS resource paths to the local key files.
+	keyFiles map[string]string
+	scopes   []string
+}
+
+// buildImagePolicy reads the keys named in the signature specs and builds the
+// policy referencing them by KBS URI.
+func buildImagePolicy(specs, unsigned []string, acceptByDefault bool, repository, name string) (*imagePolicyBundle, error) {
+	policyURI, err := kbsuri.New(repository, policyResourceType, name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy location: %w", err)
+	}
+
+	bundle := &imagePolicyBundle{
+		policyURI: policyURI,
+		keys:      make(map[string][]byte),
+		keyFiles:  make(map[string]string),
+	}
+	opts := imagepolicy.Options{
+		AcceptUnsignedByDefault: acceptByDefault,
+		Unsigned:                unsigned,
+	}
+	for _, spec := range specs {
+		scope, keyFile, err := imagepolicy.ParseSignatureSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		// #nosec G304 -- path provided by the user via flag
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key for %s: %w", scope, err)
+		}
+		keyType, err := imagepolicy.DetectKeyType(data)
+		if err != nil {
+			return nil, fmt.Errorf("key %s for %s: %w", keyFile, scope, err)
+		}
+		keyURI, err := kbsuri.New(repository, imagepolicy.KeyResourceType(keyType), imagepolicy.KeyResourceTag(scope))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key location for %s: %w", scope, err)
+		}
+		if _, exists := bundle.keys[keyURI.Path()]; exists {
+			return nil, fmt.Errorf("scopes map to the same key resource %s; use distinct scopes", keyURI)
+		}
+		bundle.keys[keyURI.Path()] = data
+		bundle.keyFiles[keyURI.Path()] = keyFile
+		opts.Signed = append(opts.Signed, imagepolicy.SignatureRule{
+			Scope:   scope,
+			KeyType: keyType,
+			KeyURI:  keyURI.String(),
+		})
+	}
+
+	p, err := imagepolicy.Build(opts)
+	if err != nil {
+		return nil, err
+	}
+	bundle.policy, err = p.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	bundle.scopes = p.Scopes()
+	return bundle, nil
+}
+
+// setContainerPolicy records the policy URI and the URIs of the keys it
+// references in the CoCo config. It returns false when the config file does
+// not exist.
+func setContainerPolicy(configPath, uri string, keyURIs []string) (bool, error) {
+	if configPath == "" {
+		var err error
+		configPath, err = config.GetConfigPath()
+		if err != nil {
+			return false, fmt.Errorf("failed to determine config path: %w", err)
+		}
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to load config from %s: %w", configPath, err)
+	}
+	cfg.ContainerPolicyURI = uri
+	cfg.ContainerPolicyKeys = keyURIs
+	if err := cfg.Save(configPath); err != nil {
+		return false, fmt.Errorf("failed to save config to %q: %w", configPath, err)
+	}
+	return true, nil
+}
+
+func runCreate(cmd *cobra.Command, _ []string) error {
+	var acceptByDefault bool
+	switch createDefaultPolicy {
+	case "reject":
+	case "accept":
+		acceptByDefault = true
+	default:
+		return fmt.Errorf("--default-policy must be reject or accept, got %q", createDefaultPolicy)
+	}
+	if createSkipUpload && createOutput == "" {
+		return fmt.Errorf("--skip-upload requires --output")
+	}
+
+	bundle, err := buildImagePolicy(createRequireSignature, createAllowUnsigned, acceptByDefault, createRepository, createName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Image policy:")
+	fmt.Printf("  - Default: %s unmatched images\n", createDefaultPolicy)
+	for _, scope := range bundle.scopes {
+		fmt.Printf("  - %s\n", scope)
+	}
+
+	if createOutput != "" {
+		if err := os.WriteFile(createOutput, bundle.policy, 0600); err != nil {
+			return fmt.Errorf("failed to write policy file: %w", err)
+		}
+		fmt.Printf("  ✓ Policy written to %s\n", createOutput)
+	}
+
+	keyPaths := make([]string, 0, len(bundle.keys))
+	for path := range bundle.keys {
+		keyPaths = append(keyPaths, path)
+	}
+	sort.Strings(keyPaths)
+	keyURIs := make([]string, 0, len(keyPaths))
+	for _, path := range keyPaths {
+		keyURIs = append(keyURIs, kbsuri.Scheme+":///"+path)
+	}
+
+	if createSkipUpload {
+		fmt.Println("\nKBS upload skipped (--skip-upload). Upload the keys and policy with:")
+		for _, path := range keyPaths {
+			fmt.Printf("  kubectl coco kbs populate --path %s --resource-file %s\n", path, bundle.keyFiles[path])
+		}
+		fmt.Printf("  kubectl coco kbs populate --path %s --resource-file %s\n", bundle.policyURI.Path(), createOutput)
+	} else {
+		ctx := cmd.Context()
+		kbsClient, stopForward, err := kbs.Connect(ctx, &createConn)
+		if err != nil {
+			return err
+		}
+		defer stopForward()
+
+		// Upload the keys first so the policy never references a missing key.
+		for _, path := range keyPaths {
+			if err := kbsClient.SetResource(ctx, path, bundle.keys[path]); err != nil {
+				return fmt.Errorf("failed to upload key to %s: %w", path, err)
+			}
+			fmt.Printf("  ✓ Uploaded key to kbs:///%s\n", path)
+		}
+		if err := kbsClient.SetResource(ctx, bundle.policyURI.Path(), bundle.policy); err != nil {
+			return fmt.Errorf("failed to upload policy to %s: %w", bundle.policyURI, err)
+		}
+		fmt.Printf("  ✓ Uploaded policy to %s\n", bundle.policyURI)
+	}
+
+	updated, err := setContainerPolicy(createConfigPath, bundle.policyURI.String(), keyURIs)
+	if err != nil {
+		return err
+	}
+	if updated {
+		fmt.Printf("  ✓ Set container_policy_uri = %s in config\n", bundle.policyURI)
+		fmt.Println("\nRe-run 'kubectl coco apply' to add image_security_policy_uri to the initdata of your workloads.")
+	} else {
+		fmt.Println("  ⚠ Warning: CoCo config not found; run 'kubectl coco init' and set:")
+		fmt.Printf("      container_policy_uri = %q\n", bundle.policyURI.String())
+		fmt.Printf("      container_policy_keys = [%s]\n", quoteList(keyURIs))
+	}
+	return nil
+}
+
+// quoteList formats values as a comma-separated list of TOML strings.
+func quoteList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = fmt.Sprintf("%q", v)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,114 @@
+package imagepolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+)
+
+const testCosignKey = "-----BEGIN PUBLIC KEY-----\nMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE\n-----END PUBLIC KEY-----\n"
+
+func TestBuildImagePolicy(t *testing.T) {
+	dir := t.TempDir()
+	cosignKey := filepath.Join(dir, "cosign.pub")
+	gpgKey := filepath.Join(dir, "team.gpg")
+	if err := os.WriteFile(cosignKey, []byte(testCosignKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(gpgKey, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\nmQIN\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := buildImagePolicy(
+		[]string{"quay.io/myorg=" + cosignKey, "registry.example.com/team=" + gpgKey},
+		[]string{"docker.io/library/busybox"},
+		false, "default", "default")
+	if err != nil {
+		t.Fatalf("buildImagePolicy() error = %v", err)
+	}
+
+	if got := bundle.policyURI.String(); got != "kbs:///default/security-policy/default" {
+		t.Errorf("policy URI = %q", got)
+	}
+	if _, ok := bundle.keys["default/cosign-public-key/quay.io_myorg"]; !ok {
+		t.Errorf("cosign key not staged, keys = %v", bundle.keyFiles)
+	}
+	if got := bundle.keyFiles["default/gpg-public-key/registry.example.com_team"]; got != gpgKey {
+		t.Errorf("gpg key file = %q, want %q", got, gpgKey)
+	}
+	for _, want := range []string{
+		`"keyPath": "kbs:///default/cosign-public-key/quay.io_myorg"`,
+		`"keyPath": "kbs:///default/gpg-public-key/registry.example.com_team"`,
+		`"docker.io/library/busybox"`,
+	} {
+		if !strings.Contains(string(bundle.policy), want) {
+			t.Errorf("policy missing %q:\n%s", want, bundle.policy)
+		}
+	}
+	if len(bundle.scopes) != 3 {
+		t.Errorf("scopes = %v, want 3", bundle.scopes)
+	}
+}
+
+func TestBuildImagePolicy_Errors(t *testing.T) {
+	dir := t.TempDir()
+	badKey := filepath.Join(dir, "bad.pub")
+	if err := os.WriteFile(badKey, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		specs []string
+		want  string
+	}{
+		{"missing key file", []string{"quay.io=" + filepath.Join(dir, "missing.pub")}, "failed to read key"},
+		{"unrecognized key", []string{"quay.io=" + badKey}, "unrecognized key format"},
+		{"malformed spec", []string{"quay.io"}, "invalid signature requirement"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := buildImagePolicy(tt.specs, nil, false, "default", "default")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("buildImagePolicy() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetContainerPolicy(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "coco-config.toml")
+
+	keys := []string{"kbs:///default/cosign-public-key/quay.io_myorg"}
+	updated, err := setContainerPolicy(configPath, "kbs:///default/security-policy/default", keys)
+	if err != nil || updated {
+		t.Fatalf("setContainerPolicy() on missing config = (%v, %v), want (false, nil)", updated, err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.TrusteeServer = "http://kbs.example.com:8080"
+	if err := cfg.Save(configPath); err != nil {
+		t.Fatal(err)
+	}
+	updated, err = setContainerPolicy(configPath, "kbs:///default/security-policy/default", keys)
+	if err != nil || !updated {
+		t.Fatalf("setContainerPolicy() = (%v, %v), want (true, nil)", updated, err)
+	}
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ContainerPolicyURI != "kbs:///default/security-policy/default" {
+		t.Errorf("ContainerPolicyURI = %q", loaded.ContainerPolicyURI)
+	}
+	if len(loaded.ContainerPolicyKeys) != 1 || loaded.ContainerPolicyKeys[0] != keys[0] {
+		t.Errorf("ContainerPolicyKeys = %q", loaded.ContainerPolicyKeys)
+	}
+	if loaded.TrusteeServer != "http://kbs.example.com:8080" {
+		t.Errorf("TrusteeServer = %q, want it preserved", loaded.TrusteeServer)
+	}
+}
@@ -0,0 +1,19 @@
+// Package imagepolicy provides the image-policy subcommand group for cococtl.
+package imagepolicy
+
+import "github.com/spf13/cobra"
+
+// ImagePolicyCmd is the root command for container image policy operations.
+var ImagePolicyCmd = &cobra.Command{
+	Use:   "image-policy",
+	Short: "Manage the container image policy enforced in the guest",
+	Long: `Commands for managing the containers-policy.json document that the Confidential
+Data Hub enforces when pulling images inside the TEE.
+
+Available subcommands:
+  create  Build an image signature policy and upload it with its keys to KBS`,
+}
+
+func init() {
+	ImagePolicyCmd.AddCommand(createCmd)
+}
@@ -12,9 +12,11 @@ import (
 	"github.com/confidential-devhub/cococtl/pkg/cluster"
 	"github.com/confidential-devhub/cococtl/pkg/config"
 	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
 	"github.com/confidential-devhub/cococtl/pkg/trustee"
 	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
 )
 
 // stdinReader is the shared reader for all interactive prompts.
@@ -261,7 +263,9 @@ func handleTrusteeSetup(cmd *cobra.Command, cfg *config.CocoConfig, interactive,
 
 	if deployed {
 		fmt.Printf("Trustee already deployed in namespace '%s'\n", namespace)
-		cfg.TrusteeServer = trustee.GetServiceURL(namespace, "trustee-kbs")
+		if err := setDeployedTrusteeServer(ctx, cfg, client.Clientset, namespace); err != nil {
+			return false, "", err
+		}
 		return true, namespace, nil
 	}
 
@@ -293,13 +297,36 @@ func handleTrusteeSetup(cmd *cobra.Command, cfg *config.CocoConfig, interactive,
 
 	// Deploy wrote the resolved path back to trusteeCfg.AuthDir; persist it.
 	cfg.KBSAuthDir = trusteeCfg.AuthDir
-	cfg.TrusteeServer = trustee.GetServiceURL(namespace, "trustee-kbs")
+	if err := setDeployedTrusteeServer(ctx, cfg, client.Clientset, namespace); err != nil {
+		return false, "", err
+	}
 	fmt.Printf("Trustee deployed successfully\n")
 	fmt.Printf("Trustee URL: %s\n", cfg.TrusteeServer)
 
 	return true, namespace, nil
 }
 
+// setDeployedTrusteeServer points trustee_server at the KBS deployed in
+// namespace, over HTTPS when it serves TLS ('kbs start --tls'), and sets
+// trustee_ca_cert to the CA that issued its certificate.
+func setDeployedTrusteeServer(ctx context.Context, cfg *config.CocoConfig, clientset kubernetes.Interface, namespace string) error {
+	servingTLS, err := trustee.GetServingTLS(ctx, clientset, namespace)
+	if err != nil {
+		return err
+	}
+	cfg.TrusteeServer = trustee.GetServiceURL(namespace, "trustee-kbs", servingTLS != nil)
+	if servingTLS == nil || len(servingTLS.CACertPEM) == 0 {
+		return nil
+	}
+	caPath, err := trustee.SaveCACert(cfg.KBSAuthDir, servingTLS.CACertPEM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return nil
+	}
+	cfg.TrusteeCACert = caPath
+	return nil
+}
+
 // handleSidecarCertSetup generates and uploads sidecar certificates.
 // It creates a Client CA, generates a client certificate for the developer,
 // uploads the Client CA to Trustee KBS, and saves both the CA and client certificate locally.
@@ -335,7 +362,7 @@ func handleSidecarCertSetup(ctx context.Context, cfg *config.CocoConfig, trustee
 		// the same client CA location.
 		const kbsResourceNamespace = "default"
 		fmt.Printf("  - Uploading Client CA to Trustee KBS (Trustee namespace: %s, resource path: default)...\n", trusteeNamespace)
-		clientCAPath = kbsResourceNamespace + "/sidecar-tls/client-ca"
+		clientCAPath = kbsuri.ResourceURI{Repository: kbsResourceNamespace, Type: "sidecar-tls", Tag: "client-ca"}.Path()
 		kbsClient, stopForward, err := trustee.NewClientWithPortForward(ctx, sidecarK8sClient.Config, sidecarK8sClient.Clientset, trusteeNamespace, cfg.KBSAuthDir)
 		if err != nil {
 			return fmt.Errorf("failed to connect to KBS: %w", err)
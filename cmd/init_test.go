@@ -8,7 +8,13 @@ import (
 	"strings"
 	"testing"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
 	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
 )
 
 func withStdin(t *testing.T, input string, fn func()) {
@@ -252,3 +258,46 @@ func TestInitCommand_CertDirWithEnableSidecar(t *testing.T) {
 		})
 	}
 }
+
+func TestSetDeployedTrusteeServer(t *testing.T) {
+	ctx := context.Background()
+	authDir := t.TempDir()
+	clientset := fake.NewSimpleClientset()
+
+	cfg := &config.CocoConfig{KBSAuthDir: authDir}
+	if err := setDeployedTrusteeServer(ctx, cfg, clientset, "coco"); err != nil {
+		t.Fatalf("setDeployedTrusteeServer() error = %v", err)
+	}
+	if cfg.TrusteeServer != "http://trustee-kbs.coco.svc.cluster.local:8080" || cfg.TrusteeCACert != "" {
+		t.Errorf("plain HTTP KBS: trustee_server = %q, trustee_ca_cert = %q", cfg.TrusteeServer, cfg.TrusteeCACert)
+	}
+
+	ca, err := certs.GenerateCA("test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, err := trustee.GenerateTLS(ca, "coco", "trustee-kbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = clientset.CoreV1().Secrets("coco").Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "kbs-tls", Namespace: "coco"},
+		Data:       map[string][]byte{"tls.crt": tlsCfg.CertPEM, "tls.key": tlsCfg.KeyPEM, "ca.crt": tlsCfg.CACertPEM},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := setDeployedTrusteeServer(ctx, cfg, clientset, "coco"); err != nil {
+		t.Fatalf("setDeployedTrusteeServer() error = %v", err)
+	}
+	if cfg.TrusteeServer != "https://trustee-kbs.coco.svc.cluster.local:8080" {
+		t.Errorf("trustee_server = %q, want the https:// Service URL", cfg.TrusteeServer)
+	}
+	if cfg.TrusteeCACert != filepath.Join(authDir, "tls", "ca-cert.pem") {
+		t.Errorf("trustee_ca_cert = %q", cfg.TrusteeCACert)
+	}
+	if data, err := os.ReadFile(cfg.TrusteeCACert); err != nil || string(data) != string(ca.CertPEM) {
+		t.Errorf("saved CA does not match the issuing CA (err %v)", err)
+	}
+}
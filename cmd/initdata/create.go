@@ -2,9 +2,12 @@ package initdata
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/confidential-devhub/cococtl/pkg/config"
 	pkginitdata "github.com/confidential-devhub/cococtl/pkg/initdata"
 	"github.com/spf13/cobra"
 )
@@ -14,10 +17,25 @@ var createCmd = &cobra.Command{
 	Short: "Generate initdata TOML from CoCo config and save to disk",
 	Long: `Generate initdata TOML from coco-config.toml and save it to disk.
 
+Besides aa.toml, cdh.toml and policy.rego, the initdata embeds the files listed
+under [initdata.extra_files] in the config and those given with --add-file,
+which take precedence. Fields under [initdata.aa_overrides] and
+[initdata.cdh_overrides] are merged into the generated aa.toml and cdh.toml.
+
+The initdata digest algorithm is taken from --initdata-algorithm, then
+[initdata] algorithm in the config, and otherwise defaults to sha384 for TDX and
+SNP runtime classes and sha256 for others. A warning is printed when the encoded
+annotation approaches the Kubernetes annotation size limit or, for peer pods,
+the cloud user-data limit.
+
 Examples:
   kubectl coco initdata create
   kubectl coco initdata create --cacert /path/to/ca.crt
-  kubectl coco initdata create --capath /etc/ssl/certs --output /tmp/initdata.toml`,
+  kubectl coco initdata create --capath /etc/ssl/certs --output /tmp/initdata.toml
+  kubectl coco initdata create --policy-preset strict
+  kubectl coco initdata create --add-file app.conf=./app.conf
+  kubectl coco initdata create --initdata-algorithm sha512
+  kubectl coco initdata create --list-policy-presets`,
 	RunE: runCreate,
 }
 
@@ -26,6 +44,10 @@ var (
 	createCACert     string
 	createCAPath     string
 	createOutput     string
+	createPreset     string
+	createListPreset bool
+	createAddFiles   []string
+	createAlgorithm  string
 )
 
 func init() {
@@ -33,10 +55,78 @@ func init() {
 	createCmd.Flags().StringVar(&createCACert, "cacert", "", "Path to CA cert PEM file")
 	createCmd.Flags().StringVar(&createCAPath, "capath", "", "Path to directory of CA cert PEM files")
 	createCmd.Flags().StringVar(&createOutput, "output", "", "Output file for raw TOML (default: ~/.kube/coco-initdata.toml)")
+	createCmd.Flags().StringVar(&createPreset, "policy-preset", "", "Built-in Kata agent policy to embed instead of kata_agent_policy (see --list-policy-presets)")
+	createCmd.Flags().BoolVar(&createListPreset, "list-policy-presets", false, "List the built-in Kata agent policy presets and exit")
+	createCmd.Flags().StringArrayVar(&createAddFiles, "add-file", nil, "Embed an extra file in initdata as name=path (repeatable)")
+	createCmd.Flags().StringVar(&createAlgorithm, "initdata-algorithm", "", "Initdata digest algorithm: sha256, sha384 or sha512 (default from config, else by runtime class)")
 	createCmd.MarkFlagsMutuallyExclusive("cacert", "capath")
+	_ = createCmd.RegisterFlagCompletionFunc("policy-preset", CompletePolicyPresets)
+	_ = createCmd.RegisterFlagCompletionFunc("initdata-algorithm", CompleteAlgorithms)
+}
+
+// CompleteAlgorithms completes --initdata-algorithm with the supported digest algorithms.
+func CompleteAlgorithms(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	return pkginitdata.ValidAlgorithms, cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompletePolicyPresets completes --policy-preset with the preset names and descriptions.
+func CompletePolicyPresets(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+	names := pkginitdata.ListPolicyPresets()
+	completions := make([]string, 0, len(names))
+	for _, name := range names {
+		completions = append(completions, name+"\t"+pkginitdata.GetPolicyPreset(name).Description)
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// listPolicyPresets prints the built-in agent policy presets with their descriptions.
+func listPolicyPresets(w io.Writer) {
+	fmt.Fprintln(w, "Available Kata agent policy presets:")
+	for _, name := range pkginitdata.ListPolicyPresets() {
+		fmt.Fprintf(w, "  %-37s %s\n", name, pkginitdata.GetPolicyPreset(name).Description)
+	}
+}
+
+// addExtraFiles adds --add-file name=path entries to the extra initdata files
+// of cfg, replacing config entries with the same name. Their paths are made
+// absolute, as they are relative to the working directory rather than to the
+// config file.
+func addExtraFiles(cfg *config.CocoConfig, specs []string) error {
+	for _, spec := range specs {
+		name, path, ok := strings.Cut(spec, "=")
+		if !ok || path == "" {
+			return fmt.Errorf("invalid --add-file %q: must be name=path", spec)
+		}
+		if err := pkginitdata.ValidateExtraFileName(name); err != nil {
+			return fmt.Errorf("invalid --add-file %q: %w", spec, err)
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid --add-file %q: %w", spec, err)
+		}
+		if cfg.Initdata.ExtraFiles == nil {
+			cfg.Initdata.ExtraFiles = make(map[string]string)
+		}
+		cfg.Initdata.ExtraFiles[name] = absPath
+	}
+	return nil
 }
 
 func runCreate(_ *cobra.Command, _ []string) error {
+	if createListPreset {
+		listPolicyPresets(os.Stdout)
+		return nil
+	}
+
+	var policy string
+	if createPreset != "" {
+		var err error
+		policy, err = pkginitdata.LoadPolicyPreset(createPreset)
+		if err != nil {
+			return err
+		}
+	}
+
 	if createCACert != "" && createCAPath != "" {
 		return fmt.Errorf("--cacert and --capath are mutually exclusive")
 	}
@@ -45,6 +135,13 @@ func runCreate(_ *cobra.Command, _ []string) error {
 	if err != nil {
 		return err
 	}
+	if err := addExtraFiles(cfg, createAddFiles); err != nil {
+		return err
+	}
+	cfg.Initdata.Algorithm, err = pkginitdata.ResolveAlgorithm(createAlgorithm, cfg.Initdata.Algorithm, cfg.RuntimeClass)
+	if err != nil {
+		return err
+	}
 
 	var certPEM string
 	switch {
@@ -92,11 +189,30 @@ func runCreate(_ *cobra.Command, _ []string) error {
 		}
 		certPEM = certsToPEM(certs)
 	}
+	for _, path := range cfg.Attestation.CACerts {
+		certs, err := loadCerts(path)
+		if err != nil {
+			return fmt.Errorf("attestation.ca_certs: %w", err)
+		}
+		if len(certs) == 0 {
+			return fmt.Errorf("attestation.ca_certs %s: no certificates found", path)
+		}
+		if err := validateCACerts(certs); err != nil {
+			return fmt.Errorf("attestation.ca_certs in config: %w", err)
+		}
+	}
 
-	raw, err := pkginitdata.GenerateRaw(cfg, certPEM, nil)
+	raw, err := pkginitdata.GenerateRawWithPolicy(cfg, certPEM, nil, policy)
 	if err != nil {
 		return fmt.Errorf("failed to generate initdata: %w", err)
 	}
+	encoded, err := pkginitdata.Encode(raw)
+	if err != nil {
+		return fmt.Errorf("failed to encode initdata: %w", err)
+	}
+	for _, warning := range pkginitdata.CheckAnnotationSize(encoded, cfg.RuntimeClass) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
 
 	outputPath := createOutput
 	if outputPath == "" {
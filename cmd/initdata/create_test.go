@@ -199,3 +199,107 @@ func TestRunCreate_OutputFileMode(t *testing.T) {
 		t.Errorf("file mode = %o, want 0600", info.Mode().Perm())
 	}
 }
+
+func TestRunCreate_PolicyPreset(t *testing.T) {
+	dir := t.TempDir()
+	createConfigPath = makeTestConfigFile(t, dir)
+	createOutput = filepath.Join(dir, "initdata.toml")
+	createPreset = "strict"
+	defer func() { createConfigPath = ""; createOutput = ""; createPreset = "" }()
+
+	if err := runCreate(nil, nil); err != nil {
+		t.Fatalf("runCreate() error: %v", err)
+	}
+	data, err := os.ReadFile(createOutput)
+	if err != nil {
+		t.Fatalf("output file not written: %v", err)
+	}
+	var id pkginitdata.InitData
+	if err := toml.Unmarshal(data, &id); err != nil {
+		t.Fatalf("output is not valid TOML: %v", err)
+	}
+	if id.Data["policy.rego"] != pkginitdata.GetPolicyPreset("strict").Policy {
+		t.Error("policy.rego does not contain the strict preset")
+	}
+}
+
+func TestRunCreate_UnknownPolicyPreset(t *testing.T) {
+	createPreset = "does-not-exist"
+	defer func() { createPreset = "" }()
+
+	err := runCreate(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown policy preset") {
+		t.Errorf("expected unknown preset error, got: %v", err)
+	}
+}
+
+func TestRunCreate_AddFile(t *testing.T) {
+	// Config paths are relative to the config file, --add-file paths to
+	// the working directory.
+	dir := t.TempDir()
+	workDir := t.TempDir()
+	t.Chdir(workDir)
+	configFile := makeTestConfigFile(t, dir)
+	flagged := filepath.Join(workDir, "flagged.conf")
+	_ = os.WriteFile(filepath.Join(dir, "configured.conf"), []byte("from = config\n"), 0600)
+	_ = os.WriteFile(flagged, []byte("from = flag\n"), 0600)
+	cfgData, _ := os.ReadFile(configFile)
+	cfgData = append(cfgData, []byte("\n[initdata.extra_files]\n\"app.conf\" = \"configured.conf\"\n\"other.conf\" = \"configured.conf\"\n")...)
+	_ = os.WriteFile(configFile, cfgData, 0600)
+
+	createConfigPath = configFile
+	createOutput = filepath.Join(dir, "initdata.toml")
+	createAddFiles = []string{"app.conf=flagged.conf"}
+	defer func() { createConfigPath = ""; createOutput = ""; createAddFiles = nil }()
+
+	if err := runCreate(nil, nil); err != nil {
+		t.Fatalf("runCreate() error: %v", err)
+	}
+	data, _ := os.ReadFile(createOutput)
+	var id pkginitdata.InitData
+	if err := toml.Unmarshal(data, &id); err != nil {
+		t.Fatalf("output is not valid TOML: %v", err)
+	}
+	if id.Data["app.conf"] != "from = flag\n" || id.Data["other.conf"] != "from = config\n" {
+		t.Errorf("extra files = app.conf %q, other.conf %q", id.Data["app.conf"], id.Data["other.conf"])
+	}
+
+	for _, spec := range []string{"app.conf", "policy.rego=" + flagged} {
+		createAddFiles = []string{spec}
+		if err := runCreate(nil, nil); err == nil || !strings.Contains(err.Error(), "invalid --add-file") {
+			t.Errorf("runCreate() with --add-file %q error = %v", spec, err)
+		}
+	}
+}
+
+func TestRunCreate_InitdataAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	configFile := makeTestConfigFile(t, dir)
+	cfgData, _ := os.ReadFile(configFile)
+	cfgData = []byte(strings.Replace(string(cfgData), "kata-cc", "kata-qemu-tdx", 1))
+	_ = os.WriteFile(configFile, cfgData, 0600)
+
+	createConfigPath = configFile
+	createOutput = filepath.Join(dir, "initdata.toml")
+	defer func() { createConfigPath = ""; createOutput = ""; createAlgorithm = "" }()
+
+	for _, tt := range []struct{ flag, want string }{{"", "sha384"}, {"sha512", "sha512"}} {
+		createAlgorithm = tt.flag
+		if err := runCreate(nil, nil); err != nil {
+			t.Fatalf("runCreate() with --initdata-algorithm %q error: %v", tt.flag, err)
+		}
+		data, _ := os.ReadFile(createOutput)
+		var id pkginitdata.InitData
+		if err := toml.Unmarshal(data, &id); err != nil {
+			t.Fatalf("output is not valid TOML: %v", err)
+		}
+		if id.Algorithm != tt.want {
+			t.Errorf("--initdata-algorithm %q: algorithm = %q, want %q", tt.flag, id.Algorithm, tt.want)
+		}
+	}
+
+	createAlgorithm = "md5"
+	if err := runCreate(nil, nil); err == nil || !strings.Contains(err.Error(), "unsupported initdata algorithm") {
+		t.Errorf("runCreate() with --initdata-algorithm md5 error = %v", err)
+	}
+}
@@ -0,0 +1,134 @@
+package initdata
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	pkginitdata "github.com/confidential-devhub/cococtl/pkg/initdata"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <a> <b>",
+	Short: "Compare two initdata and show per-file differences",
+	Long: `Compare two initdata and show a unified diff of each embedded file
+(aa.toml, cdh.toml, policy.rego, ...) together with the digest change.
+
+Each argument may be:
+  - a plaintext initdata TOML file
+  - a file holding the base64+gzip encoded blob
+  - a manifest whose resource carries the
+    io.katacontainers.config.hypervisor.cc_init_data annotation
+    (read from the pod template for Deployments, Jobs, etc.)
+  - "-" to read TOML or an encoded blob from stdin
+
+The digest is computed with the algorithm declared in each initdata; a digest
+change means the TEE measurement changes and reference values registered for
+the old initdata no longer match.
+
+Examples:
+  kubectl coco initdata diff app-coco.yaml app-v2-coco.yaml
+  kubectl coco initdata diff ~/.kube/coco-initdata.toml app-coco.yaml
+  kubectl get pod myapp -o jsonpath='{.metadata.annotations.io\.katacontainers\.config\.hypervisor\.cc_init_data}' | kubectl coco initdata diff app-coco.yaml -`,
+	Args: cobra.ExactArgs(2),
+	RunE: runDiff,
+}
+
+func runDiff(_ *cobra.Command, args []string) error {
+	if args[0] == "-" && args[1] == "-" {
+		return fmt.Errorf("only one argument can be read from stdin")
+	}
+	rawA, err := loadInitdataArg(args[0], os.Stdin)
+	if err != nil {
+		return err
+	}
+	rawB, err := loadInitdataArg(args[1], os.Stdin)
+	if err != nil {
+		return err
+	}
+	return writeInitdataDiff(os.Stdout, args[0], args[1], rawA, rawB)
+}
+
+// writeInitdataDiff prints the digest change and a unified diff of every data
+// file that differs between rawA and rawB.
+func writeInitdataDiff(w io.Writer, nameA, nameB string, rawA, rawB []byte) error {
+	var a, b pkginitdata.InitData
+	if err := toml.Unmarshal(rawA, &a); err != nil {
+		return fmt.Errorf("failed to parse initdata from %s: %w", nameA, err)
+	}
+	if err := toml.Unmarshal(rawB, &b); err != nil {
+		return fmt.Errorf("failed to parse initdata from %s: %w", nameB, err)
+	}
+
+	digestA, err := formatDigest(rawA, a.Algorithm)
+	if err != nil {
+		return fmt.Errorf("%s: %w", nameA, err)
+	}
+	digestB, err := formatDigest(rawB, b.Algorithm)
+	if err != nil {
+		return fmt.Errorf("%s: %w", nameB, err)
+	}
+
+	fmt.Fprintf(w, "a: %s\n", nameA)
+	fmt.Fprintf(w, "b: %s\n\n", nameB)
+	if digestA == digestB {
+		fmt.Fprintf(w, "Digest unchanged: %s\n", digestA)
+		fmt.Fprintln(w, "Initdata is identical.")
+		return nil
+	}
+	fmt.Fprintln(w, "Digest changed:")
+	fmt.Fprintf(w, "  - %s\n", digestA)
+	fmt.Fprintf(w, "  + %s\n", digestB)
+	if a.Version != b.Version {
+		fmt.Fprintf(w, "Version changed: %q → %q\n", a.Version, b.Version)
+	}
+	fmt.Fprintln(w)
+
+	names := make(map[string]struct{}, len(a.Data)+len(b.Data))
+	for name := range a.Data {
+		names[name] = struct{}{}
+	}
+	for name := range b.Data {
+		names[name] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	changed := 0
+	for _, name := range sorted {
+		contentA, inA := a.Data[name]
+		contentB, inB := b.Data[name]
+		labelA, labelB := "a/"+name, "b/"+name
+		switch {
+		case !inA:
+			labelA = "/dev/null"
+		case !inB:
+			labelB = "/dev/null"
+		case contentA == contentB:
+			fmt.Fprintf(w, "%s: unchanged\n", name)
+			continue
+		}
+		changed++
+		fmt.Fprint(w, pkginitdata.UnifiedDiff(labelA, labelB, contentA, contentB, 3))
+	}
+	if changed == 0 {
+		fmt.Fprintln(w, "\nAll files are identical; the digest differs due to formatting, version or algorithm.")
+	}
+	return nil
+}
+
+// formatDigest returns "<algorithm>:<hex digest>" of raw initdata.
+func formatDigest(raw []byte, algorithm string) (string, error) {
+	digest, err := pkginitdata.Digest(raw, algorithm)
+	if err != nil {
+		return "", err
+	}
+	return algorithm + ":" + hex.EncodeToString(digest), nil
+}
@@ -0,0 +1,127 @@
+package initdata
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeManifestWithInitdata writes a Deployment whose pod template carries the
+// initdata from the TOML fixture at fixture.
+func writeManifestWithInitdata(t *testing.T, fixture string) string {
+	t.Helper()
+	manifest := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: myapp
+spec:
+  template:
+    metadata:
+      annotations:
+        io.katacontainers.config.hypervisor.cc_init_data: ` + encodeBlobFromFile(t, fixture) + `
+    spec:
+      containers:
+        - name: app
+          image: nginx
+`
+	path := filepath.Join(t.TempDir(), "app-coco.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadInitdataArg(t *testing.T) {
+	want, err := os.ReadFile("testdata/valid.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobPath := filepath.Join(t.TempDir(), "initdata.b64")
+	if err := os.WriteFile(blobPath, []byte(encodeBlobFromFile(t, "testdata/valid.toml")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, path := range map[string]string{
+		"toml":     "testdata/valid.toml",
+		"blob":     blobPath,
+		"manifest": writeManifestWithInitdata(t, "testdata/valid.toml"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			got, err := loadInitdataArg(path, nil)
+			if err != nil {
+				t.Fatalf("loadInitdataArg() error = %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("loadInitdataArg() = %q, want the fixture TOML", got)
+			}
+		})
+	}
+
+	got, err := loadInitdataArg("-", strings.NewReader(encodeBlobFromFile(t, "testdata/valid.toml")))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Errorf("loadInitdataArg(-) = (%q, %v)", got, err)
+	}
+}
+
+func TestLoadInitdataArg_ManifestWithoutAnnotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pod.yaml")
+	if err := os.WriteFile(path, []byte("apiVersion: v1\nkind: Pod\nmetadata:\n  name: p\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadInitdataArg(path, nil); err == nil || !strings.Contains(err.Error(), "cc_init_data") {
+		t.Errorf("loadInitdataArg() error = %v, want missing annotation", err)
+	}
+}
+
+func TestWriteInitdataDiff(t *testing.T) {
+	a, err := os.ReadFile("testdata/valid.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := bytes.Replace(a, []byte(`url = "http://kbs.example.svc:8080"`), []byte(`url = "http://kbs.other.svc:8080"`), 1)
+
+	var out bytes.Buffer
+	if err := writeInitdataDiff(&out, "old.toml", "new.toml", a, b); err != nil {
+		t.Fatalf("writeInitdataDiff() error = %v", err)
+	}
+	for _, want := range []string{
+		"Digest changed:",
+		"--- a/aa.toml\n+++ b/aa.toml\n",
+		`-url = "http://kbs.example.svc:8080"`,
+		`+url = "http://kbs.other.svc:8080"`,
+		"cdh.toml: unchanged",
+		"policy.rego: unchanged",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("diff output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := writeInitdataDiff(&out, "a", "b", a, a); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Initdata is identical.") {
+		t.Errorf("diff of identical initdata =\n%s", out.String())
+	}
+}
+
+func TestWriteInitdataDiff_AddedFile(t *testing.T) {
+	a, err := os.ReadFile("testdata/valid-no-policy.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile("testdata/valid.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := writeInitdataDiff(&out, "a", "b", a, b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "--- /dev/null\n+++ b/policy.rego\n") {
+		t.Errorf("diff output does not show policy.rego as added:\n%s", out.String())
+	}
+}
@@ -0,0 +1,95 @@
+package initdata
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	pkginitdata "github.com/confidential-devhub/cococtl/pkg/initdata"
+	"github.com/spf13/cobra"
+)
+
+var digestCmd = &cobra.Command{
+	Use:   "digest",
+	Short: "Compute the initdata digest and expected TEE measurement",
+	Long: `Compute the digest of an initdata and the value the TEE reports for it.
+
+Reads from --file (plaintext TOML) or stdin (base64+gzip encoded blob).
+
+The digest is computed over the plaintext TOML using the algorithm declared in
+the initdata (override with --algorithm). The runtime binds it into the launch
+measurement, zero-padded or truncated to the field size:
+
+  tdx   MRCONFIGID (48 bytes)
+  snp   HOSTDATA (32 bytes)
+  vtpm  PCR8 after extending the digest into the SHA-256 bank
+
+Without --tee all values are printed. With --tee only the hex value for that
+TEE is printed, ready to be registered as a reference value.
+
+Examples:
+  kubectl coco initdata digest --file ~/.kube/coco-initdata.toml
+  kubectl coco initdata dump | kubectl coco initdata digest --tee tdx
+  kubectl coco kbs reference-values add init_data $(kubectl coco initdata digest --file initdata.toml --tee snp)`,
+	RunE: runDigest,
+}
+
+var (
+	digestFile      string
+	digestAlgorithm string
+	digestTEE       string
+)
+
+func init() {
+	digestCmd.Flags().StringVar(&digestFile, "file", "", "Path to plaintext initdata TOML file (reads encoded blob from stdin if not set)")
+	digestCmd.Flags().StringVar(&digestAlgorithm, "algorithm", "", "Hash algorithm: sha256, sha384 or sha512 (default: algorithm declared in the initdata)")
+	digestCmd.Flags().StringVar(&digestTEE, "tee", "", "Print only the expected measurement for this TEE: tdx, snp or vtpm")
+}
+
+func runDigest(_ *cobra.Command, _ []string) error {
+	raw, err := loadInitdataTOML(digestFile, os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to load initdata: %w", err)
+	}
+	return writeDigest(os.Stdout, raw, digestAlgorithm, digestTEE)
+}
+
+// writeDigest prints the digest of raw and the derived TEE measurements to w.
+func writeDigest(w io.Writer, raw []byte, algorithm, tee string) error {
+	var digest []byte
+	var err error
+	if algorithm != "" {
+		digest, err = pkginitdata.Digest(raw, algorithm)
+	} else {
+		digest, algorithm, err = pkginitdata.DigestOf(raw)
+	}
+	if err != nil {
+		return err
+	}
+
+	if tee != "" {
+		measurement, err := pkginitdata.ExpectedMeasurement(digest, pkginitdata.TEE(tee))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, hex.EncodeToString(measurement))
+		return err
+	}
+
+	fmt.Fprintf(w, "algorithm: %s\n", algorithm)
+	fmt.Fprintf(w, "digest:    %s\n", hex.EncodeToString(digest))
+	fields := map[pkginitdata.TEE]string{
+		pkginitdata.TEETDX:  "MRCONFIGID",
+		pkginitdata.TEESNP:  "HOSTDATA",
+		pkginitdata.TEEVTPM: "PCR8",
+	}
+	for _, t := range pkginitdata.ValidTEEs {
+		measurement, err := pkginitdata.ExpectedMeasurement(digest, t)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%-18s %s\n", fmt.Sprintf("%s (%s):", t, fields[t]), hex.EncodeToString(measurement))
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package initdata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWriteDigest_AllTEEs(t *testing.T) {
+	raw, err := os.ReadFile("testdata/valid.toml")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDigest(&buf, raw, "sha256", ""); err != nil {
+		t.Fatalf("writeDigest() error = %v", err)
+	}
+
+	sum := sha256.Sum256(raw)
+	out := buf.String()
+	for _, want := range []string{"algorithm: sha256", hex.EncodeToString(sum[:]), "tdx (MRCONFIGID):", "snp (HOSTDATA):", "vtpm (PCR8):"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteDigest_SingleTEE(t *testing.T) {
+	raw, err := os.ReadFile("testdata/valid.toml")
+	if err != nil {
+		t.Fatalf("failed to read testdata: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := writeDigest(&buf, raw, "sha256", "snp"); err != nil {
+		t.Fatalf("writeDigest() error = %v", err)
+	}
+
+	sum := sha256.Sum256(raw)
+	if got := strings.TrimSpace(buf.String()); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("writeDigest(snp) = %q, want %q", got, hex.EncodeToString(sum[:]))
+	}
+}
+
+func TestWriteDigest_InvalidTEE(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeDigest(&buf, []byte("version = \"0.1.0\"\n"), "sha256", "sgx"); err == nil {
+		t.Error("writeDigest() expected error for unsupported TEE")
+	}
+}
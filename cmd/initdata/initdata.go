@@ -10,12 +10,16 @@ var InitdataCmd = &cobra.Command{
 
 Available subcommands:
   create    Generate initdata TOML from CoCo config and save to disk
+  diff      Compare two initdata and show per-file differences
+  digest    Compute the initdata digest and expected TEE measurement
   dump      Display initdata as base64+gzip blob or plaintext TOML
   validate  Validate initdata structure and embedded certificates`,
 }
 
 func init() {
 	InitdataCmd.AddCommand(createCmd)
+	InitdataCmd.AddCommand(diffCmd)
+	InitdataCmd.AddCommand(digestCmd)
 	InitdataCmd.AddCommand(dumpCmd)
 	InitdataCmd.AddCommand(validateCmd)
 }
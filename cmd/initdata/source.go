@@ -0,0 +1,93 @@
+package initdata
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	pkginitdata "github.com/confidential-devhub/cococtl/pkg/initdata"
+	"github.com/confidential-devhub/cococtl/pkg/manifest"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// manifestInitdata is the initdata found on one resource of a manifest.
+type manifestInitdata struct {
+	resource string
+	raw      []byte
+}
+
+// loadInitdataArg reads initdata from path, or from stdin when path is "-".
+// It accepts plaintext initdata TOML, a base64+gzip encoded blob, or a
+// manifest carrying the cc_init_data annotation on exactly one resource.
+func loadInitdataArg(path string, stdin io.Reader) ([]byte, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		// #nosec G304 -- path comes from a user-provided argument
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if isInitdataTOML(data) {
+		return data, nil
+	}
+	if raw, err := decompressBlob(strings.TrimSpace(string(data))); err == nil {
+		return raw, nil
+	}
+	if path == "-" {
+		return nil, fmt.Errorf("stdin is neither initdata TOML nor an encoded initdata blob")
+	}
+
+	found, err := initdataFromManifest(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not initdata TOML, an encoded blob or a manifest: %w", path, err)
+	}
+	if len(found) > 1 {
+		names := make([]string, len(found))
+		for i, f := range found {
+			names[i] = f.resource
+		}
+		return nil, fmt.Errorf("%s has initdata on more than one resource (%s); split the manifest first", path, strings.Join(names, ", "))
+	}
+	return found[0].raw, nil
+}
+
+// isInitdataTOML reports whether data parses as initdata TOML.
+func isInitdataTOML(data []byte) bool {
+	var id pkginitdata.InitData
+	if err := toml.Unmarshal(data, &id); err != nil {
+		return false
+	}
+	return id.Version != "" || len(id.Data) > 0
+}
+
+// initdataFromManifest decodes the cc_init_data annotation of every resource in
+// the manifest at path. Workloads are read from their pod template.
+func initdataFromManifest(path string) ([]manifestInitdata, error) {
+	set, err := manifest.LoadMultiDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	var found []manifestInitdata
+	for _, m := range set.GetManifests() {
+		encoded := m.GetAnnotation(pkginitdata.AnnotationKey)
+		if encoded == "" {
+			continue
+		}
+		resource := m.GetKind() + "/" + m.GetName()
+		raw, err := decompressBlob(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s annotation: %w", resource, pkginitdata.AnnotationKey, err)
+		}
+		found = append(found, manifestInitdata{resource: resource, raw: raw})
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no resource in %s has the %s annotation", path, pkginitdata.AnnotationKey)
+	}
+	return found, nil
+}
@@ -39,7 +39,12 @@ const (
 const defaultPolicy = `package agent_policy
 
 default CreateContainerRequest := true
+default CreateSandboxRequest := true
+default DestroySandboxRequest := true
 default ExecProcessRequest := false
+default RemoveContainerRequest := true
+default StartContainerRequest := true
+default WaitProcessRequest := true
 `
 
 func mustGenKey() *rsa.PrivateKey {
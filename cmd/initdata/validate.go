@@ -1,6 +1,7 @@
 package initdata
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
@@ -14,9 +15,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/confidential-devhub/cococtl/pkg/config"
 	pkginitdata "github.com/confidential-devhub/cococtl/pkg/initdata"
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
 	"github.com/pelletier/go-toml/v2"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 )
 
 // errValidationFailed is a sentinel returned when runValidate has already
@@ -29,29 +34,53 @@ var validateCmd = &cobra.Command{
 	Short: "Validate initdata structure and embedded certificates",
 	Long: `Validate an initdata for structural correctness and certificate validity.
 
-Reads from --file (plaintext TOML) or stdin (base64+gzip encoded blob).
+Reads from --file (plaintext TOML) or stdin (base64+gzip encoded blob), from
+the io.katacontainers.config.hypervisor.cc_init_data annotation of every
+resource in a manifest (--from-manifest; pod templates of workloads are
+checked), or from the annotation of a running pod (--from-pod).
 
 Checks:
   - TOML parses cleanly
   - version == "0.1.0" and algorithm is one of sha256, sha384, sha512
   - aa.toml and cdh.toml are present (policy.rego is optional)
+  - aa.toml and cdh.toml match the Attestation Agent and Confidential Data
+    Hub config schemas: required keys, value types, http(s) URLs, kbs:// URIs
+    and absolute paths (unknown keys are reported as warnings)
+  - policy.rego compiles with OPA, uses package agent_policy and defines the
+    rules a pod needs to start (CreateSandboxRequest, CreateContainerRequest, ...)
   - Embedded certs are CA certificates (CA:TRUE, keyCertSign key usage)
 
 Rejected certs: leaf/non-CA certificates, expired certs, SHA-1 or MD5
 signatures, unknown critical extensions, RSA keys shorter than 1024 bits.
 
+A warning is printed when the KBS URLs differ from each other or from the
+URLs the CoCo config generates (when a config is found): the guest KBS URL
+(attestation.kbs_url or trustee_server), or attestation.as_url for the kbs
+token config in passport mode. The coco_as token config is not compared.
+
 Exit codes: 0 = passed, 1 = validation failed or input error.
 
 Examples:
   kubectl coco initdata validate --file ~/.kube/coco-initdata.toml
-  kubectl coco initdata dump | kubectl coco initdata validate`,
+  kubectl coco initdata dump | kubectl coco initdata validate
+  kubectl coco initdata validate --from-manifest app-coco.yaml
+  kubectl coco initdata validate --from-pod default/myapp`,
 	RunE: runValidate,
 }
 
-var validateFile string
+var (
+	validateFile         string
+	validateFromManifest string
+	validateFromPod      string
+	validateConfigPath   string
+)
 
 func init() {
 	validateCmd.Flags().StringVar(&validateFile, "file", "", "Path to plaintext initdata TOML file (reads encoded blob from stdin if not set)")
+	validateCmd.Flags().StringVar(&validateFromManifest, "from-manifest", "", "Validate the initdata annotation of each resource in this manifest")
+	validateCmd.Flags().StringVar(&validateFromPod, "from-pod", "", "Validate the initdata annotation of a running pod, as <namespace>/<name> or <name>")
+	validateCmd.Flags().StringVar(&validateConfigPath, "config", "", "CoCo config to compare the KBS URL against (default: ~/.kube/coco-config.toml if present)")
+	validateCmd.MarkFlagsMutuallyExclusive("file", "from-manifest", "from-pod")
 }
 
 // silenceAndReturn silences Cobra's own error/usage output for this command
@@ -66,16 +95,109 @@ func silenceAndReturn(cmd *cobra.Command) error {
 }
 
 func runValidate(cmd *cobra.Command, _ []string) error {
-	tomlBytes, err := loadInitdataTOML(validateFile, os.Stdin)
+	sources, err := loadValidateSources(cmd)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to load initdata: %v\n", err)
 		return silenceAndReturn(cmd)
 	}
 
+	cfg, err := validateConfig(validateConfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return silenceAndReturn(cmd)
+	}
+
+	failed := false
+	for _, src := range sources {
+		if src.resource != "" {
+			fmt.Printf("%s:\n", src.resource)
+		}
+		if !validateInitdata(src.raw, cfg) {
+			failed = true
+		}
+	}
+	if failed {
+		return silenceAndReturn(cmd)
+	}
+	return nil
+}
+
+// loadValidateSources returns the initdata selected by the validate flags.
+// Initdata read from --file or stdin has no resource name.
+func loadValidateSources(cmd *cobra.Command) ([]manifestInitdata, error) {
+	switch {
+	case validateFromManifest != "":
+		return initdataFromManifest(validateFromManifest)
+	case validateFromPod != "":
+		ctx := context.Background()
+		if cmd != nil && cmd.Context() != nil {
+			ctx = cmd.Context()
+		}
+		client, err := k8s.NewClient(k8s.ClientOptions{})
+		if err != nil {
+			return nil, err
+		}
+		namespace, name := client.Namespace, validateFromPod
+		if ns, n, ok := strings.Cut(validateFromPod, "/"); ok {
+			namespace, name = ns, n
+		}
+		raw, err := podInitdata(ctx, client.Clientset, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		return []manifestInitdata{{resource: "Pod/" + namespace + "/" + name, raw: raw}}, nil
+	default:
+		raw, err := loadInitdataTOML(validateFile, os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		return []manifestInitdata{{raw: raw}}, nil
+	}
+}
+
+// podInitdata decodes the cc_init_data annotation of a pod.
+func podInitdata(ctx context.Context, clientset kubernetes.Interface, namespace, name string) ([]byte, error) {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, k8s.WrapError(err, "get", "pod "+name, namespace)
+	}
+	encoded := pod.Annotations[pkginitdata.AnnotationKey]
+	if encoded == "" {
+		return nil, fmt.Errorf("pod %s/%s has no %s annotation", namespace, name, pkginitdata.AnnotationKey)
+	}
+	raw, err := decompressBlob(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("pod %s/%s: invalid %s annotation: %w", namespace, name, pkginitdata.AnnotationKey, err)
+	}
+	return raw, nil
+}
+
+// validateConfig returns the CoCo config to compare KBS URLs against, or nil
+// when there is none. The default config is optional; an explicit --config
+// must load.
+func validateConfig(configPath string) (*config.CocoConfig, error) {
+	if configPath != "" {
+		return loadConfig(configPath)
+	}
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return nil, nil
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, nil
+	}
+	return cfg, nil
+}
+
+// validateInitdata runs all checks on raw, printing diagnostics to stderr and
+// the result to stdout. It reports whether validation passed. KBS URLs are
+// compared against the URLs cfg generates when cfg is not nil.
+func validateInitdata(raw []byte, cfg *config.CocoConfig) bool {
 	var id pkginitdata.InitData
-	if err := toml.Unmarshal(tomlBytes, &id); err != nil {
+	if err := toml.Unmarshal(raw, &id); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to parse TOML: %v\n", err)
-		return silenceAndReturn(cmd)
+		return false
 	}
 
 	var failures []string
@@ -92,9 +214,22 @@ func runValidate(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
-	if warn := checkKBSURLMismatch(id.Data); warn != "" {
+	for _, f := range pkginitdata.CheckData(id.Data) {
+		if f.Warning {
+			fmt.Fprintf(os.Stderr, "WARNING: %s\n", f)
+		} else {
+			failures = append(failures, f.String())
+		}
+	}
+
+	if warn := checkKBSURLMismatch(id.Data, cfg != nil && cfg.IsPassportMode()); warn != "" {
 		fmt.Fprint(os.Stderr, warn)
 	}
+	if cfg != nil {
+		if warn := checkConfigURLMatch(id.Data, cfg); warn != "" {
+			fmt.Fprint(os.Stderr, warn)
+		}
+	}
 
 	entries, err := extractCertsFromInitdata(id.Data)
 	if err != nil {
@@ -111,29 +246,34 @@ func runValidate(cmd *cobra.Command, _ []string) error {
 		for _, f := range failures {
 			fmt.Fprintf(os.Stderr, "  %s\n", f)
 		}
-		return silenceAndReturn(cmd)
+		return false
 	}
 
 	fmt.Println("Validation passed.")
-	return nil
+	return true
 }
 
-// checkKBSURLMismatch returns a warning message when KBS URLs differ across
-// the aa.toml token_configs and cdh.toml kbc entries, or an empty string if
-// all URLs are consistent. Differing URLs are valid but likely unintentional.
-func checkKBSURLMismatch(data map[string]string) string {
-	type urlEntry struct {
-		source string
-		url    string
-	}
+// kbsURLEntry is a KBS URL found in an initdata config file.
+type kbsURLEntry struct {
+	source string
+	url    string
+}
 
-	// normalizeURL strips trailing slashes and whitespace so that
-	// "https://kbs:8080" and "https://kbs:8080/" are treated as equal.
-	normalizeURL := func(u string) string {
-		return strings.TrimRight(strings.TrimSpace(u), "/")
-	}
+// normalizeKBSURL strips trailing slashes and whitespace so that
+// "https://kbs:8080" and "https://kbs:8080/" are treated as equal.
+func normalizeKBSURL(u string) string {
+	return strings.TrimRight(strings.TrimSpace(u), "/")
+}
 
-	var entries []urlEntry
+// aaKBSSource is the source of the aa.toml kbs token config. In passport mode
+// it points at the attestation service rather than at the resource KBS.
+const aaKBSSource = "aa.toml/token_configs.kbs"
+
+// collectKBSURLs returns the normalized KBS URLs of the aa.toml token_configs
+// and the cdh.toml kbc entry, sorted by source. The coco_as token config is
+// skipped: it points at the attestation service, not at a KBS.
+func collectKBSURLs(data map[string]string) []kbsURLEntry {
+	var entries []kbsURLEntry
 
 	if aaToml, ok := data["aa.toml"]; ok && aaToml != "" {
 		var aa map[string]interface{}
@@ -145,9 +285,12 @@ func checkKBSURLMismatch(data map[string]string) string {
 				}
 				sort.Strings(names)
 				for _, name := range names {
+					if name == "coco_as" {
+						continue
+					}
 					if entry, ok := tc[name].(map[string]interface{}); ok {
 						if url, ok := entry["url"].(string); ok && url != "" {
-							entries = append(entries, urlEntry{"aa.toml/token_configs." + name, normalizeURL(url)})
+							entries = append(entries, kbsURLEntry{"aa.toml/token_configs." + name, normalizeKBSURL(url)})
 						}
 					}
 				}
@@ -160,18 +303,32 @@ func checkKBSURLMismatch(data map[string]string) string {
 		if err := toml.Unmarshal([]byte(cdhToml), &cdh); err == nil {
 			if kbc, ok := cdh["kbc"].(map[string]interface{}); ok {
 				if url, ok := kbc["url"].(string); ok && url != "" {
-					entries = append(entries, urlEntry{"cdh.toml/kbc", normalizeURL(url)})
+					entries = append(entries, kbsURLEntry{"cdh.toml/kbc", normalizeKBSURL(url)})
 				}
 			}
 		}
 	}
 
+	sort.Slice(entries, func(i, j int) bool { return entries[i].source < entries[j].source })
+	return entries
+}
+
+// checkKBSURLMismatch returns a warning message when KBS URLs differ across
+// the aa.toml token_configs and cdh.toml kbc entries, or an empty string if
+// all URLs are consistent. Differing URLs are valid but likely unintentional.
+// In passport mode the kbs token config is expected to differ and is skipped.
+func checkKBSURLMismatch(data map[string]string, passport bool) string {
+	var entries []kbsURLEntry
+	for _, e := range collectKBSURLs(data) {
+		if passport && e.source == aaKBSSource {
+			continue
+		}
+		entries = append(entries, e)
+	}
 	if len(entries) < 2 {
 		return ""
 	}
 
-	sort.Slice(entries, func(i, j int) bool { return entries[i].source < entries[j].source })
-
 	first := entries[0].url
 	for _, e := range entries[1:] {
 		if e.url != first {
@@ -187,6 +344,39 @@ func checkKBSURLMismatch(data map[string]string) string {
 	return ""
 }
 
+// configKBSURL returns the URL cfg generates for source: the attestation
+// service URL for the kbs token config in passport mode, the guest KBS URL
+// otherwise.
+func configKBSURL(cfg *config.CocoConfig, source string) string {
+	if source == aaKBSSource && cfg.IsPassportMode() {
+		return cfg.Attestation.ASURL
+	}
+	return cfg.GuestKBSURL()
+}
+
+// checkConfigURLMatch returns a warning message when a KBS URL in the
+// initdata differs from the one cfg generates for it, or an empty string if
+// they all match. A mismatch usually means the workload was transformed
+// against another Trustee or before the config changed.
+func checkConfigURLMatch(data map[string]string, cfg *config.CocoConfig) string {
+	var sb strings.Builder
+	for _, e := range collectKBSURLs(data) {
+		want := normalizeKBSURL(configKBSURL(cfg, e.source))
+		if want == "" || e.url == want {
+			continue
+		}
+		if sb.Len() == 0 {
+			sb.WriteString("WARNING: KBS URLs do not match the CoCo config:\n")
+		}
+		fmt.Fprintf(&sb, "  %-44s %s (config: %s)\n", e.source+":", e.url, want)
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
 // diagWriter wraps an io.Writer and captures the first write error,
 // short-circuiting subsequent writes so the caller can check once at the end.
 type diagWriter struct {
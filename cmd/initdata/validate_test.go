@@ -3,11 +3,18 @@ package initdata
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/base64"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 // runValidateStderr runs runValidate and returns stderr output alongside the error.
@@ -247,7 +254,7 @@ func TestCheckKBSURLMismatch_TrailingSlash(t *testing.T) {
 		"aa.toml":  certBearingEntry("http://kbs.svc:8080"),
 		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs.svc:8080/\"\n",
 	}
-	if msg := checkKBSURLMismatch(data); msg != "" {
+	if msg := checkKBSURLMismatch(data, false); msg != "" {
 		t.Errorf("trailing slash should not trigger a mismatch warning, got: %s", msg)
 	}
 }
@@ -257,7 +264,7 @@ func TestCheckKBSURLMismatch_SameURL(t *testing.T) {
 		"aa.toml":  certBearingEntry("http://kbs.svc:8080"),
 		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs.svc:8080\"\n",
 	}
-	if msg := checkKBSURLMismatch(data); msg != "" {
+	if msg := checkKBSURLMismatch(data, false); msg != "" {
 		t.Errorf("expected no warning for matching URLs, got: %s", msg)
 	}
 }
@@ -267,7 +274,7 @@ func TestCheckKBSURLMismatch_DifferentURLs(t *testing.T) {
 		"aa.toml":  certBearingEntry("http://kbs1.svc:8080"),
 		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs2.svc:8080\"\n",
 	}
-	msg := checkKBSURLMismatch(data)
+	msg := checkKBSURLMismatch(data, false)
 	if msg == "" {
 		t.Fatal("expected warning for different URLs")
 	}
@@ -284,7 +291,7 @@ func TestCheckKBSURLMismatch_SingleSource(t *testing.T) {
 		"aa.toml":  certBearingEntry("http://kbs.svc:8080"),
 		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\n",
 	}
-	if msg := checkKBSURLMismatch(data); msg != "" {
+	if msg := checkKBSURLMismatch(data, false); msg != "" {
 		t.Errorf("expected no warning with only one URL source, got: %s", msg)
 	}
 }
@@ -297,7 +304,7 @@ func TestCheckKBSURLMismatch_MultipleTokenConfigs(t *testing.T) {
 			"[token_configs.kbs2]\nurl = \"http://kbs2.svc:8080\"\ncert = \"PLACEHOLDER\"\n",
 		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs1.svc:8080\"\n",
 	}
-	msg := checkKBSURLMismatch(data)
+	msg := checkKBSURLMismatch(data, false)
 	if msg == "" {
 		t.Fatal("expected warning when token_configs have different URLs")
 	}
@@ -306,22 +313,32 @@ func TestCheckKBSURLMismatch_MultipleTokenConfigs(t *testing.T) {
 	}
 }
 
-func TestCheckKBSURLMismatch_AllTokenConfigsCompared(t *testing.T) {
-	// All token_configs URL entries are compared regardless of whether they
-	// have a cert field — a coco_as entry pointing at a different endpoint
-	// is still worth warning about so the user can verify intent.
+func TestCheckKBSURLMismatch_CocoASSkipped(t *testing.T) {
+	// The coco_as token config points at the attestation service, so a
+	// different URL there is expected and not a KBS mismatch.
 	data := map[string]string{
 		"aa.toml": "[token_configs]\n" +
 			"[token_configs.kbs]\nurl = \"http://kbs.svc:8080\"\ncert = \"PLACEHOLDER\"\n" +
 			"[token_configs.coco_as]\nurl = \"http://other.svc:9090\"\n",
 		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs.svc:8080\"\n",
 	}
-	msg := checkKBSURLMismatch(data)
-	if msg == "" {
-		t.Fatal("expected warning: all token_configs URLs are compared, including non-KBS entries")
+	if msg := checkKBSURLMismatch(data, false); msg != "" {
+		t.Errorf("expected no warning for a differing coco_as URL, got: %s", msg)
+	}
+}
+
+func TestCheckKBSURLMismatch_Passport(t *testing.T) {
+	// In passport mode the kbs token config points at the token-issuing
+	// Trustee, while cdh.toml talks to the resource KBS.
+	data := map[string]string{
+		"aa.toml":  "[token_configs.kbs]\nurl = \"http://as.svc:8080\"\n",
+		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs.svc:8080\"\n",
+	}
+	if msg := checkKBSURLMismatch(data, true); msg != "" {
+		t.Errorf("expected no warning in passport mode, got: %s", msg)
 	}
-	if !strings.Contains(msg, "other.svc") {
-		t.Errorf("expected differing URL in warning, got: %s", msg)
+	if msg := checkKBSURLMismatch(data, false); msg == "" {
+		t.Error("expected a warning outside passport mode")
 	}
 }
 
@@ -358,3 +375,166 @@ func TestReportCerts_Output(t *testing.T) {
 		}
 	}
 }
+
+func TestRunValidate_FromManifest(t *testing.T) {
+	validateFromManifest = writeManifestWithInitdata(t, "testdata/valid.toml")
+	defer func() { validateFromManifest = "" }()
+	if err := runValidate(nil, nil); err != nil {
+		t.Errorf("runValidate() unexpected error: %v", err)
+	}
+
+	// A second resource with invalid initdata fails the whole manifest.
+	data, err := os.ReadFile(validateFromManifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := "---\napiVersion: v1\nkind: Pod\nmetadata:\n  name: broken\n  annotations:\n" +
+		"    io.katacontainers.config.hypervisor.cc_init_data: " + encodeBlobFromFile(t, "testdata/invalid-version.toml") + "\n"
+	if err := os.WriteFile(validateFromManifest, append(data, invalid...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := runValidateStderr(t)
+	if err == nil {
+		t.Fatal("runValidate() expected failure for the invalid pod")
+	}
+	if !strings.Contains(stderr, "version") {
+		t.Errorf("stderr should report the version failure, got: %q", stderr)
+	}
+}
+
+func TestRunValidate_TrusteeServerMismatch(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.TrusteeServer = "http://trustee.other.svc:8080"
+	validateConfigPath = filepath.Join(t.TempDir(), "coco-config.toml")
+	if err := cfg.Save(validateConfigPath); err != nil {
+		t.Fatal(err)
+	}
+	validateFile = "testdata/valid.toml"
+	defer func() { validateFile, validateConfigPath = "", "" }()
+
+	stderr, err := runValidateStderr(t)
+	if err != nil {
+		t.Errorf("runValidate() unexpected error: %v", err)
+	}
+	if !strings.Contains(stderr, "do not match the CoCo config") || !strings.Contains(stderr, "cdh.toml/kbc") {
+		t.Errorf("stderr should warn about the config mismatch, got: %q", stderr)
+	}
+
+	validateConfigPath = "/nonexistent/coco-config.toml"
+	if _, err := runValidateStderr(t); err == nil {
+		t.Error("runValidate() expected error for a missing --config")
+	}
+}
+
+func TestCheckConfigURLMatch(t *testing.T) {
+	data := map[string]string{
+		"aa.toml":  certBearingEntry("http://kbs.svc:8080"),
+		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs.svc:8080/\"\n",
+	}
+	cfg := config.DefaultConfig()
+	cfg.TrusteeServer = "http://kbs.svc:8080/"
+	if warn := checkConfigURLMatch(data, cfg); warn != "" {
+		t.Errorf("checkConfigURLMatch() = %q, want no warning", warn)
+	}
+	cfg.TrusteeServer = "https://kbs.svc:8443"
+	warn := checkConfigURLMatch(data, cfg)
+	if !strings.Contains(warn, "aa.toml/token_configs.kbs") || !strings.Contains(warn, "cdh.toml/kbc") {
+		t.Errorf("checkConfigURLMatch() = %q, want both sources listed", warn)
+	}
+
+	// The guest reaches the KBS through attestation.kbs_url when it is set.
+	cfg.Attestation.KBSURL = "http://kbs.svc:8080"
+	if warn := checkConfigURLMatch(data, cfg); warn != "" {
+		t.Errorf("checkConfigURLMatch() with kbs_url = %q, want no warning", warn)
+	}
+}
+
+func TestCheckConfigURLMatch_Passport(t *testing.T) {
+	data := map[string]string{
+		"aa.toml": "[token_configs.kbs]\nurl = \"http://as.svc:8080\"\n" +
+			"[token_configs.coco_as]\nurl = \"http://as.svc:8080\"\n",
+		"cdh.toml": "[kbc]\nname = \"cc_kbc\"\nurl = \"http://kbs.svc:8080\"\n",
+	}
+	cfg := config.DefaultConfig()
+	cfg.TrusteeServer = "http://kbs.svc:8080"
+	cfg.Attestation.Mode = "passport"
+	cfg.Attestation.ASURL = "http://as.svc:8080"
+	if warn := checkConfigURLMatch(data, cfg); warn != "" {
+		t.Errorf("checkConfigURLMatch() = %q, want no warning", warn)
+	}
+	cfg.Attestation.ASURL = "http://other-as.svc:8080"
+	if warn := checkConfigURLMatch(data, cfg); !strings.Contains(warn, "aa.toml/token_configs.kbs") || strings.Contains(warn, "cdh.toml/kbc") {
+		t.Errorf("checkConfigURLMatch() = %q, want only the kbs token config listed", warn)
+	}
+}
+
+func TestPodInitdata(t *testing.T) {
+	want, err := os.ReadFile("testdata/valid.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "myapp",
+			Namespace:   "apps",
+			Annotations: map[string]string{"io.katacontainers.config.hypervisor.cc_init_data": encodeBlobFromFile(t, "testdata/valid.toml")},
+		}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "apps"}},
+	)
+
+	got, err := podInitdata(context.Background(), clientset, "apps", "myapp")
+	if err != nil {
+		t.Fatalf("podInitdata() error = %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("podInitdata() = %q, want the fixture TOML", got)
+	}
+	if _, err := podInitdata(context.Background(), clientset, "apps", "plain"); err == nil || !strings.Contains(err.Error(), "no io.katacontainers") {
+		t.Errorf("podInitdata() error = %v, want missing annotation", err)
+	}
+	if _, err := podInitdata(context.Background(), clientset, "apps", "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("podInitdata() error = %v, want not found", err)
+	}
+}
+
+func TestRunValidate_SchemaAndPolicyErrors(t *testing.T) {
+	initdata := `version = "0.1.0"
+algorithm = "sha256"
+
+[data]
+"aa.toml" = '''
+[token_configs.kbs]
+url = "kbs.example.svc:8080"
+'''
+"cdh.toml" = '''
+[kbc]
+name = "cc_kbc"
+url = "http://kbs.example.svc:8080"
+typo = true
+'''
+"policy.rego" = '''
+package agent_policy
+
+default CreateContainerRequest := true
+'''
+`
+	validateFile = filepath.Join(t.TempDir(), "initdata.toml")
+	if err := os.WriteFile(validateFile, []byte(initdata), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { validateFile = "" }()
+
+	stderr, err := runValidateStderr(t)
+	if err == nil {
+		t.Fatal("runValidate() expected failure")
+	}
+	for _, want := range []string{
+		"aa.toml/token_configs.kbs.url",
+		"WARNING: cdh.toml/kbc.typo: unknown key",
+		"rule CreateSandboxRequest is not defined",
+	} {
+		if !strings.Contains(stderr, want) {
+			t.Errorf("stderr missing %q, got:\n%s", want, stderr)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package kbs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsbackup"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+// backupPassphraseEnv holds the backup passphrase when --passphrase-file is not given.
+const backupPassphraseEnv = "KBS_BACKUP_PASSPHRASE"
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export KBS resources, policies and reference values",
+	Long: `Export the state of a Key Broker Service (KBS) instance to an encrypted archive.
+
+The archive holds the resources of the in-cluster KBS repository, the resource
+policy, the attestation policies selected with --policy-id and the registered
+reference values. Restore it with 'kbs restore', for example to migrate to
+another cluster or to recover a KBS whose in-memory storage was lost.
+
+The KBS admin API cannot list resources, so they are read from the repository
+of the in-cluster KBS pod. With --kbs-url, an external TrusteeServer or the
+Vault resource backend only policies and reference values are exported.
+
+The archive is a gzip-compressed tar file encrypted with age
+(https://age-encryption.org). Encrypt it either to age recipients
+(--recipient, --recipients-file) or with a passphrase read from
+--passphrase-file or $KBS_BACKUP_PASSPHRASE. Generate an age key pair with
+'age-keygen -o key.txt'.
+
+Examples:
+  kubectl coco kbs backup -o kbs-backup.age --recipient age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+  kubectl coco kbs backup -o kbs-backup.age --recipients-file recipients.txt
+  KBS_BACKUP_PASSPHRASE=... kubectl coco kbs backup -o kbs-backup.age
+  kubectl coco kbs backup -o kbs-backup.age --passphrase-file pass.txt --policy-id default --policy-id tdx`,
+	Args: cobra.NoArgs,
+	RunE: runBackup,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Import a KBS backup",
+	Long: `Import an archive written by 'kbs backup' into a Key Broker Service (KBS)
+instance.
+
+Resources and attestation policies in the archive are uploaded, the resource
+policy is replaced and the reference values are registered again. Resources and
+policies that exist in KBS but not in the archive are left untouched.
+
+Decrypt the archive with an age identity file (--identity) or with the
+passphrase read from --passphrase-file or $KBS_BACKUP_PASSPHRASE.
+
+Examples:
+  kubectl coco kbs restore -f kbs-backup.age --identity key.txt
+  KBS_BACKUP_PASSPHRASE=... kubectl coco kbs restore -f kbs-backup.age
+  kubectl coco kbs restore -f kbs-backup.age --identity key.txt -n coco-system`,
+	Args: cobra.NoArgs,
+	RunE: runRestore,
+}
+
+var (
+	backupConn           kbsConnection
+	backupOutput         string
+	backupRecipients     []string
+	backupRecipientsFile string
+	backupPassphraseFile string
+	backupPolicyIDs      []string
+
+	restoreConn           kbsConnection
+	restoreFile           string
+	restoreIdentityFiles  []string
+	restorePassphraseFile string
+)
+
+func init() {
+	addKBSConnectionFlags(backupCmd, &backupConn)
+	backupCmd.Flags().StringVarP(&backupOutput, "output", "o", "", "Write the backup archive to this file (required)")
+	backupCmd.Flags().StringArrayVar(&backupRecipients, "recipient", nil, "age recipient (age1...) to encrypt to (repeatable)")
+	backupCmd.Flags().StringVar(&backupRecipientsFile, "recipients-file", "", "File with age recipients, one per line")
+	backupCmd.Flags().StringVar(&backupPassphraseFile, "passphrase-file", "", "File holding the passphrase to encrypt with (default: $"+backupPassphraseEnv+")")
+	backupCmd.Flags().StringArrayVar(&backupPolicyIDs, "policy-id", []string{kbsclient.DefaultAttestationPolicyID}, "Attestation policy ID to export (repeatable)")
+
+	addKBSConnectionFlags(restoreCmd, &restoreConn)
+	restoreCmd.Flags().StringVarP(&restoreFile, "file", "f", "", "Backup archive to import (required)")
+	restoreCmd.Flags().StringArrayVar(&restoreIdentityFiles, "identity", nil, "age identity file to decrypt with (repeatable)")
+	restoreCmd.Flags().StringVar(&restorePassphraseFile, "passphrase-file", "", "File holding the passphrase to decrypt with (default: $"+backupPassphraseEnv+")")
+}
+
+func runBackup(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	if backupOutput == "" {
+		return fmt.Errorf("--output is required")
+	}
+	recipients, err := parseBackupRecipients()
+	if err != nil {
+		return err
+	}
+
+	kbsClient, kbsNamespace, stopForward, err := connectKBS(ctx, &backupConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	w := cmd.OutOrStdout()
+	b := &kbsbackup.Backup{
+		CreatedAt:           time.Now(),
+		Source:              "external KBS",
+		Resources:           map[string][]byte{},
+		AttestationPolicies: map[string][]byte{},
+	}
+	if kbsNamespace != "" {
+		b.Source = "in-cluster KBS in namespace " + kbsNamespace
+		if err := backupRepositoryResources(ctx, w, kbsNamespace, b); err != nil {
+			return err
+		}
+	} else {
+		fmt.Fprintf(w, "  ⚠ Resources skipped: the KBS admin API cannot list them; only the in-cluster KBS repository can be exported\n")
+	}
+	if err := backupAdminState(ctx, w, kbsClient, backupPolicyIDs, b); err != nil {
+		return err
+	}
+
+	var archive bytes.Buffer
+	if err := kbsbackup.Write(&archive, b, recipients...); err != nil {
+		return err
+	}
+	if err := os.WriteFile(backupOutput, archive.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", backupOutput, err)
+	}
+	fmt.Fprintf(w, "Backup of %d resource(s), %d attestation policy(ies) and %d reference value(s) saved to %s\n",
+		len(b.Resources), len(b.AttestationPolicies), len(b.ReferenceValues), backupOutput)
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	if restoreFile == "" {
+		return fmt.Errorf("--file is required")
+	}
+	identities, err := parseRestoreIdentities()
+	if err != nil {
+		return err
+	}
+
+	// #nosec G304 -- path provided by the user via flag
+	archive, err := os.Open(restoreFile)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", restoreFile, err)
+	}
+	defer func() { _ = archive.Close() }()
+	b, err := kbsbackup.Read(archive, identities...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", restoreFile, err)
+	}
+
+	kbsClient, kbsNamespace, stopForward, err := connectKBS(ctx, &restoreConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	w := cmd.OutOrStdout()
+	fmt.Fprintf(w, "Restoring backup of %s taken %s\n", b.Source, b.CreatedAt.Format(time.RFC3339))
+	if err := restoreBackup(ctx, w, kbsClient, kbsNamespace, b); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Backup restored from %s\n", restoreFile)
+	return nil
+}
+
+// backupRepositoryResources adds the resources of the LocalFs repository of
+// the in-cluster KBS in namespace to b.
+func backupRepositoryResources(ctx context.Context, w io.Writer, namespace string, b *kbsbackup.Backup) error {
+	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	backend, err := trustee.GetResourceBackend(ctx, k8sClient.Clientset, namespace)
+	if err != nil {
+		return err
+	}
+	if backend != trustee.ResourceBackendFile {
+		fmt.Fprintf(w, "  ⚠ Resources skipped: the KBS stores them in %s; back them up with the %s tooling\n", backend, backend)
+		return nil
+	}
+
+	paths, err := trustee.ListRepositoryResources(ctx, k8sClient.Clientset, namespace, "")
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		data, err := trustee.ReadRepositoryResource(ctx, k8sClient.Clientset, namespace, path)
+		if err != nil {
+			return err
+		}
+		b.Resources[path] = data
+		fmt.Fprintf(w, "  ✓ Resource %s\n", path)
+	}
+	return nil
+}
+
+// backupAdminState adds the policies and reference values served by the KBS
+// admin API to b. Policies KBS does not have are skipped.
+func backupAdminState(ctx context.Context, w io.Writer, kbsClient *kbsclient.Client, policyIDs []string, b *kbsbackup.Backup) error {
+	policy, err := kbsClient.GetResourcePolicy(ctx)
+	switch {
+	case kbsclient.IsNotFound(err):
+		fmt.Fprintf(w, "  ⚠ Resource policy not set; skipped\n")
+	case err != nil:
+		return fmt.Errorf("failed to get resource policy: %w", err)
+	default:
+		b.ResourcePolicy = policy
+		fmt.Fprintf(w, "  ✓ Resource policy\n")
+	}
+
+	for _, id := range policyIDs {
+		policy, err := kbsClient.GetAttestationPolicy(ctx, id)
+		switch {
+		case kbsclient.IsNotFound(err):
+			fmt.Fprintf(w, "  ⚠ Attestation policy %q not set; skipped\n", id)
+		case err != nil:
+			return fmt.Errorf("failed to get attestation policy %q: %w", id, err)
+		default:
+			b.AttestationPolicies[id] = policy
+			fmt.Fprintf(w, "  ✓ Attestation policy %q\n", id)
+		}
+	}
+
+	values, err := kbsClient.GetReferenceValues(ctx)
+	switch {
+	case kbsclient.IsNotFound(err):
+	case err != nil:
+		return fmt.Errorf("failed to get reference values: %w", err)
+	default:
+		b.ReferenceValues = values
+		fmt.Fprintf(w, "  ✓ %d reference value(s)\n", len(values))
+	}
+	return nil
+}
+
+// restoreBackup uploads the content of b to KBS. kbsNamespace is the namespace
+// of the in-cluster KBS, or empty for a KBS reached directly (see
+// setResourcePolicy).
+func restoreBackup(ctx context.Context, w io.Writer, kbsClient *kbsclient.Client, kbsNamespace string, b *kbsbackup.Backup) error {
+	for _, path := range slices.Sorted(maps.Keys(b.Resources)) {
+		if len(b.Resources[path]) == 0 {
+			fmt.Fprintf(w, "  ⚠ Resource %s is empty; skipped\n", path)
+			continue
+		}
+		if err := kbsClient.SetResource(ctx, path, b.Resources[path]); err != nil {
+			return fmt.Errorf("failed to upload %s: %w", path, err)
+		}
+		fmt.Fprintf(w, "  ✓ Resource %s\n", path)
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(b.AttestationPolicies)) {
+		if err := kbsClient.SetAttestationPolicy(ctx, id, b.AttestationPolicies[id]); err != nil {
+			return fmt.Errorf("failed to set attestation policy %q: %w", id, err)
+		}
+		fmt.Fprintf(w, "  ✓ Attestation policy %q\n", id)
+	}
+
+	if b.ResourcePolicy != nil {
+		if err := setResourcePolicy(ctx, kbsClient, kbsNamespace, b.ResourcePolicy); err != nil {
+			return fmt.Errorf("failed to set resource policy: %w", err)
+		}
+		fmt.Fprintf(w, "  ✓ Resource policy\n")
+	}
+
+	values, skipped := b.StringReferenceValues()
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if err := kbsClient.RegisterReferenceValue(ctx, name, values[name]); err != nil {
+			return fmt.Errorf("failed to register reference value %s: %w", name, err)
+		}
+		fmt.Fprintf(w, "  ✓ Reference value %s\n", name)
+	}
+	for _, name := range skipped {
+		fmt.Fprintf(w, "  ⚠ Reference value %s is not a list of strings; skipped\n", name)
+	}
+	return nil
+}
+
+// parseBackupRecipients returns the age recipients selected by the backup
+// flags, or a passphrase recipient.
+func parseBackupRecipients() ([]age.Recipient, error) {
+	if len(backupRecipients) == 0 && backupRecipientsFile == "" {
+		passphrase, err := readBackupPassphrase(backupPassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("one of --recipient, --recipients-file, --passphrase-file or $%s is required", backupPassphraseEnv)
+		}
+		recipient, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Recipient{recipient}, nil
+	}
+	if backupPassphraseFile != "" {
+		return nil, fmt.Errorf("--passphrase-file cannot be combined with --recipient or --recipients-file")
+	}
+
+	var recipients []age.Recipient
+	for _, r := range backupRecipients {
+		recipient, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --recipient %q: %w", r, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	if backupRecipientsFile != "" {
+		// #nosec G304 -- path provided by the user via flag
+		f, err := os.Open(backupRecipientsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open recipients file: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		parsed, err := age.ParseRecipients(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse recipients file %s: %w", backupRecipientsFile, err)
+		}
+		recipients = append(recipients, parsed...)
+	}
+	return recipients, nil
+}
+
+// parseRestoreIdentities returns the age identities selected by the restore
+// flags, or a passphrase identity.
+func parseRestoreIdentities() ([]age.Identity, error) {
+	if len(restoreIdentityFiles) == 0 {
+		passphrase, err := readBackupPassphrase(restorePassphraseFile)
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("one of --identity, --passphrase-file or $%s is required", backupPassphraseEnv)
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return []age.Identity{identity}, nil
+	}
+	if restorePassphraseFile != "" {
+		return nil, fmt.Errorf("--passphrase-file cannot be combined with --identity")
+	}
+
+	var identities []age.Identity
+	for _, path := range restoreIdentityFiles {
+		// #nosec G304 -- path provided by the user via flag
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open identity file: %w", err)
+		}
+		parsed, err := age.ParseIdentities(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+		}
+		identities = append(identities, parsed...)
+	}
+	return identities, nil
+}
+
+// readBackupPassphrase reads the passphrase from path, or from
+// $KBS_BACKUP_PASSPHRASE when path is empty. A trailing newline is dropped.
+func readBackupPassphrase(path string) (string, error) {
+	if path == "" {
+		return os.Getenv(backupPassphraseEnv), nil
+	}
+	// #nosec G304 -- path provided by the user via flag
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase file %s is empty", path)
+	}
+	return passphrase, nil
+}
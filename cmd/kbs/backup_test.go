@@ -0,0 +1,224 @@
+package kbs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsbackup"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+)
+
+// fakeKBS is an in-memory KBS admin API recording the requests it receives.
+type fakeKBS struct {
+	mu       sync.Mutex
+	routes   map[string]string
+	requests []string
+}
+
+func newFakeKBS(t *testing.T, routes map[string]string) (*kbsclient.Client, *fakeKBS) {
+	t.Helper()
+	kbs := &fakeKBS{routes: routes}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		kbs.mu.Lock()
+		defer kbs.mu.Unlock()
+		kbs.requests = append(kbs.requests, r.Method+" "+r.URL.Path+" "+string(body))
+		if r.Method != http.MethodGet {
+			return
+		}
+		response, ok := kbs.routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, response)
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("KBS requests: %q", kbs.requests)
+		}
+	})
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := kbsclient.New(server.URL, privateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, kbs
+}
+
+func TestBackupAdminState(t *testing.T) {
+	client, _ := newFakeKBS(t, map[string]string{
+		"/kbs/v0/resource-policy":            base64.RawURLEncoding.EncodeToString([]byte("package policy\n")),
+		"/kbs/v0/attestation-policy/default": base64.RawURLEncoding.EncodeToString([]byte("package policy\ndefault allow = true\n")),
+		"/kbs/v0/reference-value":            `{"init_data":["abc"]}`,
+	})
+
+	var out bytes.Buffer
+	b := &kbsbackup.Backup{AttestationPolicies: map[string][]byte{}}
+	if err := backupAdminState(context.Background(), &out, client, []string{"default", "tdx"}, b); err != nil {
+		t.Fatalf("backupAdminState() error = %v", err)
+	}
+	if string(b.ResourcePolicy) != "package policy\n" {
+		t.Errorf("resource policy = %q", b.ResourcePolicy)
+	}
+	if len(b.AttestationPolicies) != 1 || !strings.Contains(string(b.AttestationPolicies["default"]), "allow = true") {
+		t.Errorf("attestation policies = %q", b.AttestationPolicies)
+	}
+	if string(b.ReferenceValues["init_data"]) != `["abc"]` {
+		t.Errorf("reference values = %s", b.ReferenceValues)
+	}
+	if !strings.Contains(out.String(), `Attestation policy "tdx" not set; skipped`) {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestRestoreBackup(t *testing.T) {
+	client, kbs := newFakeKBS(t, nil)
+	b := &kbsbackup.Backup{
+		Resources: map[string][]byte{
+			"default/myapp/password": []byte("s3cret"),
+			"default/myapp/empty":    {},
+		},
+		ResourcePolicy:      []byte("package policy\n"),
+		AttestationPolicies: map[string][]byte{"default": []byte("package policy\n")},
+		ReferenceValues: kbsclient.ReferenceValues{
+			"init_data": json.RawMessage(`["abc"]`),
+			"other":     json.RawMessage(`{"a":1}`),
+		},
+	}
+
+	var out bytes.Buffer
+	if err := restoreBackup(context.Background(), &out, client, "", b); err != nil {
+		t.Fatalf("restoreBackup() error = %v", err)
+	}
+
+	requests := strings.Join(kbs.requests, "\n")
+	for _, want := range []string{
+		"POST /kbs/v0/resource/default/myapp/password s3cret",
+		"POST /kbs/v0/attestation-policy ",
+		"POST /kbs/v0/resource-policy ",
+		"POST /kbs/v0/reference-value ",
+	} {
+		if !strings.Contains(requests, want) {
+			t.Errorf("missing request %q in:\n%s", want, requests)
+		}
+	}
+	if strings.Contains(requests, "myapp/empty") {
+		t.Error("empty resource uploaded")
+	}
+	for _, want := range []string{"Resource default/myapp/empty is empty; skipped", "Reference value other is not a list of strings; skipped"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestParseBackupRecipients(t *testing.T) {
+	home := withHome(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipientsFile := filepath.Join(home, "recipients.txt")
+	if err := os.WriteFile(recipientsFile, []byte("# backup key\n"+identity.Recipient().String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	passphraseFile := filepath.Join(home, "pass.txt")
+	if err := os.WriteFile(passphraseFile, []byte("correct horse\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		backupRecipients, backupRecipientsFile, backupPassphraseFile = nil, "", ""
+	}()
+
+	tests := []struct {
+		name           string
+		recipients     []string
+		recipientsFile string
+		passphraseFile string
+		env            string
+		want           int
+		wantErr        string
+	}{
+		{"none", nil, "", "", "", 0, "is required"},
+		{"recipient and file", []string{identity.Recipient().String()}, recipientsFile, "", "", 2, ""},
+		{"invalid recipient", []string{"age1invalid"}, "", "", "", 0, "invalid --recipient"},
+		{"passphrase file", nil, "", passphraseFile, "", 1, ""},
+		{"passphrase env", nil, "", "", "from-env", 1, ""},
+		{"env ignored with recipients", []string{identity.Recipient().String()}, "", "", "from-env", 1, ""},
+		{"passphrase and recipient", []string{identity.Recipient().String()}, "", passphraseFile, "", 0, "cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(backupPassphraseEnv, tt.env)
+			backupRecipients, backupRecipientsFile, backupPassphraseFile = tt.recipients, tt.recipientsFile, tt.passphraseFile
+			recipients, err := parseBackupRecipients()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseBackupRecipients() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || len(recipients) != tt.want {
+				t.Errorf("parseBackupRecipients() = %d recipients, %v; want %d", len(recipients), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRestoreIdentities(t *testing.T) {
+	home := withHome(t)
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(home, "key.txt")
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { restoreIdentityFiles, restorePassphraseFile = nil, "" }()
+
+	t.Setenv(backupPassphraseEnv, "")
+	if _, err := parseRestoreIdentities(); err == nil || !strings.Contains(err.Error(), "is required") {
+		t.Errorf("parseRestoreIdentities() without flags error = %v", err)
+	}
+
+	restoreIdentityFiles = []string{identityFile}
+	identities, err := parseRestoreIdentities()
+	if err != nil || len(identities) != 1 {
+		t.Fatalf("parseRestoreIdentities() = %v, %v", identities, err)
+	}
+
+	// A backup encrypted to the recipient decrypts with the parsed identity.
+	var archive bytes.Buffer
+	if err := kbsbackup.Write(&archive, &kbsbackup.Backup{Source: "test"}, identity.Recipient()); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := kbsbackup.Read(&archive, identities...); err != nil || b.Source != "test" {
+		t.Errorf("Read() = %v, %v", b, err)
+	}
+
+	restorePassphraseFile = identityFile
+	if _, err := parseRestoreIdentities(); err == nil || !strings.Contains(err.Error(), "cannot be combined") {
+		t.Errorf("parseRestoreIdentities() with both error = %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package kbs
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+// kbsConnection holds the flags shared by commands that talk to the KBS admin API.
+type kbsConnection struct {
+	kbsURL    string
+	authDir   string
+	authKey   string
+	tlsCA     string
+	namespace string
+}
+
+// addKBSConnectionFlags registers the KBS connection and authentication flags on cmd.
+func addKBSConnectionFlags(cmd *cobra.Command, conn *kbsConnection) {
+	cmd.Flags().StringVar(&conn.kbsURL, "kbs-url", "", "Direct KBS URL (e.g. http://localhost:8080); skips port-forward")
+	cmd.Flags().StringVar(&conn.authDir, "auth-dir", "", "Directory containing private.key (default: ~/.kube/coco-kbs-auth)")
+	cmd.Flags().StringVar(&conn.authKey, "auth-key", "", "Path to Ed25519 private key PEM file")
+	cmd.Flags().StringVar(&conn.tlsCA, "tls-ca", "", "PEM-encoded CA certificate for TLS verification")
+	cmd.Flags().StringVarP(&conn.namespace, "namespace", "n", "", "Namespace of the in-cluster KBS pod")
+}
+
+// connectKBS builds a kbsclient.Client using the following URL resolution:
+//
+//  1. --kbs-url flag: connect directly to that URL
+//  2. config TrusteeServer (non-cluster URL): connect directly (set by 'kbs start --mode external')
+//  3. otherwise: port-forward to the in-cluster KBS pod
+//
+// Auth resolution: --auth-key > --auth-dir > config KBSAuthDir > default dir.
+// The returned namespace is the one hosting the port-forwarded KBS pod, or empty
+// when connecting directly. The caller must invoke the returned stop function when done.
+func connectKBS(ctx context.Context, conn *kbsConnection) (*kbsclient.Client, string, func(), error) {
+	noop := func() {}
+
+	// directConnect builds a client for a known URL (--kbs-url or config TrusteeServer).
+	// --tls-ca, or else defaultCA (trustee_ca_cert), is honoured here; port-forward
+	// mode takes the CA from the KBS deployment instead.
+	directConnect := func(kbsURL, defaultCA string) (*kbsclient.Client, string, func(), error) {
+		pemData, err := loadPrivateKeyPEM(conn.authKey, conn.authDir)
+		if err != nil {
+			return nil, "", noop, err
+		}
+		caPath := conn.tlsCA
+		if caPath == "" {
+			caPath = defaultCA
+		}
+		var caCert []byte
+		if caPath != "" {
+			// #nosec G304 -- path provided by the user via flag or config
+			caCert, err = os.ReadFile(caPath)
+			if err != nil {
+				return nil, "", noop, fmt.Errorf("failed to read TLS CA from %s: %w", caPath, err)
+			}
+		}
+		client, err := kbsclient.NewFromPEM(kbsURL, pemData, caCert)
+		if err != nil {
+			return nil, "", noop, fmt.Errorf("failed to create KBS client: %w", err)
+		}
+		return client, "", noop, nil
+	}
+
+	if conn.kbsURL != "" {
+		return directConnect(conn.kbsURL, "")
+	}
+
+	// If config holds a non-cluster TrusteeServer URL (written by 'kbs start --mode external'),
+	// use it directly without a port-forward. Validate the URL before using it so that a
+	// manually edited or otherwise malformed config does not produce confusing HTTP errors.
+	if cfg, err := loadCocoConfig(); err == nil && cfg.TrusteeServer != "" && !isTrusteeServerInCluster(cfg.TrusteeServer) {
+		u, err := url.Parse(cfg.TrusteeServer)
+		if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != "" {
+			return directConnect(cfg.TrusteeServer, cfg.TrusteeCACert)
+		}
+	}
+
+	// Port-forward mode: determine the namespace where KBS is deployed.
+	kbsNamespace, err := resolveKBSNamespace(conn.namespace)
+	if err != nil {
+		return nil, "", noop, err
+	}
+
+	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+	if err != nil {
+		return nil, "", noop, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	if conn.authKey != "" {
+		// --auth-key explicitly provided: load from that file and use it for the connection
+		// so the flag is honoured rather than silently falling back to the auth directory.
+		pemData, err := loadPrivateKeyPEM(conn.authKey, "")
+		if err != nil {
+			return nil, "", noop, err
+		}
+		client, stop, err := trustee.NewClientWithPortForwardFromPEM(ctx, k8sClient.Config, k8sClient.Clientset, kbsNamespace, pemData)
+		if err != nil {
+			return nil, "", noop, fmt.Errorf("failed to connect to KBS via port-forward (namespace: %s): %w", kbsNamespace, err)
+		}
+		return client, kbsNamespace, stop, nil
+	}
+
+	// No --auth-key: resolve auth dir from --auth-dir, config, or the default location.
+	authDir, err := resolveAuthDir(conn.authDir)
+	if err != nil {
+		return nil, "", noop, err
+	}
+	client, stop, err := trustee.NewClientWithPortForward(ctx, k8sClient.Config, k8sClient.Clientset, kbsNamespace, authDir)
+	if err != nil {
+		return nil, "", noop, fmt.Errorf("failed to connect to KBS via port-forward (namespace: %s): %w", kbsNamespace, err)
+	}
+	return client, kbsNamespace, stop, nil
+}
+
+// inClusterKBSNamespace returns the namespace of the in-cluster KBS pod for
+// operations that need direct pod access (e.g. reading the resource repository).
+// It fails when the connection resolves to a direct KBS URL.
+func inClusterKBSNamespace(conn *kbsConnection) (string, error) {
+	if conn.kbsURL != "" {
+		return "", fmt.Errorf("this operation requires the in-cluster KBS and cannot be used with --kbs-url")
+	}
+	if cfg, err := loadCocoConfig(); err == nil && cfg.TrusteeServer != "" && !isTrusteeServerInCluster(cfg.TrusteeServer) {
+		return "", fmt.Errorf("this operation requires the in-cluster KBS, but TrusteeServer in config points to %s", cfg.TrusteeServer)
+	}
+	return resolveKBSNamespace(conn.namespace)
+}
+
+// Connection holds the KBS connection flags for commands outside the kbs
+// group that upload to KBS (e.g. 'image-policy create').
+type Connection struct {
+	conn kbsConnection
+}
+
+// AddConnectionFlags registers the KBS connection and authentication flags on cmd.
+func AddConnectionFlags(cmd *cobra.Command, c *Connection) {
+	addKBSConnectionFlags(cmd, &c.conn)
+}
+
+// Connect builds a kbsclient.Client from the registered flags, resolving the
+// KBS URL and admin key like the kbs subcommands do.
+// The caller must invoke the returned stop function when done.
+func Connect(ctx context.Context, c *Connection) (*kbsclient.Client, func(), error) {
+	client, _, stop, err := connectKBS(ctx, &c.conn)
+	return client, stop, err
+}
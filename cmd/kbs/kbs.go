@@ -10,11 +10,31 @@ var KbsCmd = &cobra.Command{
 	Long: `Commands for deploying, configuring, and interacting with the Key Broker Service (KBS) / Trustee.
 
 Available subcommands:
-  start     Deploy or configure a KBS instance
-  populate  Upload resources to a KBS instance`,
+  start             Deploy or configure a KBS instance
+  status            Report the health of the KBS
+  stop              Remove the in-cluster KBS
+  upgrade           Roll the in-cluster KBS to a new image
+  backup            Export KBS resources, policies and reference values
+  restore           Import a KBS backup
+  populate          Upload resources to a KBS instance
+  get               Read a resource from a KBS instance
+  delete            Delete resources from a KBS instance
+  ls                List resources stored in the in-cluster KBS
+  policy            Manage attestation and resource policies
+  reference-values  Manage reference values used for attestation`,
 }
 
 func init() {
 	KbsCmd.AddCommand(startCmd)
+	KbsCmd.AddCommand(statusCmd)
+	KbsCmd.AddCommand(stopCmd)
+	KbsCmd.AddCommand(upgradeCmd)
+	KbsCmd.AddCommand(backupCmd)
+	KbsCmd.AddCommand(restoreCmd)
 	KbsCmd.AddCommand(populateCmd)
+	KbsCmd.AddCommand(getCmd)
+	KbsCmd.AddCommand(deleteCmd)
+	KbsCmd.AddCommand(lsCmd)
+	KbsCmd.AddCommand(policyCmd)
+	KbsCmd.AddCommand(referenceValuesCmd)
 }
@@ -0,0 +1,186 @@
+package kbs
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+const (
+	policyTypeAttestation = "attestation"
+	policyTypeResource    = "resource"
+)
+
+var policyCmd = &cobra.Command{
+	Use:   "policy",
+	Short: "Manage KBS attestation and resource policies",
+	Long: `Manage the policies enforced by a Key Broker Service (KBS) instance.
+
+Policy types (--type):
+  attestation  OPA policy the attestation service uses to appraise TEE evidence
+               against the registered reference values (default)
+  resource     OPA policy KBS uses to decide which attested workloads may read
+               which resources
+
+Available subcommands:
+  set  Upload a Rego policy
+  get  Print the current policy`,
+}
+
+var policySetCmd = &cobra.Command{
+	Use:   "set <policy.rego>",
+	Short: "Upload a Rego policy to KBS",
+	Long: `Upload a Rego policy to a Key Broker Service (KBS) instance, replacing the
+current policy of the selected type.
+
+The in-cluster KBS deployed by 'kbs start' reads its resource policy from the
+resource-policy ConfigMap, so a resource policy is stored there and the command
+waits until the KBS has loaded it.
+
+Examples:
+  kubectl coco kbs policy set attestation-policy.rego
+  kubectl coco kbs policy set --policy-id tdx tdx-policy.rego
+  kubectl coco kbs policy set --type resource resource-policy.rego`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPolicySet,
+}
+
+var policyGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Print the current KBS policy",
+	Long: `Print the Rego policy of the selected type currently used by a Key Broker
+Service (KBS) instance.
+
+Examples:
+  kubectl coco kbs policy get
+  kubectl coco kbs policy get --type resource -o resource-policy.rego`,
+	Args: cobra.NoArgs,
+	RunE: runPolicyGet,
+}
+
+var (
+	policyConn      kbsConnection
+	policyType      string
+	policyID        string
+	policyGetOutput string
+)
+
+func init() {
+	for _, c := range []*cobra.Command{policySetCmd, policyGetCmd} {
+		addKBSConnectionFlags(c, &policyConn)
+		c.Flags().StringVar(&policyType, "type", policyTypeAttestation, "Policy type: attestation or resource")
+		c.Flags().StringVar(&policyID, "policy-id", kbsclient.DefaultAttestationPolicyID, "Attestation policy ID (attestation policies only)")
+	}
+	policyGetCmd.Flags().StringVarP(&policyGetOutput, "output", "o", "", "Write the policy to this file instead of stdout")
+
+	policyCmd.AddCommand(policySetCmd)
+	policyCmd.AddCommand(policyGetCmd)
+}
+
+// validatePolicyFlags checks the --type and --policy-id combination.
+func validatePolicyFlags(cmd *cobra.Command) error {
+	switch policyType {
+	case policyTypeAttestation:
+		return nil
+	case policyTypeResource:
+		if cmd.Flags().Changed("policy-id") {
+			return fmt.Errorf("--policy-id only applies to attestation policies")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid --type %q: must be %s or %s", policyType, policyTypeAttestation, policyTypeResource)
+	}
+}
+
+func runPolicySet(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	if err := validatePolicyFlags(cmd); err != nil {
+		return err
+	}
+
+	// #nosec G304 -- path provided by the user as an argument
+	policy, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read policy file %s: %w", args[0], err)
+	}
+	if len(policy) == 0 {
+		return fmt.Errorf("policy file %s is empty", args[0])
+	}
+
+	kbsClient, kbsNamespace, stopForward, err := connectKBS(ctx, &policyConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	if policyType == policyTypeResource {
+		if err := setResourcePolicy(ctx, kbsClient, kbsNamespace, policy); err != nil {
+			return fmt.Errorf("failed to set resource policy: %w", err)
+		}
+		fmt.Printf("  ✓ Resource policy updated from %s\n", args[0])
+		return nil
+	}
+
+	if err := kbsClient.SetAttestationPolicy(ctx, policyID, policy); err != nil {
+		return fmt.Errorf("failed to set attestation policy %s: %w", policyID, err)
+	}
+	fmt.Printf("  ✓ Attestation policy %s updated from %s\n", policyID, args[0])
+	return nil
+}
+
+// setResourcePolicy replaces the resource policy of the KBS connectKBS
+// connected to. The in-cluster KBS, found in kbsNamespace, reads its policy
+// from a read-only ConfigMap volume, so the ConfigMap is updated instead of
+// going through the admin API.
+func setResourcePolicy(ctx context.Context, kbsClient *kbsclient.Client, kbsNamespace string, policy []byte) error {
+	if kbsNamespace == "" {
+		return kbsClient.SetResourcePolicy(ctx, policy)
+	}
+	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return trustee.SetResourcePolicy(ctx, k8sClient.Clientset, kbsNamespace, kbsClient, policy)
+}
+
+func runPolicyGet(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	if err := validatePolicyFlags(cmd); err != nil {
+		return err
+	}
+
+	kbsClient, _, stopForward, err := connectKBS(ctx, &policyConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	var policy []byte
+	if policyType == policyTypeResource {
+		policy, err = kbsClient.GetResourcePolicy(ctx)
+	} else {
+		policy, err = kbsClient.GetAttestationPolicy(ctx, policyID)
+	}
+	if err != nil {
+		if kbsclient.IsNotFound(err) {
+			return fmt.Errorf("no %s policy found in KBS", policyType)
+		}
+		return fmt.Errorf("failed to get %s policy: %w", policyType, err)
+	}
+
+	if policyGetOutput == "" {
+		_, err = cmd.OutOrStdout().Write(policy)
+		return err
+	}
+	if err := os.WriteFile(policyGetOutput, policy, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", policyGetOutput, err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Saved %s policy to %s\n", policyType, policyGetOutput)
+	return nil
+}
@@ -0,0 +1,39 @@
+package kbs
+
+import "testing"
+
+func TestValidatePolicyFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       string
+		setID     bool
+		expectErr bool
+	}{
+		{"attestation", policyTypeAttestation, false, false},
+		{"attestation with id", policyTypeAttestation, true, false},
+		{"resource", policyTypeResource, false, false},
+		{"resource with id", policyTypeResource, true, true},
+		{"unknown type", "network", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() {
+				policyType = policyTypeAttestation
+				_ = policySetCmd.Flags().Set("policy-id", "default")
+				policySetCmd.Flags().Lookup("policy-id").Changed = false
+			})
+			policyType = tt.typ
+			if tt.setID {
+				if err := policySetCmd.Flags().Set("policy-id", "tdx"); err != nil {
+					t.Fatalf("failed to set --policy-id: %v", err)
+				}
+			}
+
+			err := validatePolicyFlags(policySetCmd)
+			if (err != nil) != tt.expectErr {
+				t.Errorf("validatePolicyFlags() error = %v, expectErr %v", err, tt.expectErr)
+			}
+		})
+	}
+}
@@ -3,7 +3,6 @@ package kbs
 import (
 	"context"
 	"fmt"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,6 +13,7 @@ import (
 
 	"github.com/confidential-devhub/cococtl/pkg/k8s"
 	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 	"github.com/confidential-devhub/cococtl/pkg/sealed"
 	"github.com/confidential-devhub/cococtl/pkg/secrets"
 	"github.com/confidential-devhub/cococtl/pkg/trustee"
@@ -132,93 +132,26 @@ func resolveInputMode() (string, error) {
 		if populateResourceFile == "" {
 			return "", fmt.Errorf("--resource-file is required when --path is specified")
 		}
+		if _, err := kbsuri.ParsePath(populateKBSPath); err != nil {
+			return "", fmt.Errorf("invalid --path: %w", err)
+		}
 	}
 
 	return mode, nil
 }
 
-// createPopulateKBSClient builds a kbsclient.Client using the following URL resolution:
-//
-//  1. --kbs-url flag: connect directly to that URL
-//  2. config TrusteeServer (non-cluster URL): connect directly (set by 'kbs start --mode external')
-//  3. otherwise: port-forward to the in-cluster KBS pod
-//
-// Auth resolution: --auth-key > --auth-dir > config KBSAuthDir > default dir.
+// createPopulateKBSClient builds a kbsclient.Client from the populate flags.
+// See connectKBS for the URL and auth resolution order.
 // The caller must invoke the returned stop function when done.
 func createPopulateKBSClient(ctx context.Context) (*kbsclient.Client, func(), error) {
-	noop := func() {}
-
-	// directConnect builds a client for a known URL (--kbs-url or config TrusteeServer).
-	// --tls-ca is honoured here; it is irrelevant for port-forward mode (plain HTTP tunnel).
-	directConnect := func(kbsURL string) (*kbsclient.Client, func(), error) {
-		pemData, err := loadPrivateKeyPEM(populateAuthKey, populateAuthDir)
-		if err != nil {
-			return nil, noop, err
-		}
-		var caCert []byte
-		if populateTLSCA != "" {
-			// #nosec G304 -- path provided by the user via flag
-			caCert, err = os.ReadFile(populateTLSCA)
-			if err != nil {
-				return nil, noop, fmt.Errorf("failed to read TLS CA from %s: %w", populateTLSCA, err)
-			}
-		}
-		client, err := kbsclient.NewFromPEM(kbsURL, pemData, caCert)
-		if err != nil {
-			return nil, noop, fmt.Errorf("failed to create KBS client: %w", err)
-		}
-		return client, noop, nil
-	}
-
-	if populateKBSURL != "" {
-		return directConnect(populateKBSURL)
-	}
-
-	// If config holds a non-cluster TrusteeServer URL (written by 'kbs start --mode external'),
-	// use it directly without a port-forward. Validate the URL before using it so that a
-	// manually edited or otherwise malformed config does not produce confusing HTTP errors.
-	if cfg, err := loadCocoConfig(); err == nil && cfg.TrusteeServer != "" && !isTrusteeServerInCluster(cfg.TrusteeServer) {
-		u, err := url.Parse(cfg.TrusteeServer)
-		if err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Hostname() != "" {
-			return directConnect(cfg.TrusteeServer)
-		}
-	}
-
-	// Port-forward mode: determine the namespace where KBS is deployed.
-	kbsNamespace, err := resolveKBSNamespace()
-	if err != nil {
-		return nil, noop, err
-	}
-
-	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
-	if err != nil {
-		return nil, noop, fmt.Errorf("failed to create Kubernetes client: %w", err)
-	}
-
-	if populateAuthKey != "" {
-		// --auth-key explicitly provided: load from that file and use it for the connection
-		// so the flag is honoured rather than silently falling back to the auth directory.
-		pemData, err := loadPrivateKeyPEM(populateAuthKey, "")
-		if err != nil {
-			return nil, noop, err
-		}
-		client, stop, err := trustee.NewClientWithPortForwardFromPEM(ctx, k8sClient.Config, k8sClient.Clientset, kbsNamespace, pemData)
-		if err != nil {
-			return nil, noop, fmt.Errorf("failed to connect to KBS via port-forward (namespace: %s): %w", kbsNamespace, err)
-		}
-		return client, stop, nil
-	}
-
-	// No --auth-key: resolve auth dir from --auth-dir, config, or the default location.
-	authDir, err := resolveAuthDir(populateAuthDir)
-	if err != nil {
-		return nil, noop, err
-	}
-	client, stop, err := trustee.NewClientWithPortForward(ctx, k8sClient.Config, k8sClient.Clientset, kbsNamespace, authDir)
-	if err != nil {
-		return nil, noop, fmt.Errorf("failed to connect to KBS via port-forward (namespace: %s): %w", kbsNamespace, err)
-	}
-	return client, stop, nil
+	client, _, stop, err := connectKBS(ctx, &kbsConnection{
+		kbsURL:    populateKBSURL,
+		authDir:   populateAuthDir,
+		authKey:   populateAuthKey,
+		tlsCA:     populateTLSCA,
+		namespace: populateNamespace,
+	})
+	return client, stop, err
 }
 
 // loadPrivateKeyPEM returns the PEM bytes for the Ed25519 private key.
@@ -280,9 +213,9 @@ func isTrusteeServerInCluster(serverURL string) bool {
 
 // resolveKBSNamespace returns the namespace where the KBS pod is deployed.
 // Priority: --namespace flag > config TrusteeServer-derived namespace > current context namespace.
-func resolveKBSNamespace() (string, error) {
-	if populateNamespace != "" {
-		return populateNamespace, nil
+func resolveKBSNamespace(namespaceFlag string) (string, error) {
+	if namespaceFlag != "" {
+		return namespaceFlag, nil
 	}
 
 	// Try to derive the namespace from config's TrusteeServer URL, but only when
@@ -376,12 +309,15 @@ func populateOneFromTrusteeEntry(ctx context.Context, kbsClient *kbsclient.Clien
 			kbsKey, ns, secretName, joinKeys(k8sSecret.Data))
 	}
 
-	// Build KBS path from URI components (strip the kbs:/// prefix)
-	kbsPath := ns + "/" + secretName + "/" + kbsKey
+	// Build KBS path from URI components (the host, if any, is not part of the path)
+	uri, err := kbsuri.New(ns, secretName, kbsKey)
+	if err != nil {
+		return fmt.Errorf("invalid resource URI %q: %w", entry.ResourceURI, err)
+	}
 
-	fmt.Printf("  Uploading %s -> kbs:///%s\n", entry.ResourceURI, kbsPath)
-	if err := kbsClient.SetResource(ctx, kbsPath, value); err != nil {
-		return fmt.Errorf("failed to upload %s to KBS: %w", kbsPath, err)
+	fmt.Printf("  Uploading %s -> %s\n", entry.ResourceURI, uri)
+	if err := kbsClient.SetResource(ctx, uri.Path(), value); err != nil {
+		return fmt.Errorf("failed to upload %s to KBS: %w", uri.Path(), err)
 	}
 	return nil
 }
@@ -449,9 +385,12 @@ func uploadFromK8sSecret(ctx context.Context, kbsClient *kbsclient.Client, secre
 			value = converted
 		}
 
-		kbsPath := ns + "/" + secretName + "/" + kbsKey
-		fmt.Printf("  Uploading key %q -> kbs:///%s\n", key, kbsPath)
-		if err := kbsClient.SetResource(ctx, kbsPath, value); err != nil {
+		uri, err := kbsuri.New(ns, secretName, kbsKey)
+		if err != nil {
+			return fmt.Errorf("cannot upload key %q from secret %s/%s: %w", key, ns, secretName, err)
+		}
+		fmt.Printf("  Uploading key %q -> %s\n", key, uri)
+		if err := kbsClient.SetResource(ctx, uri.Path(), value); err != nil {
 			return fmt.Errorf("failed to upload key %q from secret %s/%s to KBS: %w", key, ns, secretName, err)
 		}
 	}
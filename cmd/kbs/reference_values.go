@@ -0,0 +1,103 @@
+package kbs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var referenceValuesCmd = &cobra.Command{
+	Use:     "reference-values",
+	Aliases: []string{"rv"},
+	Short:   "Manage reference values used for attestation",
+	Long: `Manage the reference values registered with the reference value provider
+service (RVPS) behind a Key Broker Service (KBS) instance. Attestation policies
+compare TEE evidence, such as launch measurements or the initdata digest,
+against these values.
+
+Available subcommands:
+  add  Register a reference value
+  ls   List registered reference values`,
+}
+
+var referenceValuesAddCmd = &cobra.Command{
+	Use:   "add <name> <value>...",
+	Short: "Register a reference value",
+	Long: `Register one or more accepted values under a reference value name.
+Registering a name again replaces its values.
+
+Examples:
+  kubectl coco kbs reference-values add init_data 3b0a1c...e4
+  kubectl coco kbs reference-values add mr_td 1a2b... 3c4d...`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runReferenceValuesAdd,
+}
+
+var referenceValuesLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List registered reference values",
+	Long: `List the reference values registered with the RVPS.
+
+Examples:
+  kubectl coco kbs reference-values ls
+  kubectl coco kbs reference-values ls --kbs-url https://kbs.example.com:8080 --tls-ca ca.pem`,
+	Args: cobra.NoArgs,
+	RunE: runReferenceValuesLs,
+}
+
+var referenceValuesConn kbsConnection
+
+func init() {
+	addKBSConnectionFlags(referenceValuesAddCmd, &referenceValuesConn)
+	addKBSConnectionFlags(referenceValuesLsCmd, &referenceValuesConn)
+
+	referenceValuesCmd.AddCommand(referenceValuesAddCmd)
+	referenceValuesCmd.AddCommand(referenceValuesLsCmd)
+}
+
+func runReferenceValuesAdd(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	name, values := args[0], args[1:]
+
+	kbsClient, _, stopForward, err := connectKBS(ctx, &referenceValuesConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	if err := kbsClient.RegisterReferenceValue(ctx, name, values); err != nil {
+		return fmt.Errorf("failed to register reference value %s: %w", name, err)
+	}
+	fmt.Printf("  ✓ Registered reference value %s (%d value(s))\n", name, len(values))
+	return nil
+}
+
+func runReferenceValuesLs(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+
+	kbsClient, _, stopForward, err := connectKBS(ctx, &referenceValuesConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	values, err := kbsClient.GetReferenceValues(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list reference values: %w", err)
+	}
+	if len(values) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No reference values registered")
+		return nil
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", name, values[name])
+	}
+	return nil
+}
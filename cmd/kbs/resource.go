@@ -0,0 +1,179 @@
+package kbs
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get <repository/type/tag>",
+	Short: "Read a resource from a KBS instance",
+	Long: `Read a resource from a Key Broker Service (KBS) instance.
+
+The resource is requested through the KBS admin HTTP API. KBS normally only
+releases resources to attested workloads, so when the API refuses the request
+and the KBS runs in-cluster, the resource is read from the KBS pod's local
+repository instead.
+
+The resource is written to stdout unless -o is given.
+
+Examples:
+  kubectl coco kbs get default/myapp/password
+  kubectl coco kbs get default/sidecar-tls/server-cert -o server-cert.pem
+  kubectl coco kbs get default/myapp/password --kbs-url https://kbs.example.com:8080 --tls-ca ca.pem`,
+	Args: cobra.ExactArgs(1),
+	RunE: runGet,
+}
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete <repository/type/tag>...",
+	Short: "Delete resources from a KBS instance",
+	Long: `Delete one or more resources from a Key Broker Service (KBS) instance via the
+KBS admin HTTP API.
+
+Examples:
+  kubectl coco kbs delete default/myapp/password
+  kubectl coco kbs delete default/sidecar-tls/server-cert default/sidecar-tls/server-key`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runDelete,
+}
+
+var lsCmd = &cobra.Command{
+	Use:   "ls [prefix]",
+	Short: "List resources stored in the in-cluster KBS",
+	Long: `List the resources stored in the in-cluster Key Broker Service (KBS).
+
+The KBS admin API has no listing endpoint, so the resource repository of the
+KBS pod is read directly. This only works for a KBS deployed with
+'kubectl coco kbs start' using the local filesystem backend; it is not
+available with --kbs-url or an external TrusteeServer.
+
+An optional prefix limits the output (e.g. "default/" or "default/myapp/").
+
+Examples:
+  kubectl coco kbs ls
+  kubectl coco kbs ls default/
+  kubectl coco kbs ls -n coco-trustee`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLs,
+}
+
+var (
+	getConn    kbsConnection
+	getOutput  string
+	deleteConn kbsConnection
+	lsConn     kbsConnection
+)
+
+func init() {
+	addKBSConnectionFlags(getCmd, &getConn)
+	getCmd.Flags().StringVarP(&getOutput, "output", "o", "", "Write the resource to this file instead of stdout")
+
+	addKBSConnectionFlags(deleteCmd, &deleteConn)
+
+	addKBSConnectionFlags(lsCmd, &lsConn)
+}
+
+func runGet(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	resourcePath := args[0]
+	if _, err := kbsuri.ParsePath(resourcePath); err != nil {
+		return err
+	}
+
+	kbsClient, kbsNamespace, stopForward, err := connectKBS(ctx, &getConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	data, err := kbsClient.GetResource(ctx, resourcePath)
+	if err != nil && kbsclient.IsUnauthorized(err) && kbsNamespace != "" {
+		// KBS only hands resources to attested clients; read the repository directly.
+		k8sClient, clientErr := k8s.NewClient(k8s.ClientOptions{})
+		if clientErr != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %w", clientErr)
+		}
+		data, err = trustee.ReadRepositoryResource(ctx, k8sClient.Clientset, kbsNamespace, resourcePath)
+	}
+	if err != nil {
+		if kbsclient.IsNotFound(err) {
+			return fmt.Errorf("resource %s not found in KBS", resourcePath)
+		}
+		if kbsclient.IsUnauthorized(err) {
+			return fmt.Errorf("KBS refused to return %s: %w\n\nKBS only releases resources to attested workloads when accessed via --kbs-url or an external TrusteeServer", resourcePath, err)
+		}
+		return fmt.Errorf("failed to get %s: %w", resourcePath, err)
+	}
+
+	if getOutput == "" {
+		_, err = cmd.OutOrStdout().Write(data)
+		return err
+	}
+	if err := os.WriteFile(getOutput, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", getOutput, err)
+	}
+	fmt.Fprintf(cmd.ErrOrStderr(), "Saved %s to %s (%d bytes)\n", resourcePath, getOutput, len(data))
+	return nil
+}
+
+func runDelete(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	for _, resourcePath := range args {
+		if _, err := kbsuri.ParsePath(resourcePath); err != nil {
+			return err
+		}
+	}
+
+	kbsClient, _, stopForward, err := connectKBS(ctx, &deleteConn)
+	if err != nil {
+		return err
+	}
+	defer stopForward()
+
+	for _, resourcePath := range args {
+		if err := kbsClient.DeleteResource(ctx, resourcePath); err != nil {
+			if kbsclient.IsNotFound(err) {
+				return fmt.Errorf("resource %s not found in KBS", resourcePath)
+			}
+			return fmt.Errorf("failed to delete %s: %w", resourcePath, err)
+		}
+		fmt.Printf("  ✓ Deleted %s\n", resourcePath)
+	}
+	return nil
+}
+
+func runLs(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	prefix := ""
+	if len(args) == 1 {
+		prefix = args[0]
+	}
+
+	kbsNamespace, err := inClusterKBSNamespace(&lsConn)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	paths, err := trustee.ListRepositoryResources(ctx, k8sClient.Clientset, kbsNamespace, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range paths {
+		fmt.Fprintln(cmd.OutOrStdout(), p)
+	}
+	return nil
+}
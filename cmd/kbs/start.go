@@ -1,17 +1,23 @@
 package kbs
 
 import (
+	"crypto/tls"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/fs"
 	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/confidential-devhub/cococtl/pkg/config"
 	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
 	"github.com/confidential-devhub/cococtl/pkg/trustee"
 )
 
@@ -23,6 +29,26 @@ var startCmd = &cobra.Command{
 --mode k8s       Deploy KBS to a Kubernetes cluster using the all-in-one Trustee image.
                  The admin private key is written to --auth-dir (default: ~/.kube/coco-kbs-auth).
                  Use 'kubectl coco kbs populate' afterwards to upload resources.
+                 With --tls the KBS serves HTTPS using a certificate issued by a
+                 CA kept in <auth-dir>/tls, or the one given with --tls-cert and
+                 --tls-key. The CA is saved as trustee_ca_cert in the config so
+                 that initdata embeds it.
+                 Resources and attestation state live in memory by default and
+                 are lost when the KBS pod restarts; --storage pvc keeps them on
+                 a PersistentVolumeClaim sized with --storage-size.
+                 With --resource-backend vault, resources are stored in the KV
+                 engine of the Vault server at --vault-addr instead. The KBS
+                 authenticates with the token in --vault-token-file (or
+                 $VAULT_TOKEN), or logs in with its service account via the
+                 Vault Kubernetes auth role given with --vault-k8s-role. The
+                 token must not expire: use a token without a TTL or a
+                 periodic one (a role with token_period), which the KBS pod
+                 keeps renewing.
+                 --overrides reads a YAML file that sets the resources,
+                 nodeSelector, tolerations and imagePullSecrets of the KBS pod
+                 and extra kbs-config.toml settings (kbsConfig). Overrides are
+                 applied when the KBS is deployed; to change them, run
+                 'kbs stop --keep-data' and start it again.
 
 --mode external  Register a pre-existing KBS instance. Writes --url and --auth-dir to
                  config so 'kbs populate' can connect without explicit flags.
@@ -30,6 +56,12 @@ var startCmd = &cobra.Command{
 
 Examples:
   kubectl coco kbs start --mode k8s --namespace coco-system
+  kubectl coco kbs start --mode k8s --tls
+  kubectl coco kbs start --mode k8s --storage pvc --storage-class standard --storage-size 5Gi
+  kubectl coco kbs start --mode k8s --resource-backend vault --vault-addr http://vault.vault:8200 --vault-token-file token
+  kubectl coco kbs start --mode k8s --resource-backend vault --vault-addr https://vault.example.com --vault-k8s-role kbs --vault-ca vault-ca.crt
+  kubectl coco kbs start --mode k8s --overrides kbs-overrides.yaml
+  kubectl coco kbs start --mode k8s --tls-cert kbs.crt --tls-key kbs.key --tls-ca ca.crt
   kubectl coco kbs start --mode external --url http://kbs.example.com:8080
   kubectl coco kbs start --mode external --url http://kbs.example.com:8080 --auth-dir ~/.kube/my-kbs-auth`,
 	RunE: runStart,
@@ -42,15 +74,43 @@ var (
 	startImage           string
 	startAuthDir         string
 	startURL             string
+	startTLS             bool
+	startTLSCert         string
+	startTLSKey          string
+	startTLSCA           string
+	startStorage         string
+	startStorageClass    string
+	startStorageSize     string
+	startVaultAddr       string
+	startVaultMount      string
+	startVaultTokenFile  string
+	startVaultK8sRole    string
+	startVaultK8sAuth    string
+	startVaultCA         string
+	startOverrides       string
 )
 
 func init() {
 	startCmd.Flags().StringVar(&startMode, "mode", "k8s", "KBS deployment mode: k8s, external")
-	startCmd.Flags().StringVar(&startResourceBackend, "resource-backend", "file", "Resource backend: file (default), vault (not yet implemented)")
+	startCmd.Flags().StringVar(&startResourceBackend, "resource-backend", "file", "Resource backend: file (default), vault")
 	startCmd.Flags().StringVar(&startNamespace, "namespace", "", "Kubernetes namespace for KBS deployment (default: current context namespace)")
 	startCmd.Flags().StringVar(&startImage, "image", "", "KBS container image (default: from config or built-in)")
 	startCmd.Flags().StringVar(&startAuthDir, "auth-dir", "", "Directory to store the KBS admin private key (default: ~/.kube/coco-kbs-auth)")
 	startCmd.Flags().StringVar(&startURL, "url", "", "URL of the external KBS instance (required for --mode external)")
+	startCmd.Flags().BoolVar(&startTLS, "tls", false, "Serve the in-cluster KBS over HTTPS with a generated certificate")
+	startCmd.Flags().StringVar(&startTLSCert, "tls-cert", "", "PEM serving certificate for the in-cluster KBS (implies --tls, requires --tls-key)")
+	startCmd.Flags().StringVar(&startTLSKey, "tls-key", "", "PEM private key of --tls-cert")
+	startCmd.Flags().StringVar(&startTLSCA, "tls-ca", "", "PEM CA certificate that issued --tls-cert, saved as trustee_ca_cert (omit for publicly trusted certificates)")
+	startCmd.Flags().StringVar(&startStorage, "storage", trustee.StorageMemory, "Storage for KBS resources and attestation state: memory, pvc")
+	startCmd.Flags().StringVar(&startStorageClass, "storage-class", "", "StorageClass of the KBS PVC (default: cluster default; requires --storage pvc)")
+	startCmd.Flags().StringVar(&startStorageSize, "storage-size", trustee.DefaultStorageSize, "Size of the KBS PVC (requires --storage pvc)")
+	startCmd.Flags().StringVar(&startVaultAddr, "vault-addr", "", "URL of the Vault server as reached from the KBS pod (required for --resource-backend vault)")
+	startCmd.Flags().StringVar(&startVaultMount, "vault-mount", trustee.DefaultVaultMount, "Mount path of the Vault KV secrets engine")
+	startCmd.Flags().StringVar(&startVaultTokenFile, "vault-token-file", "", "File with the Vault token of the KBS (default: $VAULT_TOKEN)")
+	startCmd.Flags().StringVar(&startVaultK8sRole, "vault-k8s-role", "", "Vault Kubernetes auth role the KBS logs in as, instead of a token")
+	startCmd.Flags().StringVar(&startVaultK8sAuth, "vault-k8s-auth-path", trustee.DefaultVaultK8sAuthPath, "Mount path of the Vault Kubernetes auth method")
+	startCmd.Flags().StringVar(&startVaultCA, "vault-ca", "", "PEM CA certificate that issued the Vault serving certificate")
+	startCmd.Flags().StringVar(&startOverrides, "overrides", "", "YAML file customizing the KBS deployment (resources, nodeSelector, tolerations, imagePullSecrets, kbsConfig)")
 }
 
 func runStart(cmd *cobra.Command, _ []string) error {
@@ -80,13 +140,38 @@ func checkKubectl() error {
 }
 
 func runStartK8s(cmd *cobra.Command) error {
-	if startResourceBackend == "vault" {
-		return fmt.Errorf("--resource-backend vault is not yet implemented")
-	}
-	if startResourceBackend != "file" {
+	var vaultCfg *trustee.VaultConfig
+	switch startResourceBackend {
+	case trustee.ResourceBackendFile:
+		if startVaultAddr != "" || startVaultTokenFile != "" || startVaultK8sRole != "" || startVaultCA != "" {
+			return fmt.Errorf("--vault-* flags require --resource-backend vault")
+		}
+	case trustee.ResourceBackendVault:
+		var err error
+		if vaultCfg, err = buildVaultConfig(); err != nil {
+			return err
+		}
+	default:
 		return fmt.Errorf("unknown --resource-backend %q: supported values are: file, vault", startResourceBackend)
 	}
 
+	if (startTLSKey != "" || startTLSCA != "") && startTLSCert == "" {
+		return fmt.Errorf("--tls-key and --tls-ca require --tls-cert")
+	}
+	if startTLSCert != "" && startTLSKey == "" {
+		return fmt.Errorf("--tls-cert requires --tls-key")
+	}
+	if err := validateStorageFlags(cmd); err != nil {
+		return err
+	}
+	var overrides *trustee.Overrides
+	if startOverrides != "" {
+		var err error
+		if overrides, err = trustee.LoadOverrides(startOverrides); err != nil {
+			return err
+		}
+	}
+
 	if err := checkKubectl(); err != nil {
 		return err
 	}
@@ -144,17 +229,39 @@ func runStartK8s(cmd *cobra.Command) error {
 		return fmt.Errorf("failed to check KBS deployment status: %w", err)
 	}
 	if deployed {
-		kbsURL := trustee.GetServiceURL(namespace, "trustee-kbs")
+		servingTLS, err := trustee.GetServingTLS(ctx, k8sClient.Clientset, namespace)
+		if err != nil {
+			return err
+		}
+		kbsURL := trustee.GetServiceURL(namespace, "trustee-kbs", servingTLS != nil)
 		fmt.Printf("KBS is already deployed in namespace '%s'\n", namespace)
 		fmt.Printf("KBS URL: %s\n", kbsURL)
+		if overrides != nil {
+			fmt.Fprintf(os.Stderr, "Warning: --overrides not applied to the running KBS; run 'kubectl coco kbs stop --keep-data' first to redeploy with them\n")
+		}
+		var caPath string
+		if servingTLS != nil && len(servingTLS.CACertPEM) > 0 {
+			if caPath, err = trustee.SaveCACert(authDir, servingTLS.CACertPEM); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
 		// Persist so that subsequent 'kbs populate' calls can derive namespace/auth-dir
 		// from config without explicit flags, even when no fresh deploy happened.
-		if err := persistStartConfig(cfg, kbsURL, authDir); err != nil {
+		if err := persistStartConfig(cfg, kbsURL, authDir, caPath); err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 		}
 		return nil
 	}
 
+	var tlsCfg *trustee.TLSConfig
+	var caPath string
+	if startTLS || startTLSCert != "" {
+		tlsCfg, caPath, err = prepareKBSTLS(authDir, namespace, "trustee-kbs")
+		if err != nil {
+			return err
+		}
+	}
+
 	fmt.Printf("Deploying KBS to namespace '%s'...\n", namespace)
 
 	trusteeCfg := &trustee.Config{
@@ -164,20 +271,31 @@ func runStartK8s(cmd *cobra.Command) error {
 		PCCSURL:     pccsURL,
 		RESTConfig:  k8sClient.Config,
 		AuthDir:     authDir,
+		TLS:         tlsCfg,
+		Storage:     startStorage,
+		Vault:       vaultCfg,
+		Overrides:   overrides,
+	}
+	if startStorage == trustee.StoragePVC {
+		trusteeCfg.StorageClass = startStorageClass
+		trusteeCfg.StorageSize = startStorageSize
 	}
 
 	if err := trustee.Deploy(ctx, k8sClient.Clientset, trusteeCfg); err != nil {
 		return fmt.Errorf("failed to deploy KBS: %w", err)
 	}
 
-	kbsURL := trustee.GetServiceURL(namespace, "trustee-kbs")
-	if err := persistStartConfig(cfg, kbsURL, trusteeCfg.AuthDir); err != nil {
+	kbsURL := trustee.GetServiceURL(namespace, "trustee-kbs", tlsCfg != nil)
+	if err := persistStartConfig(cfg, kbsURL, trusteeCfg.AuthDir, caPath); err != nil {
 		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
 	}
 
 	fmt.Printf("KBS deployed successfully\n")
 	fmt.Printf("KBS URL: %s\n", kbsURL)
 	fmt.Printf("Auth dir: %s\n", trusteeCfg.AuthDir)
+	if caPath != "" {
+		fmt.Printf("CA certificate: %s\n", caPath)
+	}
 	fmt.Println()
 	fmt.Println("To upload resources to KBS:")
 	fmt.Printf("  kubectl coco kbs populate -f <secrets.yaml>\n")
@@ -185,7 +303,9 @@ func runStartK8s(cmd *cobra.Command) error {
 	return nil
 }
 
-func persistStartConfig(cfg *config.CocoConfig, kbsURL, authDir string) error {
+// persistStartConfig saves the KBS URL, auth dir and, when non-empty, the CA
+// certificate path that verifies the KBS to the CoCo config.
+func persistStartConfig(cfg *config.CocoConfig, kbsURL, authDir, caCertPath string) error {
 	if cfg == nil {
 		cfg = config.DefaultConfig()
 	}
@@ -193,6 +313,9 @@ func persistStartConfig(cfg *config.CocoConfig, kbsURL, authDir string) error {
 	if authDir != "" {
 		cfg.KBSAuthDir = authDir
 	}
+	if caCertPath != "" {
+		cfg.TrusteeCACert = caCertPath
+	}
 	configPath, err := config.GetConfigPath()
 	if err != nil {
 		return fmt.Errorf("failed to determine config path: %w", err)
@@ -224,7 +347,7 @@ func runStartExternal(_ *cobra.Command) error {
 		fmt.Fprintf(os.Stderr, "Warning: failed to load config file: %v\n", configErr)
 	}
 
-	if err := persistStartConfig(cfg, startURL, startAuthDir); err != nil {
+	if err := persistStartConfig(cfg, startURL, startAuthDir, ""); err != nil {
 		return err
 	}
 
@@ -261,3 +384,157 @@ func loadCocoConfig() (*config.CocoConfig, error) {
 	}
 	return cfg, nil
 }
+
+// prepareKBSTLS returns the serving certificate for an HTTPS KBS and the path
+// of the CA certificate clients should trust, or an empty path when the
+// certificate given with --tls-cert is publicly trusted.
+//
+// Without --tls-cert, the certificate is issued by a CA kept in <authDir>/tls,
+// which is created on first use and reused afterwards so that initdata
+// embedding the CA stays valid across redeployments.
+func prepareKBSTLS(authDir, namespace, serviceName string) (*trustee.TLSConfig, string, error) {
+	resolvedAuthDir, err := trustee.DefaultAuthDir(authDir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve auth directory: %w", err)
+	}
+
+	if startTLSCert != "" {
+		// #nosec G304 -- path provided by the user via flag
+		certPEM, err := os.ReadFile(startTLSCert)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read --tls-cert: %w", err)
+		}
+		// #nosec G304 -- path provided by the user via flag
+		keyPEM, err := os.ReadFile(startTLSKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read --tls-key: %w", err)
+		}
+		if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+			return nil, "", fmt.Errorf("--tls-cert and --tls-key do not form a valid key pair: %w", err)
+		}
+		tlsCfg := &trustee.TLSConfig{CertPEM: certPEM, KeyPEM: keyPEM}
+		if startTLSCA == "" {
+			return tlsCfg, "", nil
+		}
+		// #nosec G304 -- path provided by the user via flag
+		tlsCfg.CACertPEM, err = os.ReadFile(startTLSCA)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read --tls-ca: %w", err)
+		}
+		caPath, err := filepath.Abs(startTLSCA)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to resolve --tls-ca path: %w", err)
+		}
+		return tlsCfg, caPath, nil
+	}
+
+	tlsDir := filepath.Join(resolvedAuthDir, "tls")
+	caCertPath := filepath.Join(tlsDir, "ca-cert.pem")
+	ca, err := loadCertificateSet(caCertPath, filepath.Join(tlsDir, "ca-key.pem"))
+	if err != nil {
+		return nil, "", err
+	}
+	if ca == nil {
+		fmt.Printf("Generating KBS CA in %s\n", tlsDir)
+		ca, err = certs.GenerateCA("CoCo Trustee CA")
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to generate KBS CA: %w", err)
+		}
+		if err := ca.SaveToFile(tlsDir, "ca"); err != nil {
+			return nil, "", fmt.Errorf("failed to save KBS CA: %w", err)
+		}
+	}
+	tlsCfg, err := trustee.GenerateTLS(ca, namespace, serviceName)
+	if err != nil {
+		return nil, "", err
+	}
+	return tlsCfg, caCertPath, nil
+}
+
+// loadCertificateSet reads a PEM certificate and key, returning nil when
+// neither file exists.
+func loadCertificateSet(certPath, keyPath string) (*certs.CertificateSet, error) {
+	// #nosec G304 -- path is under the resolved auth directory
+	certPEM, certErr := os.ReadFile(certPath)
+	// #nosec G304 -- path is under the resolved auth directory
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	switch {
+	case errors.Is(certErr, fs.ErrNotExist) && errors.Is(keyErr, fs.ErrNotExist):
+		return nil, nil
+	case certErr != nil:
+		return nil, fmt.Errorf("failed to read %s: %w", certPath, certErr)
+	case keyErr != nil:
+		return nil, fmt.Errorf("failed to read %s: %w", keyPath, keyErr)
+	}
+	return &certs.CertificateSet{CertPEM: certPEM, KeyPEM: keyPEM}, nil
+}
+
+// buildVaultConfig builds the Vault resource backend settings from the
+// --vault-* flags. The token comes from --vault-token-file or $VAULT_TOKEN
+// unless --vault-k8s-role selects Kubernetes auth.
+func buildVaultConfig() (*trustee.VaultConfig, error) {
+	if startVaultAddr == "" {
+		return nil, fmt.Errorf("--resource-backend vault requires --vault-addr")
+	}
+	vaultCfg := &trustee.VaultConfig{
+		Address:     startVaultAddr,
+		MountPath:   startVaultMount,
+		K8sRole:     startVaultK8sRole,
+		K8sAuthPath: startVaultK8sAuth,
+	}
+
+	switch {
+	case startVaultK8sRole != "" && startVaultTokenFile != "":
+		return nil, fmt.Errorf("--vault-token-file and --vault-k8s-role are mutually exclusive")
+	case startVaultTokenFile != "":
+		// #nosec G304 -- path is a user-supplied CLI flag
+		token, err := os.ReadFile(startVaultTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --vault-token-file: %w", err)
+		}
+		vaultCfg.Token = strings.TrimSpace(string(token))
+		if vaultCfg.Token == "" {
+			return nil, fmt.Errorf("--vault-token-file %s is empty", startVaultTokenFile)
+		}
+	case startVaultK8sRole == "":
+		vaultCfg.Token = os.Getenv("VAULT_TOKEN")
+		if vaultCfg.Token == "" {
+			return nil, fmt.Errorf("--resource-backend vault requires --vault-token-file, $VAULT_TOKEN or --vault-k8s-role")
+		}
+	}
+
+	if startVaultCA != "" {
+		// #nosec G304 -- path is a user-supplied CLI flag
+		caPEM, err := os.ReadFile(startVaultCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --vault-ca: %w", err)
+		}
+		if block, _ := pem.Decode(caPEM); block == nil || block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("--vault-ca %s: no PEM certificate found", startVaultCA)
+		}
+		vaultCfg.CACertPEM = caPEM
+	}
+
+	if err := vaultCfg.Validate(); err != nil {
+		return nil, err
+	}
+	return vaultCfg, nil
+}
+
+// validateStorageFlags checks --storage and that --storage-class and
+// --storage-size are only given together with --storage pvc.
+func validateStorageFlags(cmd *cobra.Command) error {
+	switch startStorage {
+	case trustee.StorageMemory:
+		if startStorageClass != "" || (cmd != nil && cmd.Flags().Changed("storage-size")) {
+			return fmt.Errorf("--storage-class and --storage-size require --storage pvc")
+		}
+	case trustee.StoragePVC:
+		if _, err := resource.ParseQuantity(startStorageSize); err != nil {
+			return fmt.Errorf("invalid --storage-size %q: %w", startStorageSize, err)
+		}
+	default:
+		return fmt.Errorf("unknown --storage %q: supported values are: memory, pvc", startStorage)
+	}
+	return nil
+}
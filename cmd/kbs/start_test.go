@@ -1,6 +1,8 @@
 package kbs
 
 import (
+	"bytes"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -8,6 +10,8 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
 )
 
 func newTestCmd() *cobra.Command {
@@ -129,3 +133,206 @@ func TestRunStartExternal_ErrorWhenURLHasSchemeButEmptyHost(t *testing.T) {
 		t.Errorf("error %q should mention http/https", err.Error())
 	}
 }
+
+func TestRunStartK8s_TLSFlagValidation(t *testing.T) {
+	withHome(t)
+	defer func() { startTLSCert = ""; startTLSKey = ""; startTLSCA = "" }()
+
+	for _, tt := range []struct{ cert, key, ca, want string }{
+		{"", "kbs.key", "", "require --tls-cert"},
+		{"", "", "ca.crt", "require --tls-cert"},
+		{"kbs.crt", "", "", "requires --tls-key"},
+	} {
+		startTLSCert, startTLSKey, startTLSCA = tt.cert, tt.key, tt.ca
+		err := runStartK8s(newTestCmd())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runStartK8s(cert=%q key=%q ca=%q) error = %v, want %q", tt.cert, tt.key, tt.ca, err, tt.want)
+		}
+	}
+}
+
+func TestPrepareKBSTLS_GeneratesAndReusesCA(t *testing.T) {
+	home := withHome(t)
+	authDir := filepath.Join(home, "auth")
+
+	tlsCfg, caPath, err := prepareKBSTLS(authDir, "coco", "trustee-kbs")
+	if err != nil {
+		t.Fatalf("prepareKBSTLS() error = %v", err)
+	}
+	if caPath != filepath.Join(authDir, "tls", "ca-cert.pem") {
+		t.Errorf("CA path = %q", caPath)
+	}
+	savedCA, err := os.ReadFile(caPath)
+	if err != nil || !bytes.Equal(savedCA, tlsCfg.CACertPEM) {
+		t.Fatalf("saved CA does not match the issuing CA (err %v)", err)
+	}
+
+	again, _, err := prepareKBSTLS(authDir, "coco", "trustee-kbs")
+	if err != nil {
+		t.Fatalf("second prepareKBSTLS() error = %v", err)
+	}
+	if !bytes.Equal(again.CACertPEM, tlsCfg.CACertPEM) {
+		t.Error("second prepareKBSTLS() generated a new CA instead of reusing the saved one")
+	}
+}
+
+func TestPrepareKBSTLS_ProvidedCertificate(t *testing.T) {
+	home := withHome(t)
+	defer func() { startTLSCert = ""; startTLSKey = ""; startTLSCA = "" }()
+
+	ca, err := certs.GenerateCA("test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := certs.GenerateServerCert(ca.CertPEM, ca.KeyPEM, "kbs", certs.SANs{DNSNames: []string{"kbs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.SaveToFile(home, "kbs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.SaveToFile(home, "ca"); err != nil {
+		t.Fatal(err)
+	}
+	startTLSCert = filepath.Join(home, "kbs-cert.pem")
+	startTLSKey = filepath.Join(home, "kbs-key.pem")
+	startTLSCA = filepath.Join(home, "ca-cert.pem")
+
+	tlsCfg, caPath, err := prepareKBSTLS("", "coco", "trustee-kbs")
+	if err != nil {
+		t.Fatalf("prepareKBSTLS() error = %v", err)
+	}
+	if caPath != startTLSCA || !bytes.Equal(tlsCfg.CertPEM, server.CertPEM) || !bytes.Equal(tlsCfg.CACertPEM, ca.CertPEM) {
+		t.Errorf("prepareKBSTLS() = CA path %q, want provided files", caPath)
+	}
+
+	startTLSKey = filepath.Join(home, "ca-key.pem")
+	if _, _, err := prepareKBSTLS("", "coco", "trustee-kbs"); err == nil || !strings.Contains(err.Error(), "valid key pair") {
+		t.Errorf("prepareKBSTLS() with mismatched key error = %v", err)
+	}
+}
+
+func TestPersistStartConfig_SetsTrusteeCACert(t *testing.T) {
+	home := withHome(t)
+	if err := persistStartConfig(nil, "https://trustee-kbs.coco.svc.cluster.local:8080", "", "/tmp/ca-cert.pem"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(filepath.Join(home, ".kube", "coco-config.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TrusteeCACert != "/tmp/ca-cert.pem" || !strings.HasPrefix(cfg.TrusteeServer, "https://") {
+		t.Errorf("config = trustee_server %q, trustee_ca_cert %q", cfg.TrusteeServer, cfg.TrusteeCACert)
+	}
+}
+
+func TestRunStartK8s_StorageFlagValidation(t *testing.T) {
+	withHome(t)
+	defer func() {
+		startStorage, startStorageClass, startStorageSize = trustee.StorageMemory, "", trustee.DefaultStorageSize
+	}()
+
+	for _, tt := range []struct{ storage, class, size, want string }{
+		{"disk", "", trustee.DefaultStorageSize, "unknown --storage"},
+		{trustee.StorageMemory, "standard", trustee.DefaultStorageSize, "require --storage pvc"},
+		{trustee.StoragePVC, "", "lots", "invalid --storage-size"},
+	} {
+		startStorage, startStorageClass, startStorageSize = tt.storage, tt.class, tt.size
+		err := runStartK8s(newTestCmd())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runStartK8s(storage=%q class=%q size=%q) error = %v, want %q", tt.storage, tt.class, tt.size, err, tt.want)
+		}
+	}
+}
+
+func TestRunStartK8s_VaultFlagValidation(t *testing.T) {
+	home := withHome(t)
+	t.Setenv("VAULT_TOKEN", "")
+	defer func() {
+		startResourceBackend, startVaultAddr, startVaultTokenFile, startVaultK8sRole, startVaultCA = trustee.ResourceBackendFile, "", "", "", ""
+	}()
+	emptyToken := filepath.Join(home, "empty-token")
+	if err := os.WriteFile(emptyToken, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct{ backend, addr, tokenFile, role, want string }{
+		{"s3", "", "", "", "unknown --resource-backend"},
+		{trustee.ResourceBackendFile, "http://vault:8200", "", "", "require --resource-backend vault"},
+		{trustee.ResourceBackendVault, "", "", "kbs", "requires --vault-addr"},
+		{trustee.ResourceBackendVault, "http://vault:8200", "", "", "requires --vault-token-file"},
+		{trustee.ResourceBackendVault, "http://vault:8200", emptyToken, "", "is empty"},
+		{trustee.ResourceBackendVault, "http://vault:8200", emptyToken, "kbs", "mutually exclusive"},
+		{trustee.ResourceBackendVault, "vault:8200", "", "kbs", "invalid Vault address"},
+	} {
+		startResourceBackend, startVaultAddr, startVaultTokenFile, startVaultK8sRole = tt.backend, tt.addr, tt.tokenFile, tt.role
+		err := runStartK8s(newTestCmd())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runStartK8s(backend=%q addr=%q token-file=%q role=%q) error = %v, want %q", tt.backend, tt.addr, tt.tokenFile, tt.role, err, tt.want)
+		}
+	}
+}
+
+func TestBuildVaultConfig(t *testing.T) {
+	home := withHome(t)
+	defer func() { startVaultAddr, startVaultTokenFile, startVaultCA = "", "", "" }()
+
+	tokenFile := filepath.Join(home, "token")
+	if err := os.WriteFile(tokenFile, []byte("hvs.file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := certs.GenerateCA("vault CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ca.SaveToFile(home, "vault"); err != nil {
+		t.Fatal(err)
+	}
+
+	startVaultAddr = "https://vault.example.com"
+	startVaultTokenFile = tokenFile
+	startVaultCA = filepath.Join(home, "vault-cert.pem")
+	vaultCfg, err := buildVaultConfig()
+	if err != nil {
+		t.Fatalf("buildVaultConfig() error = %v", err)
+	}
+	if vaultCfg.Token != "hvs.file" || vaultCfg.MountPath != trustee.DefaultVaultMount || !bytes.Equal(vaultCfg.CACertPEM, ca.CertPEM) {
+		t.Errorf("buildVaultConfig() = %+v", vaultCfg)
+	}
+
+	startVaultTokenFile, startVaultCA = "", ""
+	t.Setenv("VAULT_TOKEN", "hvs.env")
+	if vaultCfg, err = buildVaultConfig(); err != nil || vaultCfg.Token != "hvs.env" {
+		t.Errorf("buildVaultConfig() from $VAULT_TOKEN = %+v, %v", vaultCfg, err)
+	}
+
+	startVaultCA = tokenFile
+	if _, err := buildVaultConfig(); err == nil || !strings.Contains(err.Error(), "no PEM certificate") {
+		t.Errorf("buildVaultConfig() with non-PEM --vault-ca error = %v", err)
+	}
+}
+
+func TestRunStartK8s_OverridesValidation(t *testing.T) {
+	home := withHome(t)
+	defer func() { startOverrides = "" }()
+
+	for _, tt := range []struct{ content, want string }{
+		{"replicas: 2\n", "unknown field"},
+		{"kbsConfig: |\n  [http_server]\n  insecure_http = true\n", "cannot set http_server.insecure_http"},
+	} {
+		path := filepath.Join(home, "overrides.yaml")
+		if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		startOverrides = path
+		err := runStartK8s(newTestCmd())
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("runStartK8s(overrides=%q) error = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+
+	startOverrides = filepath.Join(home, "missing.yaml")
+	if err := runStartK8s(newTestCmd()); err == nil || !strings.Contains(err.Error(), "failed to read overrides file") {
+		t.Errorf("runStartK8s() with missing overrides error = %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package kbs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+const (
+	// statusMaxLogErrors caps the KBS log errors printed per pod.
+	statusMaxLogErrors = 10
+
+	// statusLogLineWidth truncates long KBS log lines.
+	statusLogLineWidth = 200
+
+	// statusProbeTimeout bounds the TrusteeServer reachability check.
+	statusProbeTimeout = 5 * time.Second
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Report the health of the KBS",
+	Long: `Report the health of the Key Broker Service (KBS) / Trustee.
+
+For the in-cluster KBS, status shows the readiness of the Deployment and its
+pods, the KBS image, the resource backend and storage, whether the admin public
+key deployed to KBS matches the local private.key, and errors among the recent
+KBS log lines. Through the admin API it then shows the configured resource and
+attestation policies and the number of reference values. Finally it checks that
+the TrusteeServer in the config points to the deployed KBS or, for an external
+KBS, that it is reachable.
+
+The in-cluster checks are skipped when --kbs-url is given or the TrusteeServer
+in the config is an external KBS. The command fails when any check fails.
+
+Examples:
+  kubectl coco kbs status
+  kubectl coco kbs status -n coco-system
+  kubectl coco kbs status --log-lines 1000`,
+	Args: cobra.NoArgs,
+	RunE: runStatus,
+}
+
+var (
+	statusConn     kbsConnection
+	statusLogLines int64
+)
+
+func init() {
+	addKBSConnectionFlags(statusCmd, &statusConn)
+	statusCmd.Flags().Int64Var(&statusLogLines, "log-lines", 200, "Number of recent KBS log lines to scan for errors")
+}
+
+// statusReport prints the result of each status check and counts failures.
+type statusReport struct {
+	w      io.Writer
+	failed int
+}
+
+func (r *statusReport) section(title string) {
+	fmt.Fprintf(r.w, "\n%s\n", title)
+}
+
+func (r *statusReport) ok(format string, args ...any) {
+	fmt.Fprintf(r.w, "  ✓ %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *statusReport) warn(format string, args ...any) {
+	fmt.Fprintf(r.w, "  ⚠ %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *statusReport) fail(format string, args ...any) {
+	fmt.Fprintf(r.w, "  ✗ %s\n", fmt.Sprintf(format, args...))
+	r.failed++
+}
+
+func (r *statusReport) info(format string, args ...any) {
+	fmt.Fprintf(r.w, "    %s\n", fmt.Sprintf(format, args...))
+}
+
+func runStatus(cmd *cobra.Command, _ []string) error {
+	ctx := cmd.Context()
+	r := &statusReport{w: cmd.OutOrStdout()}
+
+	cfg, err := loadCocoConfig()
+	if err != nil && !errors.Is(err, errConfigNotFound) {
+		fmt.Fprintf(os.Stderr, "Warning: failed to load config file: %v\n", err)
+	}
+
+	var kbsStatus *trustee.Status
+	namespace, err := inClusterKBSNamespace(&statusConn)
+	if err != nil {
+		fmt.Fprintf(r.w, "In-cluster KBS: skipped (%v)\n", err)
+	} else {
+		k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create Kubernetes client: %w", err)
+		}
+		kbsStatus, err = reportDeployment(ctx, r, k8sClient.Clientset, namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	reportAdminAPI(ctx, r)
+	reportTrusteeServer(ctx, r, cfg, kbsStatus)
+
+	if r.failed > 0 {
+		return fmt.Errorf("%d KBS status check(s) failed", r.failed)
+	}
+	return nil
+}
+
+// reportDeployment reports the in-cluster KBS in namespace. It returns nil
+// when no KBS is deployed there.
+func reportDeployment(ctx context.Context, r *statusReport, clientset kubernetes.Interface, namespace string) (*trustee.Status, error) {
+	fmt.Fprintf(r.w, "In-cluster KBS (namespace %s)\n", namespace)
+
+	kbsStatus, err := trustee.GetStatus(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !kbsStatus.Deployed {
+		r.fail("No KBS deployment found (run 'kubectl coco kbs start')")
+		return nil, nil
+	}
+
+	if kbsStatus.ReadyReplicas >= kbsStatus.Replicas {
+		r.ok("Deployment: %d/%d replicas ready", kbsStatus.ReadyReplicas, kbsStatus.Replicas)
+	} else {
+		r.fail("Deployment: %d/%d replicas ready", kbsStatus.ReadyReplicas, kbsStatus.Replicas)
+	}
+	for _, pod := range kbsStatus.Pods {
+		if pod.Ready {
+			r.ok("Pod %s: %s, ready, %d restart(s)", pod.Name, pod.Phase, pod.Restarts)
+		} else {
+			r.fail("Pod %s: %s, not ready, %d restart(s)", pod.Name, pod.Phase, pod.Restarts)
+		}
+	}
+
+	r.info("Image: %s", kbsStatus.Image)
+	for _, pod := range kbsStatus.Pods {
+		if pod.ImageID != "" {
+			r.info("Running image: %s", pod.ImageID)
+			break
+		}
+	}
+	r.info("Resource backend: %s", kbsStatus.ResourceBackend)
+	r.info("Storage: %s", kbsStatus.Storage)
+	if kbsStatus.TLS {
+		r.info("Serving: HTTPS")
+	} else {
+		r.info("Serving: HTTP")
+	}
+
+	reportAuthKey(r, kbsStatus.AuthKeyFingerprint)
+
+	for _, pod := range kbsStatus.Pods {
+		errorLines, err := trustee.RecentLogErrors(ctx, clientset, namespace, pod.Name, statusLogLines, statusMaxLogErrors)
+		switch {
+		case err != nil:
+			r.warn("Logs of %s: %v", pod.Name, err)
+		case len(errorLines) == 0:
+			r.ok("No errors in the last %d log lines of %s", statusLogLines, pod.Name)
+		default:
+			r.warn("Errors in the last %d log lines of %s:", statusLogLines, pod.Name)
+			for _, line := range errorLines {
+				if len(line) > statusLogLineWidth {
+					line = line[:statusLogLineWidth] + "…"
+				}
+				r.info("%s", line)
+			}
+		}
+	}
+
+	return kbsStatus, nil
+}
+
+// reportAuthKey compares the admin public key deployed to KBS with the local
+// private key that admin commands sign their tokens with.
+func reportAuthKey(r *statusReport, deployedFingerprint string) {
+	keyPath := statusConn.authKey
+	if keyPath == "" {
+		authDir, err := resolveAuthDir(statusConn.authDir)
+		if err != nil {
+			r.fail("Auth key: %v", err)
+			return
+		}
+		keyPath = filepath.Join(authDir, "private.key")
+	}
+	// #nosec G304 -- path provided by the user via flag or derived from the auth dir
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		r.fail("Auth key: cannot read local key: %v", err)
+		return
+	}
+	localFingerprint, err := trustee.KeyFingerprint(keyPEM)
+	if err != nil {
+		r.fail("Auth key: %s: %v", keyPath, err)
+		return
+	}
+
+	switch deployedFingerprint {
+	case "":
+		r.fail("Auth key: kbs-auth-public-key Secret not found")
+	case localFingerprint:
+		r.ok("Auth key: %s matches %s", deployedFingerprint, keyPath)
+	default:
+		r.fail("Auth key: deployed %s does not match %s (%s)", deployedFingerprint, keyPath, localFingerprint)
+	}
+}
+
+// reportAdminAPI reports the policies and reference values configured in KBS.
+func reportAdminAPI(ctx context.Context, r *statusReport) {
+	r.section("KBS admin API")
+
+	kbsClient, _, stopForward, err := connectKBS(ctx, &statusConn)
+	if err != nil {
+		r.fail("%v", err)
+		return
+	}
+	defer stopForward()
+
+	resourcePolicy, err := kbsClient.GetResourcePolicy(ctx)
+	switch {
+	case kbsclient.IsNotFound(err):
+		r.warn("Resource policy: not set")
+	case err != nil:
+		r.fail("Resource policy: %v", err)
+	default:
+		apps, allowAll := trustee.DescribeResourcePolicy(string(resourcePolicy))
+		if allowAll {
+			r.warn("Resource policy: releases every resource (default allow = true)")
+		} else {
+			r.ok("Resource policy: default deny")
+		}
+		if len(apps) > 0 {
+			r.info("Bound apps: %s", strings.Join(apps, ", "))
+		}
+	}
+
+	_, err = kbsClient.GetAttestationPolicy(ctx, kbsclient.DefaultAttestationPolicyID)
+	switch {
+	case kbsclient.IsNotFound(err):
+		r.warn("Attestation policy %s: not set, the attestation service uses its built-in policy", kbsclient.DefaultAttestationPolicyID)
+	case err != nil:
+		r.fail("Attestation policy %s: %v", kbsclient.DefaultAttestationPolicyID, err)
+	default:
+		r.ok("Attestation policy %s: set", kbsclient.DefaultAttestationPolicyID)
+	}
+
+	referenceValues, err := kbsClient.GetReferenceValues(ctx)
+	if err != nil {
+		r.fail("Reference values: %v", err)
+	} else {
+		r.ok("Reference values: %d registered", len(referenceValues))
+	}
+}
+
+// reportTrusteeServer checks the TrusteeServer in the config. An in-cluster
+// URL must match the Service of the deployed KBS; an external URL must answer
+// HTTP requests.
+func reportTrusteeServer(ctx context.Context, r *statusReport, cfg *config.CocoConfig, kbsStatus *trustee.Status) {
+	r.section("Config")
+
+	if cfg == nil || cfg.TrusteeServer == "" {
+		r.warn("TrusteeServer: not set in the config (run 'kubectl coco init' or 'kubectl coco kbs start')")
+		return
+	}
+
+	if isTrusteeServerInCluster(cfg.TrusteeServer) {
+		if kbsStatus == nil {
+			r.warn("TrusteeServer %s: in-cluster URL, no deployed KBS to compare with", cfg.TrusteeServer)
+			return
+		}
+		want := trustee.GetServiceURL(kbsStatus.Namespace, "trustee-kbs", kbsStatus.TLS)
+		if cfg.TrusteeServer == want {
+			r.ok("TrusteeServer %s: points to the deployed KBS", cfg.TrusteeServer)
+		} else {
+			r.fail("TrusteeServer %s: the deployed KBS is served at %s", cfg.TrusteeServer, want)
+		}
+		return
+	}
+
+	var caCert []byte
+	if cfg.TrusteeCACert != "" {
+		var err error
+		// #nosec G304 -- path from the user's config file
+		if caCert, err = os.ReadFile(cfg.TrusteeCACert); err != nil {
+			r.fail("TrusteeServer %s: failed to read trustee_ca_cert: %v", cfg.TrusteeServer, err)
+			return
+		}
+	}
+	statusCode, err := probeURL(ctx, cfg.TrusteeServer, caCert)
+	if err != nil {
+		r.fail("TrusteeServer %s: unreachable: %v", cfg.TrusteeServer, err)
+		return
+	}
+	r.ok("TrusteeServer %s: reachable (HTTP %d)", cfg.TrusteeServer, statusCode)
+}
+
+// probeURL sends a GET request to rawURL and returns the response status. Any
+// HTTP response counts as reachable. caCert, if set, is trusted in addition to
+// the system roots.
+func probeURL(ctx context.Context, rawURL string, caCert []byte) (int, error) {
+	dt, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		dt = &http.Transport{}
+	}
+	transport := dt.Clone()
+	if len(caCert) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return 0, fmt.Errorf("failed to parse CA certificate PEM")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, statusProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req) // #nosec G704 -- URL is the TrusteeServer from the user's config
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, nil
+}
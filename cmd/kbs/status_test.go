@@ -0,0 +1,95 @@
+package kbs
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+func TestReportAuthKey(t *testing.T) {
+	home := withHome(t)
+	defer func() { statusConn = kbsConnection{} }()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	statusConn.authDir = filepath.Join(home, "auth")
+	if err := os.MkdirAll(statusConn.authDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(statusConn.authDir, "private.key"), keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := trustee.KeyFingerprint(keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		deployed, want string
+		failed         int
+	}{
+		{fingerprint, "✓ Auth key: " + fingerprint + " matches", 0},
+		{"SHA256:other", "does not match", 1},
+		{"", "Secret not found", 1},
+	} {
+		var out bytes.Buffer
+		r := &statusReport{w: &out}
+		reportAuthKey(r, tt.deployed)
+		if !strings.Contains(out.String(), tt.want) || r.failed != tt.failed {
+			t.Errorf("reportAuthKey(%q) = %q (failed %d), want %q (failed %d)", tt.deployed, out.String(), r.failed, tt.want, tt.failed)
+		}
+	}
+}
+
+func TestReportTrusteeServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	deployed := &trustee.Status{Namespace: "coco", Deployed: true, TLS: true}
+	for _, tt := range []struct {
+		name      string
+		cfg       *config.CocoConfig
+		kbsStatus *trustee.Status
+		want      string
+		failed    int
+	}{
+		{"no config", nil, nil, "not set in the config", 0},
+		{"in-cluster match", &config.CocoConfig{TrusteeServer: "https://trustee-kbs.coco.svc.cluster.local:8080"}, deployed, "points to the deployed KBS", 0},
+		{"in-cluster scheme mismatch", &config.CocoConfig{TrusteeServer: "http://trustee-kbs.coco.svc.cluster.local:8080"}, deployed, "served at https://", 1},
+		{"in-cluster without deployment", &config.CocoConfig{TrusteeServer: "http://trustee-kbs.coco.svc.cluster.local:8080"}, nil, "no deployed KBS", 0},
+		{"external reachable", &config.CocoConfig{TrusteeServer: server.URL}, nil, "reachable (HTTP 404)", 0},
+		{"external unreachable", &config.CocoConfig{TrusteeServer: unreachable.URL}, nil, "unreachable", 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := &statusReport{w: &out}
+			reportTrusteeServer(context.Background(), r, tt.cfg, tt.kbsStatus)
+			if !strings.Contains(out.String(), tt.want) || r.failed != tt.failed {
+				t.Errorf("reportTrusteeServer() = %q (failed %d), want %q (failed %d)", out.String(), r.failed, tt.want, tt.failed)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package kbs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Remove the in-cluster KBS",
+	Long: `Remove the Key Broker Service (KBS) / Trustee deployed by 'kbs start'.
+
+stop deletes the objects 'kbs start' created in the KBS namespace: the
+Deployment, the Service, the KBS ConfigMaps and Secrets and the storage PVC.
+They are found by the app.kubernetes.io/managed-by=cococtl label; the namespace
+itself is not deleted.
+
+With --keep-data the admin public key, the TLS and Vault Secrets, the
+resource policy and the storage PVC are kept, so that a later 'kbs start' in
+the same namespace serves the same resources under the same policy to the same
+admin key. Resources held in memory
+(--storage memory) are lost either way.
+
+The local admin key in the auth directory is never deleted.
+
+Examples:
+  kubectl coco kbs stop
+  kubectl coco kbs stop --keep-data
+  kubectl coco kbs stop -n coco-system`,
+	Args: cobra.NoArgs,
+	RunE: runStop,
+}
+
+var (
+	stopNamespace string
+	stopKeepData  bool
+)
+
+func init() {
+	stopCmd.Flags().StringVarP(&stopNamespace, "namespace", "n", "", "Namespace of the in-cluster KBS")
+	stopCmd.Flags().BoolVar(&stopKeepData, "keep-data", false, "Keep the admin public key, TLS and Vault Secrets, resource policy and storage PVC")
+}
+
+func runStop(cmd *cobra.Command, _ []string) error {
+	namespace, err := resolveKBSNamespace(stopNamespace)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	return stopKBS(cmd.Context(), cmd.OutOrStdout(), k8sClient.Clientset, namespace, stopKeepData)
+}
+
+// stopKBS removes the KBS deployed in namespace and reports what was deleted.
+func stopKBS(ctx context.Context, w io.Writer, clientset kubernetes.Interface, namespace string, keepData bool) error {
+	kbsStatus, err := trustee.GetStatus(ctx, clientset, namespace)
+	if err != nil {
+		return err
+	}
+	if !kbsStatus.Deployed {
+		return fmt.Errorf("no KBS deployment found in namespace %s", namespace)
+	}
+
+	fmt.Fprintf(w, "Removing KBS from namespace '%s'...\n", namespace)
+	deleted, err := trustee.Undeploy(ctx, clientset, namespace, keepData)
+	for _, object := range deleted {
+		fmt.Fprintf(w, "  ✓ Deleted %s\n", object)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !kbsStatus.Managed {
+		fmt.Fprintf(w, "  ⚠ The other KBS objects in namespace %s are not labelled app.kubernetes.io/managed-by=cococtl and were left in place\n", namespace)
+	}
+	if keepData {
+		if kbsStatus.Storage == trustee.StorageMemory && kbsStatus.ResourceBackend == trustee.ResourceBackendFile {
+			fmt.Fprintf(w, "  ⚠ KBS resources were kept in memory and are lost; the admin key and Secrets are kept\n")
+		} else {
+			fmt.Fprintf(w, "  ✓ Kept the admin key, Secrets and stored resources\n")
+		}
+	}
+
+	fmt.Fprintf(w, "KBS removed\n")
+	fmt.Fprintf(w, "To deploy it again: kubectl coco kbs start -n %s\n", namespace)
+	return nil
+}
@@ -0,0 +1,72 @@
+package kbs
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+func TestStopKBS(t *testing.T) {
+	managed := map[string]string{trustee.ManagedByLabel: "cococtl"}
+	newClientset := func(deploymentLabels map[string]string) *fake.Clientset {
+		return fake.NewSimpleClientset(
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "trustee-deployment", Namespace: "coco", Labels: deploymentLabels}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "trustee-kbs", Namespace: "coco", Labels: managed}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "kbs-tls", Namespace: "coco", Labels: map[string]string{
+				trustee.ManagedByLabel: "cococtl", trustee.DataLabel: "true",
+			}}},
+		)
+	}
+
+	tests := []struct {
+		name     string
+		labels   map[string]string
+		keepData bool
+		want     []string
+		notWant  []string
+	}{
+		{"managed", map[string]string{"app": "kbs", trustee.ManagedByLabel: "cococtl"}, false,
+			[]string{"Deleted deployment/trustee-deployment", "Deleted service/trustee-kbs", "Deleted secret/kbs-tls", "KBS removed"},
+			[]string{"not labelled", "Kept"}},
+		{"keep data in memory", map[string]string{"app": "kbs", trustee.ManagedByLabel: "cococtl"}, true,
+			[]string{"Deleted service/trustee-kbs", "kept in memory and are lost"},
+			[]string{"Deleted secret/kbs-tls"}},
+		{"unlabelled", map[string]string{"app": "kbs"}, false,
+			[]string{"Deleted deployment/trustee-deployment", "not labelled"},
+			nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := stopKBS(context.Background(), &out, newClientset(tt.labels), "coco", tt.keepData); err != nil {
+				t.Fatalf("stopKBS() error = %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out.String(), notWant) {
+					t.Errorf("output contains %q:\n%s", notWant, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestStopKBS_NotDeployed(t *testing.T) {
+	var out bytes.Buffer
+	err := stopKBS(context.Background(), &out, fake.NewSimpleClientset(), "coco", false)
+	if err == nil || !strings.Contains(err.Error(), "no KBS deployment") {
+		t.Errorf("stopKBS() error = %v", err)
+	}
+}
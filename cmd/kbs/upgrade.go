@@ -0,0 +1,127 @@
+package kbs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/k8s"
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Roll the in-cluster KBS to a new image",
+	Long: `Roll the Key Broker Service (KBS) / Trustee deployed by 'kbs start' to a new
+image and wait until the new pod is ready.
+
+The admin public key, the KBS configuration, policies and Secrets are kept.
+Resources survive the roll when they are stored on a PVC (--storage pvc) or in
+Vault (--resource-backend vault). With in-memory storage they are lost, so
+upgrade refuses to run unless --force is given; re-upload them afterwards with
+'kbs populate'.
+
+The image is also saved as kbs_image in the config, so that later 'kbs start'
+deploys it.
+
+Examples:
+  kubectl coco kbs upgrade --image ghcr.io/confidential-containers/key-broker-service:v0.17.0
+  kubectl coco kbs upgrade --image <image> -n coco-system
+  kubectl coco kbs upgrade --image <image> --force`,
+	Args: cobra.NoArgs,
+	RunE: runUpgrade,
+}
+
+var (
+	upgradeImage     string
+	upgradeNamespace string
+	upgradeAuthDir   string
+	upgradeForce     bool
+)
+
+func init() {
+	upgradeCmd.Flags().StringVar(&upgradeImage, "image", "", "KBS image to roll to (required)")
+	upgradeCmd.Flags().StringVarP(&upgradeNamespace, "namespace", "n", "", "Namespace of the in-cluster KBS")
+	upgradeCmd.Flags().StringVar(&upgradeAuthDir, "auth-dir", "", "Directory containing private.key (default: ~/.kube/coco-kbs-auth)")
+	upgradeCmd.Flags().BoolVar(&upgradeForce, "force", false, "Upgrade even though resources held in memory are lost")
+}
+
+func runUpgrade(cmd *cobra.Command, _ []string) error {
+	if upgradeImage == "" {
+		return fmt.Errorf("--image is required")
+	}
+
+	namespace, err := resolveKBSNamespace(upgradeNamespace)
+	if err != nil {
+		return err
+	}
+	authDir, err := resolveAuthDir(upgradeAuthDir)
+	if err != nil {
+		return err
+	}
+
+	k8sClient, err := k8s.NewClient(k8s.ClientOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	ctx := cmd.Context()
+	kbsStatus, err := trustee.GetStatus(ctx, k8sClient.Clientset, namespace)
+	if err != nil {
+		return err
+	}
+	if !kbsStatus.Deployed {
+		return fmt.Errorf("no KBS deployment found in namespace %s", namespace)
+	}
+	if err := checkUpgradeStorage(kbsStatus, upgradeForce); err != nil {
+		return err
+	}
+
+	fmt.Printf("Upgrading KBS in namespace '%s' to %s...\n", namespace, upgradeImage)
+	previous, err := trustee.Upgrade(ctx, k8sClient.Clientset, k8sClient.Config, namespace, upgradeImage, authDir)
+	if err != nil {
+		return fmt.Errorf("failed to upgrade KBS: %w", err)
+	}
+	if previous == upgradeImage {
+		fmt.Printf("KBS already runs %s\n", upgradeImage)
+	} else {
+		fmt.Printf("  ✓ Rolled %s → %s\n", previous, upgradeImage)
+	}
+
+	cfg, err := loadCocoConfig()
+	switch {
+	case errors.Is(err, errConfigNotFound):
+		cfg = config.DefaultConfig()
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Warning: failed to load config file: %v\n", err)
+		cfg = nil
+	}
+	if cfg != nil {
+		cfg.KBSImage = upgradeImage
+		if configPath, err := config.GetConfigPath(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to determine config path: %v\n", err)
+		} else if err := cfg.Save(configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to save config to %q: %v\n", configPath, err)
+		}
+	}
+
+	fmt.Printf("KBS upgraded successfully\n")
+	if kbsStatus.Storage == trustee.StorageMemory && kbsStatus.ResourceBackend == trustee.ResourceBackendFile {
+		fmt.Println()
+		fmt.Println("Resources were held in memory; upload them again:")
+		fmt.Printf("  kubectl coco kbs populate -f <secrets.yaml>\n")
+	}
+	return nil
+}
+
+// checkUpgradeStorage refuses to roll a KBS whose resources live in memory
+// unless force is set.
+func checkUpgradeStorage(kbsStatus *trustee.Status, force bool) error {
+	if kbsStatus.Storage != trustee.StorageMemory || kbsStatus.ResourceBackend != trustee.ResourceBackendFile || force {
+		return nil
+	}
+	return fmt.Errorf("the KBS in namespace %s keeps resources in memory and they would be lost; use --force to upgrade anyway, or redeploy with 'kbs start --storage pvc'", kbsStatus.Namespace)
+}
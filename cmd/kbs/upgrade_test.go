@@ -0,0 +1,37 @@
+package kbs
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/confidential-devhub/cococtl/pkg/trustee"
+)
+
+func TestRunUpgrade_ImageRequired(t *testing.T) {
+	withHome(t)
+	upgradeImage = ""
+	err := runUpgrade(newTestCmd(), nil)
+	if err == nil || !strings.Contains(err.Error(), "--image is required") {
+		t.Errorf("runUpgrade() error = %v", err)
+	}
+}
+
+func TestCheckUpgradeStorage(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  trustee.Status
+		force   bool
+		wantErr bool
+	}{
+		{"memory", trustee.Status{Storage: trustee.StorageMemory, ResourceBackend: trustee.ResourceBackendFile}, false, true},
+		{"memory forced", trustee.Status{Storage: trustee.StorageMemory, ResourceBackend: trustee.ResourceBackendFile}, true, false},
+		{"pvc", trustee.Status{Storage: trustee.StoragePVC, ResourceBackend: trustee.ResourceBackendFile}, false, false},
+		{"vault", trustee.Status{Storage: trustee.StorageMemory, ResourceBackend: trustee.ResourceBackendVault}, false, false},
+	}
+	for _, tt := range tests {
+		err := checkUpgradeStorage(&tt.status, tt.force)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkUpgradeStorage() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
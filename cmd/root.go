@@ -8,6 +8,8 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/confidential-devhub/cococtl/cmd/image"
+	"github.com/confidential-devhub/cococtl/cmd/imagepolicy"
 	"github.com/confidential-devhub/cococtl/cmd/initdata"
 	"github.com/confidential-devhub/cococtl/cmd/kbs"
 )
@@ -38,6 +40,8 @@ func init() {
 	cobra.OnInitialize()
 	rootCmd.AddCommand(kbs.KbsCmd)
 	rootCmd.AddCommand(initdata.InitdataCmd)
+	rootCmd.AddCommand(imagepolicy.ImagePolicyCmd)
+	rootCmd.AddCommand(image.ImageCmd)
 }
 
 // contextKey is the type for context keys used in cococtl
@@ -18,49 +18,89 @@ const (
 	DefaultKBSImage           = "ghcr.io/confidential-containers/key-broker-service:built-in-as-v0.17.0"
 	DefaultPCCSURL            = "https://api.trustedservices.intel.com/sgx/certification/v4/"
 	// Sidecar defaults
-	DefaultSidecarImage       = "quay.io/confidential-devhub/coco-secure-access:latest"
-	DefaultSidecarHTTPSPort   = 8443
-	DefaultSidecarTLSCertURI  = "kbs:///default/sidecar-tls/server-cert"
-	DefaultSidecarTLSKeyURI   = "kbs:///default/sidecar-tls/server-key"
-	DefaultSidecarClientCAURI = "kbs:///default/sidecar-tls/client-ca"
-	DefaultSidecarCPULimit    = "100m"
-	DefaultSidecarMemLimit    = "128Mi"
-	DefaultSidecarCPURequest  = "50m"
-	DefaultSidecarMemRequest  = "64Mi"
+	DefaultSidecarImage                      = "quay.io/confidential-devhub/coco-secure-access:latest"
+	DefaultSidecarHTTPSPort                  = 8443
+	DefaultSidecarTLSCertURI                 = "kbs:///default/sidecar-tls/server-cert"
+	DefaultSidecarTLSKeyURI                  = "kbs:///default/sidecar-tls/server-key"
+	DefaultSidecarClientCAURI                = "kbs:///default/sidecar-tls/client-ca"
+	DefaultSidecarCPULimit                   = "100m"
+	DefaultSidecarMemLimit                   = "128Mi"
+	DefaultSidecarCPURequest                 = "50m"
+	DefaultSidecarMemRequest                 = "64Mi"
+	DefaultSidecarLogLevel                   = "info"
+	DefaultSidecarAttestationRefreshInterval = "5m"
 )
 
 // SidecarConfig represents the configuration for the secure access sidecar.
 type SidecarConfig struct {
-	Enabled       bool   `toml:"enabled" comment:"Enable secure access sidecar injection (default: false)"`
-	CertDir       string `toml:"cert_dir" comment:"Directory to store sidecar certificates and keys (default: $HOME/.kube/coco-sidecar)"`
-	Image         string `toml:"image" comment:"Sidecar container image (default: ghcr.io/confidential-containers/coco-secure-access:v0.1.0)"`
-	HTTPSPort     int    `toml:"https_port" comment:"HTTPS server port (default: 8443)"`
-	TLSCertURI    string `toml:"tls_cert_uri" comment:"Server TLS certificate KBS URI (required if sidecar enabled)"`
-	TLSKeyURI     string `toml:"tls_key_uri" comment:"Server TLS key KBS URI (required if sidecar enabled)"`
-	ClientCAURI   string `toml:"client_ca_uri" comment:"Client CA certificate KBS URI for mTLS (required if sidecar enabled)"`
-	ForwardPort   int    `toml:"forward_port" comment:"Port to forward from primary container (optional)"`
-	CPULimit      string `toml:"cpu_limit" comment:"CPU limit (default: 100m)"`
-	MemoryLimit   string `toml:"memory_limit" comment:"Memory limit (default: 128Mi)"`
-	CPURequest    string `toml:"cpu_request" comment:"CPU request (default: 50m)"`
-	MemoryRequest string `toml:"memory_request" comment:"Memory request (default: 64Mi)"`
+	Enabled                    bool     `toml:"enabled" comment:"Enable secure access sidecar injection (default: false)"`
+	CertDir                    string   `toml:"cert_dir" comment:"Directory to store sidecar certificates and keys (default: $HOME/.kube/coco-sidecar)"`
+	Image                      string   `toml:"image" comment:"Sidecar container image (default: ghcr.io/confidential-containers/coco-secure-access:v0.1.0)"`
+	HTTPSPort                  int      `toml:"https_port" comment:"HTTPS server port (default: 8443)"`
+	TLSCertURI                 string   `toml:"tls_cert_uri" comment:"Server TLS certificate KBS URI (required if sidecar enabled)"`
+	TLSKeyURI                  string   `toml:"tls_key_uri" comment:"Server TLS key KBS URI (required if sidecar enabled)"`
+	ClientCAURI                string   `toml:"client_ca_uri" comment:"Client CA certificate KBS URI for mTLS (required if sidecar enabled)"`
+	ForwardPort                int      `toml:"forward_port" comment:"Port to forward from primary container (optional)"`
+	CPULimit                   string   `toml:"cpu_limit" comment:"CPU limit (default: 100m)"`
+	MemoryLimit                string   `toml:"memory_limit" comment:"Memory limit (default: 128Mi)"`
+	CPURequest                 string   `toml:"cpu_request" comment:"CPU request (default: 50m)"`
+	MemoryRequest              string   `toml:"memory_request" comment:"Memory request (default: 64Mi)"`
+	LogLevel                   string   `toml:"log_level" comment:"Sidecar log level: debug, info, warn or error (default: info)"`
+	AttestationRefreshInterval string   `toml:"attestation_refresh_interval" comment:"Interval between attestation status refreshes, e.g. 5m; 0 disables (default: 5m)"`
+	CertRefreshInterval        string   `toml:"cert_refresh_interval" comment:"Interval between TLS certificate refreshes from KBS, e.g. 1h (optional, default: disabled)"`
+	AllowedClientCNs           []string `toml:"allowed_client_cns" comment:"Client certificate Common Names allowed to access the sidecar (optional, default: any client signed by the client CA)"`
+	CDHURL                     string   `toml:"cdh_url" comment:"Confidential Data Hub endpoint used by the sidecar to fetch KBS resources (optional, default: http://127.0.0.1:8006)"`
+}
+
+// Attestation modes for AttestationConfig.Mode.
+const (
+	// AttestationModeBackgroundCheck has the guest attest to the KBS it fetches resources from.
+	AttestationModeBackgroundCheck = "background-check"
+	// AttestationModePassport has the guest attest to as_url for a token it presents to the KBS.
+	AttestationModePassport = "passport"
+)
+
+// AttestationConfig configures the attestation and key broker endpoints and
+// the trust anchors written to the guest aa.toml and cdh.toml.
+type AttestationConfig struct {
+	Mode    string   `toml:"mode" comment:"Attestation mode: background-check or passport (default: background-check)"`
+	ASURL   string   `toml:"as_url" comment:"Attestation Service URL: the CoCo AS in background-check mode, the token-issuing Trustee in passport mode (optional, required for passport)"`
+	KBSURL  string   `toml:"kbs_url" comment:"KBS URL the guest fetches resources from (optional, default: trustee_server)"`
+	CACerts []string `toml:"ca_certs" comment:"Additional CA bundle files trusted for the AS and KBS, alongside trustee_ca_cert (optional)"`
+}
+
+// InitdataConfig customizes the initdata generated from the configuration.
+type InitdataConfig struct {
+	Algorithm    string                 `toml:"algorithm" comment:"Initdata hash algorithm: sha256, sha384 or sha512 (optional, default: sha384 for TDX/SNP runtime classes, sha256 otherwise)"`
+	ExtraFiles   map[string]string      `toml:"extra_files" comment:"Extra files to embed in initdata, as data key = local file path relative to this file (optional)"`
+	AAOverrides  map[string]interface{} `toml:"aa_overrides" comment:"Fields merged into the generated aa.toml, e.g. [initdata.aa_overrides.eventlog_config] (optional)"`
+	CDHOverrides map[string]interface{} `toml:"cdh_overrides" comment:"Fields merged into the generated cdh.toml, e.g. [initdata.cdh_overrides.image] (optional)"`
 }
 
 // CocoConfig represents the configuration for CoCo deployments.
 type CocoConfig struct {
-	TrusteeServer      string            `toml:"trustee_server" comment:"Trustee server URL (mandatory)"`
-	RuntimeClass       string            `toml:"runtime_class" comment:"Default RuntimeClass to use when --runtime-class is not specified (default: kata-cc)"`
-	TrusteeCACert      string            `toml:"trustee_ca_cert" comment:"Trustee CA cert location (optional)"`
-	KataAgentPolicy    string            `toml:"kata_agent_policy" comment:"Kata-agent policy file path (optional)"`
-	InitContainerImage string            `toml:"init_container_image" comment:"Default init container image (optional, default: quay.io/fedora/fedora:44)"`
-	InitContainerCmd   string            `toml:"init_container_cmd" comment:"Default init container command (optional, default: attestation check)"`
-	KBSImage           string            `toml:"kbs_image" comment:"KBS all-in-one image for Trustee deployment (optional, default: ghcr.io/confidential-containers/key-broker-service:built-in-as-v0.17.0)"`
-	PCCSURL            string            `toml:"pccs_url" comment:"PCCS URL for SGX attestation (optional, default: https://api.trustedservices.intel.com/sgx/certification/v4/)"`
-	KBSAuthDir         string            `toml:"kbs_auth_dir" comment:"Directory containing KBS admin keys for 'kbs populate'; set automatically during init (default: ~/.kube/coco-kbs-auth)"`
-	ContainerPolicyURI string            `toml:"container_policy_uri" comment:"Container policy URI (optional)"`
-	RegistryCredURI    string            `toml:"registry_cred_uri" comment:"Container registry credentials URI (optional)"`
-	RegistryConfigURI  string            `toml:"registry_config_uri" comment:"Container registry config URI (optional)"`
-	Annotations        map[string]string `toml:"annotations" comment:"Custom annotations to add to pods (optional)"`
-	Sidecar            SidecarConfig     `toml:"sidecar" comment:"Secure access sidecar configuration (optional)"`
+	TrusteeServer       string            `toml:"trustee_server" comment:"Trustee server URL (mandatory)"`
+	RuntimeClass        string            `toml:"runtime_class" comment:"Default RuntimeClass to use when --runtime-class is not specified (default: kata-cc)"`
+	TrusteeCACert       string            `toml:"trustee_ca_cert" comment:"Trustee CA cert location (optional)"`
+	KataAgentPolicy     string            `toml:"kata_agent_policy" comment:"Kata-agent policy file path (optional)"`
+	InitContainerImage  string            `toml:"init_container_image" comment:"Default init container image (optional, default: quay.io/fedora/fedora:44)"`
+	InitContainerCmd    string            `toml:"init_container_cmd" comment:"Default init container command (optional, default: attestation check)"`
+	KBSImage            string            `toml:"kbs_image" comment:"KBS all-in-one image for Trustee deployment (optional, default: ghcr.io/confidential-containers/key-broker-service:built-in-as-v0.17.0)"`
+	PCCSURL             string            `toml:"pccs_url" comment:"PCCS URL for SGX attestation (optional, default: https://api.trustedservices.intel.com/sgx/certification/v4/)"`
+	KBSAuthDir          string            `toml:"kbs_auth_dir" comment:"Directory containing KBS admin keys for 'kbs populate'; set automatically during init (default: ~/.kube/coco-kbs-auth)"`
+	ContainerPolicyURI  string            `toml:"container_policy_uri" comment:"Container policy URI (optional)"`
+	ContainerPolicyKeys []string          `toml:"container_policy_keys" comment:"KBS URIs of the signature keys referenced by container_policy_uri, set by 'image-policy create' (optional)"`
+	RegistryCredURI     string            `toml:"registry_cred_uri" comment:"Container registry credentials URI (optional)"`
+	RegistryConfigURI   string            `toml:"registry_config_uri" comment:"Container registry config URI (optional)"`
+	EncryptedImages     map[string]string `toml:"encrypted_images" comment:"Encrypted images and the KBS URI of their decryption key, recorded by 'image encrypt' (optional)"`
+	Annotations         map[string]string `toml:"annotations" comment:"Custom annotations to add to pods (optional)"`
+	Attestation         AttestationConfig `toml:"attestation" comment:"Attestation Service and KBS endpoints, CA bundles and attestation mode for the guest (optional)"`
+	Initdata            InitdataConfig    `toml:"initdata" comment:"Initdata customization: extra files and aa.toml/cdh.toml overrides (optional)"`
+	Sidecar             SidecarConfig     `toml:"sidecar" comment:"Secure access sidecar configuration (optional)"`
+
+	// dir is the directory of the config file Load read, which relative
+	// paths in the config are resolved against.
+	dir string
 }
 
 // GetTrusteeNamespace extracts the namespace from the Trustee server URL.
@@ -118,17 +158,19 @@ func DefaultConfig() *CocoConfig {
 			"io.katacontainers.config.hypervisor.image":                 "",
 		},
 		Sidecar: SidecarConfig{
-			Enabled:       false,
-			CertDir:       GetDefaultCertDir(),
-			Image:         DefaultSidecarImage,
-			HTTPSPort:     DefaultSidecarHTTPSPort,
-			TLSCertURI:    DefaultSidecarTLSCertURI,
-			TLSKeyURI:     DefaultSidecarTLSKeyURI,
-			ClientCAURI:   DefaultSidecarClientCAURI,
-			CPULimit:      DefaultSidecarCPULimit,
-			MemoryLimit:   DefaultSidecarMemLimit,
-			CPURequest:    DefaultSidecarCPURequest,
-			MemoryRequest: DefaultSidecarMemRequest,
+			Enabled:                    false,
+			CertDir:                    GetDefaultCertDir(),
+			Image:                      DefaultSidecarImage,
+			HTTPSPort:                  DefaultSidecarHTTPSPort,
+			TLSCertURI:                 DefaultSidecarTLSCertURI,
+			TLSKeyURI:                  DefaultSidecarTLSKeyURI,
+			ClientCAURI:                DefaultSidecarClientCAURI,
+			CPULimit:                   DefaultSidecarCPULimit,
+			MemoryLimit:                DefaultSidecarMemLimit,
+			CPURequest:                 DefaultSidecarCPURequest,
+			MemoryRequest:              DefaultSidecarMemRequest,
+			LogLevel:                   DefaultSidecarLogLevel,
+			AttestationRefreshInterval: DefaultSidecarAttestationRefreshInterval,
 		},
 	}
 }
@@ -191,10 +233,22 @@ func Load(path string) (*CocoConfig, error) {
 
 	// Apply defaults for sidecar if not set
 	applyDefaults(&cfg)
+	cfg.dir = filepath.Dir(cleanPath)
 
 	return &cfg, nil
 }
 
+// ResolvePath returns path, a file path from the configuration, relative to
+// the directory of the config file it was loaded from, so that the result
+// does not depend on the working directory. Absolute paths and configs that
+// were not loaded from a file are returned unchanged.
+func (c *CocoConfig) ResolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) || c.dir == "" {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
 // applyDefaults applies default values to config fields if they are not set.
 func applyDefaults(cfg *CocoConfig) {
 	// Apply sidecar defaults
@@ -231,6 +285,12 @@ func applyDefaults(cfg *CocoConfig) {
 	if cfg.Sidecar.MemoryRequest == "" {
 		cfg.Sidecar.MemoryRequest = DefaultSidecarMemRequest
 	}
+	if cfg.Sidecar.LogLevel == "" {
+		cfg.Sidecar.LogLevel = DefaultSidecarLogLevel
+	}
+	if cfg.Sidecar.AttestationRefreshInterval == "" {
+		cfg.Sidecar.AttestationRefreshInterval = DefaultSidecarAttestationRefreshInterval
+	}
 }
 
 // Save writes the configuration to the specified path.
@@ -265,12 +325,44 @@ func (c *CocoConfig) Validate() error {
 	// Normalize trustee_server URL - add https:// prefix if no protocol is specified
 	c.NormalizeTrusteeServer()
 
+	switch c.Attestation.Mode {
+	case "", AttestationModeBackgroundCheck:
+	case AttestationModePassport:
+		if c.Attestation.ASURL == "" {
+			return fmt.Errorf("attestation.as_url is required in passport mode")
+		}
+	default:
+		return fmt.Errorf("attestation.mode must be %s or %s, got %q", AttestationModeBackgroundCheck, AttestationModePassport, c.Attestation.Mode)
+	}
+	c.Attestation.ASURL = normalizeURL(c.Attestation.ASURL)
+	c.Attestation.KBSURL = normalizeURL(c.Attestation.KBSURL)
+
 	return nil
 }
 
+// GuestKBSURL returns the KBS URL the guest fetches resources from:
+// attestation.kbs_url if set, otherwise trustee_server.
+func (c *CocoConfig) GuestKBSURL() string {
+	if c.Attestation.KBSURL != "" {
+		return c.Attestation.KBSURL
+	}
+	return c.TrusteeServer
+}
+
+// IsPassportMode reports whether the guest uses passport-mode attestation.
+func (c *CocoConfig) IsPassportMode() bool {
+	return c.Attestation.Mode == AttestationModePassport
+}
+
 // NormalizeTrusteeServer adds https:// prefix to trustee_server if no protocol is specified
 func (c *CocoConfig) NormalizeTrusteeServer() {
-	if c.TrusteeServer != "" && !strings.HasPrefix(c.TrusteeServer, "http://") && !strings.HasPrefix(c.TrusteeServer, "https://") {
-		c.TrusteeServer = "https://" + c.TrusteeServer
+	c.TrusteeServer = normalizeURL(c.TrusteeServer)
+}
+
+// normalizeURL adds an https:// prefix to a non-empty URL without a protocol.
+func normalizeURL(u string) string {
+	if u != "" && !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		return "https://" + u
 	}
+	return u
 }
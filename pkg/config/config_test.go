@@ -46,6 +46,12 @@ func TestApplyDefaults(t *testing.T) {
 				if cfg.Sidecar.MemoryRequest != DefaultSidecarMemRequest {
 					t.Errorf("Expected default memory request %s, got %s", DefaultSidecarMemRequest, cfg.Sidecar.MemoryRequest)
 				}
+				if cfg.Sidecar.LogLevel != DefaultSidecarLogLevel {
+					t.Errorf("Expected default log level %s, got %s", DefaultSidecarLogLevel, cfg.Sidecar.LogLevel)
+				}
+				if cfg.Sidecar.AttestationRefreshInterval != DefaultSidecarAttestationRefreshInterval {
+					t.Errorf("Expected default attestation refresh interval %s, got %s", DefaultSidecarAttestationRefreshInterval, cfg.Sidecar.AttestationRefreshInterval)
+				}
 			},
 		},
 		{
@@ -211,3 +217,59 @@ func TestGetTrusteeNamespace(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate_Attestation(t *testing.T) {
+	tests := []struct {
+		name        string
+		attestation AttestationConfig
+		wantErr     bool
+	}{
+		{name: "unset", attestation: AttestationConfig{}},
+		{name: "background-check with AS", attestation: AttestationConfig{Mode: AttestationModeBackgroundCheck, ASURL: "as.example.com:50004"}},
+		{name: "passport", attestation: AttestationConfig{Mode: AttestationModePassport, ASURL: "https://issuer.example.com"}},
+		{name: "passport without AS", attestation: AttestationConfig{Mode: AttestationModePassport}, wantErr: true},
+		{name: "unknown mode", attestation: AttestationConfig{Mode: "token"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &CocoConfig{TrusteeServer: "kbs.example.com", RuntimeClass: DefaultRuntimeClass, Attestation: tt.attestation}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.attestation.ASURL != "" && cfg.Attestation.ASURL[:8] != "https://" {
+				t.Errorf("as_url not normalized: %q", cfg.Attestation.ASURL)
+			}
+		})
+	}
+}
+
+func TestGuestKBSURL(t *testing.T) {
+	cfg := &CocoConfig{TrusteeServer: "https://kbs.example.com"}
+	if got := cfg.GuestKBSURL(); got != "https://kbs.example.com" {
+		t.Errorf("GuestKBSURL() = %q, want trustee_server", got)
+	}
+	cfg.Attestation.KBSURL = "https://resources.example.com"
+	if got := cfg.GuestKBSURL(); got != "https://resources.example.com" {
+		t.Errorf("GuestKBSURL() = %q, want kbs_url", got)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	cfg := &CocoConfig{dir: "/home/user/.kube"}
+	tests := map[string]string{
+		"":              "",
+		"/etc/app.conf": "/etc/app.conf",
+		"app.conf":      "/home/user/.kube/app.conf",
+		"../app.conf":   "/home/user/app.conf",
+	}
+	for path, want := range tests {
+		if got := cfg.ResolvePath(path); got != want {
+			t.Errorf("ResolvePath(%q) = %q, want %q", path, got, want)
+		}
+	}
+	if got := (&CocoConfig{}).ResolvePath("app.conf"); got != "app.conf" {
+		t.Errorf("ResolvePath() without a config file = %q, want unchanged", got)
+	}
+}
@@ -0,0 +1,402 @@
+// Package imagecrypt encrypts the layers of an OCI image layout so that only a
+// TEE that passes attestation can run the image.
+//
+// Layers are encrypted with the ocicrypt block cipher (AES_256_CTR_HMAC_SHA256).
+// The per-layer options holding the symmetric key are wrapped with a key
+// encryption key (KEK) kept in KBS, using the annotation format of the
+// attestation-agent key provider: inside the guest, image-rs hands the
+// annotation to the Confidential Data Hub, which fetches the KEK from KBS by
+// its kid after attestation and unwraps the layer key.
+package imagecrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/containers/ocicrypt/blockcipher"
+	godigest "github.com/opencontainers/go-digest"
+)
+
+// Annotations set on encrypted layer descriptors.
+const (
+	// AnnotationKeyProvider holds the wrapped layer options for the
+	// attestation-agent key provider.
+	AnnotationKeyProvider = "org.opencontainers.image.enc.keys.provider.attestation-agent"
+	// AnnotationPubOpts holds the public layer options (cipher and HMAC).
+	AnnotationPubOpts = "org.opencontainers.image.enc.pubopts"
+)
+
+// KeySize is the size in bytes of the key encryption key stored in KBS.
+const KeySize = 32
+
+const (
+	wrapType = "A256GCM"
+
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	layerPrefix       = "application/vnd.oci.image.layer."
+	encryptedSuffix   = "+encrypted"
+)
+
+var hexDigest = regexp.MustCompile(`^[a-f0-9]{64}$`)
+
+// Result summarizes an encryption run.
+type Result struct {
+	Manifests int
+	Layers    int
+	// Skipped counts layers that were already encrypted.
+	Skipped int
+}
+
+// annotationPacket is the wrapped key format of the attestation-agent key provider.
+type annotationPacket struct {
+	Kid         string `json:"kid"`
+	WrappedData string `json:"wrapped_data"`
+	IV          string `json:"iv"`
+	WrapType    string `json:"wrap_type"`
+}
+
+// GenerateKey returns a fresh key encryption key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// layout copies blobs from an input OCI layout to an output one.
+type layout struct {
+	src, dst string
+	kek      []byte
+	kid      string
+	result   Result
+}
+
+// EncryptLayout writes to dst a copy of the OCI image layout at src in which
+// every layer is encrypted. Layer keys are wrapped with kek, which the guest
+// fetches from KBS at keyURI. dst must not exist or be empty.
+func EncryptLayout(src, dst string, kek []byte, keyURI string) (*Result, error) {
+	if len(kek) != KeySize {
+		return nil, fmt.Errorf("invalid key length of %d bytes; need %d bytes", len(kek), KeySize)
+	}
+	if _, err := os.Stat(filepath.Join(src, "oci-layout")); err != nil {
+		return nil, fmt.Errorf("%s is not an OCI image layout: %w", src, err)
+	}
+	if entries, err := os.ReadDir(dst); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("output directory %s is not empty", dst)
+	}
+	if err := os.MkdirAll(filepath.Join(dst, "blobs", "sha256"), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create output layout: %w", err)
+	}
+
+	// #nosec G304 -- path provided by the user via flag
+	ociLayout, err := os.ReadFile(filepath.Join(src, "oci-layout"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read oci-layout: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "oci-layout"), ociLayout, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write oci-layout: %w", err)
+	}
+
+	l := &layout{src: src, dst: dst, kek: kek, kid: keyURI}
+
+	// #nosec G304 -- path provided by the user via flag
+	indexData, err := os.ReadFile(filepath.Join(src, "index.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index.json: %w", err)
+	}
+	index, err := decodeJSON(indexData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse index.json: %w", err)
+	}
+	if err := l.rewriteIndexEntries(index); err != nil {
+		return nil, err
+	}
+	newIndex, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal index.json: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "index.json"), newIndex, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write index.json: %w", err)
+	}
+
+	if l.result.Layers == 0 && l.result.Skipped == 0 {
+		return nil, errors.New("no image layers found in the layout")
+	}
+	return &l.result, nil
+}
+
+// rewriteIndexEntries processes the manifests listed in an image index in place.
+func (l *layout) rewriteIndexEntries(index map[string]interface{}) error {
+	manifests, _ := index["manifests"].([]interface{})
+	if len(manifests) == 0 {
+		return errors.New("image index lists no manifests")
+	}
+	for i, m := range manifests {
+		desc, ok := m.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid manifest descriptor at index %d", i)
+		}
+		if err := l.rewriteDescriptor(desc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rewriteDescriptor encrypts the content referenced by a manifest or index
+// descriptor and updates its digest and size.
+func (l *layout) rewriteDescriptor(desc map[string]interface{}) error {
+	mediaType, _ := desc["mediaType"].(string)
+	digest, _ := desc["digest"].(string)
+	data, err := l.readBlob(digest)
+	if err != nil {
+		return err
+	}
+	doc, err := decodeJSON(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", digest, err)
+	}
+
+	switch mediaType {
+	case mediaTypeIndex:
+		if err := l.rewriteIndexEntries(doc); err != nil {
+			return err
+		}
+	case mediaTypeManifest:
+		if err := l.rewriteManifest(doc); err != nil {
+			return fmt.Errorf("manifest %s: %w", digest, err)
+		}
+		l.result.Manifests++
+	default:
+		return fmt.Errorf("unsupported manifest media type %q (convert the image to OCI format, e.g. with 'skopeo copy --format oci')", mediaType)
+	}
+
+	newData, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", digest, err)
+	}
+	newDigest, err := l.writeBlob(newData)
+	if err != nil {
+		return err
+	}
+	desc["digest"] = newDigest
+	desc["size"] = len(newData)
+	return nil
+}
+
+// rewriteManifest copies the config blob and encrypts every layer of an image manifest.
+func (l *layout) rewriteManifest(manifest map[string]interface{}) error {
+	if config, ok := manifest["config"].(map[string]interface{}); ok {
+		digest, _ := config["digest"].(string)
+		if err := l.copyBlob(digest); err != nil {
+			return err
+		}
+	}
+
+	layers, _ := manifest["layers"].([]interface{})
+	for i, layer := range layers {
+		desc, ok := layer.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid layer descriptor at index %d", i)
+		}
+		mediaType, _ := desc["mediaType"].(string)
+		digest, _ := desc["digest"].(string)
+		switch {
+		case strings.HasSuffix(mediaType, encryptedSuffix):
+			if err := l.copyBlob(digest); err != nil {
+				return err
+			}
+			l.result.Skipped++
+		case strings.HasPrefix(mediaType, layerPrefix):
+			if err := l.encryptLayer(desc); err != nil {
+				return fmt.Errorf("layer %s: %w", digest, err)
+			}
+			l.result.Layers++
+		default:
+			return fmt.Errorf("unsupported layer media type %q", mediaType)
+		}
+	}
+	return nil
+}
+
+// encryptLayer writes the encrypted layer blob and updates its descriptor.
+func (l *layout) encryptLayer(desc map[string]interface{}) error {
+	digest, _ := desc["digest"].(string)
+	srcPath, err := blobPath(l.src, digest)
+	if err != nil {
+		return err
+	}
+	// #nosec G304 -- blob path validated by blobPath
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to open layer: %w", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	handler, err := blockcipher.NewLayerBlockCipherHandler()
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	encrypted, finalize, err := handler.Encrypt(in, blockcipher.AES256CTR)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(l.dst, "blobs", "sha256"), ".encrypting-")
+	if err != nil {
+		return fmt.Errorf("failed to create layer blob: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	// Hash the ciphertext for the new descriptor.
+	blobHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, blobHash), encrypted)
+	if err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to encrypt layer: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write layer blob: %w", err)
+	}
+
+	newHex := hex.EncodeToString(blobHash.Sum(nil))
+	if err := os.Rename(tmp.Name(), filepath.Join(l.dst, "blobs", "sha256", newHex)); err != nil {
+		return fmt.Errorf("failed to write layer blob: %w", err)
+	}
+
+	opts, err := finalize()
+	if err != nil {
+		return fmt.Errorf("failed to encrypt layer: %w", err)
+	}
+	opts.Private.Digest = godigest.Digest(digest)
+	pubOpts, err := json.Marshal(opts.Public)
+	if err != nil {
+		return fmt.Errorf("failed to marshal layer options: %w", err)
+	}
+	privOpts, err := json.Marshal(opts.Private)
+	if err != nil {
+		return fmt.Errorf("failed to marshal layer options: %w", err)
+	}
+	wrapped, err := wrapKey(l.kek, l.kid, privOpts)
+	if err != nil {
+		return err
+	}
+
+	annotations, _ := desc["annotations"].(map[string]interface{})
+	if annotations == nil {
+		annotations = make(map[string]interface{})
+	}
+	annotations[AnnotationKeyProvider] = wrapped
+	annotations[AnnotationPubOpts] = base64.StdEncoding.EncodeToString(pubOpts)
+	desc["annotations"] = annotations
+	desc["mediaType"] = desc["mediaType"].(string) + encryptedSuffix
+	desc["digest"] = "sha256:" + newHex
+	desc["size"] = size
+	return nil
+}
+
+// wrapKey seals the private layer options with the KEK and returns the
+// base64-encoded attestation-agent annotation packet.
+func wrapKey(kek []byte, kid string, optsData []byte) (string, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return "", fmt.Errorf("failed to create key wrapping cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to create key wrapping cipher: %w", err)
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
+	}
+	packet, err := json.Marshal(annotationPacket{
+		Kid:         kid,
+		WrappedData: base64.StdEncoding.EncodeToString(gcm.Seal(nil, iv, optsData, nil)),
+		IV:          base64.StdEncoding.EncodeToString(iv),
+		WrapType:    wrapType,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal wrapped key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(packet), nil
+}
+
+// readBlob reads a blob from the input layout.
+func (l *layout) readBlob(digest string) ([]byte, error) {
+	path, err := blobPath(l.src, digest)
+	if err != nil {
+		return nil, err
+	}
+	// #nosec G304 -- blob path validated by blobPath
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", digest, err)
+	}
+	return data, nil
+}
+
+// copyBlob copies a blob unchanged from the input to the output layout.
+func (l *layout) copyBlob(digest string) error {
+	data, err := l.readBlob(digest)
+	if err != nil {
+		return err
+	}
+	dstPath, err := blobPath(l.dst, digest)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dstPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write blob %s: %w", digest, err)
+	}
+	return nil
+}
+
+// writeBlob stores data in the output layout and returns its digest.
+func (l *layout) writeBlob(data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	path, err := blobPath(l.dst, digest)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write blob %s: %w", digest, err)
+	}
+	return digest, nil
+}
+
+// blobPath returns the path of a sha256 blob, rejecting malformed digests.
+func blobPath(dir, digest string) (string, error) {
+	hexPart, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok || !hexDigest.MatchString(hexPart) {
+		return "", fmt.Errorf("unsupported or malformed digest %q", digest)
+	}
+	return filepath.Join(dir, "blobs", "sha256", hexPart), nil
+}
+
+// decodeJSON decodes a JSON object keeping numbers intact.
+func decodeJSON(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -0,0 +1,263 @@
+package imagecrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/ocicrypt"
+	"github.com/containers/ocicrypt/blockcipher"
+	"github.com/containers/ocicrypt/config"
+	godigest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const testKID = "kbs:///default/image-kek/app"
+
+// writeTestBlob stores data in the layout and returns its digest.
+func writeTestBlob(t *testing.T, dir string, data []byte) string {
+	t.Helper()
+	sum := sha256.Sum256(data)
+	hexSum := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", hexSum), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return "sha256:" + hexSum
+}
+
+// newTestLayout creates an OCI layout with a single-layer image manifest.
+func newTestLayout(t *testing.T, layerMediaType string, layer []byte) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	configDigest := writeTestBlob(t, dir, []byte(`{"architecture":"amd64","os":"linux"}`))
+	layerDigest := writeTestBlob(t, dir, layer)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"` + configDigest + `","size":37},` +
+		`"layers":[{"mediaType":"` + layerMediaType + `","digest":"` + layerDigest + `","size":` + jsonInt(len(layer)) + `}]}`)
+	manifestDigest := writeTestBlob(t, dir, manifest)
+	index := `{"schemaVersion":2,"manifests":[{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` +
+		manifestDigest + `","size":` + jsonInt(len(manifest)) + `,"annotations":{"org.opencontainers.image.ref.name":"v1"}}]}`
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return dir, layerDigest
+}
+
+func jsonInt(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func readTestJSON(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("failed to parse %s: %v", path, err)
+	}
+}
+
+type testDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func TestEncryptLayout_RoundTrip(t *testing.T) {
+	plain := bytes.Repeat([]byte("layer-data"), 5000)
+	src, layerDigest := newTestLayout(t, "application/vnd.oci.image.layer.v1.tar+gzip", plain)
+	dst := filepath.Join(t.TempDir(), "out")
+	kek, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := EncryptLayout(src, dst, kek, testKID)
+	if err != nil {
+		t.Fatalf("EncryptLayout() error = %v", err)
+	}
+	if result.Manifests != 1 || result.Layers != 1 || result.Skipped != 0 {
+		t.Errorf("EncryptLayout() = %+v, want 1 manifest and 1 layer", result)
+	}
+
+	var index struct {
+		Manifests []testDescriptor `json:"manifests"`
+	}
+	readTestJSON(t, filepath.Join(dst, "index.json"), &index)
+	if got := index.Manifests[0].Annotations["org.opencontainers.image.ref.name"]; got != "v1" {
+		t.Errorf("index annotations not preserved, ref.name = %q", got)
+	}
+	manifestPath, err := blobPath(dst, index.Manifests[0].Digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Config testDescriptor   `json:"config"`
+		Layers []testDescriptor `json:"layers"`
+	}
+	readTestJSON(t, manifestPath, &manifest)
+	if _, err := os.Stat(mustBlobPath(t, dst, manifest.Config.Digest)); err != nil {
+		t.Errorf("config blob not copied: %v", err)
+	}
+
+	layer := manifest.Layers[0]
+	if layer.MediaType != "application/vnd.oci.image.layer.v1.tar+gzip+encrypted" {
+		t.Errorf("layer media type = %q", layer.MediaType)
+	}
+	ciphertext, err := os.ReadFile(mustBlobPath(t, dst, layer.Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(ciphertext)) != layer.Size || bytes.Equal(ciphertext, plain) {
+		t.Fatalf("layer blob size = %d (descriptor %d), or not encrypted", len(ciphertext), layer.Size)
+	}
+
+	// Decrypt the layer with ocicrypt, unwrapping the layer options as the
+	// attestation-agent key provider does in the guest.
+	provider := &testKeyProvider{t: t, kek: kek}
+	ocicrypt.RegisterKeyWrapper("provider.attestation-agent", provider)
+	desc := ocispec.Descriptor{
+		MediaType:   layer.MediaType,
+		Digest:      godigest.Digest(layer.Digest),
+		Size:        layer.Size,
+		Annotations: layer.Annotations,
+	}
+	dc := &config.DecryptConfig{Parameters: map[string][][]byte{testKeyProviderParam: {kek}}}
+	reader, _, err := ocicrypt.DecryptLayer(dc, bytes.NewReader(ciphertext), desc, false)
+	if err != nil {
+		t.Fatalf("ocicrypt.DecryptLayer() error = %v", err)
+	}
+	decrypted, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decrypt layer: %v", err)
+	}
+	if !bytes.Equal(decrypted, plain) {
+		t.Error("decrypted layer does not match the original")
+	}
+	var priv blockcipher.PrivateLayerBlockCipherOptions
+	if err := json.Unmarshal(provider.optsData, &priv); err != nil {
+		t.Fatal(err)
+	}
+	if priv.Digest.String() != layerDigest {
+		t.Errorf("private options digest = %q, want %q", priv.Digest, layerDigest)
+	}
+}
+
+// testKeyProviderParam is the decrypt config parameter holding the KEK.
+const testKeyProviderParam = "attestation-agent-kek"
+
+// testKeyProvider unwraps attestation-agent annotation packets with a KEK, as
+// the Confidential Data Hub does after fetching the KEK from KBS.
+type testKeyProvider struct {
+	t        *testing.T
+	kek      []byte
+	optsData []byte
+}
+
+func (p *testKeyProvider) WrapKeys(*config.EncryptConfig, []byte) ([]byte, error) {
+	return nil, nil
+}
+
+func (p *testKeyProvider) UnwrapKey(_ *config.DecryptConfig, annotation []byte) ([]byte, error) {
+	var packet annotationPacket
+	if err := json.Unmarshal(annotation, &packet); err != nil {
+		return nil, err
+	}
+	if packet.Kid != testKID || packet.WrapType != "A256GCM" {
+		p.t.Errorf("annotation packet = %+v", packet)
+	}
+	block, err := aes.NewCipher(p.kek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := base64.StdEncoding.DecodeString(packet.IV)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(packet.WrappedData)
+	if err != nil {
+		return nil, err
+	}
+	p.optsData, err = gcm.Open(nil, iv, wrapped, nil)
+	return p.optsData, err
+}
+
+func (p *testKeyProvider) GetAnnotationID() string { return AnnotationKeyProvider }
+
+func (p *testKeyProvider) NoPossibleKeys(params map[string][][]byte) bool {
+	return len(params[testKeyProviderParam]) == 0
+}
+
+func (p *testKeyProvider) GetPrivateKeys(params map[string][][]byte) [][]byte {
+	return params[testKeyProviderParam]
+}
+
+func (p *testKeyProvider) GetKeyIdsFromPacket(string) ([]uint64, error) { return nil, nil }
+
+func (p *testKeyProvider) GetRecipients(string) ([]string, error) { return nil, nil }
+
+func mustBlobPath(t *testing.T, dir, digest string) string {
+	t.Helper()
+	p, err := blobPath(dir, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEncryptLayout_Errors(t *testing.T) {
+	kek, _ := GenerateKey()
+
+	src, _ := newTestLayout(t, "application/vnd.oci.image.layer.v1.tar", []byte("x"))
+	dst := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dst, "existing"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EncryptLayout(src, dst, kek, testKID); err == nil || !strings.Contains(err.Error(), "not empty") {
+		t.Errorf("EncryptLayout() error = %v, want non-empty output error", err)
+	}
+
+	if _, err := EncryptLayout(t.TempDir(), filepath.Join(t.TempDir(), "out"), kek, testKID); err == nil {
+		t.Error("EncryptLayout() expected error for a directory without oci-layout")
+	}
+
+	if _, err := EncryptLayout(src, filepath.Join(t.TempDir(), "out"), kek[:16], testKID); err == nil {
+		t.Error("EncryptLayout() expected error for a short key")
+	}
+
+	docker, _ := newTestLayout(t, "application/vnd.docker.image.rootfs.diff.tar.gzip", []byte("x"))
+	if _, err := EncryptLayout(docker, filepath.Join(t.TempDir(), "out"), kek, testKID); err == nil || !strings.Contains(err.Error(), "unsupported layer media type") {
+		t.Errorf("EncryptLayout() error = %v, want unsupported media type", err)
+	}
+}
+
+func TestBlobPath(t *testing.T) {
+	for _, digest := range []string{"sha256:../../etc/passwd", "sha512:" + strings.Repeat("a", 64), "sha256:ABC"} {
+		if _, err := blobPath("/layout", digest); err == nil {
+			t.Errorf("blobPath(%q) expected error", digest)
+		}
+	}
+}
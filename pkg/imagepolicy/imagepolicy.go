@@ -0,0 +1,195 @@
+// Package imagepolicy builds the containers-policy.json document that the
+// Confidential Data Hub enforces when pulling images inside the guest.
+//
+// The policy follows the containers-policy.json(5) format understood by
+// image-rs: a default requirement plus per-scope requirements for the docker
+// transport. Public keys are referenced by KBS resource URIs so that the guest
+// fetches them after attestation.
+package imagepolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Requirement types understood by image-rs.
+const (
+	TypeInsecureAcceptAnything = "insecureAcceptAnything"
+	TypeReject                 = "reject"
+	TypeSigstoreSigned         = "sigstoreSigned"
+	TypeSignedBy               = "signedBy"
+)
+
+// KeyType identifies the kind of public key used to verify signatures.
+type KeyType string
+
+const (
+	// KeySigstore is a cosign/sigstore PEM public key.
+	KeySigstore KeyType = "sigstore"
+	// KeyGPG is a GPG public key (armored or binary).
+	KeyGPG KeyType = "gpg"
+)
+
+// Requirement is one entry of a containers-policy.json requirement list.
+type Requirement struct {
+	Type    string `json:"type"`
+	KeyType string `json:"keyType,omitempty"`
+	KeyPath string `json:"keyPath,omitempty"`
+}
+
+// Policy is a containers-policy.json document.
+type Policy struct {
+	Default    []Requirement                       `json:"default"`
+	Transports map[string]map[string][]Requirement `json:"transports,omitempty"`
+}
+
+// SignatureRule requires images under Scope to be signed by the key at KeyURI.
+type SignatureRule struct {
+	Scope   string
+	KeyType KeyType
+	KeyURI  string
+}
+
+// Options controls the generated policy.
+type Options struct {
+	// AcceptUnsignedByDefault accepts images that match no scope; otherwise
+	// they are rejected.
+	AcceptUnsignedByDefault bool
+	// Signed lists the scopes that require a valid signature.
+	Signed []SignatureRule
+	// Unsigned lists scopes accepted without a signature.
+	Unsigned []string
+}
+
+// tagSanitizer replaces characters that are not allowed in a KBS path segment.
+var tagSanitizer = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// ParseSignatureSpec parses a "scope=path" specification as passed to
+// --require-signature, e.g. "quay.io/myorg=cosign.pub".
+func ParseSignatureSpec(spec string) (scope, keyFile string, err error) {
+	scope, keyFile, ok := strings.Cut(spec, "=")
+	if !ok || keyFile == "" {
+		return "", "", fmt.Errorf("invalid signature requirement %q: must be 'registry[/repository]=key-file'", spec)
+	}
+	if err := ValidateScope(scope); err != nil {
+		return "", "", err
+	}
+	return scope, keyFile, nil
+}
+
+// ValidateScope checks that scope is a docker transport scope: a registry host
+// optionally followed by a repository path, without a URL scheme.
+func ValidateScope(scope string) error {
+	if scope == "" {
+		return fmt.Errorf("image scope cannot be empty")
+	}
+	if strings.Contains(scope, "://") {
+		return fmt.Errorf("invalid image scope %q: use 'registry[/repository]' without a URL scheme", scope)
+	}
+	if strings.ContainsAny(scope, " \t@") || strings.HasPrefix(scope, "/") || strings.HasSuffix(scope, "/") {
+		return fmt.Errorf("invalid image scope %q: use 'registry[/repository]'", scope)
+	}
+	return nil
+}
+
+// DetectKeyType reports whether data is a sigstore (PEM) or GPG public key.
+func DetectKeyType(data []byte) (KeyType, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(trimmed) == 0:
+		return "", fmt.Errorf("key file is empty")
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")):
+		return KeyGPG, nil
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN PUBLIC KEY-----")):
+		return KeySigstore, nil
+	case bytes.HasPrefix(trimmed, []byte("-----BEGIN")):
+		return "", fmt.Errorf("unsupported PEM key: expected a PUBLIC KEY or PGP PUBLIC KEY BLOCK")
+	case trimmed[0]&0x80 != 0:
+		// Binary OpenPGP packets always have the high bit of the tag byte set.
+		return KeyGPG, nil
+	default:
+		return "", fmt.Errorf("unrecognized key format: expected a cosign PEM public key or a GPG public key")
+	}
+}
+
+// KeyResourceType returns the KBS resource type under which keys of kt are stored.
+func KeyResourceType(kt KeyType) string {
+	if kt == KeyGPG {
+		return "gpg-public-key"
+	}
+	return "cosign-public-key"
+}
+
+// KeyResourceTag derives a KBS resource tag from an image scope,
+// e.g. "quay.io/myorg" becomes "quay.io_myorg".
+func KeyResourceTag(scope string) string {
+	return strings.Trim(tagSanitizer.ReplaceAllString(scope, "_"), ".")
+}
+
+// Build returns the policy described by opts.
+func Build(opts Options) (*Policy, error) {
+	p := &Policy{
+		Default: []Requirement{{Type: TypeReject}},
+	}
+	if opts.AcceptUnsignedByDefault {
+		p.Default = []Requirement{{Type: TypeInsecureAcceptAnything}}
+	}
+
+	docker := make(map[string][]Requirement)
+	for _, rule := range opts.Signed {
+		if err := ValidateScope(rule.Scope); err != nil {
+			return nil, err
+		}
+		if _, exists := docker[rule.Scope]; exists {
+			return nil, fmt.Errorf("duplicate policy for image scope %q", rule.Scope)
+		}
+		req := Requirement{KeyPath: rule.KeyURI}
+		switch rule.KeyType {
+		case KeySigstore:
+			req.Type = TypeSigstoreSigned
+		case KeyGPG:
+			req.Type = TypeSignedBy
+			req.KeyType = "GPGKeys"
+		default:
+			return nil, fmt.Errorf("unsupported key type %q for image scope %q", rule.KeyType, rule.Scope)
+		}
+		docker[rule.Scope] = []Requirement{req}
+	}
+	for _, scope := range opts.Unsigned {
+		if err := ValidateScope(scope); err != nil {
+			return nil, err
+		}
+		if _, exists := docker[scope]; exists {
+			return nil, fmt.Errorf("duplicate policy for image scope %q", scope)
+		}
+		docker[scope] = []Requirement{{Type: TypeInsecureAcceptAnything}}
+	}
+
+	if len(docker) > 0 {
+		p.Transports = map[string]map[string][]Requirement{"docker": docker}
+	}
+	return p, nil
+}
+
+// Marshal encodes the policy as indented JSON.
+func (p *Policy) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal image policy: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Scopes returns the docker scopes of the policy in sorted order.
+func (p *Policy) Scopes() []string {
+	scopes := make([]string, 0, len(p.Transports["docker"]))
+	for scope := range p.Transports["docker"] {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
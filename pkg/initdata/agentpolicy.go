@@ -0,0 +1,321 @@
+package initdata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// agentPolicyRules are the Rego rules of a generated agent policy. They check
+// each CreateContainerRequest against the containers data document emitted by
+// GenerateAgentPolicy.
+const agentPolicyRules = `
+# The pause container of the pod sandbox.
+CreateContainerRequest if {
+	input.OCI.Annotations["io.kubernetes.cri.container-type"] == "sandbox"
+}
+
+CreateContainerRequest if {
+	some c in containers
+	input.OCI.Annotations["io.kubernetes.cri.container-name"] == c.name
+	input.OCI.Annotations["io.kubernetes.cri.image-name"] in c.images
+	allow_args(c)
+	allow_env(c)
+	allow_mounts(c)
+}
+
+# No command or args in the spec: the image entrypoint is used.
+allow_args(c) if {
+	c.command == null
+	count(c.args) == 0
+}
+
+allow_args(c) if {
+	c.command != null
+	input.OCI.Process.Args == array.concat(c.command, c.args)
+}
+
+# Only args in the spec: they follow the image entrypoint.
+allow_args(c) if {
+	c.command == null
+	count(c.args) > 0
+	n := count(input.OCI.Process.Args)
+	array.slice(input.OCI.Process.Args, n - count(c.args), n) == c.args
+}
+
+allow_env(c) if {
+	every e in input.OCI.Process.Env {
+		allow_env_var(c, e)
+	}
+}
+
+# Variables set literally in the spec must keep their value.
+allow_env_var(c, e) if e in c.env
+
+# Variables set from secrets, config maps or field references may take any value.
+allow_env_var(c, e) if split(e, "=")[0] in c.env_from
+
+# Variables the spec does not name are only allowed when the runtime or
+# Kubernetes adds them to every container: service links, the pod hostname,
+# the terminal type and a PATH of system directories. Other variables the
+# image sets must be listed in the spec, which pins their value.
+allow_env_var(c, e) if {
+	name := split(e, "=")[0]
+	not name in c.env_names
+	not name in c.env_from
+	some pattern in runtime_env
+	regex.match(pattern, e)
+}
+
+runtime_env := [
+	"^[A-Z0-9_]+_SERVICE_HOST=[0-9a-fA-F.:]+$",
+	"^[A-Z0-9_]+_SERVICE_PORT(_[A-Z0-9_]+)?=[0-9]+$",
+	"^[A-Z0-9_]+_PORT=(tcp|udp|sctp)://[0-9a-fA-F.:\\[\\]]+:[0-9]+$",
+	"^[A-Z0-9_]+_PORT_[0-9]+_(TCP|UDP|SCTP)=(tcp|udp|sctp)://[0-9a-fA-F.:\\[\\]]+:[0-9]+$",
+	"^[A-Z0-9_]+_PORT_[0-9]+_(TCP|UDP|SCTP)_PROTO=(tcp|udp|sctp)$",
+	"^[A-Z0-9_]+_PORT_[0-9]+_(TCP|UDP|SCTP)_PORT=[0-9]+$",
+	"^[A-Z0-9_]+_PORT_[0-9]+_(TCP|UDP|SCTP)_ADDR=[0-9a-fA-F.:]+$",
+	"^HOSTNAME=[a-z0-9]([-a-z0-9.]*[a-z0-9])?$",
+	"^TERM=xterm$",
+	"^PATH=(/usr/local/sbin|/usr/local/bin|/usr/sbin|/usr/bin|/sbin|/bin)(:(/usr/local/sbin|/usr/local/bin|/usr/sbin|/usr/bin|/sbin|/bin))*$",
+]
+
+allow_mounts(c) if {
+	every m in input.OCI.Mounts {
+		allow_mount(c, m)
+	}
+}
+
+# Volumes of the spec are bind mounts the agent prepares under
+# kata_mount_prefix, read-only when the spec says so.
+# The agent serializes the OCI mount type as type_.
+allow_mount(c, m) if {
+	some v in c.mounts
+	m.destination == v.path
+	m.type_ == "bind"
+	kata_mount_source(m.source)
+	every o in m.options {
+		o in volume_mount_options
+	}
+	allow_mount_access(v, m)
+}
+
+allow_mount(_, m) if {
+	some r in runtime_mounts[m.destination]
+	m.type_ == r.type_
+	allow_runtime_source(r, m)
+}
+
+allow_mount_access(v, m) if {
+	v.read_only
+	"ro" in m.options
+	not "rw" in m.options
+}
+
+allow_mount_access(v, _) if not v.read_only
+
+allow_runtime_source(r, m) if {
+	r.type_ != "bind"
+	m.source == r.source
+}
+
+allow_runtime_source(r, m) if {
+	r.type_ == "bind"
+	kata_mount_source(m.source)
+}
+
+kata_mount_source(source) if {
+	startswith(source, kata_mount_prefix)
+	not contains(source, "/../")
+}
+
+kata_mount_prefix := "/run/kata-containers/"
+
+volume_mount_options := {"bind", "rbind", "private", "rprivate", "slave", "rslave", "ro", "rw", "nosuid", "nodev", "noexec"}
+
+kata_bind := [{"type_": "bind", "source": kata_mount_prefix}]
+
+# Mounts added by the container runtime and Kubernetes to every container.
+runtime_mounts := {
+	"/proc": [{"type_": "proc", "source": "proc"}],
+	"/dev": [{"type_": "tmpfs", "source": "tmpfs"}],
+	"/dev/pts": [{"type_": "devpts", "source": "devpts"}],
+	"/dev/mqueue": [{"type_": "mqueue", "source": "mqueue"}],
+	"/dev/shm": array.concat([{"type_": "tmpfs", "source": "shm"}], kata_bind),
+	"/sys": [{"type_": "sysfs", "source": "sysfs"}],
+	"/sys/fs/cgroup": [{"type_": "cgroup", "source": "cgroup"}],
+	"/etc/hosts": kata_bind,
+	"/etc/hostname": kata_bind,
+	"/etc/resolv.conf": kata_bind,
+	"/dev/termination-log": kata_bind,
+	"/var/run/secrets/kubernetes.io/serviceaccount": kata_bind,
+}
+`
+
+// policyContainer is the per-container data a generated agent policy allows.
+type policyContainer struct {
+	Name     string        `json:"name"`
+	Images   []string      `json:"images"`
+	Command  []string      `json:"command"`
+	Args     []string      `json:"args"`
+	Env      []string      `json:"env"`
+	EnvNames []string      `json:"env_names"`
+	EnvFrom  []string      `json:"env_from"`
+	Mounts   []policyMount `json:"mounts"`
+}
+
+// policyMount is a volume mount of a container spec.
+type policyMount struct {
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"read_only"`
+}
+
+// GenerateAgentPolicy derives a restrictive Kata agent policy from a pod spec
+// (as returned by manifest.GetPodSpec). The policy only lets the agent create
+// the pod's containers and init containers with their images, commands,
+// literal environment values and volume mounts, and denies exec into them.
+// Environment variables the spec does not name are limited to the ones the
+// runtime and Kubernetes add, so variables set by the image must be listed
+// in the spec.
+//
+// Image references that are not pinned by digest are allowed by name but
+// reported in the returned warnings, since the registry can change what they
+// resolve to.
+func GenerateAgentPolicy(podSpec map[string]interface{}) (string, []string, error) {
+	var containers []policyContainer
+	var warnings []string
+	for _, field := range []string{"initContainers", "containers"} {
+		list, _ := podSpec[field].([]interface{})
+		for _, item := range list {
+			spec, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			c, err := policyContainerFromSpec(spec)
+			if err != nil {
+				return "", nil, err
+			}
+			if !strings.Contains(c.Images[0], "@") {
+				warnings = append(warnings, fmt.Sprintf("container %s: image %s is not pinned by digest", c.Name, c.Images[0]))
+			}
+			containers = append(containers, c)
+		}
+	}
+	if len(containers) == 0 {
+		return "", nil, fmt.Errorf("pod spec has no containers")
+	}
+
+	data, err := json.MarshalIndent(containers, "", "\t")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode containers: %w", err)
+	}
+
+	// Start from the default policy, but only allow the containers above.
+	defaults := strings.Replace(getDefaultPolicy(), "default CreateContainerRequest := true", "default CreateContainerRequest := false", 1)
+	defaults = strings.Replace(defaults, "package agent_policy\n", "package agent_policy\n\nimport future.keywords.every\nimport future.keywords.if\nimport future.keywords.in\n", 1)
+
+	var sb strings.Builder
+	sb.WriteString("# Generated by cococtl from the workload spec.\n")
+	sb.WriteString(defaults)
+	sb.WriteString(agentPolicyRules)
+	fmt.Fprintf(&sb, "\ncontainers := %s\n", data)
+	return sb.String(), warnings, nil
+}
+
+// policyContainerFromSpec extracts the policy data of one container spec.
+func policyContainerFromSpec(spec map[string]interface{}) (policyContainer, error) {
+	name, _ := spec["name"].(string)
+	image, _ := spec["image"].(string)
+	if name == "" || image == "" {
+		return policyContainer{}, fmt.Errorf("container spec requires name and image")
+	}
+
+	c := policyContainer{
+		Name:     name,
+		Images:   imageReferences(image),
+		Command:  stringList(spec["command"]),
+		Args:     stringList(spec["args"]),
+		Env:      []string{},
+		EnvNames: []string{},
+		EnvFrom:  []string{},
+		Mounts:   []policyMount{},
+	}
+	if c.Args == nil {
+		c.Args = []string{}
+	}
+
+	envList, _ := spec["env"].([]interface{})
+	for _, item := range envList {
+		env, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		envName, _ := env["name"].(string)
+		if envName == "" {
+			continue
+		}
+		if _, dynamic := env["valueFrom"]; dynamic {
+			c.EnvFrom = append(c.EnvFrom, envName)
+			continue
+		}
+		value, _ := env["value"].(string)
+		c.EnvNames = append(c.EnvNames, envName)
+		c.Env = append(c.Env, envName+"="+value)
+	}
+
+	mounts, _ := spec["volumeMounts"].([]interface{})
+	for _, item := range mounts {
+		if mount, ok := item.(map[string]interface{}); ok {
+			if path, _ := mount["mountPath"].(string); path != "" {
+				readOnly, _ := mount["readOnly"].(bool)
+				c.Mounts = append(c.Mounts, policyMount{Path: path, ReadOnly: readOnly})
+			}
+		}
+	}
+	sort.Slice(c.Mounts, func(i, j int) bool { return c.Mounts[i].Path < c.Mounts[j].Path })
+
+	return c, nil
+}
+
+// imageReferences returns image as written in the spec plus the fully
+// qualified forms the runtime may report for it (registry, library namespace
+// and implicit :latest tag added).
+func imageReferences(image string) []string {
+	name, digest, hasDigest := strings.Cut(image, "@")
+
+	qualified := name
+	first, _, hasSlash := strings.Cut(name, "/")
+	if !hasSlash || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		if !hasSlash {
+			qualified = "docker.io/library/" + name
+		} else {
+			qualified = "docker.io/" + name
+		}
+	}
+	lastSegment := qualified[strings.LastIndex(qualified, "/")+1:]
+	if !hasDigest && !strings.Contains(lastSegment, ":") {
+		qualified += ":latest"
+	}
+	if hasDigest {
+		qualified += "@" + digest
+	}
+
+	if qualified == image {
+		return []string{image}
+	}
+	return []string{image, qualified}
+}
+
+// stringList converts a YAML sequence of strings; it returns nil when v is absent.
+func stringList(v interface{}) []string {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		out = append(out, fmt.Sprint(item))
+	}
+	return out
+}
@@ -0,0 +1,226 @@
+package initdata
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/rego"
+	"gopkg.in/yaml.v3"
+)
+
+const testPodSpec = `
+initContainers:
+- name: init
+  image: quay.io/fedora/fedora@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+  command: ["curl", "http://localhost:8006/cdh/resource/default/attestation-status/status"]
+containers:
+- name: app
+  image: nginx:1.25
+  args: ["-g", "daemon off;"]
+  env:
+  - name: MODE
+    value: production
+  - name: DB_PASSWORD
+    valueFrom:
+      secretKeyRef:
+        name: db
+        key: password
+  volumeMounts:
+  - name: data
+    mountPath: /data
+  - name: config
+    mountPath: /etc/app
+    readOnly: true
+`
+
+func loadTestPodSpec(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal([]byte(testPodSpec), &spec); err != nil {
+		t.Fatalf("failed to parse pod spec: %v", err)
+	}
+	return spec
+}
+
+func TestGenerateAgentPolicy(t *testing.T) {
+	policy, warnings, err := GenerateAgentPolicy(loadTestPodSpec(t))
+	if err != nil {
+		t.Fatalf("GenerateAgentPolicy() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"package agent_policy",
+		"default CreateContainerRequest := false",
+		"default ExecProcessRequest := false",
+		"default SetPolicyRequest := false",
+		`"name": "app"`,
+		`"docker.io/library/nginx:1.25"`,
+		`"MODE=production"`,
+		`"DB_PASSWORD"`,
+		`"/data"`,
+		`"name": "init"`,
+	} {
+		if !strings.Contains(policy, want) {
+			t.Errorf("policy missing %q", want)
+		}
+	}
+	if strings.Contains(policy, "default CreateContainerRequest := true") {
+		t.Error("generated policy must not allow arbitrary containers")
+	}
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "nginx:1.25") {
+		t.Errorf("warnings = %v, want one warning for the unpinned nginx image", warnings)
+	}
+}
+
+// createContainerInput returns a CreateContainerRequest for the app container
+// of testPodSpec as the runtime sends it, with extra env and mounts.
+func createContainerInput(env []string, mounts []map[string]interface{}) map[string]interface{} {
+	baseMounts := []map[string]interface{}{
+		{"destination": "/proc", "type_": "proc", "source": "proc", "options": []string{"nosuid", "noexec", "nodev"}},
+		{"destination": "/etc/hosts", "type_": "bind", "source": "/run/kata-containers/shared/containers/abc-hosts", "options": []string{"rbind", "rprivate", "rw"}},
+		{"destination": "/data", "type_": "bind", "source": "/run/kata-containers/shared/containers/abc-data", "options": []string{"rbind", "rprivate", "rw"}},
+		{"destination": "/etc/app", "type_": "bind", "source": "/run/kata-containers/shared/containers/abc-config", "options": []string{"rbind", "rprivate", "ro"}},
+	}
+	return map[string]interface{}{
+		"OCI": map[string]interface{}{
+			"Annotations": map[string]string{
+				"io.kubernetes.cri.container-type": "container",
+				"io.kubernetes.cri.container-name": "app",
+				"io.kubernetes.cri.image-name":     "docker.io/library/nginx:1.25",
+			},
+			"Process": map[string]interface{}{
+				"Args": []string{"/docker-entrypoint.sh", "nginx", "-g", "daemon off;"},
+				"Env": append([]string{
+					"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+					"HOSTNAME=app-7d9f8b6c5-x2x4q",
+					"MODE=production",
+					"DB_PASSWORD=s3cret",
+					"KUBERNETES_SERVICE_HOST=10.96.0.1",
+					"KUBERNETES_SERVICE_PORT=443",
+					"KUBERNETES_SERVICE_PORT_HTTPS=443",
+					"KUBERNETES_PORT=tcp://10.96.0.1:443",
+					"KUBERNETES_PORT_443_TCP=tcp://10.96.0.1:443",
+					"KUBERNETES_PORT_443_TCP_PROTO=tcp",
+					"KUBERNETES_PORT_443_TCP_PORT=443",
+					"KUBERNETES_PORT_443_TCP_ADDR=10.96.0.1",
+				}, env...),
+			},
+			"Mounts": append(baseMounts, mounts...),
+		},
+	}
+}
+
+func TestGenerateAgentPolicy_CreateContainerRequest(t *testing.T) {
+	policy, _, err := GenerateAgentPolicy(loadTestPodSpec(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := rego.New(
+		rego.Query("data.agent_policy.CreateContainerRequest"),
+		rego.Module("policy.rego", policy),
+		rego.SetRegoVersion(ast.RegoV0),
+	).PrepareForEval(context.Background())
+	if err != nil {
+		t.Fatalf("failed to compile the generated policy: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		env    []string
+		mounts []map[string]interface{}
+		allow  bool
+	}{
+		{"spec and runtime", nil, nil, true},
+		{"terminal", []string{"TERM=xterm"}, nil, true},
+		{"image env not in spec", []string{"NGINX_VERSION=1.25.5"}, nil, false},
+		{"interpreter options", []string{"NODE_OPTIONS=--require /data/x.js"}, nil, false},
+		{"loader override", []string{"LD_PRELOAD=/data/x.so"}, nil, false},
+		{"changed literal", []string{"MODE=debug"}, nil, false},
+		{"PATH into a volume", []string{"PATH=/data:/usr/bin"}, nil, false},
+		{"service link with a command", []string{"EVIL_SERVICE_HOST=$(id)"}, nil, false},
+		{"host path source", nil, []map[string]interface{}{
+			{"destination": "/data", "type_": "bind", "source": "/etc", "options": []string{"rbind", "rw"}},
+		}, false},
+		{"writable read-only volume", nil, []map[string]interface{}{
+			{"destination": "/etc/app", "type_": "bind", "source": "/run/kata-containers/shared/containers/abc-config", "options": []string{"rbind", "rw"}},
+		}, false},
+		{"suid volume", nil, []map[string]interface{}{
+			{"destination": "/data", "type_": "bind", "source": "/run/kata-containers/shared/containers/abc-data", "options": []string{"rbind", "suid"}},
+		}, false},
+		{"escaping source", nil, []map[string]interface{}{
+			{"destination": "/data", "type_": "bind", "source": "/run/kata-containers/../../etc", "options": []string{"rbind"}},
+		}, false},
+		{"proc from the host", nil, []map[string]interface{}{
+			{"destination": "/proc", "type_": "bind", "source": "/proc", "options": []string{"rbind"}},
+		}, false},
+		{"unknown destination", nil, []map[string]interface{}{
+			{"destination": "/opt", "type_": "bind", "source": "/run/kata-containers/shared/containers/abc-opt", "options": []string{"rbind"}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs, err := query.Eval(context.Background(), rego.EvalInput(createContainerInput(tt.env, tt.mounts)))
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got := rs.Allowed(); got != tt.allow {
+				t.Errorf("CreateContainerRequest = %v, want %v", got, tt.allow)
+			}
+		})
+	}
+}
+
+func TestGenerateAgentPolicy_NoContainers(t *testing.T) {
+	if _, _, err := GenerateAgentPolicy(map[string]interface{}{}); err == nil {
+		t.Error("GenerateAgentPolicy() expected error for a pod spec without containers")
+	}
+}
+
+func TestPolicyContainerFromSpec(t *testing.T) {
+	spec := loadTestPodSpec(t)
+	app := spec["containers"].([]interface{})[0].(map[string]interface{})
+
+	c, err := policyContainerFromSpec(app)
+	if err != nil {
+		t.Fatalf("policyContainerFromSpec() error = %v", err)
+	}
+	if c.Command != nil {
+		t.Errorf("Command = %v, want nil (image entrypoint)", c.Command)
+	}
+	if !reflect.DeepEqual(c.Args, []string{"-g", "daemon off;"}) {
+		t.Errorf("Args = %v", c.Args)
+	}
+	if !reflect.DeepEqual(c.Env, []string{"MODE=production"}) {
+		t.Errorf("Env = %v", c.Env)
+	}
+	if !reflect.DeepEqual(c.EnvFrom, []string{"DB_PASSWORD"}) {
+		t.Errorf("EnvFrom = %v", c.EnvFrom)
+	}
+
+	if _, err := policyContainerFromSpec(map[string]interface{}{"name": "x"}); err == nil {
+		t.Error("policyContainerFromSpec() expected error for a container without image")
+	}
+}
+
+func TestImageReferences(t *testing.T) {
+	tests := []struct {
+		image string
+		want  []string
+	}{
+		{"nginx", []string{"nginx", "docker.io/library/nginx:latest"}},
+		{"nginx:1.25", []string{"nginx:1.25", "docker.io/library/nginx:1.25"}},
+		{"bitnami/redis:7", []string{"bitnami/redis:7", "docker.io/bitnami/redis:7"}},
+		{"quay.io/org/app:v1", []string{"quay.io/org/app:v1"}},
+		{"localhost:5000/app", []string{"localhost:5000/app", "localhost:5000/app:latest"}},
+		{"nginx@sha256:abc", []string{"nginx@sha256:abc", "docker.io/library/nginx@sha256:abc"}},
+	}
+	for _, tt := range tests {
+		if got := imageReferences(tt.image); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("imageReferences(%q) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package initdata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Annotation size limits the encoded initdata is checked against.
+const (
+	// MaxAnnotationsSize is the Kubernetes limit on the total size of an
+	// object's annotations (256 KiB); the API server rejects larger objects.
+	MaxAnnotationsSize = 256 * 1024
+	// MaxRemoteUserDataSize is the smallest cloud user-data limit (16 KiB on
+	// AWS) through which peer pods pass initdata to the pod VM.
+	MaxRemoteUserDataSize = 16 * 1024
+	// sizeWarningPercent is the share of a limit above which a warning is given.
+	sizeWarningPercent = 80
+)
+
+// DefaultAlgorithm returns the initdata hash algorithm for runtimeClass.
+// TDX and SNP bind the digest into 48- and 32-byte measurement fields, so they
+// default to sha384 (SNP binds its first 32 bytes); other runtimes use sha256.
+func DefaultAlgorithm(runtimeClass string) string {
+	if tee, ok := TEEFromRuntimeClass(runtimeClass); ok && (tee == TEETDX || tee == TEESNP) {
+		return "sha384"
+	}
+	return InitDataAlgorithm
+}
+
+// ResolveAlgorithm returns the initdata hash algorithm to use: explicit (from a
+// flag) if set, then configured (from the config), then the runtime class
+// default.
+func ResolveAlgorithm(explicit, configured, runtimeClass string) (string, error) {
+	algorithm := explicit
+	if algorithm == "" {
+		algorithm = configured
+	}
+	if algorithm == "" {
+		return DefaultAlgorithm(runtimeClass), nil
+	}
+	if !IsValidAlgorithm(algorithm) {
+		return "", fmt.Errorf("unsupported initdata algorithm %q (must be one of: %s)", algorithm, strings.Join(ValidAlgorithms, ", "))
+	}
+	return algorithm, nil
+}
+
+// CheckAnnotationSize returns warnings when the encoded initdata annotation
+// approaches or exceeds the Kubernetes annotation limit or, for peer pods
+// (kata-remote runtime classes), the cloud user-data limit.
+func CheckAnnotationSize(encoded, runtimeClass string) []string {
+	var warnings []string
+	check := func(limit int, what string) {
+		size := len(encoded)
+		switch {
+		case size > limit:
+			warnings = append(warnings, fmt.Sprintf("initdata annotation is %d bytes, over the %d KiB %s", size, limit/1024, what))
+		case size*100 >= limit*sizeWarningPercent:
+			warnings = append(warnings, fmt.Sprintf("initdata annotation is %d bytes, close to the %d KiB %s", size, limit/1024, what))
+		}
+	}
+	check(MaxAnnotationsSize, "Kubernetes limit on the total size of annotations")
+	if strings.Contains(strings.ToLower(runtimeClass), "remote") {
+		check(MaxRemoteUserDataSize, "user-data limit of some cloud providers for peer pods")
+	}
+	return warnings
+}
@@ -0,0 +1,76 @@
+package initdata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestResolveAlgorithm(t *testing.T) {
+	tests := []struct {
+		name                 string
+		explicit, configured string
+		runtimeClass         string
+		want                 string
+	}{
+		{"tdx default", "", "", "kata-qemu-tdx", "sha384"},
+		{"snp default", "", "", "kata-qemu-snp", "sha384"},
+		{"generic default", "", "", "kata-cc", "sha256"},
+		{"config wins over default", "", "sha512", "kata-qemu-tdx", "sha512"},
+		{"flag wins over config", "sha256", "sha512", "kata-qemu-tdx", "sha256"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveAlgorithm(tt.explicit, tt.configured, tt.runtimeClass)
+			if err != nil || got != tt.want {
+				t.Errorf("ResolveAlgorithm() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := ResolveAlgorithm("md5", "", "kata-cc"); err == nil || !strings.Contains(err.Error(), "unsupported initdata algorithm") {
+		t.Errorf("ResolveAlgorithm(md5) error = %v", err)
+	}
+}
+
+func TestGenerateRaw_ConfiguredAlgorithm(t *testing.T) {
+	cfg := minimalCfg()
+	cfg.Initdata.Algorithm = "sha384"
+	raw, err := GenerateRaw(cfg, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateRaw() error = %v", err)
+	}
+	var id InitData
+	if err := toml.Unmarshal(raw, &id); err != nil {
+		t.Fatal(err)
+	}
+	if id.Algorithm != "sha384" {
+		t.Errorf("algorithm = %q, want sha384", id.Algorithm)
+	}
+
+	cfg.Initdata.Algorithm = "sha1"
+	if _, err := GenerateRaw(cfg, "", nil); err == nil {
+		t.Error("GenerateRaw() accepted an unsupported algorithm")
+	}
+}
+
+func TestCheckAnnotationSize(t *testing.T) {
+	if warnings := CheckAnnotationSize(strings.Repeat("a", 1024), "kata-remote"); len(warnings) != 0 {
+		t.Errorf("small annotation warnings = %v", warnings)
+	}
+
+	near := strings.Repeat("a", 14*1024)
+	if warnings := CheckAnnotationSize(near, "kata-qemu-tdx"); len(warnings) != 0 {
+		t.Errorf("14 KiB annotation on kata-qemu-tdx warnings = %v", warnings)
+	}
+	if warnings := CheckAnnotationSize(near, "kata-remote"); len(warnings) != 1 || !strings.Contains(warnings[0], "close to the 16 KiB") {
+		t.Errorf("14 KiB annotation on kata-remote warnings = %v", warnings)
+	}
+
+	over := strings.Repeat("a", MaxAnnotationsSize+1)
+	warnings := CheckAnnotationSize(over, "kata-remote")
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "over the 256 KiB Kubernetes limit") || !strings.Contains(warnings[1], "over the 16 KiB") {
+		t.Errorf("oversized annotation warnings = %v", warnings)
+	}
+}
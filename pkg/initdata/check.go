@@ -0,0 +1,337 @@
+package initdata
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Finding is a problem found in an initdata data file.
+type Finding struct {
+	// Source locates the problem, e.g. "cdh.toml/kbc.url".
+	Source string
+	// Message describes the problem.
+	Message string
+	// Warning marks findings that do not make the initdata invalid, such as
+	// keys the guest components ignore.
+	Warning bool
+}
+
+func (f Finding) String() string {
+	return f.Source + ": " + f.Message
+}
+
+// RequiredPolicyRules lists the Kata agent requests a policy must define for a
+// pod to start; the agent denies requests whose rule is undefined.
+var RequiredPolicyRules = []string{
+	"CreateContainerRequest",
+	"CreateSandboxRequest",
+	"DestroySandboxRequest",
+	"RemoveContainerRequest",
+	"StartContainerRequest",
+	"WaitProcessRequest",
+}
+
+// PolicyPackage is the Rego package the Kata agent evaluates.
+const PolicyPackage = "agent_policy"
+
+// KnownKBCs lists the key broker clients the Confidential Data Hub supports.
+var KnownKBCs = []string{"cc_kbc", "offline_fs_kbc", "offline_sev_kbc"}
+
+// valueKind is the TOML type expected for a config key.
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindInt
+	kindBool
+	kindStringArray
+	kindTable
+	kindTableArray
+)
+
+func (k valueKind) String() string {
+	return [...]string{"a string", "an integer", "a boolean", "an array of strings", "a table", "an array of tables"}[k]
+}
+
+// schemaField describes one config key. Nested tables and the elements of
+// arrays of tables are described by fields.
+type schemaField struct {
+	kind     valueKind
+	required bool
+	format   func(string) error
+	fields   map[string]*schemaField
+}
+
+var aaSchema = map[string]*schemaField{
+	"token_configs": {kind: kindTable, fields: map[string]*schemaField{
+		"coco_as": {kind: kindTable, fields: map[string]*schemaField{
+			"url": {kind: kindString, required: true, format: checkHTTPURL},
+		}},
+		"kbs": {kind: kindTable, fields: map[string]*schemaField{
+			"url":  {kind: kindString, required: true, format: checkHTTPURL},
+			"cert": {kind: kindString},
+		}},
+	}},
+	"eventlog_config": {kind: kindTable, fields: map[string]*schemaField{
+		"eventlog_algorithm": {kind: kindString, format: checkOneOf("sha256", "sha384", "sha512", "sm3")},
+		"init_pcr":           {kind: kindInt},
+		"enable_eventlog":    {kind: kindBool},
+	}},
+}
+
+var cdhSchema = map[string]*schemaField{
+	"socket": {kind: kindString},
+	"kbc": {kind: kindTable, required: true, fields: map[string]*schemaField{
+		"name":     {kind: kindString, required: true, format: checkOneOf(KnownKBCs...)},
+		"url":      {kind: kindString, format: checkHTTPURL},
+		"kbs_cert": {kind: kindString},
+	}},
+	"credentials": {kind: kindTableArray, fields: map[string]*schemaField{
+		"resource_uri": {kind: kindString, required: true, format: checkKBSURI},
+		"path":         {kind: kindString, required: true, format: checkAbsPath},
+	}},
+	"image": {kind: kindTable, fields: map[string]*schemaField{
+		"image_security_policy_uri":                {kind: kindString, format: checkKBSURI},
+		"sigstore_config_uri":                      {kind: kindString, format: checkKBSURI},
+		"authenticated_registry_credentials_uri":   {kind: kindString, format: checkKBSURI},
+		"registry_configuration_uri":               {kind: kindString, format: checkKBSURI},
+		"extra_root_certificates":                  {kind: kindStringArray},
+		"max_concurrent_layer_downloads_per_image": {kind: kindInt},
+		"work_dir": {kind: kindString, format: checkAbsPath},
+		"image_pull_proxy": {kind: kindTable, fields: map[string]*schemaField{
+			"https_proxy": {kind: kindString, format: checkHTTPURL},
+			"http_proxy":  {kind: kindString, format: checkHTTPURL},
+			"no_proxy":    {kind: kindString},
+		}},
+	}},
+}
+
+// CheckData runs the schema checks on aa.toml and cdh.toml and compiles
+// policy.rego, for whichever of them data contains.
+func CheckData(data map[string]string) []Finding {
+	var findings []Finding
+	if aa, ok := data["aa.toml"]; ok {
+		findings = append(findings, CheckAAConfig(aa)...)
+	}
+	if cdh, ok := data["cdh.toml"]; ok {
+		findings = append(findings, CheckCDHConfig(cdh)...)
+	}
+	if policy, ok := data["policy.rego"]; ok {
+		findings = append(findings, CheckAgentPolicy(policy)...)
+	}
+	return findings
+}
+
+// CheckAAConfig checks aa.toml against the Attestation Agent config schema.
+func CheckAAConfig(content string) []Finding {
+	return checkTOML("aa.toml", content, aaSchema)
+}
+
+// CheckCDHConfig checks cdh.toml against the Confidential Data Hub config
+// schema. The kbc URL is required for cc_kbc, which fetches from a remote KBS.
+func CheckCDHConfig(content string) []Finding {
+	findings := checkTOML("cdh.toml", content, cdhSchema)
+	var cdh map[string]interface{}
+	if toml.Unmarshal([]byte(content), &cdh) == nil {
+		if kbc, ok := cdh["kbc"].(map[string]interface{}); ok && kbc["name"] == "cc_kbc" {
+			if _, ok := kbc["url"]; !ok {
+				findings = append(findings, Finding{Source: "cdh.toml/kbc.url", Message: "required for cc_kbc"})
+			}
+		}
+	}
+	return findings
+}
+
+func checkTOML(file, content string, schema map[string]*schemaField) []Finding {
+	var doc map[string]interface{}
+	if err := toml.Unmarshal([]byte(content), &doc); err != nil {
+		return []Finding{{Source: file, Message: fmt.Sprintf("invalid TOML: %v", err)}}
+	}
+	return checkTable(file+"/", doc, schema)
+}
+
+// checkTable checks the keys of table against schema. prefix is prepended to
+// every key path in findings.
+func checkTable(prefix string, table map[string]interface{}, schema map[string]*schemaField) []Finding {
+	var findings []Finding
+
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		source := prefix + key
+		field, ok := schema[key]
+		if !ok {
+			findings = append(findings, Finding{Source: source, Message: "unknown key, ignored by the guest", Warning: true})
+			continue
+		}
+		findings = append(findings, checkValue(source, table[key], field)...)
+	}
+
+	required := make([]string, 0, len(schema))
+	for key, field := range schema {
+		if _, ok := table[key]; field.required && !ok {
+			required = append(required, key)
+		}
+	}
+	sort.Strings(required)
+	for _, key := range required {
+		findings = append(findings, Finding{Source: prefix + key, Message: "required key is missing"})
+	}
+	return findings
+}
+
+func checkValue(source string, value interface{}, field *schemaField) []Finding {
+	mismatch := []Finding{{Source: source, Message: fmt.Sprintf("must be %s", field.kind)}}
+	switch field.kind {
+	case kindString:
+		s, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		if field.format != nil {
+			if err := field.format(s); err != nil {
+				return []Finding{{Source: source, Message: err.Error()}}
+			}
+		}
+	case kindInt:
+		if _, ok := value.(int64); !ok {
+			return mismatch
+		}
+	case kindBool:
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	case kindStringArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		for _, item := range items {
+			if _, ok := item.(string); !ok {
+				return mismatch
+			}
+		}
+	case kindTable:
+		table, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+		return checkTable(source+".", table, field.fields)
+	case kindTableArray:
+		items, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+		var findings []Finding
+		for i, item := range items {
+			table, ok := item.(map[string]interface{})
+			if !ok {
+				return mismatch
+			}
+			findings = append(findings, checkTable(fmt.Sprintf("%s[%d].", source, i), table, field.fields)...)
+		}
+		return findings
+	}
+	return nil
+}
+
+func checkHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", s)
+	}
+	return nil
+}
+
+func checkKBSURI(s string) error {
+	_, err := kbsuri.Parse(s)
+	return err
+}
+
+func checkAbsPath(s string) error {
+	if !path.IsAbs(s) {
+		return fmt.Errorf("%q is not an absolute path", s)
+	}
+	return nil
+}
+
+func checkOneOf(values ...string) func(string) error {
+	return func(s string) error {
+		for _, v := range values {
+			if s == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not one of: %s", s, strings.Join(values, ", "))
+	}
+}
+
+// CheckAgentPolicy compiles policy.rego with OPA and checks that it declares
+// the agent_policy package and defines RequiredPolicyRules. Kata policies are
+// written in both Rego v0 (with future.keywords imports) and v1 syntax, so the
+// policy is accepted if it compiles as either; otherwise the errors of the
+// closer match are reported.
+func CheckAgentPolicy(content string) []Finding {
+	module, errs := compilePolicy(content, ast.RegoV1)
+	if errs != nil {
+		var v0Errs ast.Errors
+		module, v0Errs = compilePolicy(content, ast.RegoV0)
+		if v0Errs != nil {
+			if len(v0Errs) < len(errs) {
+				errs = v0Errs
+			}
+			findings := make([]Finding, 0, len(errs))
+			for _, e := range errs {
+				source := "policy.rego"
+				if e.Location != nil {
+					source = fmt.Sprintf("policy.rego:%d:%d", e.Location.Row, e.Location.Col)
+				}
+				findings = append(findings, Finding{Source: source, Message: e.Message})
+			}
+			return findings
+		}
+	}
+
+	var findings []Finding
+	if pkg := strings.TrimPrefix(module.Package.Path.String(), "data."); pkg != PolicyPackage {
+		findings = append(findings, Finding{Source: "policy.rego", Message: fmt.Sprintf("package is %q, the Kata agent evaluates %q", pkg, PolicyPackage)})
+	}
+	defined := make(map[string]bool, len(module.Rules))
+	for _, rule := range module.Rules {
+		defined[rule.Head.Ref().String()] = true
+	}
+	for _, name := range RequiredPolicyRules {
+		if !defined[name] {
+			findings = append(findings, Finding{Source: "policy.rego", Message: fmt.Sprintf("rule %s is not defined; the agent denies it and pods cannot run", name)})
+		}
+	}
+	return findings
+}
+
+// compilePolicy parses and compiles a single Rego module as version.
+func compilePolicy(content string, version ast.RegoVersion) (*ast.Module, ast.Errors) {
+	opts := ast.ParserOptions{RegoVersion: version}
+	module, err := ast.ParseModuleWithOpts("policy.rego", content, opts)
+	if err != nil {
+		if errs, ok := err.(ast.Errors); ok {
+			return nil, errs
+		}
+		return nil, ast.Errors{ast.NewError(ast.ParseErr, nil, "%s", err.Error())}
+	}
+	compiler := ast.NewCompiler().WithDefaultRegoVersion(version)
+	compiler.Compile(map[string]*ast.Module{"policy.rego": module})
+	if compiler.Failed() {
+		return nil, compiler.Errors
+	}
+	return module, nil
+}
@@ -0,0 +1,143 @@
+package initdata
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+)
+
+// findingsText joins findings into one string for substring assertions.
+func findingsText(findings []Finding) string {
+	lines := make([]string, len(findings))
+	for i, f := range findings {
+		lines[i] = f.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCheckData_GeneratedInitdata(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.TrusteeServer = "https://kbs.example.com:8080"
+	cfg.ContainerPolicyURI = "kbs:///default/security-policy/default"
+	cfg.KataAgentPolicy = ""
+	imagePullSecrets := []ImagePullSecretInfo{{Namespace: "default", SecretName: "app-registry-auth", Key: "dockerconfigjson"}}
+
+	aa, err := generateAAToml(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cdh, err := generateCDHToml(cfg, nil, imagePullSecrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]string{"aa.toml": aa, "cdh.toml": cdh, "policy.rego": getDefaultPolicy()}
+	if findings := CheckData(data); len(findings) != 0 {
+		t.Errorf("CheckData() on generated initdata = \n%s", findingsText(findings))
+	}
+}
+
+func TestCheckAAConfig(t *testing.T) {
+	aa := `
+[token_configs.kbs]
+url = "kbs.example.com:8080"
+certificate = "x"
+
+[token_configs.coco_as]
+
+[eventlog_config]
+init_pcr = "17"
+`
+	got := findingsText(CheckAAConfig(aa))
+	for _, want := range []string{
+		`aa.toml/token_configs.kbs.url: "kbs.example.com:8080" is not an http(s) URL`,
+		"aa.toml/token_configs.kbs.certificate: unknown key",
+		"aa.toml/token_configs.coco_as.url: required key is missing",
+		"aa.toml/eventlog_config.init_pcr: must be an integer",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("CheckAAConfig() missing %q, got:\n%s", want, got)
+		}
+	}
+
+	if findings := CheckAAConfig("not = [toml"); len(findings) != 1 || !strings.Contains(findings[0].Message, "invalid TOML") {
+		t.Errorf("CheckAAConfig() on invalid TOML = %v", findings)
+	}
+}
+
+func TestCheckCDHConfig(t *testing.T) {
+	cdh := `
+[kbc]
+name = "cc_kbc"
+
+[image]
+image_security_policy_uri = "kbs://default/security-policy"
+extra_root_certificates = "pem"
+
+[[credentials]]
+resource_uri = "kbs:///default/creds/key"
+path = "relative/path"
+`
+	got := findingsText(CheckCDHConfig(cdh))
+	for _, want := range []string{
+		"cdh.toml/kbc.url: required for cc_kbc",
+		"cdh.toml/image.image_security_policy_uri: invalid KBS URI",
+		"cdh.toml/image.extra_root_certificates: must be an array of strings",
+		`cdh.toml/credentials[0].path: "relative/path" is not an absolute path`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("CheckCDHConfig() missing %q, got:\n%s", want, got)
+		}
+	}
+
+	findings := CheckCDHConfig("[kbc]\nname = \"offline_fs_kbc\"\n\n[extra]\nkey = 1\n")
+	if len(findings) != 1 || !findings[0].Warning || findings[0].Source != "cdh.toml/extra" {
+		t.Errorf("CheckCDHConfig() = %v, want a single unknown-key warning", findings)
+	}
+
+	if got := findingsText(CheckCDHConfig("socket = \"unix:///run/cdh.sock\"\n")); !strings.Contains(got, "cdh.toml/kbc: required key is missing") {
+		t.Errorf("CheckCDHConfig() without kbc = %q", got)
+	}
+}
+
+func TestCheckAgentPolicy(t *testing.T) {
+	for _, name := range ListPolicyPresets() {
+		policy, err := LoadPolicyPreset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if findings := CheckAgentPolicy(policy); len(findings) != 0 {
+			t.Errorf("preset %s: CheckAgentPolicy() =\n%s", name, findingsText(findings))
+		}
+	}
+
+	generated, _, err := GenerateAgentPolicy(loadTestPodSpec(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings := CheckAgentPolicy(generated); len(findings) != 0 {
+		t.Errorf("generated policy: CheckAgentPolicy() =\n%s", findingsText(findings))
+	}
+}
+
+func TestCheckAgentPolicy_Errors(t *testing.T) {
+	syntax := "package agent_policy\n\nCreateContainerRequest if { input.x == }\n"
+	if got := findingsText(CheckAgentPolicy(syntax)); !strings.Contains(got, "policy.rego:3:") {
+		t.Errorf("CheckAgentPolicy() syntax error = %q, want a located error", got)
+	}
+
+	got := findingsText(CheckAgentPolicy("package other\n\ndefault CreateContainerRequest := true\n"))
+	for _, want := range []string{`package is "other"`, "rule CreateSandboxRequest is not defined", "rule WaitProcessRequest is not defined"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("CheckAgentPolicy() missing %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "rule CreateContainerRequest") {
+		t.Errorf("CheckAgentPolicy() reported a defined rule:\n%s", got)
+	}
+
+	undefinedRef := "package agent_policy\n\nCreateContainerRequest if { missing_rule }\n"
+	if got := findingsText(CheckAgentPolicy(undefinedRef)); !strings.Contains(got, "missing_rule") {
+		t.Errorf("CheckAgentPolicy() undefined reference = %q", got)
+	}
+}
@@ -0,0 +1,143 @@
+package initdata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// lineEdit is a single line of a line diff: ' ' kept, '-' removed, '+' added.
+type lineEdit struct {
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns a unified diff of a and b with context lines of
+// surrounding text around each change, or an empty string when they are equal.
+// labelA and labelB name the two sides in the "---" and "+++" header lines.
+func UnifiedDiff(labelA, labelB, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", labelA, labelB)
+
+	// aPos and bPos hold the 0-based line numbers at the start of each edit.
+	aPos := make([]int, len(edits)+1)
+	bPos := make([]int, len(edits)+1)
+	for i, e := range edits {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if e.kind != '+' {
+			aPos[i+1]++
+		}
+		if e.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while the next change is within 2*context lines.
+		start := max(i-context, 0)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != ' ' {
+				end = j
+			} else if j-end > 2*context {
+				break
+			}
+		}
+		stop := min(end+context+1, len(edits))
+
+		aCount, bCount := aPos[stop]-aPos[start], bPos[stop]-bPos[start]
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aPos[start], aCount), hunkRange(bPos[start], bCount))
+		for _, e := range edits[start:stop] {
+			sb.WriteByte(e.kind)
+			sb.WriteString(e.line)
+			sb.WriteByte('\n')
+		}
+		i = stop
+	}
+	return sb.String()
+}
+
+// hunkRange formats a unified diff range; an empty range names the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines computes a minimal line diff using the longest common subsequence.
+// Common leading and trailing lines are stripped first, which keeps the
+// quadratic table small for the typical case of a few changed lines.
+func diffLines(a, b []string) []lineEdit {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	edits := make([]lineEdit, 0, len(a)+len(b))
+	for _, l := range a[:prefix] {
+		edits = append(edits, lineEdit{' ', l})
+	}
+
+	// lcs[i][j] is the LCS length of midA[i:] and midB[j:].
+	n, m := len(midA), len(midB)
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case midA[i] == midB[j]:
+			edits = append(edits, lineEdit{' ', midA[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, lineEdit{'-', midA[i]})
+			i++
+		default:
+			edits = append(edits, lineEdit{'+', midB[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, lineEdit{'-', midA[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, lineEdit{'+', midB[j]})
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		edits = append(edits, lineEdit{' ', l})
+	}
+	return edits
+}
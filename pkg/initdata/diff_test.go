@@ -0,0 +1,51 @@
+package initdata
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	if got := UnifiedDiff("a", "b", "x\ny\n", "x\ny\n", 3); got != "" {
+		t.Errorf("UnifiedDiff() of equal inputs = %q, want empty", got)
+	}
+
+	a := "[token_configs.kbs]\nurl = \"http://old:8080\"\n"
+	b := "[token_configs.kbs]\nurl = \"http://new:8080\"\n"
+	want := `--- a/aa.toml
++++ b/aa.toml
+@@ -1,2 +1,2 @@
+ [token_configs.kbs]
+-url = "http://old:8080"
++url = "http://new:8080"
+`
+	if got := UnifiedDiff("a/aa.toml", "b/aa.toml", a, b, 3); got != want {
+		t.Errorf("UnifiedDiff() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := UnifiedDiff("a", "b", "", "line\n", 3); !strings.Contains(got, "@@ -0,0 +1,1 @@\n+line\n") {
+		t.Errorf("UnifiedDiff() of added file =\n%s", got)
+	}
+}
+
+func TestUnifiedDiff_SeparateHunks(t *testing.T) {
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, string(rune('a'+i)))
+	}
+	a := strings.Join(lines, "\n") + "\n"
+	changed := append([]string(nil), lines...)
+	changed[1] = "B"
+	changed[18] = "S"
+	b := strings.Join(changed, "\n") + "\n"
+
+	got := UnifiedDiff("a", "b", a, b, 2)
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Fatalf("UnifiedDiff() produced %d hunks, want 2:\n%s", n, got)
+	}
+	for _, want := range []string{"@@ -1,4 +1,4 @@", "@@ -17,4 +17,4 @@", "-b\n+B\n", "-s\n+S\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("UnifiedDiff() missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package initdata
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// TEE identifies the launch measurement field an initdata digest is bound to.
+type TEE string
+
+// Supported TEEs for initdata digest binding.
+const (
+	// TEETDX binds the digest to MRCONFIGID (48 bytes).
+	TEETDX TEE = "tdx"
+	// TEESNP binds the digest to HOSTDATA (32 bytes).
+	TEESNP TEE = "snp"
+	// TEEVTPM extends the digest into PCR8 of the SHA-256 bank of a (v)TPM.
+	TEEVTPM TEE = "vtpm"
+)
+
+// ValidTEEs lists all TEEs accepted by ExpectedMeasurement.
+var ValidTEEs = []TEE{TEETDX, TEESNP, TEEVTPM}
+
+// ReferenceValueName is the RVPS reference value name under which the
+// expected initdata measurement is registered.
+const ReferenceValueName = "init_data"
+
+// Digest returns the hash of the raw initdata TOML using algorithm
+// (sha256, sha384 or sha512). This is the value the runtime binds into the
+// TEE launch measurement; see ExpectedMeasurement for the per-TEE encoding.
+func Digest(raw []byte, algorithm string) ([]byte, error) {
+	var h hash.Hash
+	switch algorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported initdata algorithm %q (must be one of: %s)", algorithm, strings.Join(ValidAlgorithms, ", "))
+	}
+	h.Write(raw)
+	return h.Sum(nil), nil
+}
+
+// DigestOf returns the digest of the raw initdata TOML using the algorithm
+// declared in its own algorithm field, together with that algorithm.
+func DigestOf(raw []byte) ([]byte, string, error) {
+	var id InitData
+	if err := toml.Unmarshal(raw, &id); err != nil {
+		return nil, "", fmt.Errorf("failed to parse initdata TOML: %w", err)
+	}
+	digest, err := Digest(raw, id.Algorithm)
+	if err != nil {
+		return nil, "", err
+	}
+	return digest, id.Algorithm, nil
+}
+
+// ExpectedMeasurement converts an initdata digest into the value the TEE
+// reports after launch. The digest is zero-padded or truncated to the size of
+// the measurement field, matching the Kata runtime:
+//
+//   - tdx:  MRCONFIGID, 48 bytes
+//   - snp:  HOSTDATA, 32 bytes
+//   - vtpm: PCR8 after a single extend, SHA256(zeros(32) || digest[:32])
+func ExpectedMeasurement(digest []byte, tee TEE) ([]byte, error) {
+	switch tee {
+	case TEETDX:
+		return fitDigest(digest, 48), nil
+	case TEESNP:
+		return fitDigest(digest, 32), nil
+	case TEEVTPM:
+		pcr := sha256.Sum256(append(make([]byte, sha256.Size), fitDigest(digest, sha256.Size)...))
+		return pcr[:], nil
+	default:
+		return nil, fmt.Errorf("unsupported TEE %q (must be one of: tdx, snp, vtpm)", tee)
+	}
+}
+
+// TEEFromRuntimeClass guesses the TEE from a Kata RuntimeClass name such as
+// kata-qemu-tdx or kata-qemu-snp. It returns false when the name does not
+// identify a TEE (e.g. kata-cc or kata-remote).
+func TEEFromRuntimeClass(runtimeClass string) (TEE, bool) {
+	rc := strings.ToLower(runtimeClass)
+	switch {
+	case strings.Contains(rc, "tdx"):
+		return TEETDX, true
+	case strings.Contains(rc, "snp"):
+		return TEESNP, true
+	default:
+		return "", false
+	}
+}
+
+// fitDigest zero-pads or truncates digest to size bytes.
+func fitDigest(digest []byte, size int) []byte {
+	out := make([]byte, size)
+	copy(out, digest)
+	return out
+}
@@ -0,0 +1,117 @@
+package initdata
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDigest(t *testing.T) {
+	raw := []byte("version = \"0.1.0\"\nalgorithm = \"sha256\"\n")
+	sum256 := sha256.Sum256(raw)
+	sum384 := sha512.Sum384(raw)
+	sum512 := sha512.Sum512(raw)
+
+	tests := []struct {
+		algorithm string
+		want      []byte
+	}{
+		{"sha256", sum256[:]},
+		{"sha384", sum384[:]},
+		{"sha512", sum512[:]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			got, err := Digest(raw, tt.algorithm)
+			if err != nil {
+				t.Fatalf("Digest() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Digest() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Digest(raw, "md5"); err == nil {
+		t.Error("Digest() expected error for unsupported algorithm")
+	}
+}
+
+func TestDigestOf_UsesDeclaredAlgorithm(t *testing.T) {
+	raw := []byte("version = \"0.1.0\"\nalgorithm = \"sha384\"\n\n[data]\n")
+	digest, alg, err := DigestOf(raw)
+	if err != nil {
+		t.Fatalf("DigestOf() error = %v", err)
+	}
+	if alg != "sha384" {
+		t.Errorf("algorithm = %q, want sha384", alg)
+	}
+	want := sha512.Sum384(raw)
+	if !bytes.Equal(digest, want[:]) {
+		t.Errorf("DigestOf() = %x, want %x", digest, want)
+	}
+}
+
+func TestExpectedMeasurement(t *testing.T) {
+	d256 := bytes.Repeat([]byte{0xaa}, 32)
+	d384 := bytes.Repeat([]byte{0xbb}, 48)
+	d512 := bytes.Repeat([]byte{0xcc}, 64)
+
+	tests := []struct {
+		name   string
+		digest []byte
+		tee    TEE
+		want   []byte
+	}{
+		{"tdx pads sha256", d256, TEETDX, append(bytes.Clone(d256), make([]byte, 16)...)},
+		{"tdx keeps sha384", d384, TEETDX, d384},
+		{"tdx truncates sha512", d512, TEETDX, d512[:48]},
+		{"snp keeps sha256", d256, TEESNP, d256},
+		{"snp truncates sha384", d384, TEESNP, d384[:32]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExpectedMeasurement(tt.digest, tt.tee)
+			if err != nil {
+				t.Fatalf("ExpectedMeasurement() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ExpectedMeasurement() = %s, want %s", hex.EncodeToString(got), hex.EncodeToString(tt.want))
+			}
+		})
+	}
+
+	pcr, err := ExpectedMeasurement(d256, TEEVTPM)
+	if err != nil {
+		t.Fatalf("ExpectedMeasurement(vtpm) error = %v", err)
+	}
+	wantPCR := sha256.Sum256(append(make([]byte, 32), d256...))
+	if !bytes.Equal(pcr, wantPCR[:]) {
+		t.Errorf("ExpectedMeasurement(vtpm) = %x, want %x", pcr, wantPCR)
+	}
+
+	if _, err := ExpectedMeasurement(d256, "sgx"); err == nil {
+		t.Error("ExpectedMeasurement() expected error for unsupported TEE")
+	}
+}
+
+func TestTEEFromRuntimeClass(t *testing.T) {
+	tests := []struct {
+		rc     string
+		want   TEE
+		wantOK bool
+	}{
+		{"kata-qemu-tdx", TEETDX, true},
+		{"kata-qemu-snp", TEESNP, true},
+		{"kata-cc", "", false},
+		{"kata-remote", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := TEEFromRuntimeClass(tt.rc)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("TEEFromRuntimeClass(%q) = %q, %v; want %q, %v", tt.rc, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
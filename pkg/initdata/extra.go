@@ -0,0 +1,89 @@
+package initdata
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// ReservedDataKeys are the initdata data keys generated from the config, which
+// extra files cannot replace; use the aa/cdh overrides or kata_agent_policy.
+var ReservedDataKeys = []string{"aa.toml", "cdh.toml", "policy.rego"}
+
+// ValidateExtraFileName checks that name can be used as an extra initdata data key.
+func ValidateExtraFileName(name string) error {
+	for _, reserved := range ReservedDataKeys {
+		if name == reserved {
+			return fmt.Errorf("initdata file %q is generated by cococtl and cannot be replaced by an extra file", name)
+		}
+	}
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid initdata file name %q: must be a plain file name", name)
+	}
+	return nil
+}
+
+// loadExtraFiles reads the extra initdata files, keyed by data key, from the
+// local paths in files.
+func loadExtraFiles(files map[string]string) (map[string]string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	data := make(map[string]string, len(files))
+	for _, name := range names {
+		if err := ValidateExtraFileName(name); err != nil {
+			return nil, err
+		}
+		path := files[name]
+		// #nosec G304 -- path comes from the user's config or --add-file flag
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read initdata file %q from %s: %w", name, path, err)
+		}
+		if err := checkLiteralString(string(content)); err != nil {
+			return nil, fmt.Errorf("initdata file %q (%s): %w", name, path, err)
+		}
+		data[name] = string(content)
+	}
+	return data, nil
+}
+
+// checkLiteralString reports whether s can be embedded as a TOML multi-line
+// literal string, which is how marshalInitData writes data values.
+func checkLiteralString(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("content is not valid UTF-8 text; base64-encode binary files")
+	}
+	if strings.Contains(s, "'''") {
+		return fmt.Errorf("content must not contain '''")
+	}
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0x7f {
+			return fmt.Errorf("content contains control character %U; base64-encode binary files", r)
+		}
+	}
+	return nil
+}
+
+// mergeOverrides deep-merges overrides into base: nested tables are merged key
+// by key, any other value replaces the generated one.
+func mergeOverrides(base, overrides map[string]interface{}) {
+	for key, value := range overrides {
+		if table, ok := value.(map[string]interface{}); ok {
+			if existing, ok := base[key].(map[string]interface{}); ok {
+				mergeOverrides(existing, table)
+				continue
+			}
+			copied := make(map[string]interface{}, len(table))
+			mergeOverrides(copied, table)
+			base[key] = copied
+			continue
+		}
+		base[key] = value
+	}
+}
@@ -0,0 +1,107 @@
+package initdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestGenerateRaw_ExtraFilesAndOverrides(t *testing.T) {
+	dir := t.TempDir()
+	confPath := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(confPath, []byte("log_level = debug\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := minimalCfg()
+	cfg.ContainerPolicyURI = "kbs:///default/security-policy/default"
+	cfg.Initdata.ExtraFiles = map[string]string{"app.conf": confPath}
+	cfg.Initdata.AAOverrides = map[string]interface{}{
+		"eventlog_config": map[string]interface{}{"enable_eventlog": true},
+	}
+	cfg.Initdata.CDHOverrides = map[string]interface{}{
+		"kbc":   map[string]interface{}{"url": "http://kbs.override.svc:8080"},
+		"image": map[string]interface{}{"max_concurrent_layer_downloads_per_image": int64(2)},
+	}
+
+	raw, err := GenerateRaw(cfg, "", nil)
+	if err != nil {
+		t.Fatalf("GenerateRaw() error = %v", err)
+	}
+	var id InitData
+	if err := toml.Unmarshal(raw, &id); err != nil {
+		t.Fatalf("output is not valid TOML: %v", err)
+	}
+	if got := id.Data["app.conf"]; got != "log_level = debug\n" {
+		t.Errorf("data[app.conf] = %q", got)
+	}
+
+	var aa struct {
+		EventlogConfig struct {
+			EnableEventlog bool `toml:"enable_eventlog"`
+		} `toml:"eventlog_config"`
+		TokenConfigs struct {
+			KBS struct {
+				URL string `toml:"url"`
+			} `toml:"kbs"`
+		} `toml:"token_configs"`
+	}
+	if err := toml.Unmarshal([]byte(id.Data["aa.toml"]), &aa); err != nil {
+		t.Fatal(err)
+	}
+	if !aa.EventlogConfig.EnableEventlog || aa.TokenConfigs.KBS.URL != cfg.TrusteeServer {
+		t.Errorf("aa.toml not merged correctly:\n%s", id.Data["aa.toml"])
+	}
+
+	cdh := id.Data["cdh.toml"]
+	for _, want := range []string{
+		`name = 'cc_kbc'`,
+		`url = 'http://kbs.override.svc:8080'`,
+		`image_security_policy_uri = 'kbs:///default/security-policy/default'`,
+		`max_concurrent_layer_downloads_per_image = 2`,
+	} {
+		if !strings.Contains(cdh, want) {
+			t.Errorf("cdh.toml missing %q:\n%s", want, cdh)
+		}
+	}
+	if len(cfg.Initdata.CDHOverrides["kbc"].(map[string]interface{})) != 1 {
+		t.Error("GenerateRaw() modified the overrides in the config")
+	}
+}
+
+func TestGenerateRaw_ExtraFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "blob.bin")
+	if err := os.WriteFile(binPath, []byte{0x00, 0x01, 0xff}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	quotePath := filepath.Join(dir, "quote.txt")
+	if err := os.WriteFile(quotePath, []byte("a ''' b\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"reserved name", map[string]string{"cdh.toml": quotePath}, "cannot be replaced"},
+		{"path in name", map[string]string{"etc/app.conf": quotePath}, "plain file name"},
+		{"missing file", map[string]string{"app.conf": filepath.Join(dir, "missing")}, "failed to read initdata file"},
+		{"binary content", map[string]string{"blob.bin": binPath}, "base64-encode"},
+		{"literal delimiter", map[string]string{"quote.txt": quotePath}, "must not contain '''"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := minimalCfg()
+			cfg.Initdata.ExtraFiles = tt.files
+			_, err := GenerateRaw(cfg, "", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GenerateRaw() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -13,15 +13,19 @@ import (
 	"strings"
 
 	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 	"github.com/pelletier/go-toml/v2"
 )
 
-// InitData constants define the version and algorithm for initdata generation
+// InitData constants define the version and the default algorithm for initdata generation
 const (
 	InitDataVersion   = "0.1.0"
 	InitDataAlgorithm = "sha256"
 )
 
+// AnnotationKey is the pod annotation carrying the encoded initdata.
+const AnnotationKey = "io.katacontainers.config.hypervisor.cc_init_data"
+
 // ValidAlgorithms lists all hash algorithms accepted during initdata validation.
 var ValidAlgorithms = []string{"sha256", "sha384", "sha512"}
 
@@ -56,6 +60,12 @@ func Generate(cfg *config.CocoConfig, imagePullSecrets []ImagePullSecretInfo) (s
 	if err != nil {
 		return "", err
 	}
+	return Encode(raw)
+}
+
+// Encode gzips and base64-encodes raw initdata TOML for use as the
+// io.katacontainers.config.hypervisor.cc_init_data annotation value.
+func Encode(raw []byte) (string, error) {
 	encoded, err := compressAndEncode(raw)
 	if err != nil {
 		return "", fmt.Errorf("failed to compress and encode initdata: %w", err)
@@ -65,7 +75,15 @@ func Generate(cfg *config.CocoConfig, imagePullSecrets []ImagePullSecretInfo) (s
 
 // GenerateRaw returns the raw initdata TOML bytes without gzip/base64 encoding.
 // When certPEM is non-empty it is used directly instead of reading cfg.TrusteeCACert.
+// The CA bundles in cfg.Attestation.CACerts are trusted in addition.
 func GenerateRaw(cfg *config.CocoConfig, certPEM string, imagePullSecrets []ImagePullSecretInfo) ([]byte, error) {
+	return GenerateRawWithPolicy(cfg, certPEM, imagePullSecrets, "")
+}
+
+// GenerateRawWithPolicy is GenerateRaw with an explicit agent policy (e.g. from
+// GenerateAgentPolicy) embedded as policy.rego. An empty policy falls back to
+// cfg.KataAgentPolicy and then to the default policy.
+func GenerateRawWithPolicy(cfg *config.CocoConfig, certPEM string, imagePullSecrets []ImagePullSecretInfo, policy string) ([]byte, error) {
 	if cfg.TrusteeServer == "" {
 		return nil, fmt.Errorf("trustee server URL is required for initdata generation")
 	}
@@ -78,35 +96,63 @@ func GenerateRaw(cfg *config.CocoConfig, certPEM string, imagePullSecrets []Imag
 		}
 		caCert = string(raw)
 	}
+	var caCerts []string
+	if caCert != "" {
+		caCerts = append(caCerts, caCert)
+	}
+	for _, path := range cfg.Attestation.CACerts {
+		// #nosec G304 -- path comes from the user's config
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle from %q: %w", path, err)
+		}
+		caCerts = append(caCerts, string(raw))
+	}
 
-	aaToml, err := generateAAToml(cfg, caCert)
+	aaToml, err := generateAAToml(cfg, caCerts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate aa.toml: %w", err)
 	}
 
-	cdhToml, err := generateCDHToml(cfg, caCert, imagePullSecrets)
+	cdhToml, err := generateCDHToml(cfg, caCerts, imagePullSecrets)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate cdh.toml: %w", err)
 	}
 
-	var policy string
-	if cfg.KataAgentPolicy != "" {
+	switch {
+	case policy != "":
+	case cfg.KataAgentPolicy != "":
 		policy, err = loadPolicyFile(cfg.KataAgentPolicy)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load policy file: %w", err)
 		}
-	} else {
+	default:
 		policy = getDefaultPolicy()
 	}
 
+	extraFiles := make(map[string]string, len(cfg.Initdata.ExtraFiles))
+	for name, path := range cfg.Initdata.ExtraFiles {
+		extraFiles[name] = cfg.ResolvePath(path)
+	}
+	data, err := loadExtraFiles(extraFiles)
+	if err != nil {
+		return nil, err
+	}
+	data["aa.toml"] = aaToml
+	data["cdh.toml"] = cdhToml
+	data["policy.rego"] = policy
+
+	algorithm := cfg.Initdata.Algorithm
+	if algorithm == "" {
+		algorithm = InitDataAlgorithm
+	} else if !IsValidAlgorithm(algorithm) {
+		return nil, fmt.Errorf("unsupported initdata algorithm %q (must be one of: %s)", algorithm, strings.Join(ValidAlgorithms, ", "))
+	}
+
 	id := InitData{
-		Algorithm: InitDataAlgorithm,
+		Algorithm: algorithm,
 		Version:   InitDataVersion,
-		Data: map[string]string{
-			"aa.toml":     aaToml,
-			"cdh.toml":    cdhToml,
-			"policy.rego": policy,
-		},
+		Data:      data,
 	}
 
 	return marshalInitData(id)
@@ -159,21 +205,37 @@ func Decode(encoded string) (map[string]string, error) {
 }
 
 // generateAAToml creates the Attestation Agent configuration.
-// caCert is the PEM content of the CA certificate (empty string if not configured).
-func generateAAToml(cfg *config.CocoConfig, caCert string) (string, error) {
+// caCerts are the PEM CA bundles to trust (nil if none are configured).
+// In passport mode the kbs token config points at the token-issuing Trustee
+// (attestation.as_url); otherwise at the KBS, with attestation.as_url, if
+// set, as the CoCo AS token endpoint.
+func generateAAToml(cfg *config.CocoConfig, caCerts []string) (string, error) {
+	kbsConfig := map[string]interface{}{
+		"url": cfg.GuestKBSURL(),
+	}
+	tokenConfigs := map[string]interface{}{
+		"kbs": kbsConfig,
+	}
 	aaConfig := map[string]interface{}{
-		"token_configs": map[string]interface{}{
-			"kbs": map[string]interface{}{
-				"url": cfg.TrusteeServer,
-			},
-		},
+		"token_configs": tokenConfigs,
 	}
 
-	if caCert != "" {
-		kbsConfig := aaConfig["token_configs"].(map[string]interface{})["kbs"].(map[string]interface{})
-		kbsConfig["cert"] = caCert
+	switch {
+	case cfg.IsPassportMode():
+		kbsConfig["url"] = cfg.Attestation.ASURL
+	case cfg.Attestation.ASURL != "":
+		tokenConfigs["coco_as"] = map[string]interface{}{
+			"url": cfg.Attestation.ASURL,
+		}
+	}
+
+	if len(caCerts) > 0 {
+		kbsConfig["cert"] = joinPEM(caCerts)
 	}
 
+	// Apply user overrides from [initdata.aa_overrides]
+	mergeOverrides(aaConfig, cfg.Initdata.AAOverrides)
+
 	tomlData, err := toml.Marshal(aaConfig)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal aa.toml: %w", err)
@@ -183,22 +245,22 @@ func generateAAToml(cfg *config.CocoConfig, caCert string) (string, error) {
 }
 
 // generateCDHToml creates the Confidential Data Hub configuration.
-// caCert is the PEM content of the CA certificate (empty string if not configured).
-func generateCDHToml(cfg *config.CocoConfig, caCert string, imagePullSecrets []ImagePullSecretInfo) (string, error) {
+// caCerts are the PEM CA bundles to trust (nil if none are configured).
+func generateCDHToml(cfg *config.CocoConfig, caCerts []string, imagePullSecrets []ImagePullSecretInfo) (string, error) {
 	cdhConfig := map[string]interface{}{
 		"kbc": map[string]interface{}{
 			"name": "cc_kbc",
-			"url":  cfg.TrusteeServer,
+			"url":  cfg.GuestKBSURL(),
 		},
 	}
 
-	if caCert != "" {
+	if len(caCerts) > 0 {
 		kbcConfig := cdhConfig["kbc"].(map[string]interface{})
-		kbcConfig["kbs_cert"] = caCert
+		kbcConfig["kbs_cert"] = joinPEM(caCerts)
 	}
 
 	// Add image registry configuration if provided or if imagePullSecrets exist
-	if cfg.RegistryConfigURI != "" || cfg.RegistryCredURI != "" || cfg.ContainerPolicyURI != "" || caCert != "" || len(imagePullSecrets) > 0 {
+	if cfg.RegistryConfigURI != "" || cfg.RegistryCredURI != "" || cfg.ContainerPolicyURI != "" || len(caCerts) > 0 || len(imagePullSecrets) > 0 {
 		imageConfig := make(map[string]interface{})
 
 		// Add image security policy URI if provided
@@ -209,10 +271,14 @@ func generateCDHToml(cfg *config.CocoConfig, caCert string, imagePullSecrets []I
 		// Add authenticated registry credentials URI
 		// Priority: imagePullSecrets (dynamic) > config.RegistryCredURI (static)
 		if len(imagePullSecrets) > 0 {
-			// CDH spec only supports one URI; use the first entry.
+			// CDH spec only supports one URI; apply merges all imagePullSecrets
+			// into a single credentials resource, so use the first entry.
 			ips := imagePullSecrets[0]
-			uri := fmt.Sprintf("kbs:///%s/%s/%s", ips.Namespace, ips.SecretName, ips.Key)
-			imageConfig["authenticated_registry_credentials_uri"] = uri
+			uri, err := kbsuri.New(ips.Namespace, ips.SecretName, ips.Key)
+			if err != nil {
+				return "", fmt.Errorf("invalid KBS URI for imagePullSecret %s/%s: %w", ips.Namespace, ips.SecretName, err)
+			}
+			imageConfig["authenticated_registry_credentials_uri"] = uri.String()
 		} else if cfg.RegistryCredURI != "" {
 			// Fall back to config value if no imagePullSecrets
 			imageConfig["authenticated_registry_credentials_uri"] = cfg.RegistryCredURI
@@ -223,8 +289,8 @@ func generateCDHToml(cfg *config.CocoConfig, caCert string, imagePullSecrets []I
 			imageConfig["registry_configuration_uri"] = cfg.RegistryConfigURI
 		}
 
-		if caCert != "" {
-			imageConfig["extra_root_certificates"] = []string{caCert}
+		if len(caCerts) > 0 {
+			imageConfig["extra_root_certificates"] = caCerts
 		}
 
 		if len(imageConfig) > 0 {
@@ -232,6 +298,9 @@ func generateCDHToml(cfg *config.CocoConfig, caCert string, imagePullSecrets []I
 		}
 	}
 
+	// Apply user overrides from [initdata.cdh_overrides]
+	mergeOverrides(cdhConfig, cfg.Initdata.CDHOverrides)
+
 	tomlData, err := toml.Marshal(cdhConfig)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal cdh.toml: %w", err)
@@ -240,6 +309,18 @@ func generateCDHToml(cfg *config.CocoConfig, caCert string, imagePullSecrets []I
 	return string(tomlData), nil
 }
 
+// joinPEM concatenates PEM bundles into one, keeping each on its own lines.
+func joinPEM(bundles []string) string {
+	var sb strings.Builder
+	for _, b := range bundles {
+		sb.WriteString(b)
+		if !strings.HasSuffix(b, "\n") {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
 // loadPolicyFile reads a policy file from disk
 func loadPolicyFile(path string) (string, error) {
 	cleanPath := filepath.Clean(path)
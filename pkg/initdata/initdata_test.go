@@ -2,6 +2,7 @@ package initdata
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -123,3 +124,88 @@ func TestDecode_InvalidBase64(t *testing.T) {
 		t.Fatal("expected error for invalid base64")
 	}
 }
+
+func TestGenerateRaw_AttestationEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	bundleA := filepath.Join(dir, "a.pem")
+	bundleB := filepath.Join(dir, "b.pem")
+	_ = os.WriteFile(bundleA, []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"), 0600)
+	_ = os.WriteFile(bundleB, []byte("-----BEGIN CERTIFICATE-----\nBBBB\n-----END CERTIFICATE-----"), 0600)
+
+	type aaTokens struct {
+		TokenConfigs map[string]struct {
+			URL  string `toml:"url"`
+			Cert string `toml:"cert"`
+		} `toml:"token_configs"`
+	}
+	type cdhKBC struct {
+		KBC struct {
+			URL     string `toml:"url"`
+			KBSCert string `toml:"kbs_cert"`
+		} `toml:"kbc"`
+		Image struct {
+			ExtraRootCertificates []string `toml:"extra_root_certificates"`
+		} `toml:"image"`
+	}
+	generate := func(cfg *config.CocoConfig) (aaTokens, cdhKBC) {
+		t.Helper()
+		raw, err := GenerateRaw(cfg, "", nil)
+		if err != nil {
+			t.Fatalf("GenerateRaw() error: %v", err)
+		}
+		var id InitData
+		if err := toml.Unmarshal(raw, &id); err != nil {
+			t.Fatal(err)
+		}
+		var aa aaTokens
+		var cdh cdhKBC
+		if err := toml.Unmarshal([]byte(id.Data["aa.toml"]), &aa); err != nil {
+			t.Fatal(err)
+		}
+		if err := toml.Unmarshal([]byte(id.Data["cdh.toml"]), &cdh); err != nil {
+			t.Fatal(err)
+		}
+		return aa, cdh
+	}
+
+	cfg := minimalCfg()
+	cfg.Attestation = config.AttestationConfig{
+		ASURL:   "https://as.example.com:50004",
+		KBSURL:  "https://kbs.example.com:8080",
+		CACerts: []string{bundleA, bundleB},
+	}
+	aa, cdh := generate(cfg)
+	if got := aa.TokenConfigs["kbs"].URL; got != "https://kbs.example.com:8080" {
+		t.Errorf("background-check: token_configs.kbs.url = %q", got)
+	}
+	if got := aa.TokenConfigs["coco_as"].URL; got != "https://as.example.com:50004" {
+		t.Errorf("background-check: token_configs.coco_as.url = %q", got)
+	}
+	if cdh.KBC.URL != "https://kbs.example.com:8080" {
+		t.Errorf("background-check: kbc.url = %q", cdh.KBC.URL)
+	}
+	cert := aa.TokenConfigs["kbs"].Cert
+	if !strings.Contains(cert, "AAAA") || !strings.Contains(cert, "BBBB") || cert != cdh.KBC.KBSCert {
+		t.Errorf("CA bundles not joined into kbs cert:\n%s", cert)
+	}
+	if len(cdh.Image.ExtraRootCertificates) != 2 {
+		t.Errorf("extra_root_certificates = %d entries, want one per bundle", len(cdh.Image.ExtraRootCertificates))
+	}
+
+	cfg.Attestation.Mode = config.AttestationModePassport
+	aa, cdh = generate(cfg)
+	if got := aa.TokenConfigs["kbs"].URL; got != "https://as.example.com:50004" {
+		t.Errorf("passport: token_configs.kbs.url = %q, want the issuing Trustee", got)
+	}
+	if _, ok := aa.TokenConfigs["coco_as"]; ok {
+		t.Error("passport: unexpected token_configs.coco_as")
+	}
+	if cdh.KBC.URL != "https://kbs.example.com:8080" {
+		t.Errorf("passport: kbc.url = %q, want the resource KBS", cdh.KBC.URL)
+	}
+
+	cfg.Attestation.CACerts = []string{filepath.Join(dir, "missing.pem")}
+	if _, err := GenerateRaw(cfg, "", nil); err == nil || !strings.Contains(err.Error(), "CA bundle") {
+		t.Errorf("GenerateRaw() with missing CA bundle error = %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package initdata
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PolicyPreset is a built-in Kata agent policy selectable by name.
+type PolicyPreset struct {
+	Name        string
+	Description string
+	Policy      string
+}
+
+//go:embed presets/allow-all.rego
+var allowAllPolicy string
+
+//go:embed presets/strict.rego
+var strictPolicy string
+
+//go:embed presets/allow-specific-kbs-resource.rego
+var allowSpecificKBSResourcePolicy string
+
+//go:embed presets/allow-ssh-with-no-ssh-config-update.rego
+var allowSSHPolicy string
+
+// PolicyPresets is the registry of all built-in agent policies. The rego files
+// mirror the ones in the repository's examples/ directory; TestPolicyPresets_MatchExamples
+// fails when the two copies drift apart.
+var PolicyPresets = map[string]*PolicyPreset{
+	"default": {
+		Name:        "Default",
+		Description: "Allow all requests except exec and policy changes; container logs stay readable",
+		Policy:      getDefaultPolicy(),
+	},
+	"allow-all": {
+		Name:        "Allow all",
+		Description: "Allow every agent request, including exec and policy changes (debugging only)",
+		Policy:      allowAllPolicy,
+	},
+	"strict": {
+		Name:        "Strict",
+		Description: "Deny exec, policy changes and reading container logs",
+		Policy:      strictPolicy,
+	},
+	"allow-specific-kbs-resource": {
+		Name:        "Allow attestation check via exec",
+		Description: "Deny exec except the curl command that reads the attestation-status resource from CDH",
+		Policy:      allowSpecificKBSResourcePolicy,
+	},
+	"allow-ssh-with-no-ssh-config-update": {
+		Name:        "SSH server without config updates",
+		Description: "Example for an SSH server pod: only listed images, no exec or logs, no copying SSH config files (edit the image list before use)",
+		Policy:      allowSSHPolicy,
+	},
+}
+
+// ListPolicyPresets returns the names of all built-in policy presets, sorted.
+func ListPolicyPresets() []string {
+	names := make([]string, 0, len(PolicyPresets))
+	for name := range PolicyPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetPolicyPreset returns a policy preset by name, or nil if not found.
+func GetPolicyPreset(name string) *PolicyPreset {
+	return PolicyPresets[name]
+}
+
+// LoadPolicyPreset returns the Rego policy of the named preset.
+func LoadPolicyPreset(name string) (string, error) {
+	preset := GetPolicyPreset(name)
+	if preset == nil {
+		return "", fmt.Errorf("unknown policy preset %q (available: %s)", name, strings.Join(ListPolicyPresets(), ", "))
+	}
+	return preset.Policy, nil
+}
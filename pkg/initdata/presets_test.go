@@ -0,0 +1,63 @@
+package initdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicyPresets(t *testing.T) {
+	names := ListPolicyPresets()
+	if len(names) != len(PolicyPresets) {
+		t.Fatalf("ListPolicyPresets() returned %d names, want %d", len(names), len(PolicyPresets))
+	}
+	for _, name := range names {
+		p := GetPolicyPreset(name)
+		if p.Description == "" {
+			t.Errorf("preset %s has no description", name)
+		}
+		if !strings.Contains(p.Policy, "package agent_policy") {
+			t.Errorf("preset %s is not an agent policy", name)
+		}
+	}
+}
+
+// TestPolicyPresets_MatchExamples keeps the embedded presets in sync with the
+// policies in examples/: update both copies together.
+func TestPolicyPresets_MatchExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("presets", "*.rego"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no preset files found: %v", err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".rego")
+		preset, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		example, err := os.ReadFile(filepath.Join("..", "..", "examples", name+"-policy.rego"))
+		if err != nil {
+			t.Errorf("preset %s has no example policy: %v", name, err)
+			continue
+		}
+		if string(preset) != string(example) {
+			t.Errorf("presets/%s.rego differs from examples/%s-policy.rego", name, name)
+		}
+	}
+}
+
+func TestLoadPolicyPreset(t *testing.T) {
+	policy, err := LoadPolicyPreset("strict")
+	if err != nil {
+		t.Fatalf("LoadPolicyPreset() error = %v", err)
+	}
+	if !strings.Contains(policy, "default ExecProcessRequest := false") {
+		t.Error("strict preset should deny exec")
+	}
+
+	_, err = LoadPolicyPreset("nope")
+	if err == nil || !strings.Contains(err.Error(), "strict") {
+		t.Errorf("LoadPolicyPreset() error = %v, want unknown preset error listing available presets", err)
+	}
+}
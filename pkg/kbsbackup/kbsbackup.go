@@ -0,0 +1,258 @@
+// Package kbsbackup writes and reads encrypted backups of the state of a Key
+// Broker Service (KBS): its resources, policies and reference values.
+//
+// A backup is a gzip-compressed tar archive encrypted with age
+// (https://age-encryption.org), either to age recipients or with a passphrase,
+// so that it can also be inspected with the age CLI. The archive holds:
+//
+//	manifest.json                         format version, creation time and source
+//	resources/<repository>/<type>/<tag>   resource data
+//	policies/resource.rego                resource policy
+//	policies/attestation/<id>.rego        attestation policies by policy ID
+//	reference-values.json                 reference values by name
+package kbsbackup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+)
+
+// FormatVersion is the archive format written by Write. Read rejects archives
+// of a newer version.
+const FormatVersion = 1
+
+const (
+	manifestName        = "manifest.json"
+	resourcesDir        = "resources/"
+	resourcePolicyName  = "policies/resource.rego"
+	attestationDir      = "policies/attestation/"
+	attestationExt      = ".rego"
+	referenceValuesName = "reference-values.json"
+
+	// maxEntrySize caps the size of a single archive entry read by Read.
+	maxEntrySize = 16 << 20
+)
+
+// Backup is the content of a KBS backup.
+type Backup struct {
+	// CreatedAt is when the backup was taken.
+	CreatedAt time.Time
+	// Source describes the KBS the backup was taken from, e.g. its namespace
+	// or URL. It is informational only.
+	Source string
+	// Resources maps resource paths (repository/type/tag) to their data.
+	Resources map[string][]byte
+	// ResourcePolicy is the Rego resource policy, or nil when not backed up.
+	ResourcePolicy []byte
+	// AttestationPolicies maps attestation policy IDs to Rego policies.
+	AttestationPolicies map[string][]byte
+	// ReferenceValues holds the reference values registered with the RVPS.
+	ReferenceValues kbsclient.ReferenceValues
+}
+
+// manifest is the JSON document stored as manifest.json.
+type manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Source    string    `json:"source,omitempty"`
+}
+
+// Write encrypts b to recipients and writes it to w. Use
+// age.NewScryptRecipient for a passphrase-protected backup.
+func Write(w io.Writer, b *Backup, recipients ...age.Recipient) error {
+	if len(recipients) == 0 {
+		return fmt.Errorf("at least one age recipient or a passphrase is required")
+	}
+
+	encrypted, err := age.Encrypt(w, recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	gz := gzip.NewWriter(encrypted)
+	tw := tar.NewWriter(gz)
+
+	manifestJSON, err := json.MarshalIndent(manifest{Version: FormatVersion, CreatedAt: b.CreatedAt.UTC(), Source: b.Source}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+	if err := writeEntry(tw, manifestName, manifestJSON, b.CreatedAt); err != nil {
+		return err
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(b.Resources)) {
+		if _, err := kbsuri.ParsePath(path); err != nil {
+			return err
+		}
+		if err := writeEntry(tw, resourcesDir+path, b.Resources[path], b.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if b.ResourcePolicy != nil {
+		if err := writeEntry(tw, resourcePolicyName, b.ResourcePolicy, b.CreatedAt); err != nil {
+			return err
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(b.AttestationPolicies)) {
+		if err := validatePolicyID(id); err != nil {
+			return err
+		}
+		if err := writeEntry(tw, attestationDir+id+attestationExt, b.AttestationPolicies[id], b.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if len(b.ReferenceValues) > 0 {
+		values, err := json.MarshalIndent(b.ReferenceValues, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal reference values: %w", err)
+		}
+		if err := writeEntry(tw, referenceValuesName, values, b.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write backup archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress backup archive: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	return nil
+}
+
+// Read decrypts a backup written by Write with one of identities. Use
+// age.NewScryptIdentity for a passphrase-protected backup.
+func Read(r io.Reader, identities ...age.Identity) (*Backup, error) {
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+	gz, err := gzip.NewReader(decrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	defer func() { _ = gz.Close() }()
+	tr := tar.NewReader(gz)
+
+	b := &Backup{
+		Resources:           map[string][]byte{},
+		AttestationPolicies: map[string][]byte{},
+	}
+	seenManifest := false
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %s in backup archive", header.Name)
+		}
+		if header.Size > maxEntrySize {
+			return nil, fmt.Errorf("entry %s in backup archive is too large (%d bytes)", header.Name, header.Size)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from backup archive: %w", header.Name, err)
+		}
+
+		name := header.Name
+		switch {
+		case name == manifestName:
+			var m manifest
+			if err := json.Unmarshal(data, &m); err != nil {
+				return nil, fmt.Errorf("invalid backup manifest: %w", err)
+			}
+			if m.Version < 1 || m.Version > FormatVersion {
+				return nil, fmt.Errorf("unsupported backup format version %d", m.Version)
+			}
+			b.CreatedAt = m.CreatedAt
+			b.Source = m.Source
+			seenManifest = true
+		case strings.HasPrefix(name, resourcesDir):
+			path := strings.TrimPrefix(name, resourcesDir)
+			if _, err := kbsuri.ParsePath(path); err != nil {
+				return nil, fmt.Errorf("invalid resource in backup archive: %w", err)
+			}
+			b.Resources[path] = data
+		case name == resourcePolicyName:
+			b.ResourcePolicy = data
+		case strings.HasPrefix(name, attestationDir) && strings.HasSuffix(name, attestationExt):
+			id := strings.TrimSuffix(strings.TrimPrefix(name, attestationDir), attestationExt)
+			if err := validatePolicyID(id); err != nil {
+				return nil, err
+			}
+			b.AttestationPolicies[id] = data
+		case name == referenceValuesName:
+			if err := json.Unmarshal(data, &b.ReferenceValues); err != nil {
+				return nil, fmt.Errorf("invalid reference values in backup archive: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unexpected entry %s in backup archive", name)
+		}
+	}
+	if !seenManifest {
+		return nil, fmt.Errorf("backup archive has no %s", manifestName)
+	}
+	return b, nil
+}
+
+// StringReferenceValues returns the reference values of b that are plain lists
+// of strings, as RegisterReferenceValue accepts them, and the names of the
+// others.
+func (b *Backup) StringReferenceValues() (values map[string][]string, skipped []string) {
+	values = map[string][]string{}
+	for _, name := range slices.Sorted(maps.Keys(b.ReferenceValues)) {
+		var list []string
+		if err := json.Unmarshal(b.ReferenceValues[name], &list); err != nil || len(list) == 0 {
+			skipped = append(skipped, name)
+			continue
+		}
+		values[name] = list
+	}
+	return values, skipped
+}
+
+func writeEntry(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     int64(len(data)),
+		Mode:     0600,
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s to backup archive: %w", name, err)
+	}
+	if _, err := io.Copy(tw, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write %s to backup archive: %w", name, err)
+	}
+	return nil
+}
+
+// validatePolicyID rejects attestation policy IDs that cannot be stored as a
+// single archive entry name.
+func validatePolicyID(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return fmt.Errorf("invalid attestation policy ID %q", id)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package kbsbackup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+)
+
+func testBackup() *Backup {
+	return &Backup{
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Source:    "namespace coco",
+		Resources: map[string][]byte{
+			"default/myapp/password":            []byte("s3cret"),
+			"default/attestation-status/status": []byte("success"),
+		},
+		ResourcePolicy:      []byte("package policy\ndefault allow = false\n"),
+		AttestationPolicies: map[string][]byte{"default": []byte("package policy\n")},
+		ReferenceValues: kbsclient.ReferenceValues{
+			"init_data": json.RawMessage(`["abc","def"]`),
+		},
+	}
+}
+
+func TestWriteRead_Recipient(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, testBackup(), identity.Recipient()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("s3cret")) {
+		t.Fatal("backup is not encrypted")
+	}
+
+	got, err := Read(bytes.NewReader(buf.Bytes()), identity)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	want := testBackup()
+	if !got.CreatedAt.Equal(want.CreatedAt) || got.Source != want.Source {
+		t.Errorf("manifest = %v %q", got.CreatedAt, got.Source)
+	}
+	if !reflect.DeepEqual(got.Resources, want.Resources) || !reflect.DeepEqual(got.AttestationPolicies, want.AttestationPolicies) {
+		t.Errorf("resources = %v, attestation policies = %v", got.Resources, got.AttestationPolicies)
+	}
+	if string(got.ResourcePolicy) != string(want.ResourcePolicy) {
+		t.Errorf("resource policy = %q", got.ResourcePolicy)
+	}
+	if values, skipped := got.StringReferenceValues(); len(skipped) != 0 || !reflect.DeepEqual(values["init_data"], []string{"abc", "def"}) {
+		t.Errorf("reference values = %v, skipped %v", values, skipped)
+	}
+
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()), other); err == nil {
+		t.Error("Read() with the wrong identity expected error")
+	}
+}
+
+func TestWriteRead_Passphrase(t *testing.T) {
+	recipient, err := age.NewScryptRecipient("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient.SetWorkFactor(10)
+	var buf bytes.Buffer
+	if err := Write(&buf, &Backup{CreatedAt: time.Now()}, recipient); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	identity, err := age.NewScryptIdentity("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(bytes.NewReader(buf.Bytes()), identity)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(got.Resources) != 0 || got.ResourcePolicy != nil || len(got.ReferenceValues) != 0 {
+		t.Errorf("empty backup = %+v", got)
+	}
+
+	wrong, err := age.NewScryptIdentity("wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()), wrong); err == nil {
+		t.Error("Read() with the wrong passphrase expected error")
+	}
+}
+
+func TestWrite_NoRecipients(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, testBackup()); err == nil {
+		t.Error("Write() without recipients expected error")
+	}
+}
+
+func TestWrite_InvalidNames(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []*Backup{
+		{Resources: map[string][]byte{"../etc/passwd": nil}},
+		{AttestationPolicies: map[string][]byte{"a/b": nil}},
+	} {
+		if err := Write(&bytes.Buffer{}, b, identity.Recipient()); err == nil {
+			t.Errorf("Write(%+v) expected error", b)
+		}
+	}
+}
+
+// writeRawArchive encrypts a tar archive with the given entries, bypassing the
+// validation in Write.
+func writeRawArchive(t *testing.T, recipient age.Recipient, entries map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	encrypted, err := age.Encrypt(&buf, recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(encrypted)
+	tw := tar.NewWriter(gz)
+	for name, data := range entries {
+		if err := writeEntry(tw, name, []byte(data), time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []interface{ Close() error }{tw, gz, encrypted} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestRead_RejectsInvalidArchives(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validManifest := `{"version":1,"created_at":"2026-01-02T03:04:05Z"}`
+	tests := []struct {
+		name    string
+		entries map[string]string
+		want    string
+	}{
+		{"no manifest", map[string]string{"resources/default/a/b": "x"}, "no manifest.json"},
+		{"newer version", map[string]string{manifestName: `{"version":2}`}, "unsupported backup format version 2"},
+		{"traversal", map[string]string{manifestName: validManifest, "resources/../../etc/passwd": "x"}, "invalid resource"},
+		{"unknown entry", map[string]string{manifestName: validManifest, "other.txt": "x"}, "unexpected entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archive := writeRawArchive(t, identity.Recipient(), tt.entries)
+			_, err := Read(bytes.NewReader(archive), identity)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Read() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringReferenceValues_SkipsOtherValues(t *testing.T) {
+	b := &Backup{ReferenceValues: kbsclient.ReferenceValues{
+		"list":   json.RawMessage(`["a"]`),
+		"object": json.RawMessage(`{"a":1}`),
+		"empty":  json.RawMessage(`[]`),
+	}}
+	values, skipped := b.StringReferenceValues()
+	if len(values) != 1 || !reflect.DeepEqual(skipped, []string{"empty", "object"}) {
+		t.Errorf("StringReferenceValues() = %v, %v", values, skipped)
+	}
+}
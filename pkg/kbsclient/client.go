@@ -13,20 +13,15 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
-)
 
-// resourcePathRegexp enforces the KBS resource path pattern:
-// ^[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*\/[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*\/[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*$
-// Each segment must start with an alphanumeric, underscore, or hyphen character
-// and may be followed by the same characters plus dots.  This excludes characters
-// such as '?', '#', '%', and spaces that would corrupt the URL or enable injection.
-var resourcePathRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*\/[a-zA-Z0-9_-][a-zA-Z0-9_.-]*\/[a-zA-Z0-9_-][a-zA-Z0-9_.-]*$`)
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+)
 
 const (
 	kbsAPIPrefix = "/kbs/v0"
@@ -37,8 +32,33 @@ const (
 	// errorBodyLimit caps the bytes read from an error response body to avoid
 	// unbounded memory use if the server (or a MITM) returns a large body.
 	errorBodyLimit = 4096
+
+	// resourceBodyLimit caps the size of a resource returned by GetResource.
+	resourceBodyLimit = 16 << 20
 )
 
+// StatusError is returned when KBS answers with a non-200 status code.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("KBS returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// IsNotFound reports whether err is a KBS 404 response.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is a KBS 401 or 403 response.
+func IsUnauthorized(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && (se.StatusCode == http.StatusUnauthorized || se.StatusCode == http.StatusForbidden)
+}
+
 // Client is a client for the KBS admin HTTP API.
 type Client struct {
 	baseURL    string
@@ -90,6 +110,30 @@ func New(baseURL string, privateKey ed25519.PrivateKey, caCert []byte) (*Client,
 	}, nil
 }
 
+// WithServerName returns a copy of c that verifies the KBS certificate against
+// serverName instead of the host of the base URL. Use it when the KBS is
+// reached through a tunnel such as a port-forward to 127.0.0.1.
+func (c *Client) WithServerName(serverName string) *Client {
+	var transport *http.Transport
+	if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = &http.Transport{}
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.ServerName = serverName
+
+	httpClient := *c.httpClient
+	httpClient.Transport = transport
+	return &Client{
+		baseURL:    c.baseURL,
+		privateKey: c.privateKey,
+		httpClient: &httpClient,
+	}
+}
+
 // NewFromPEM creates a Client from a PEM-encoded PKCS#8 Ed25519 private key.
 // This is the typical constructor when the key is loaded from disk.
 // caCert is an optional PEM-encoded CA certificate; pass nil to use system roots.
@@ -116,26 +160,73 @@ func NewFromPEM(baseURL string, privateKeyPEM []byte, caCert []byte) (*Client, e
 // resourcePath must be in "repository/type/tag" format
 // (e.g. "default/my-secret/password"). The data is sent as raw bytes.
 func (c *Client) SetResource(ctx context.Context, resourcePath string, data []byte) error {
-	if err := validateResourcePath(resourcePath); err != nil {
+	uri, err := kbsuri.ParsePath(resourcePath)
+	if err != nil {
 		return err
 	}
 
-	token, err := signAdminToken(c.privateKey)
+	req, err := c.newAdminRequest(ctx, http.MethodPost, uri.AdminPath(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return c.doRequest(req)
+}
+
+// GetResource downloads a resource from the KBS repository using the admin token.
+// resourcePath must be in "repository/type/tag" format.
+//
+// Note that upstream KBS only releases resources to attested clients (the response
+// is encrypted to the TEE key), so against such a deployment this returns an error
+// for which IsUnauthorized reports true. Callers with another way to read the
+// resource (e.g. the in-cluster repository) should fall back to it.
+func (c *Client) GetResource(ctx context.Context, resourcePath string) ([]byte, error) {
+	uri, err := kbsuri.ParsePath(resourcePath)
 	if err != nil {
-		return fmt.Errorf("sign admin token: %w", err)
+		return nil, err
 	}
 
-	url := c.baseURL + kbsAPIPrefix + "/resource/" + resourcePath
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	req, err := c.newAdminRequest(ctx, http.MethodGet, uri.AdminPath(), nil)
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return nil, err
+	}
+
+	return c.doRequestWithBody(req, resourceBodyLimit)
+}
+
+// DeleteResource removes a resource from the KBS repository.
+// resourcePath must be in "repository/type/tag" format.
+func (c *Client) DeleteResource(ctx context.Context, resourcePath string) error {
+	uri, err := kbsuri.ParsePath(resourcePath)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.newAdminRequest(ctx, http.MethodDelete, uri.AdminPath(), nil)
+	if err != nil {
+		return err
 	}
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Authorization", "Bearer "+token)
 
 	return c.doRequest(req)
 }
 
+// newAdminRequest builds a request to the KBS API carrying a freshly signed admin token.
+// path is relative to the KBS base URL.
+func (c *Client) newAdminRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	token, err := signAdminToken(c.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign admin token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
+
 // resourcePolicyRequest is the JSON body for the resource-policy endpoint.
 type resourcePolicyRequest struct {
 	Policy string `json:"policy"`
@@ -144,11 +235,6 @@ type resourcePolicyRequest struct {
 // SetResourcePolicy uploads an OPA resource policy to KBS.
 // policy is the raw Rego policy bytes; it is base64-encoded before sending.
 func (c *Client) SetResourcePolicy(ctx context.Context, policy []byte) error {
-	token, err := signAdminToken(c.privateKey)
-	if err != nil {
-		return fmt.Errorf("sign admin token: %w", err)
-	}
-
 	body, err := json.Marshal(resourcePolicyRequest{
 		Policy: base64.StdEncoding.EncodeToString(policy),
 	})
@@ -156,13 +242,11 @@ func (c *Client) SetResourcePolicy(ctx context.Context, policy []byte) error {
 		return fmt.Errorf("marshal policy request: %w", err)
 	}
 
-	url := c.baseURL + kbsAPIPrefix + "/resource-policy"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	req, err := c.newAdminRequest(ctx, http.MethodPost, kbsAPIPrefix+"/resource-policy", bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("create request: %w", err)
+		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
 
 	return c.doRequest(req)
 }
@@ -173,31 +257,37 @@ func (c *Client) SetResourcePolicy(ctx context.Context, policy []byte) error {
 // The response body is included in errors to aid diagnostics, capped at
 // errorBodyLimit bytes to prevent unbounded memory use.
 func (c *Client) doRequest(req *http.Request) error {
+	_, err := c.doRequestWithBody(req, 0)
+	return err
+}
+
+// doRequestWithBody executes an HTTP request and returns up to limit bytes of the
+// response body on 200 OK. A body larger than limit is an error. Non-200 responses
+// are returned as *StatusError.
+func (c *Client) doRequestWithBody(req *http.Request, limit int64) ([]byte, error) {
 	resp, err := c.httpClient.Do(req) // #nosec G704 -- baseURL is set at construction time from trusted config, not from user input
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer func() {
 		_, _ = io.Copy(io.Discard, resp.Body)
 		_ = resp.Body.Close()
 	}()
 
-	if resp.StatusCode == http.StatusOK {
-		return nil
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
 	}
 
-	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, errorBodyLimit))
-	return fmt.Errorf("KBS returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
-}
-
-// validateResourcePath checks that resourcePath matches the KBS regex:
-// ^[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*\/[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*\/[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*$
-// This enforces exactly three slash-separated segments, each starting with an
-// alphanumeric/underscore/hyphen character, and rejects characters such as '?',
-// '#', '%', spaces, and leading dots that would corrupt the URL or enable injection.
-func validateResourcePath(resourcePath string) error {
-	if !resourcePathRegexp.MatchString(resourcePath) {
-		return fmt.Errorf("invalid resource path %q: must be 'repository/type/tag' with each segment matching [a-zA-Z0-9_-][a-zA-Z0-9_-.]*", resourcePath)
+	if limit == 0 {
+		return nil, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("response exceeds %d bytes", limit)
 	}
-	return nil
+	return body, nil
 }
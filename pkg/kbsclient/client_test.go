@@ -479,77 +479,6 @@ func TestSetResourcePolicy_ErrorOnNon200(t *testing.T) {
 	}
 }
 
-// --- validateResourcePath tests ---
-
-func TestValidateResourcePath_Valid(t *testing.T) {
-	cases := []string{
-		"default/my-secret/password",
-		"default/attestation-status/status",
-		"ns/sidecar-tls-app/server-cert",
-		"a/b/c",
-	}
-	for _, path := range cases {
-		if err := validateResourcePath(path); err != nil {
-			t.Errorf("validateResourcePath(%q) error = %v, want nil", path, err)
-		}
-	}
-}
-
-func TestValidateResourcePath_Traversal(t *testing.T) {
-	cases := []string{
-		"../../etc/passwd",
-		"default/../secret/key",
-		"default/secret/../../key",
-	}
-	for _, path := range cases {
-		if err := validateResourcePath(path); err == nil {
-			t.Errorf("validateResourcePath(%q) = nil, want error for traversal", path)
-		}
-	}
-}
-
-func TestValidateResourcePath_WrongSegments(t *testing.T) {
-	cases := []string{
-		"only-one-part",
-		"only/two",
-		"too/many/parts/here",
-		"",
-	}
-	for _, path := range cases {
-		if err := validateResourcePath(path); err == nil {
-			t.Errorf("validateResourcePath(%q) = nil, want error for wrong segment count", path)
-		}
-	}
-}
-
-func TestValidateResourcePath_InvalidChars(t *testing.T) {
-	cases := []string{
-		"default/secret/key?x=y",  // query string injection
-		"default/secret/key#frag", // fragment injection
-		"default/secret/key%20",   // URL encoding
-		"default/my secret/key",   // space
-		".hidden/secret/key",      // leading dot in segment
-	}
-	for _, path := range cases {
-		if err := validateResourcePath(path); err == nil {
-			t.Errorf("validateResourcePath(%q) = nil, want error for invalid chars", path)
-		}
-	}
-}
-
-func TestValidateResourcePath_EmptySegment(t *testing.T) {
-	cases := []string{
-		"/secret/key",
-		"default//key",
-		"default/secret/",
-	}
-	for _, path := range cases {
-		if err := validateResourcePath(path); err == nil {
-			t.Errorf("validateResourcePath(%q) = nil, want error for empty segment", path)
-		}
-	}
-}
-
 func TestSetResource_InvalidPath(t *testing.T) {
 	_, priv := generateTestKey(t)
 
@@ -659,3 +588,137 @@ func TestNew_TLSWithCustomCA(t *testing.T) {
 		t.Fatalf("SetResource() with custom CA error = %v", err)
 	}
 }
+
+func TestWithServerName(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	caCertPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	_, priv := generateTestKey(t)
+	c, err := New(srv.URL, priv, caCertPEM)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	// The httptest certificate is issued for example.com (and 127.0.0.1).
+	if err := c.WithServerName("example.com").SetResource(context.Background(), "default/secret/key", []byte("data")); err != nil {
+		t.Fatalf("SetResource() with matching server name error = %v", err)
+	}
+	if err := c.WithServerName("kbs.other.svc").SetResource(context.Background(), "default/secret/key", []byte("data")); err == nil {
+		t.Fatal("SetResource() with mismatched server name succeeded, want certificate error")
+	}
+}
+
+// --- GetResource / DeleteResource tests ---
+
+func TestGetResource_RequestFormat(t *testing.T) {
+	_, priv := generateTestKey(t)
+
+	var capturedReq *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedReq = r
+		_, _ = w.Write([]byte("secret-value"))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	data, err := c.GetResource(context.Background(), "default/my-secret/password")
+	if err != nil {
+		t.Fatalf("GetResource() error = %v", err)
+	}
+	if string(data) != "secret-value" {
+		t.Errorf("GetResource() = %q, want %q", data, "secret-value")
+	}
+	if capturedReq.Method != http.MethodGet {
+		t.Errorf("Method = %q, want %q", capturedReq.Method, http.MethodGet)
+	}
+	if capturedReq.URL.Path != "/kbs/v0/resource/default/my-secret/password" {
+		t.Errorf("URL.Path = %q", capturedReq.URL.Path)
+	}
+	if !strings.HasPrefix(capturedReq.Header.Get("Authorization"), "Bearer ") {
+		t.Errorf("Authorization = %q, want Bearer prefix", capturedReq.Header.Get("Authorization"))
+	}
+}
+
+func TestGetResource_StatusErrors(t *testing.T) {
+	_, priv := generateTestKey(t)
+
+	tests := []struct {
+		status           int
+		wantNotFound     bool
+		wantUnauthorized bool
+	}{
+		{http.StatusNotFound, true, false},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusForbidden, false, true},
+		{http.StatusInternalServerError, false, false},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+
+		c, err := New(srv.URL, priv, nil)
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		_, err = c.GetResource(context.Background(), "default/secret/key")
+		srv.Close()
+
+		if err == nil {
+			t.Fatalf("GetResource() expected error for status %d, got nil", tt.status)
+		}
+		if IsNotFound(err) != tt.wantNotFound {
+			t.Errorf("status %d: IsNotFound() = %v, want %v", tt.status, IsNotFound(err), tt.wantNotFound)
+		}
+		if IsUnauthorized(err) != tt.wantUnauthorized {
+			t.Errorf("status %d: IsUnauthorized() = %v, want %v", tt.status, IsUnauthorized(err), tt.wantUnauthorized)
+		}
+	}
+}
+
+func TestGetResource_InvalidPath(t *testing.T) {
+	_, priv := generateTestKey(t)
+	c, err := New("http://localhost:1", priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := c.GetResource(context.Background(), "default/../key"); err == nil {
+		t.Error("GetResource() expected error for invalid path, got nil")
+	}
+}
+
+func TestDeleteResource_RequestFormat(t *testing.T) {
+	_, priv := generateTestKey(t)
+
+	var capturedReq *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedReq = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := c.DeleteResource(context.Background(), "default/my-secret/password"); err != nil {
+		t.Fatalf("DeleteResource() error = %v", err)
+	}
+	if capturedReq.Method != http.MethodDelete {
+		t.Errorf("Method = %q, want %q", capturedReq.Method, http.MethodDelete)
+	}
+	if capturedReq.URL.Path != "/kbs/v0/resource/default/my-secret/password" {
+		t.Errorf("URL.Path = %q", capturedReq.URL.Path)
+	}
+	if !strings.HasPrefix(capturedReq.Header.Get("Authorization"), "Bearer ") {
+		t.Errorf("Authorization = %q, want Bearer prefix", capturedReq.Header.Get("Authorization"))
+	}
+}
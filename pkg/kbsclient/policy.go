@@ -0,0 +1,100 @@
+package kbsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// DefaultAttestationPolicyID is the policy ID the attestation service
+	// evaluates when a request does not name another policy.
+	DefaultAttestationPolicyID = "default"
+
+	// policyBodyLimit caps the size of a policy returned by KBS.
+	policyBodyLimit = 1 << 20
+)
+
+// attestationPolicyRequest is the JSON body for the attestation-policy endpoint.
+// It mirrors SetPolicyInput in the trustee attestation service.
+type attestationPolicyRequest struct {
+	Type     string `json:"type"`
+	PolicyID string `json:"policy_id"`
+	Policy   string `json:"policy"`
+}
+
+// SetAttestationPolicy uploads an OPA attestation policy to the attestation service
+// behind KBS under policyID (DefaultAttestationPolicyID when empty).
+// policy is the raw Rego policy; it is base64url-encoded before sending, as the
+// attestation service expects.
+func (c *Client) SetAttestationPolicy(ctx context.Context, policyID string, policy []byte) error {
+	if policyID == "" {
+		policyID = DefaultAttestationPolicyID
+	}
+
+	body, err := json.Marshal(attestationPolicyRequest{
+		Type:     "rego",
+		PolicyID: policyID,
+		Policy:   base64.RawURLEncoding.EncodeToString(policy),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal policy request: %w", err)
+	}
+
+	req, err := c.newAdminRequest(ctx, http.MethodPost, kbsAPIPrefix+"/attestation-policy", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.doRequest(req)
+}
+
+// GetAttestationPolicy downloads the attestation policy stored under policyID
+// (DefaultAttestationPolicyID when empty) and returns the raw Rego policy.
+func (c *Client) GetAttestationPolicy(ctx context.Context, policyID string) ([]byte, error) {
+	if policyID == "" {
+		policyID = DefaultAttestationPolicyID
+	}
+
+	req, err := c.newAdminRequest(ctx, http.MethodGet, kbsAPIPrefix+"/attestation-policy/"+url.PathEscape(policyID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.doRequestWithBody(req, policyBodyLimit)
+	if err != nil {
+		return nil, err
+	}
+	return decodePolicy(body)
+}
+
+// GetResourcePolicy downloads the resource policy currently enforced by KBS
+// and returns the raw Rego policy.
+func (c *Client) GetResourcePolicy(ctx context.Context) ([]byte, error) {
+	req, err := c.newAdminRequest(ctx, http.MethodGet, kbsAPIPrefix+"/resource-policy", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.doRequestWithBody(req, policyBodyLimit)
+	if err != nil {
+		return nil, err
+	}
+	return decodePolicy(body)
+}
+
+// decodePolicy decodes a policy response. KBS returns the Rego text
+// base64url-encoded without padding.
+func decodePolicy(body []byte) ([]byte, error) {
+	policy, err := base64.RawURLEncoding.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("KBS returned a policy that is not base64url-encoded: %w", err)
+	}
+	return policy, nil
+}
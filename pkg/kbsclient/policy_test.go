@@ -0,0 +1,136 @@
+package kbsclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetAttestationPolicy_RequestFormat(t *testing.T) {
+	_, priv := generateTestKey(t)
+	policy := []byte("package policy\ndefault allow = false\n")
+
+	var capturedReq *http.Request
+	var capturedBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedReq = r
+		capturedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := c.SetAttestationPolicy(context.Background(), "", policy); err != nil {
+		t.Fatalf("SetAttestationPolicy() error = %v", err)
+	}
+
+	if capturedReq.Method != http.MethodPost {
+		t.Errorf("Method = %q, want %q", capturedReq.Method, http.MethodPost)
+	}
+	if capturedReq.URL.Path != "/kbs/v0/attestation-policy" {
+		t.Errorf("URL.Path = %q, want %q", capturedReq.URL.Path, "/kbs/v0/attestation-policy")
+	}
+
+	var body attestationPolicyRequest
+	if err := json.Unmarshal(capturedBody, &body); err != nil {
+		t.Fatalf("body is not valid JSON: %v", err)
+	}
+	if body.Type != "rego" {
+		t.Errorf("type = %q, want rego", body.Type)
+	}
+	if body.PolicyID != DefaultAttestationPolicyID {
+		t.Errorf("policy_id = %q, want %q", body.PolicyID, DefaultAttestationPolicyID)
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(body.Policy)
+	if err != nil {
+		t.Fatalf("policy is not base64url: %v", err)
+	}
+	if string(decoded) != string(policy) {
+		t.Errorf("decoded policy = %q, want %q", decoded, policy)
+	}
+}
+
+func TestGetAttestationPolicy_RequestFormat(t *testing.T) {
+	_, priv := generateTestKey(t)
+	policy := "package policy\ndefault allow = false\n"
+
+	var capturedPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedPath = r.URL.Path
+		_, _ = w.Write([]byte(base64.RawURLEncoding.EncodeToString([]byte(policy))))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got, err := c.GetAttestationPolicy(context.Background(), "tdx")
+	if err != nil {
+		t.Fatalf("GetAttestationPolicy() error = %v", err)
+	}
+	if capturedPath != "/kbs/v0/attestation-policy/tdx" {
+		t.Errorf("URL.Path = %q, want %q", capturedPath, "/kbs/v0/attestation-policy/tdx")
+	}
+	if string(got) != policy {
+		t.Errorf("GetAttestationPolicy() = %q, want %q", got, policy)
+	}
+}
+
+func TestGetResourcePolicy_RequestFormat(t *testing.T) {
+	_, priv := generateTestKey(t)
+
+	var capturedReq *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedReq = r
+		_, _ = w.Write([]byte(base64.RawURLEncoding.EncodeToString([]byte("package policy\ndefault allow = true\n"))))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got, err := c.GetResourcePolicy(context.Background())
+	if err != nil {
+		t.Fatalf("GetResourcePolicy() error = %v", err)
+	}
+	if capturedReq.Method != http.MethodGet || capturedReq.URL.Path != "/kbs/v0/resource-policy" {
+		t.Errorf("request = %s %s, want GET /kbs/v0/resource-policy", capturedReq.Method, capturedReq.URL.Path)
+	}
+	if string(got) != "package policy\ndefault allow = true\n" {
+		t.Errorf("GetResourcePolicy() = %q", got)
+	}
+}
+
+func TestDecodePolicy(t *testing.T) {
+	policy := "package policy\ndefault allow = true\n"
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(policy))
+	for _, body := range []string{encoded, encoded + "\n"} {
+		got, err := decodePolicy([]byte(body))
+		if err != nil || string(got) != policy {
+			t.Errorf("decodePolicy(%q) = %q, %v; want %q", body, got, err, policy)
+		}
+	}
+
+	for name, body := range map[string]string{
+		"raw":         policy,
+		"padded":      base64.URLEncoding.EncodeToString([]byte(policy + "x")),
+		"base64 std":  base64.StdEncoding.EncodeToString([]byte{0xfb, 0xff}),
+		"json object": `{"policy":"` + encoded + `"}`,
+	} {
+		if _, err := decodePolicy([]byte(body)); err == nil {
+			t.Errorf("decodePolicy(%s) expected error", name)
+		}
+	}
+}
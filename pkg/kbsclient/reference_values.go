@@ -0,0 +1,88 @@
+package kbsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// rvpsMessageVersion is the RVPS message format version understood by trustee.
+	rvpsMessageVersion = "0.1.0"
+
+	// rvpsSampleType selects the RVPS "sample" extractor, which accepts
+	// reference values as a plain name -> values map without provenance checks.
+	rvpsSampleType = "sample"
+
+	// referenceValuesBodyLimit caps the size of the reference value listing.
+	referenceValuesBodyLimit = 4 << 20
+)
+
+// ReferenceValues maps a reference value name to its JSON-encoded value as
+// reported by the reference value provider service (RVPS).
+type ReferenceValues map[string]json.RawMessage
+
+// rvpsMessage is the envelope the RVPS accepts on registration.
+type rvpsMessage struct {
+	Version string `json:"version"`
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+}
+
+// RegisterReferenceValue registers values under name with the RVPS behind KBS.
+// Attestation policies compare TEE evidence (e.g. measurements or the initdata
+// digest) against these values.
+func (c *Client) RegisterReferenceValue(ctx context.Context, name string, values []string) error {
+	if name == "" {
+		return fmt.Errorf("reference value name must not be empty")
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("reference value %s: at least one value is required", name)
+	}
+
+	payload, err := json.Marshal(map[string][]string{name: values})
+	if err != nil {
+		return fmt.Errorf("marshal reference value: %w", err)
+	}
+	body, err := json.Marshal(rvpsMessage{
+		Version: rvpsMessageVersion,
+		Type:    rvpsSampleType,
+		Payload: base64.StdEncoding.EncodeToString(payload),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal RVPS message: %w", err)
+	}
+
+	req, err := c.newAdminRequest(ctx, http.MethodPost, kbsAPIPrefix+"/reference-value", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.doRequest(req)
+}
+
+// GetReferenceValues returns all reference values registered with the RVPS.
+func (c *Client) GetReferenceValues(ctx context.Context) (ReferenceValues, error) {
+	req, err := c.newAdminRequest(ctx, http.MethodGet, kbsAPIPrefix+"/reference-value", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := c.doRequestWithBody(req, referenceValuesBodyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	values := ReferenceValues{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return values, nil
+	}
+	if err := json.Unmarshal(body, &values); err != nil {
+		return nil, fmt.Errorf("parse reference values: %w", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,99 @@
+package kbsclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegisterReferenceValue_RequestFormat(t *testing.T) {
+	_, priv := generateTestKey(t)
+
+	var capturedReq *http.Request
+	var capturedBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		capturedReq = r
+		capturedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := c.RegisterReferenceValue(context.Background(), "init_data", []string{"abc", "def"}); err != nil {
+		t.Fatalf("RegisterReferenceValue() error = %v", err)
+	}
+
+	if capturedReq.Method != http.MethodPost || capturedReq.URL.Path != "/kbs/v0/reference-value" {
+		t.Errorf("request = %s %s, want POST /kbs/v0/reference-value", capturedReq.Method, capturedReq.URL.Path)
+	}
+
+	var msg rvpsMessage
+	if err := json.Unmarshal(capturedBody, &msg); err != nil {
+		t.Fatalf("body is not valid JSON: %v", err)
+	}
+	if msg.Version != rvpsMessageVersion || msg.Type != rvpsSampleType {
+		t.Errorf("message = %+v, want version %s type %s", msg, rvpsMessageVersion, rvpsSampleType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(msg.Payload)
+	if err != nil {
+		t.Fatalf("payload is not base64: %v", err)
+	}
+	var values map[string][]string
+	if err := json.Unmarshal(payload, &values); err != nil {
+		t.Fatalf("payload is not valid JSON: %v", err)
+	}
+	if got := values["init_data"]; len(got) != 2 || got[0] != "abc" || got[1] != "def" {
+		t.Errorf("payload values = %v, want [abc def]", got)
+	}
+}
+
+func TestRegisterReferenceValue_InvalidInput(t *testing.T) {
+	_, priv := generateTestKey(t)
+	c, err := New("http://127.0.0.1:1", priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := c.RegisterReferenceValue(context.Background(), "", []string{"abc"}); err == nil {
+		t.Error("expected error for empty name")
+	}
+	if err := c.RegisterReferenceValue(context.Background(), "init_data", nil); err == nil {
+		t.Error("expected error for empty values")
+	}
+}
+
+func TestGetReferenceValues(t *testing.T) {
+	_, priv := generateTestKey(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/kbs/v0/reference-value" {
+			t.Errorf("request = %s %s, want GET /kbs/v0/reference-value", r.Method, r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{"init_data":["abc"],"svn":["1"]}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, priv, nil)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	values, err := c.GetReferenceValues(context.Background())
+	if err != nil {
+		t.Fatalf("GetReferenceValues() error = %v", err)
+	}
+	if len(values) != 2 {
+		t.Fatalf("GetReferenceValues() returned %d entries, want 2", len(values))
+	}
+	if string(values["init_data"]) != `["abc"]` {
+		t.Errorf("init_data = %s, want [\"abc\"]", values["init_data"])
+	}
+}
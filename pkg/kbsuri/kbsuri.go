@@ -0,0 +1,138 @@
+// Package kbsuri parses and formats KBS resource URIs.
+//
+// A KBS resource URI has the form kbs://<host>/<repository>/<type>/<tag>. The host
+// is optional and usually empty (kbs:///default/mysecret/user), in which case the
+// KBS configured in the guest's initdata is used. Each path segment must match the
+// KBS resource path pattern, so that names KBS would reject (for example secret
+// keys with a leading dot) are caught when URIs are built rather than at fetch time.
+// The package depends only on the standard library so that it can be shared by
+// the CLI and the sidecar.
+package kbsuri
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Scheme is the URI scheme of KBS resource URIs.
+const Scheme = "kbs"
+
+// adminResourcePrefix is the KBS admin API prefix for resources.
+const adminResourcePrefix = "/kbs/v0/resource/"
+
+// segmentRegexp enforces the KBS resource path pattern for a single segment:
+// ^[a-zA-Z0-9_-]+[a-zA-Z0-9_-.]*$
+// A segment must start with an alphanumeric, underscore, or hyphen character and
+// may be followed by the same characters plus dots. This excludes characters such
+// as '?', '#', '%', '/' and spaces that would corrupt the URL or enable injection.
+var segmentRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*$`)
+
+// DefaultCDHURL is the base URL of the Confidential Data Hub API inside the pod sandbox.
+const DefaultCDHURL = "http://127.0.0.1:8006"
+
+// ResourceURI is a parsed KBS resource URI.
+type ResourceURI struct {
+	// Host is the optional KBS host. Empty means the KBS configured in the guest.
+	Host       string
+	Repository string
+	Type       string
+	Tag        string
+}
+
+// Parse parses a KBS resource URI. It rejects URIs that do not use the kbs
+// scheme, carry user info, a query or a fragment, or whose path is not exactly
+// three non-empty segments.
+func Parse(uri string) (ResourceURI, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ResourceURI{}, fmt.Errorf("invalid KBS URI %q: %w", uri, err)
+	}
+	if u.Scheme != Scheme {
+		return ResourceURI{}, fmt.Errorf("invalid KBS URI %q: must start with kbs://", uri)
+	}
+	if u.Opaque != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || u.RawPath != "" {
+		return ResourceURI{}, fmt.Errorf("invalid KBS URI %q: expected kbs://<host>/<repository>/<type>/<tag>", uri)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(u.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return ResourceURI{}, fmt.Errorf("invalid KBS URI %q: expected kbs:///<repository>/<type>/<tag>", uri)
+	}
+
+	r := ResourceURI{
+		Host:       u.Host,
+		Repository: parts[0],
+		Type:       parts[1],
+		Tag:        parts[2],
+	}
+	if err := r.Validate(); err != nil {
+		return ResourceURI{}, fmt.Errorf("invalid KBS URI %q: %w", uri, err)
+	}
+	return r, nil
+}
+
+// New builds a validated ResourceURI without a host from its path segments.
+func New(repository, typ, tag string) (ResourceURI, error) {
+	r := ResourceURI{Repository: repository, Type: typ, Tag: tag}
+	if err := r.Validate(); err != nil {
+		return ResourceURI{}, err
+	}
+	return r, nil
+}
+
+// ParsePath parses a bare resource path in 'repository/type/tag' format,
+// as used by the KBS admin API and 'kubectl coco kbs populate --path'.
+func ParsePath(path string) (ResourceURI, error) {
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 {
+		return ResourceURI{}, fmt.Errorf("invalid resource path %q: must be 'repository/type/tag'", path)
+	}
+	r, err := New(parts[0], parts[1], parts[2])
+	if err != nil {
+		return ResourceURI{}, fmt.Errorf("invalid resource path %q: %w", path, err)
+	}
+	return r, nil
+}
+
+// Validate checks that every path segment matches the KBS resource path pattern.
+func (r ResourceURI) Validate() error {
+	for _, seg := range []struct{ name, value string }{
+		{"repository", r.Repository},
+		{"type", r.Type},
+		{"tag", r.Tag},
+	} {
+		if !segmentRegexp.MatchString(seg.value) {
+			return fmt.Errorf("%s %q must match [a-zA-Z0-9_-][a-zA-Z0-9_-.]*", seg.name, seg.value)
+		}
+	}
+	return nil
+}
+
+// String formats the URI as kbs://<host>/<repository>/<type>/<tag>.
+func (r ResourceURI) String() string {
+	return fmt.Sprintf("%s://%s/%s", Scheme, r.Host, r.Path())
+}
+
+// Path returns the resource path <repository>/<type>/<tag>.
+func (r ResourceURI) Path() string {
+	return r.Repository + "/" + r.Type + "/" + r.Tag
+}
+
+// AdminPath returns the KBS admin API path of the resource, relative to the KBS
+// base URL, e.g. /kbs/v0/resource/default/mysecret/user.
+func (r ResourceURI) AdminPath() string {
+	return adminResourcePrefix + r.Path()
+}
+
+// CDHURL returns the Confidential Data Hub URL serving the resource, e.g.
+// http://127.0.0.1:8006/cdh/resource/default/mysecret/user. CDH always fetches
+// from the KBS configured in the guest, so the host component is not part of the URL.
+// An empty cdhBaseURL selects DefaultCDHURL.
+func (r ResourceURI) CDHURL(cdhBaseURL string) string {
+	if cdhBaseURL == "" {
+		cdhBaseURL = DefaultCDHURL
+	}
+	return strings.TrimSuffix(cdhBaseURL, "/") + "/cdh/resource/" + r.Path()
+}
@@ -0,0 +1,132 @@
+package kbsuri
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		want    ResourceURI
+		wantErr string
+	}{
+		{
+			name: "empty host",
+			uri:  "kbs:///default/mysecret/user",
+			want: ResourceURI{Repository: "default", Type: "mysecret", Tag: "user"},
+		},
+		{
+			name: "with host",
+			uri:  "kbs://kbs.example.com:8080/default/mysecret/user",
+			want: ResourceURI{Host: "kbs.example.com:8080", Repository: "default", Type: "mysecret", Tag: "user"},
+		},
+		{name: "wrong scheme", uri: "http:///default/mysecret/user", wantErr: "must start with kbs://"},
+		{name: "too few segments", uri: "kbs:///default/mysecret", wantErr: "expected"},
+		{name: "too many segments", uri: "kbs:///default/mysecret/user/extra", wantErr: "expected"},
+		{name: "empty segment", uri: "kbs:///default//user", wantErr: "expected"},
+		{name: "trailing slash", uri: "kbs:///default/mysecret/user/", wantErr: "expected"},
+		{name: "query", uri: "kbs:///default/mysecret/user?x=1", wantErr: "expected"},
+		{name: "fragment", uri: "kbs:///default/mysecret/user#frag", wantErr: "expected"},
+		{name: "user info", uri: "kbs://admin@host/default/mysecret/user", wantErr: "expected"},
+		{name: "opaque", uri: "kbs:default/mysecret/user", wantErr: "expected"},
+		{name: "leading dot", uri: "kbs:///default/mysecret/.dockerconfigjson", wantErr: "tag"},
+		{name: "encoded characters", uri: "kbs:///default/my%20secret/user", wantErr: "type"},
+		{name: "traversal", uri: "kbs:///default/../user", wantErr: "type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.uri)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse(%q) error = %v, want it to contain %q", tt.uri, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.uri, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.uri, got, tt.want)
+			}
+			if got.String() != tt.uri {
+				t.Errorf("String() = %q, want %q", got.String(), tt.uri)
+			}
+		})
+	}
+}
+
+func TestCDHURL(t *testing.T) {
+	uri := ResourceURI{Host: "kbs.example.com", Repository: "default", Type: "mysecret", Tag: "user"}
+
+	if got, want := uri.CDHURL(""), "http://127.0.0.1:8006/cdh/resource/default/mysecret/user"; got != want {
+		t.Errorf("CDHURL(\"\") = %q, want %q", got, want)
+	}
+	if got, want := uri.CDHURL("http://localhost:9006/"), "http://localhost:9006/cdh/resource/default/mysecret/user"; got != want {
+		t.Errorf("CDHURL(custom) = %q, want %q", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	uri, err := New("default", "my.secret", "tls.crt")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got, want := uri.String(), "kbs:///default/my.secret/tls.crt"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if got, want := uri.AdminPath(), "/kbs/v0/resource/default/my.secret/tls.crt"; got != want {
+		t.Errorf("AdminPath() = %q, want %q", got, want)
+	}
+
+	for _, segs := range [][3]string{
+		{"", "secret", "key"},
+		{"default", ".hidden", "key"},
+		{"default", "secret", "a/b"},
+		{"default", "secret", "key?x=y"},
+		{"default", "my secret", "key"},
+	} {
+		if _, err := New(segs[0], segs[1], segs[2]); err == nil {
+			t.Errorf("New(%q) expected error, got nil", segs)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	uri, err := ParsePath("default/attestation-status/status")
+	if err != nil {
+		t.Fatalf("ParsePath() error = %v", err)
+	}
+	if uri.Repository != "default" || uri.Type != "attestation-status" || uri.Tag != "status" {
+		t.Errorf("ParsePath() = %+v", uri)
+	}
+
+	for _, path := range []string{
+		"default/my-secret/password",
+		"ns/sidecar-tls-app/server-cert",
+		"a/b/c",
+	} {
+		if _, err := ParsePath(path); err != nil {
+			t.Errorf("ParsePath(%q) error = %v, want nil", path, err)
+		}
+	}
+
+	for _, path := range []string{
+		// wrong segment count
+		"", "only-one-part", "a/b", "a/b/c/d",
+		// empty segments
+		"/a/b/c", "a/b/c/", "default//key",
+		// traversal
+		"../../etc/passwd", "default/../secret/key", "default/secret/../../key",
+		// characters that would corrupt the URL
+		"default/secret/key?x=y", "default/secret/key#frag", "default/secret/key%20", "default/my secret/key",
+		// leading dot in a segment
+		".hidden/secret/key",
+	} {
+		if _, err := ParsePath(path); err == nil {
+			t.Errorf("ParsePath(%q) expected error, got nil", path)
+		}
+	}
+}
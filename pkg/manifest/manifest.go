@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 )
 
 // workloadKinds is the canonical set of Kubernetes workload resource kinds
@@ -899,8 +901,11 @@ func (m *Manifest) ConvertVolumeSecretToInitContainer(
 		if namespace == "" {
 			namespace = "default"
 		}
-		resourceURI := fmt.Sprintf("kbs:///%s/%s/%s", namespace, secretName, key)
-		cdhURL := strings.Replace(resourceURI, "kbs://", "http://127.0.0.1:8006/cdh/resource", 1)
+		resourceURI, err := kbsuri.New(namespace, secretName, key)
+		if err != nil {
+			return fmt.Errorf("cannot build KBS URI for secret %s key %q: %w", secretName, key, err)
+		}
+		cdhURL := resourceURI.CDHURL(kbsuri.DefaultCDHURL)
 
 		// Build file path
 		filePath := fmt.Sprintf("%s/%s", strings.TrimSuffix(mountPath, "/"), key)
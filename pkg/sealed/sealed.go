@@ -5,7 +5,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"strings"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 )
 
 // SecretSpec represents the sealed secret specification.
@@ -48,19 +49,11 @@ func GenerateSealedSecret(resourceURI string) (string, error) {
 
 // ParseResourceURI extracts the path components from a KBS resource URI.
 // Example: kbs:///default/mysecret/user -> namespace=default, resource=mysecret, key=user.
+// The optional host component (kbs://<host>/...) is accepted and ignored.
 func ParseResourceURI(uri string) (namespace, resource, key string, err error) {
-	// Remove kbs:// prefix
-	if !strings.HasPrefix(uri, "kbs://") {
-		return "", "", "", fmt.Errorf("invalid KBS URI format, must start with kbs://")
-	}
-
-	// Remove prefix and split by /
-	path := strings.TrimPrefix(uri, "kbs://")
-	parts := strings.Split(strings.Trim(path, "/"), "/")
-
-	if len(parts) < 3 {
-		return "", "", "", fmt.Errorf("invalid KBS URI format, expected kbs:///namespace/resource/key")
+	parsed, err := kbsuri.Parse(uri)
+	if err != nil {
+		return "", "", "", err
 	}
-
-	return parts[0], parts[1], parts[2], nil
+	return parsed.Repository, parsed.Type, parsed.Tag, nil
 }
@@ -119,3 +119,19 @@ func TestGenerateSealedSecretFormat(t *testing.T) {
 		t.Fatal("Payload is empty")
 	}
 }
+
+func TestParseResourceURI(t *testing.T) {
+	ns, resource, key, err := ParseResourceURI("kbs://kbs.example.com/default/mysecret/user")
+	if err != nil {
+		t.Fatalf("ParseResourceURI() error = %v", err)
+	}
+	if ns != "default" || resource != "mysecret" || key != "user" {
+		t.Errorf("ParseResourceURI() = %q, %q, %q, want default, mysecret, user", ns, resource, key)
+	}
+
+	for _, uri := range []string{"default/mysecret/user", "kbs:///default/mysecret", "kbs:///default/mysecret/user/extra"} {
+		if _, _, _, err := ParseResourceURI(uri); err == nil {
+			t.Errorf("ParseResourceURI(%q) expected error, got nil", uri)
+		}
+	}
+}
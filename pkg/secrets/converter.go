@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 	"github.com/confidential-devhub/cococtl/pkg/sealed"
 )
 
@@ -25,7 +26,11 @@ func ConvertToSealed(namespace, secretName, key string) (*SealedSecretData, erro
 
 	// Build KBS resource URI
 	// Format: kbs:///namespace/secretName/key
-	resourceURI := fmt.Sprintf("kbs:///%s/%s/%s", namespace, secretName, cleanKey)
+	uri, err := kbsuri.New(namespace, secretName, cleanKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build KBS URI for secret %s/%s key %q: %w", namespace, secretName, key, err)
+	}
+	resourceURI := uri.String()
 
 	// Generate sealed secret using existing sealed package
 	sealedSecret, err := sealed.GenerateSealedSecret(resourceURI)
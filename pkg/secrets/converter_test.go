@@ -37,6 +37,16 @@ func TestConvertToSealed(t *testing.T) {
 	}
 }
 
+func TestConvertToSealed_InvalidKBSName(t *testing.T) {
+	// A single leading dot is stripped, but the remaining name must still be a valid KBS segment
+	if _, err := ConvertToSealed("default", "db-creds", "..hidden"); err == nil {
+		t.Error("ConvertToSealed() expected error for key that is not a valid KBS name, got nil")
+	}
+	if _, err := ConvertToSealed("default", "db creds", "password"); err == nil {
+		t.Error("ConvertToSealed() expected error for secret name with a space, got nil")
+	}
+}
+
 func TestConvertSecrets_WithKnownKeys(t *testing.T) {
 	refs := []SecretReference{
 		{
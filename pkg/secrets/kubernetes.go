@@ -253,29 +253,41 @@ func CreateSealedSecrets(sealedSecrets []*SealedSecretData) (map[string]string,
 // If namespace is empty, uses current context namespace
 // Returns the first imagePullSecret name or empty string if none found
 func GetServiceAccountImagePullSecrets(ctx context.Context, clientset kubernetes.Interface, serviceAccountName, namespace string) (string, error) {
+	names, err := GetServiceAccountImagePullSecretNames(ctx, clientset, serviceAccountName, namespace)
+	if err != nil || len(names) == 0 {
+		return "", err
+	}
+	return names[0], nil
+}
+
+// GetServiceAccountImagePullSecretNames queries a service account for imagePullSecrets
+// If namespace is empty, uses current context namespace
+// Returns all imagePullSecret names in the order listed on the service account
+func GetServiceAccountImagePullSecretNames(ctx context.Context, clientset kubernetes.Interface, serviceAccountName, namespace string) ([]string, error) {
 	// Resolve empty namespace to current context namespace
 	ns := namespace
 	if ns == "" {
 		var err error
 		ns, err = k8s.GetCurrentNamespace()
 		if err != nil {
-			return "", fmt.Errorf("failed to resolve namespace: %w", err)
+			return nil, fmt.Errorf("failed to resolve namespace: %w", err)
 		}
 	}
 
 	// Get ServiceAccount using client-go
 	sa, err := clientset.CoreV1().ServiceAccounts(ns).Get(ctx, serviceAccountName, metav1.GetOptions{})
 	if err != nil {
-		return "", k8s.WrapError(err, "get", fmt.Sprintf("serviceaccount/%s", serviceAccountName), ns)
+		return nil, k8s.WrapError(err, "get", fmt.Sprintf("serviceaccount/%s", serviceAccountName), ns)
 	}
 
 	// Typed field access - ImagePullSecrets is []corev1.LocalObjectReference
-	if len(sa.ImagePullSecrets) == 0 {
-		return "", nil
+	names := make([]string, 0, len(sa.ImagePullSecrets))
+	for _, ref := range sa.ImagePullSecrets {
+		if ref.Name != "" {
+			names = append(names, ref.Name)
+		}
 	}
-
-	// Return first imagePullSecret name
-	return sa.ImagePullSecrets[0].Name, nil
+	return names, nil
 }
 
 // describeUsageTypes returns a comma-separated list of usage types for error messages
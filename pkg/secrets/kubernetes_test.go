@@ -344,6 +344,70 @@ func TestGetServiceAccountImagePullSecrets_Found(t *testing.T) {
 	}
 }
 
+func TestGetServiceAccountImagePullSecretNames_All(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-sa",
+				Namespace: "default",
+			},
+			ImagePullSecrets: []corev1.LocalObjectReference{
+				{Name: "regcred"},
+				{Name: "regcred2"},
+			},
+		},
+	)
+
+	ctx := context.Background()
+	names, err := GetServiceAccountImagePullSecretNames(ctx, fakeClient, "test-sa", "default")
+	if err != nil {
+		t.Fatalf("GetServiceAccountImagePullSecretNames() error = %v, want nil", err)
+	}
+
+	if len(names) != 2 || names[0] != "regcred" || names[1] != "regcred2" {
+		t.Errorf("GetServiceAccountImagePullSecretNames() = %v, want [regcred regcred2]", names)
+	}
+}
+
+func TestDetectImagePullSecretsWithServiceAccount_Fallback(t *testing.T) {
+	fakeClient := fake.NewSimpleClientset(
+		&corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "builder",
+				Namespace: "apps",
+			},
+			ImagePullSecrets: []corev1.LocalObjectReference{
+				{Name: "zeta-cred"},
+				{Name: "alpha-cred"},
+			},
+		},
+	)
+
+	manifestData := map[string]interface{}{
+		"kind":     "Pod",
+		"metadata": map[string]interface{}{"name": "app", "namespace": "apps"},
+		"spec": map[string]interface{}{
+			"serviceAccountName": "builder",
+			"containers":         []interface{}{map[string]interface{}{"name": "app", "image": "nginx"}},
+		},
+	}
+
+	refs, err := DetectImagePullSecretsWithServiceAccount(context.Background(), fakeClient, manifestData)
+	if err != nil {
+		t.Fatalf("DetectImagePullSecretsWithServiceAccount() error = %v", err)
+	}
+
+	// All service account secrets are returned, in the order they are listed
+	if len(refs) != 2 || refs[0].Name != "zeta-cred" || refs[1].Name != "alpha-cred" {
+		t.Fatalf("DetectImagePullSecretsWithServiceAccount() = %+v, want [zeta-cred alpha-cred]", refs)
+	}
+	for _, ref := range refs {
+		if !ref.NeedsLookup || ref.Namespace != "apps" {
+			t.Errorf("ref %s = %+v, want NeedsLookup in namespace apps", ref.Name, ref)
+		}
+	}
+}
+
 func TestGetServiceAccountImagePullSecrets_NotFound(t *testing.T) {
 	// Empty fake clientset - serviceaccount doesn't exist
 	fakeClient := fake.NewSimpleClientset()
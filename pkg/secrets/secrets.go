@@ -306,9 +306,12 @@ func detectImagePullSecrets(spec map[string]interface{}, namespace string, secre
 }
 
 // DetectImagePullSecretsWithServiceAccount detects imagePullSecrets from manifest
-// and falls back to default service account if none are found in the spec.
+// and falls back to the pod's service account (spec.serviceAccountName, or
+// "default") if none are found in the spec, as the kubelet does.
 // The clientset parameter is used for the service account fallback lookup;
 // pass nil to skip the fallback.
+// References are returned in the order they are listed, so callers that merge
+// registry credentials give precedence to the first secret.
 func DetectImagePullSecretsWithServiceAccount(ctx context.Context, clientset kubernetes.Interface, manifestData map[string]interface{}) ([]SecretReference, error) {
 	namespace, podSpec, err := manifestPreamble(manifestData)
 	if err != nil {
@@ -319,29 +322,55 @@ func DetectImagePullSecretsWithServiceAccount(ctx context.Context, clientset kub
 
 	// First, check for imagePullSecrets in the manifest
 	detectImagePullSecrets(podSpec, namespace, secretsMap)
+	order := imagePullSecretNames(podSpec)
 
-	// If no imagePullSecrets found in manifest, check default service account
+	// If no imagePullSecrets found in manifest, check the pod's service account
 	if len(secretsMap) == 0 && clientset != nil {
-		secretName, err := GetServiceAccountImagePullSecrets(ctx, clientset, "default", namespace)
-		if err == nil && secretName != "" {
-			// Found imagePullSecret in default service account
-			ref := getOrCreateSecretRef(secretsMap, secretName, namespace)
-			ref.NeedsLookup = true
-			ref.Usages = append(ref.Usages, SecretUsage{
-				Type: "imagePullSecrets",
-			})
+		serviceAccount, _ := podSpec["serviceAccountName"].(string)
+		if serviceAccount == "" {
+			serviceAccount = "default"
+		}
+		secretNames, err := GetServiceAccountImagePullSecretNames(ctx, clientset, serviceAccount, namespace)
+		if err == nil {
+			for _, secretName := range secretNames {
+				ref := getOrCreateSecretRef(secretsMap, secretName, namespace)
+				ref.NeedsLookup = true
+				ref.Usages = append(ref.Usages, SecretUsage{
+					Type: "imagePullSecrets",
+				})
+			}
+			order = secretNames
 		}
 	}
 
-	// Convert map to slice
+	// Convert map to slice, preserving the listing order
 	secrets := make([]SecretReference, 0, len(secretsMap))
-	for _, ref := range secretsMap {
-		secrets = append(secrets, *ref)
+	for _, name := range order {
+		if ref, ok := secretsMap[name]; ok {
+			secrets = append(secrets, *ref)
+			delete(secretsMap, name)
+		}
 	}
 
 	return secrets, nil
 }
 
+// imagePullSecretNames returns the imagePullSecret names listed in a pod spec, in order
+func imagePullSecretNames(spec map[string]interface{}) []string {
+	imagePullSecrets, _ := spec["imagePullSecrets"].([]interface{})
+	names := make([]string, 0, len(imagePullSecrets))
+	for _, ips := range imagePullSecrets {
+		ipsMap, ok := ips.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _ := ipsMap["name"].(string); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // getContainerName extracts the container name
 func getContainerName(container map[string]interface{}) string {
 	if name, ok := container["name"].(string); ok {
@@ -0,0 +1,71 @@
+package sidecar
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/sidecarconfig"
+)
+
+// GenerateConfigURI returns the per-app KBS URI of the sidecar configuration document.
+// Format: kbs:///<namespace>/sidecar-config-<appName>/config
+func GenerateConfigURI(appName, namespace string) string {
+	return kbsuri.ResourceURI{Repository: namespace, Type: "sidecar-config-" + appName, Tag: "config"}.String()
+}
+
+// GenerateConfig builds the sidecar configuration document for an app from the
+// [sidecar] section of the CoCo configuration and returns it encoded as JSON.
+// The document is validated before being returned.
+func GenerateConfig(cfg *config.CocoConfig, appName, namespace string) ([]byte, error) {
+	serverCertURI, serverKeyURI, clientCAURI := GenerateCertURIs(appName, namespace)
+
+	attestationRefresh, err := parseInterval("attestation_refresh_interval", cfg.Sidecar.AttestationRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+	certRefresh, err := parseInterval("cert_refresh_interval", cfg.Sidecar.CertRefreshInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &sidecarconfig.Config{
+		Version:     sidecarconfig.Version,
+		HTTPSPort:   cfg.Sidecar.HTTPSPort,
+		ForwardPort: cfg.Sidecar.ForwardPort,
+		LogLevel:    cfg.Sidecar.LogLevel,
+		TLS: sidecarconfig.TLS{
+			CertURI:     serverCertURI,
+			KeyURI:      serverKeyURI,
+			ClientCAURI: clientCAURI,
+		},
+		Refresh: sidecarconfig.Refresh{
+			Attestation:  sidecarconfig.Duration{Duration: attestationRefresh},
+			Certificates: sidecarconfig.Duration{Duration: certRefresh},
+		},
+	}
+	if len(cfg.Sidecar.AllowedClientCNs) > 0 {
+		doc.Auth.Rules = []sidecarconfig.AuthRule{
+			{PathPrefix: "/", AllowedCNs: cfg.Sidecar.AllowedClientCNs},
+		}
+	}
+
+	doc.ApplyDefaults()
+	if err := doc.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sidecar config: %w", err)
+	}
+	return doc.Marshal()
+}
+
+// parseInterval parses a refresh interval from the config. Empty means disabled.
+func parseInterval(field, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", field, value, err)
+	}
+	return d, nil
+}
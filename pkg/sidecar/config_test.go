@@ -0,0 +1,92 @@
+package sidecar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/sidecarconfig"
+)
+
+func TestGenerateConfigURI(t *testing.T) {
+	got := GenerateConfigURI("my-app", "prod")
+	want := "kbs:///prod/sidecar-config-my-app/config"
+	if got != want {
+		t.Errorf("GenerateConfigURI() = %q, want %q", got, want)
+	}
+}
+
+func TestGenerateConfig(t *testing.T) {
+	cfg := &config.CocoConfig{
+		Sidecar: config.SidecarConfig{
+			HTTPSPort:                  8443,
+			ForwardPort:                8888,
+			LogLevel:                   "warn",
+			AttestationRefreshInterval: "5m",
+			CertRefreshInterval:        "1h",
+			AllowedClientCNs:           []string{"developer"},
+		},
+	}
+
+	data, err := GenerateConfig(cfg, "my-app", "prod")
+	if err != nil {
+		t.Fatalf("GenerateConfig() error = %v", err)
+	}
+
+	// The generated document must be accepted by the sidecar's strict parser
+	doc, err := sidecarconfig.Parse(data)
+	if err != nil {
+		t.Fatalf("sidecarconfig.Parse() error = %v\n%s", err, data)
+	}
+
+	certURI, keyURI, caURI := GenerateCertURIs("my-app", "prod")
+	if doc.TLS.CertURI != certURI || doc.TLS.KeyURI != keyURI || doc.TLS.ClientCAURI != caURI {
+		t.Errorf("TLS URIs = %+v, want per-app cert URIs", doc.TLS)
+	}
+	if doc.LogLevel != "warn" {
+		t.Errorf("LogLevel = %q, want warn", doc.LogLevel)
+	}
+	if doc.Refresh.Attestation.Duration != 5*time.Minute || doc.Refresh.Certificates.Duration != time.Hour {
+		t.Errorf("Refresh = %+v, want 5m/1h", doc.Refresh)
+	}
+	if got := doc.Auth.AllowedCNs("/api/status"); len(got) != 1 || got[0] != "developer" {
+		t.Errorf("AllowedCNs(/api/status) = %v, want [developer]", got)
+	}
+	if last := doc.Routes[len(doc.Routes)-1]; last.Handler != sidecarconfig.HandlerProxy || last.Port != 8888 {
+		t.Errorf("root route = %+v, want proxy to 8888", last)
+	}
+}
+
+func TestGenerateConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		sidecar config.SidecarConfig
+		wantErr string
+	}{
+		{
+			name:    "bad log level",
+			sidecar: config.SidecarConfig{HTTPSPort: 8443, LogLevel: "verbose"},
+			wantErr: "logLevel",
+		},
+		{
+			name:    "unparsable interval",
+			sidecar: config.SidecarConfig{HTTPSPort: 8443, AttestationRefreshInterval: "often"},
+			wantErr: "attestation_refresh_interval",
+		},
+		{
+			name:    "forward port equals https port",
+			sidecar: config.SidecarConfig{HTTPSPort: 8443, ForwardPort: 8443},
+			wantErr: "conflicts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateConfig(&config.CocoConfig{Sidecar: tt.sidecar}, "app", "default")
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GenerateConfig() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -3,8 +3,10 @@ package sidecar
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/confidential-devhub/cococtl/pkg/config"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 	"github.com/confidential-devhub/cococtl/pkg/manifest"
 )
 
@@ -22,6 +24,11 @@ func Inject(m *manifest.Manifest, cfg *config.CocoConfig, appName, namespace str
 		return fmt.Errorf("invalid sidecar config: %w", err)
 	}
 
+	// Per-app KBS URIs embed the app name and namespace; reject names KBS cannot serve
+	if _, err := kbsuri.New(namespace, "sidecar-tls-"+appName, "server-cert"); err != nil {
+		return fmt.Errorf("cannot build sidecar KBS URIs for app %q in namespace %q: %w", appName, namespace, err)
+	}
+
 	container := buildContainer(cfg, appName, namespace)
 
 	if err := m.AddSidecarContainer(container); err != nil {
@@ -40,6 +47,12 @@ func validateConfig(cfg *config.CocoConfig) error {
 	if cfg.Sidecar.HTTPSPort <= 0 || cfg.Sidecar.HTTPSPort > 65535 {
 		return fmt.Errorf("invalid https_port: must be between 1 and 65535")
 	}
+	if cfg.Sidecar.CDHURL != "" {
+		u, err := url.Parse(cfg.Sidecar.CDHURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid cdh_url %q: must be an http(s) URL with a host", cfg.Sidecar.CDHURL)
+		}
+	}
 	return nil
 }
 
@@ -48,11 +61,11 @@ func validateConfig(cfg *config.CocoConfig) error {
 //
 //	kbs:///default/sidecar-tls/client-ca (global, always in default namespace)
 func GenerateCertURIs(appName, namespace string) (serverCertURI, serverKeyURI, clientCAURI string) {
-	certPrefix := fmt.Sprintf("kbs:///%s/sidecar-tls-%s", namespace, appName)
-	serverCertURI = certPrefix + "/server-cert"
-	serverKeyURI = certPrefix + "/server-key"
+	certType := "sidecar-tls-" + appName
+	serverCertURI = kbsuri.ResourceURI{Repository: namespace, Type: certType, Tag: "server-cert"}.String()
+	serverKeyURI = kbsuri.ResourceURI{Repository: namespace, Type: certType, Tag: "server-key"}.String()
 	// Client CA is always stored in "default" namespace for consistency
-	clientCAURI = "kbs:///default/sidecar-tls/client-ca"
+	clientCAURI = kbsuri.ResourceURI{Repository: "default", Type: "sidecar-tls", Tag: "client-ca"}.String()
 	return
 }
 
@@ -61,8 +74,14 @@ func buildContainer(cfg *config.CocoConfig, appName, namespace string) map[strin
 	// Generate per-app certificate URIs
 	serverCertURI, serverKeyURI, clientCAURI := GenerateCertURIs(appName, namespace)
 
-	// Environment variables for KBS URIs and pod metadata
+	// Environment variables for KBS URIs and pod metadata.
+	// CONFIG_URI takes precedence in the sidecar; the individual variables are kept
+	// for sidecar images that predate the configuration document.
 	env := []interface{}{
+		map[string]interface{}{
+			"name":  "CONFIG_URI",
+			"value": GenerateConfigURI(appName, namespace),
+		},
 		map[string]interface{}{
 			"name":  "TLS_CERT_URI",
 			"value": serverCertURI,
@@ -98,6 +117,14 @@ func buildContainer(cfg *config.CocoConfig, appName, namespace string) map[strin
 		},
 	}
 
+	// Point the sidecar at a non-default CDH endpoint if configured
+	if cfg.Sidecar.CDHURL != "" {
+		env = append(env, map[string]interface{}{
+			"name":  "CDH_URL",
+			"value": cfg.Sidecar.CDHURL,
+		})
+	}
+
 	// Add forward port if configured
 	if cfg.Sidecar.ForwardPort > 0 {
 		env = append(env, map[string]interface{}{
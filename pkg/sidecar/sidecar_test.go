@@ -24,6 +24,19 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid cdh_url",
+			cfg: &config.CocoConfig{
+				Sidecar: config.SidecarConfig{
+					Enabled:   true,
+					Image:     "test:latest",
+					HTTPSPort: 8443,
+					CDHURL:    "127.0.0.1:8006",
+				},
+			},
+			wantErr: true,
+			errMsg:  "invalid cdh_url",
+		},
 		{
 			name: "missing image",
 			cfg: &config.CocoConfig{
@@ -0,0 +1,323 @@
+// Package sidecarconfig defines the versioned configuration document consumed by
+// the secure access sidecar.
+//
+// The document is generated by 'kubectl coco apply' from the [sidecar] section of
+// coco-config.toml, uploaded to KBS, and fetched by the sidecar at startup via CDH.
+// It is shared by the CLI and the sidecar binary so that both sides agree on the
+// schema; the package intentionally depends only on the standard library and
+// pkg/kbsuri.
+package sidecarconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+)
+
+// Version is the only document version understood by this package.
+const Version = "v1"
+
+// Default values applied to fields that are not set in the document.
+const (
+	DefaultHTTPSPort = 8443
+	DefaultLogLevel  = LogLevelInfo
+
+	// minRefreshInterval guards against refresh loops that would hammer CDH.
+	minRefreshInterval = 10 * time.Second
+)
+
+// Log levels accepted in the logLevel field.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+)
+
+// Route handlers accepted in routes[].handler.
+const (
+	HandlerDashboard   = "dashboard"
+	HandlerStatus      = "status"
+	HandlerAttestation = "attestation"
+	HandlerProxy       = "proxy"
+)
+
+// Config is the sidecar configuration document.
+type Config struct {
+	Version     string  `json:"version"`
+	HTTPSPort   int     `json:"httpsPort"`
+	ForwardPort int     `json:"forwardPort,omitempty"`
+	LogLevel    string  `json:"logLevel,omitempty"`
+	TLS         TLS     `json:"tls"`
+	Routes      []Route `json:"routes,omitempty"`
+	Auth        Auth    `json:"auth,omitempty"`
+	Refresh     Refresh `json:"refresh,omitempty"`
+}
+
+// TLS holds the KBS resource URIs of the sidecar's TLS material.
+type TLS struct {
+	CertURI     string `json:"certURI"`
+	KeyURI      string `json:"keyURI"`
+	ClientCAURI string `json:"clientCAURI"`
+}
+
+// Route maps a URL path pattern to one of the built-in handlers.
+// Port is required for the proxy handler and must be zero otherwise.
+type Route struct {
+	Path    string `json:"path"`
+	Handler string `json:"handler"`
+	Port    int    `json:"port,omitempty"`
+}
+
+// Auth holds authorization rules applied on top of mTLS client verification.
+type Auth struct {
+	Rules []AuthRule `json:"rules,omitempty"`
+}
+
+// AuthRule restricts requests whose path starts with PathPrefix to clients
+// presenting a certificate with one of the listed Common Names.
+// When several rules match, the longest PathPrefix wins.
+type AuthRule struct {
+	PathPrefix string   `json:"pathPrefix"`
+	AllowedCNs []string `json:"allowedCNs"`
+}
+
+// Refresh holds the periodic refresh intervals. A zero interval disables the
+// corresponding refresh loop.
+type Refresh struct {
+	Attestation  Duration `json:"attestation,omitempty"`
+	Certificates Duration `json:"certificates,omitempty"`
+}
+
+// Duration is a time.Duration encoded as a Go duration string ("30s", "5m").
+type Duration struct {
+	time.Duration
+}
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a duration string. Bare numbers are rejected so that
+// units are always explicit.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\" or \"5m\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Parse decodes a configuration document, applies defaults and validates it.
+// Unknown fields and trailing data are rejected.
+func Parse(data []byte) (*Config, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var cfg Config
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse sidecar config: %w", err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse sidecar config: unexpected data after document")
+	}
+
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid sidecar config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Marshal encodes the document as indented JSON.
+func (c *Config) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sidecar config: %w", err)
+	}
+	return data, nil
+}
+
+// ApplyDefaults fills in unset fields. Routes default to DefaultRoutes.
+func (c *Config) ApplyDefaults() {
+	if c.HTTPSPort == 0 {
+		c.HTTPSPort = DefaultHTTPSPort
+	}
+	if c.LogLevel == "" {
+		c.LogLevel = DefaultLogLevel
+	}
+	if len(c.Routes) == 0 {
+		c.Routes = DefaultRoutes(c.ForwardPort)
+	}
+}
+
+// DefaultRoutes returns the routes served when none are configured: the status
+// and attestation APIs, plus either the dashboard at "/" or, when forwardPort is
+// set, the dashboard at "/dashboard" and the forwarded application at "/".
+func DefaultRoutes(forwardPort int) []Route {
+	routes := []Route{
+		{Path: "/api/status", Handler: HandlerStatus},
+		{Path: "/api/attestation", Handler: HandlerAttestation},
+	}
+	if forwardPort > 0 {
+		return append(routes,
+			Route{Path: "/dashboard", Handler: HandlerDashboard},
+			Route{Path: "/", Handler: HandlerProxy, Port: forwardPort},
+		)
+	}
+	return append(routes, Route{Path: "/", Handler: HandlerDashboard})
+}
+
+// Validate checks the document for consistency. It does not apply defaults.
+func (c *Config) Validate() error {
+	if c.Version != Version {
+		return fmt.Errorf("version: got %q, want %q", c.Version, Version)
+	}
+	if err := validatePort("httpsPort", c.HTTPSPort); err != nil {
+		return err
+	}
+	if c.ForwardPort != 0 {
+		if err := validatePort("forwardPort", c.ForwardPort); err != nil {
+			return err
+		}
+		if c.ForwardPort == c.HTTPSPort {
+			return fmt.Errorf("forwardPort %d conflicts with httpsPort", c.ForwardPort)
+		}
+	}
+
+	switch c.LogLevel {
+	case LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		return fmt.Errorf("logLevel: got %q, want one of debug, info, warn, error", c.LogLevel)
+	}
+
+	for _, f := range []struct{ name, uri string }{
+		{"tls.certURI", c.TLS.CertURI},
+		{"tls.keyURI", c.TLS.KeyURI},
+		{"tls.clientCAURI", c.TLS.ClientCAURI},
+	} {
+		if f.uri == "" {
+			return fmt.Errorf("%s is required", f.name)
+		}
+		if _, err := kbsuri.Parse(f.uri); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	if err := validateRoutes(c.Routes, c.HTTPSPort); err != nil {
+		return err
+	}
+	if err := validateAuthRules(c.Auth.Rules); err != nil {
+		return err
+	}
+
+	for _, f := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"refresh.attestation", c.Refresh.Attestation.Duration},
+		{"refresh.certificates", c.Refresh.Certificates.Duration},
+	} {
+		if f.d < 0 {
+			return fmt.Errorf("%s must not be negative", f.name)
+		}
+		if f.d > 0 && f.d < minRefreshInterval {
+			return fmt.Errorf("%s must be 0 (disabled) or at least %s, got %s", f.name, minRefreshInterval, f.d)
+		}
+	}
+
+	return nil
+}
+
+func validatePort(field string, port int) error {
+	if port <= 0 || port > 65535 {
+		return fmt.Errorf("%s must be between 1 and 65535, got %d", field, port)
+	}
+	return nil
+}
+
+func validateRoutes(routes []Route, httpsPort int) error {
+	if len(routes) == 0 {
+		return fmt.Errorf("at least one route is required")
+	}
+	seen := make(map[string]bool, len(routes))
+	for i, r := range routes {
+		if !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("routes[%d].path %q must start with /", i, r.Path)
+		}
+		if seen[r.Path] {
+			return fmt.Errorf("routes[%d].path %q is duplicated", i, r.Path)
+		}
+		seen[r.Path] = true
+
+		switch r.Handler {
+		case HandlerDashboard, HandlerStatus, HandlerAttestation:
+			if r.Port != 0 {
+				return fmt.Errorf("routes[%d].port is only valid for the proxy handler", i)
+			}
+		case HandlerProxy:
+			if err := validatePort(fmt.Sprintf("routes[%d].port", i), r.Port); err != nil {
+				return err
+			}
+			if r.Port == httpsPort {
+				return fmt.Errorf("routes[%d].port %d conflicts with httpsPort", i, r.Port)
+			}
+		default:
+			return fmt.Errorf("routes[%d].handler: got %q, want one of dashboard, status, attestation, proxy", i, r.Handler)
+		}
+	}
+	return nil
+}
+
+func validateAuthRules(rules []AuthRule) error {
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if !strings.HasPrefix(rule.PathPrefix, "/") {
+			return fmt.Errorf("auth.rules[%d].pathPrefix %q must start with /", i, rule.PathPrefix)
+		}
+		if seen[rule.PathPrefix] {
+			return fmt.Errorf("auth.rules[%d].pathPrefix %q is duplicated", i, rule.PathPrefix)
+		}
+		seen[rule.PathPrefix] = true
+		if len(rule.AllowedCNs) == 0 {
+			return fmt.Errorf("auth.rules[%d].allowedCNs must not be empty", i)
+		}
+		for _, cn := range rule.AllowedCNs {
+			if strings.TrimSpace(cn) == "" {
+				return fmt.Errorf("auth.rules[%d].allowedCNs contains an empty name", i)
+			}
+		}
+	}
+	return nil
+}
+
+// AllowedCNs returns the Common Names allowed to access path, or nil when no
+// rule applies. The rule with the longest matching PathPrefix wins.
+func (a Auth) AllowedCNs(path string) []string {
+	var best *AuthRule
+	for i := range a.Rules {
+		rule := &a.Rules[i]
+		if !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		if best == nil || len(rule.PathPrefix) > len(best.PathPrefix) {
+			best = rule
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.AllowedCNs
+}
@@ -0,0 +1,173 @@
+package sidecarconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const validDoc = `{
+  "version": "v1",
+  "httpsPort": 8443,
+  "forwardPort": 8888,
+  "logLevel": "warn",
+  "tls": {
+    "certURI": "kbs:///default/sidecar-tls-app/server-cert",
+    "keyURI": "kbs:///default/sidecar-tls-app/server-key",
+    "clientCAURI": "kbs:///default/sidecar-tls/client-ca"
+  },
+  "auth": {
+    "rules": [
+      {"pathPrefix": "/", "allowedCNs": ["developer"]},
+      {"pathPrefix": "/api/", "allowedCNs": ["developer", "monitor"]}
+    ]
+  },
+  "refresh": {
+    "attestation": "5m",
+    "certificates": "1h"
+  }
+}`
+
+func TestParse_Valid(t *testing.T) {
+	cfg, err := Parse([]byte(validDoc))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.ForwardPort != 8888 {
+		t.Errorf("ForwardPort = %d, want 8888", cfg.ForwardPort)
+	}
+	if cfg.LogLevel != LogLevelWarn {
+		t.Errorf("LogLevel = %q, want %q", cfg.LogLevel, LogLevelWarn)
+	}
+	if cfg.Refresh.Attestation.Duration != 5*time.Minute {
+		t.Errorf("Refresh.Attestation = %s, want 5m", cfg.Refresh.Attestation)
+	}
+	if cfg.Refresh.Certificates.Duration != time.Hour {
+		t.Errorf("Refresh.Certificates = %s, want 1h", cfg.Refresh.Certificates)
+	}
+	// Routes default from forwardPort when omitted.
+	if len(cfg.Routes) != 4 {
+		t.Fatalf("expected 4 default routes, got %d", len(cfg.Routes))
+	}
+	last := cfg.Routes[len(cfg.Routes)-1]
+	if last.Path != "/" || last.Handler != HandlerProxy || last.Port != 8888 {
+		t.Errorf("root route = %+v, want proxy to 8888", last)
+	}
+}
+
+func TestParse_RoundTrip(t *testing.T) {
+	cfg, err := Parse([]byte(validDoc))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	data, err := cfg.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	again, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse(Marshal()) error = %v\n%s", err, data)
+	}
+	if again.Refresh.Certificates != cfg.Refresh.Certificates {
+		t.Errorf("round trip changed refresh.certificates: %s -> %s", cfg.Refresh.Certificates, again.Refresh.Certificates)
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(string) string
+		wantErr string
+	}{
+		{"unknown field", func(s string) string { return strings.Replace(s, `"logLevel"`, `"logFormat"`, 1) }, "unknown field"},
+		{"wrong version", func(s string) string { return strings.Replace(s, `"v1"`, `"v2"`, 1) }, "version"},
+		{"bad log level", func(s string) string { return strings.Replace(s, `"warn"`, `"verbose"`, 1) }, "logLevel"},
+		{"port out of range", func(s string) string { return strings.Replace(s, `8888`, `70000`, 1) }, "forwardPort"},
+		{"port conflict", func(s string) string { return strings.Replace(s, `8888`, `8443`, 1) }, "conflicts"},
+		{"non-kbs uri", func(s string) string {
+			return strings.Replace(s, `kbs:///default/sidecar-tls/client-ca`, `http://x`, 1)
+		}, "tls.clientCAURI"},
+		{"numeric duration", func(s string) string { return strings.Replace(s, `"5m"`, `300`, 1) }, "duration"},
+		{"too short refresh", func(s string) string { return strings.Replace(s, `"5m"`, `"1s"`, 1) }, "refresh.attestation"},
+		{"empty allowedCNs", func(s string) string { return strings.Replace(s, `["developer"]`, `[]`, 1) }, "allowedCNs"},
+		{"trailing data", func(s string) string { return s + `{}` }, "unexpected data"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.mutate(validDoc)))
+			if err == nil {
+				t.Fatal("Parse() expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Routes(t *testing.T) {
+	base := func() *Config {
+		return &Config{
+			Version:   Version,
+			HTTPSPort: 8443,
+			LogLevel:  LogLevelInfo,
+			TLS: TLS{
+				CertURI:     "kbs:///a/b/c",
+				KeyURI:      "kbs:///a/b/d",
+				ClientCAURI: "kbs:///a/b/e",
+			},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		routes  []Route
+		wantErr string
+	}{
+		{"relative path", []Route{{Path: "api", Handler: HandlerStatus}}, "must start with /"},
+		{"duplicate path", []Route{{Path: "/", Handler: HandlerDashboard}, {Path: "/", Handler: HandlerStatus}}, "duplicated"},
+		{"unknown handler", []Route{{Path: "/", Handler: "shell"}}, "handler"},
+		{"proxy without port", []Route{{Path: "/", Handler: HandlerProxy}}, "port"},
+		{"port on non-proxy", []Route{{Path: "/", Handler: HandlerDashboard, Port: 80}}, "only valid for the proxy"},
+		{"proxy to https port", []Route{{Path: "/", Handler: HandlerProxy, Port: 8443}}, "conflicts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base()
+			cfg.Routes = tt.routes
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultRoutes(t *testing.T) {
+	routes := DefaultRoutes(0)
+	if routes[len(routes)-1].Handler != HandlerDashboard {
+		t.Errorf("without forward port, / should serve the dashboard, got %+v", routes)
+	}
+	for _, r := range routes {
+		if r.Handler == HandlerProxy {
+			t.Errorf("unexpected proxy route without forward port: %+v", r)
+		}
+	}
+}
+
+func TestAuth_AllowedCNs(t *testing.T) {
+	auth := Auth{Rules: []AuthRule{
+		{PathPrefix: "/", AllowedCNs: []string{"developer"}},
+		{PathPrefix: "/api/", AllowedCNs: []string{"monitor"}},
+	}}
+
+	if got := auth.AllowedCNs("/api/status"); len(got) != 1 || got[0] != "monitor" {
+		t.Errorf("AllowedCNs(/api/status) = %v, want [monitor]", got)
+	}
+	if got := auth.AllowedCNs("/dashboard"); len(got) != 1 || got[0] != "developer" {
+		t.Errorf("AllowedCNs(/dashboard) = %v, want [developer]", got)
+	}
+	if got := (Auth{}).AllowedCNs("/"); got != nil {
+		t.Errorf("AllowedCNs with no rules = %v, want nil", got)
+	}
+}
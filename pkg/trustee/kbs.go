@@ -1,11 +1,16 @@
 package trustee
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -14,6 +19,7 @@ import (
 	"k8s.io/client-go/rest"
 
 	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 )
 
 // errWatchClosed is returned by watchUntilReady when the API server closes the
@@ -40,6 +46,36 @@ func UploadResources(ctx context.Context, client *kbsclient.Client, resources ma
 	return nil
 }
 
+// AddReferenceValues registers values under name with the KBS reference value
+// provider, keeping any values already registered under that name so that
+// several workloads can share one reference value (e.g. the initdata digest).
+// Existing values that are not a plain list of strings are replaced.
+func AddReferenceValues(ctx context.Context, client *kbsclient.Client, name string, values []string) error {
+	merged := values
+	if existing, err := client.GetReferenceValues(ctx); err == nil {
+		var current []string
+		if raw, ok := existing[name]; ok && json.Unmarshal(raw, &current) == nil {
+			merged = mergeValues(current, values)
+		}
+	} else if !kbsclient.IsNotFound(err) {
+		return fmt.Errorf("failed to read reference values: %w", err)
+	}
+	return client.RegisterReferenceValue(ctx, name, merged)
+}
+
+// mergeValues returns current followed by the entries of added not already present.
+func mergeValues(current, added []string) []string {
+	seen := make(map[string]bool, len(current))
+	merged := make([]string, 0, len(current)+len(added))
+	for _, v := range append(append([]string{}, current...), added...) {
+		if !seen[v] {
+			seen[v] = true
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
 // NewClientWithPortForward creates a kbsclient.Client connected to the KBS pod via a
 // temporary port-forward. The caller must invoke the returned stop function when done
 // to release the port-forward. ctx bounds only the port-forward handshake; subsequent
@@ -90,8 +126,9 @@ func NewClientWithPortForwardFromPEM(ctx context.Context, restConfig *rest.Confi
 		return nil, nil, fmt.Errorf("failed to port-forward to KBS pod: %w", err)
 	}
 
-	kbsURL := fmt.Sprintf("http://127.0.0.1:%d", localPort)
-	kbsClient, err := kbsclient.NewFromPEM(kbsURL, privateKeyPEM, nil)
+	kbsClient, err := tunnelClient(ctx, clientset, namespace, localPort, func(baseURL string, caCert []byte) (*kbsclient.Client, error) {
+		return kbsclient.NewFromPEM(baseURL, privateKeyPEM, caCert)
+	})
 	if err != nil {
 		stopForward()
 		return nil, nil, fmt.Errorf("failed to create KBS client: %w", err)
@@ -225,3 +262,95 @@ func isPodReady(pod *corev1.Pod) bool {
 	return false
 }
 
+// ListRepositoryResources lists the resource paths (repository/type/tag) stored
+// in the LocalFs repository of the in-cluster KBS pod. The KBS API has no
+// listing endpoint, so the repository directory is read via kubectl exec.
+// Only paths under prefix are returned; an empty prefix lists everything.
+func ListRepositoryResources(ctx context.Context, clientset kubernetes.Interface, namespace, prefix string) ([]string, error) {
+	if err := requireLocalFs(ctx, clientset, namespace); err != nil {
+		return nil, err
+	}
+
+	podName, err := getReadyKBSPodName(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := execInKBSPod(ctx, namespace, podName, "find", kbsRepositoryDir, "-type", "f")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list KBS repository: %w", err)
+	}
+
+	return parseRepositoryListing(string(output), prefix), nil
+}
+
+// ReadRepositoryResource reads a resource directly from the LocalFs repository
+// of the in-cluster KBS pod. It is used when the KBS API refuses to return the
+// resource to the admin (resource GET normally requires an attestation token).
+func ReadRepositoryResource(ctx context.Context, clientset kubernetes.Interface, namespace, resourcePath string) ([]byte, error) {
+	uri, err := kbsuri.ParsePath(resourcePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireLocalFs(ctx, clientset, namespace); err != nil {
+		return nil, err
+	}
+
+	podName, err := getReadyKBSPodName(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := execInKBSPod(ctx, namespace, podName, "cat", kbsRepositoryDir+"/"+uri.Path())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from KBS repository: %w", uri.Path(), err)
+	}
+	return output, nil
+}
+
+// requireLocalFs returns an error when the KBS in namespace keeps its
+// resources in Vault, where the repository directory is not used.
+func requireLocalFs(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	backend, err := GetResourceBackend(ctx, clientset, namespace)
+	if err != nil {
+		return err
+	}
+	if backend != ResourceBackendFile {
+		return fmt.Errorf("the KBS in namespace %s stores resources in %s, not in its LocalFs repository; use the %s tooling to read them", namespace, backend, backend)
+	}
+	return nil
+}
+
+// parseRepositoryListing converts `find <repository> -type f` output into sorted
+// resource paths, skipping entries that are not valid repository/type/tag paths.
+func parseRepositoryListing(output, prefix string) []string {
+	var paths []string
+	for _, line := range strings.Split(output, "\n") {
+		rel, ok := strings.CutPrefix(strings.TrimSpace(line), kbsRepositoryDir+"/")
+		if !ok {
+			continue
+		}
+		if _, err := kbsuri.ParsePath(rel); err != nil {
+			continue
+		}
+		if !strings.HasPrefix(rel, prefix) {
+			continue
+		}
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// execInKBSPod runs a command in the KBS container and returns its stdout.
+func execInKBSPod(ctx context.Context, namespace, podName string, command ...string) ([]byte, error) {
+	args := append([]string{"exec", "-n", namespace, podName, "-c", "kbs", "--"}, command...)
+	cmd := exec.CommandContext(ctx, "kubectl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl exec failed: %w\n%s", err, stderr.String())
+	}
+	return output, nil
+}
@@ -252,3 +252,51 @@ func TestWaitForKBSReady_WatchClosedRelists(t *testing.T) {
 		t.Fatalf("WaitForKBSReady() error = %v, want nil after re-list", err)
 	}
 }
+
+func TestParseRepositoryListing(t *testing.T) {
+	output := kbsRepositoryDir + "/default/sidecar-tls/server-cert\n" +
+		kbsRepositoryDir + "/default/attestation-status/status\n" +
+		kbsRepositoryDir + "/prod/app/key\n" +
+		kbsRepositoryDir + "/stray-file\n" +
+		"/elsewhere/default/x/y\n\n"
+
+	got := parseRepositoryListing(output, "")
+	want := []string{
+		"default/attestation-status/status",
+		"default/sidecar-tls/server-cert",
+		"prod/app/key",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseRepositoryListing() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("parseRepositoryListing()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	filtered := parseRepositoryListing(output, "prod/")
+	if len(filtered) != 1 || filtered[0] != "prod/app/key" {
+		t.Errorf("parseRepositoryListing() with prefix = %v, want [prod/app/key]", filtered)
+	}
+}
+
+func TestReadRepositoryResource_InvalidPath(t *testing.T) {
+	clientset := fake.NewSimpleClientset(readyPod("kbs-abc", "trustee"))
+	if _, err := ReadRepositoryResource(context.Background(), clientset, "trustee", "../etc/passwd"); err == nil {
+		t.Error("ReadRepositoryResource() expected error for invalid path")
+	}
+}
+
+func TestMergeValues(t *testing.T) {
+	got := mergeValues([]string{"a", "b"}, []string{"b", "c", "c"})
+	want := []string{"a", "b", "c"}
+	if len(got) != len(want) {
+		t.Fatalf("mergeValues() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("mergeValues()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package trustee
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+)
+
+const (
+	// ManagedByLabel is set to "cococtl" on every object Deploy creates, so
+	// that Undeploy can find them.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+
+	// DataLabel marks the objects holding KBS state: the admin public key,
+	// the TLS and Vault Secrets, the resource policy ConfigMap and the
+	// storage PVC. Undeploy keeps them when asked to keep data.
+	DataLabel = "confidential-devhub.github.io/kbs-data"
+
+	managedByValue = "cococtl"
+
+	// rolloutPollInterval is how often Upgrade checks the rollout progress,
+	// and SetResourcePolicy whether KBS loaded the new policy.
+	rolloutPollInterval = 2 * time.Second
+)
+
+// Undeploy deletes the KBS objects Deploy created in namespace, selected by
+// ManagedByLabel. With keepData the objects labelled DataLabel are kept, so
+// that a later Deploy serves the same resources to the same admin key. The
+// namespace itself is left in place. It returns the deleted objects as
+// "kind/name".
+//
+// KBS Deployments created before the labels were introduced are found by the
+// app=kbs label; their other objects are left behind.
+func Undeploy(ctx context.Context, clientset kubernetes.Interface, namespace string, keepData bool) ([]string, error) {
+	selector := ManagedByLabel + "=" + managedByValue
+	if keepData {
+		selector += "," + DataLabel + "!=true"
+	}
+	listOpts := metav1.ListOptions{LabelSelector: selector}
+	// Remove the pods with their Deployment rather than orphaning them.
+	propagation := metav1.DeletePropagationBackground
+	deleteOpts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	var deleted []string
+	deleteAll := func(kind string, names []string, del func(name string) error) error {
+		for _, name := range names {
+			if err := del(name); err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete %s/%s: %w", kind, name, err)
+			}
+			deleted = append(deleted, kind+"/"+name)
+		}
+		return nil
+	}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: trusteeLabel})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list KBS deployments: %w", err)
+	}
+	var names []string
+	for _, d := range deployments.Items {
+		names = append(names, d.Name)
+	}
+	if err := deleteAll("deployment", names, func(name string) error {
+		return clientset.AppsV1().Deployments(namespace).Delete(ctx, name, deleteOpts)
+	}); err != nil {
+		return deleted, err
+	}
+
+	services, err := clientset.CoreV1().Services(namespace).List(ctx, listOpts)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to list KBS services: %w", err)
+	}
+	names = nil
+	for _, svc := range services.Items {
+		names = append(names, svc.Name)
+	}
+	if err := deleteAll("service", names, func(name string) error {
+		return clientset.CoreV1().Services(namespace).Delete(ctx, name, deleteOpts)
+	}); err != nil {
+		return deleted, err
+	}
+
+	configMaps, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, listOpts)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to list KBS ConfigMaps: %w", err)
+	}
+	names = nil
+	for _, cm := range configMaps.Items {
+		names = append(names, cm.Name)
+	}
+	if err := deleteAll("configmap", names, func(name string) error {
+		return clientset.CoreV1().ConfigMaps(namespace).Delete(ctx, name, deleteOpts)
+	}); err != nil {
+		return deleted, err
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(namespace).List(ctx, listOpts)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to list KBS secrets: %w", err)
+	}
+	names = nil
+	for _, secret := range secrets.Items {
+		names = append(names, secret.Name)
+	}
+	if err := deleteAll("secret", names, func(name string) error {
+		return clientset.CoreV1().Secrets(namespace).Delete(ctx, name, deleteOpts)
+	}); err != nil {
+		return deleted, err
+	}
+
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(namespace).List(ctx, listOpts)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to list KBS PersistentVolumeClaims: %w", err)
+	}
+	names = nil
+	for _, pvc := range pvcs.Items {
+		names = append(names, pvc.Name)
+	}
+	if err := deleteAll("persistentvolumeclaim", names, func(name string) error {
+		return clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, deleteOpts)
+	}); err != nil {
+		return deleted, err
+	}
+
+	return deleted, nil
+}
+
+// Upgrade rolls the KBS Deployment in namespace to image and waits until the
+// new pod is ready. The admin key and the KBS configuration are untouched;
+// resources survive when they are kept on a PVC or in Vault. Afterwards the
+// attestation status resource is uploaded again with the key in authDir if the
+// roll lost it, as it does with in-memory storage. It returns the previous image.
+func Upgrade(ctx context.Context, clientset kubernetes.Interface, restConfig *rest.Config, namespace, image, authDir string) (string, error) {
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{LabelSelector: trusteeLabel})
+	if err != nil {
+		return "", fmt.Errorf("failed to get KBS deployment: %w", err)
+	}
+	if len(deployments.Items) == 0 {
+		return "", fmt.Errorf("no KBS deployment found in namespace %s", namespace)
+	}
+	deployment := &deployments.Items[0]
+
+	previous, err := setKBSImage(deployment, image)
+	if err != nil {
+		return "", err
+	}
+	if previous == image {
+		return previous, nil
+	}
+	if deployment, err = clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		return previous, fmt.Errorf("failed to update KBS deployment: %w", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, kbsReadyTimeout)
+	defer cancel()
+	if err := waitForRollout(waitCtx, clientset, namespace, deployment.Name); err != nil {
+		return previous, err
+	}
+
+	kbsClient, stop, err := NewClientWithPortForward(ctx, restConfig, clientset, namespace, authDir)
+	if err != nil {
+		return previous, err
+	}
+	defer stop()
+	if err := restoreAttestationStatus(ctx, kbsClient, persistentStorage(deployment)); err != nil {
+		return previous, err
+	}
+	return previous, nil
+}
+
+// persistentStorage reports whether deployment keeps KBS resources on a PVC
+// or in Vault, so that they survive a roll.
+func persistentStorage(deployment *appsv1.Deployment) bool {
+	for _, v := range deployment.Spec.Template.Spec.Volumes {
+		if (v.Name == "confidential-containers" && v.PersistentVolumeClaim != nil) || v.Name == "kbs-vault" {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreAttestationStatus uploads the default attestation status resource
+// unless it is kept on persistent storage and still present.
+func restoreAttestationStatus(ctx context.Context, client *kbsclient.Client, persistent bool) error {
+	if persistent {
+		_, err := client.GetResource(ctx, AttestationStatusPath)
+		switch {
+		case err == nil:
+			return nil
+		case kbsclient.IsUnauthorized(err):
+			// Upstream KBS only releases resources to attested clients;
+			// assume the resource survived on the persistent storage.
+			return nil
+		case !kbsclient.IsNotFound(err):
+			return fmt.Errorf("failed to read attestation status: %w", err)
+		}
+	}
+	if err := client.SetResource(ctx, AttestationStatusPath, []byte(defaultAttestationStatusContent)); err != nil {
+		return fmt.Errorf("failed to set default attestation status: %w", err)
+	}
+	return nil
+}
+
+// setKBSImage sets the image of the kbs container of deployment and returns
+// the previous one.
+func setKBSImage(deployment *appsv1.Deployment, image string) (string, error) {
+	containers := deployment.Spec.Template.Spec.Containers
+	for i := range containers {
+		if containers[i].Name == "kbs" {
+			previous := containers[i].Image
+			containers[i].Image = image
+			return previous, nil
+		}
+	}
+	return "", fmt.Errorf("deployment %s has no kbs container", deployment.Name)
+}
+
+// waitForRollout polls the Deployment until all its replicas run the latest
+// pod template and are ready.
+func waitForRollout(ctx context.Context, clientset kubernetes.Interface, namespace, name string) error {
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	for {
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get KBS deployment: %w", err)
+		}
+		if rolloutComplete(deployment) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for the KBS rollout: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// rolloutComplete reports whether the controller has observed the latest
+// generation of deployment and every replica is updated and ready, with no old
+// replicas left.
+func rolloutComplete(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == replicas &&
+		status.ReadyReplicas == replicas &&
+		status.Replicas == replicas
+}
@@ -0,0 +1,264 @@
+package trustee
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+)
+
+func TestManifests_ManagedByLabel(t *testing.T) {
+	cfg := &Config{Namespace: "coco", ServiceName: "trustee-kbs", KBSImage: "kbs:test", Storage: StoragePVC}
+	manifests := map[string]string{
+		"configmaps": configMapsManifest(t, &Config{Namespace: "coco"}),
+		"kbs":        kbsManifest(t, cfg),
+		"pvc":        objectsManifest(t, storagePVC(t, cfg)),
+		"policy":     objectsManifest(t, buildResourcePolicyConfigMap("coco")),
+		"auth":       objectsManifest(t, buildAuthSecret("coco", []byte("key"))),
+		"tls":        objectsManifest(t, buildTLSSecret("coco", &TLSConfig{CertPEM: []byte("c"), KeyPEM: []byte("k")})),
+		"vault":      objectsManifest(t, buildVaultSecret("coco", &VaultConfig{Token: "t"})),
+	}
+	data := map[string]bool{"trustee-kbs": false, "resource-policy": true, "kbs-storage": true, "kbs-auth-public-key": true, "kbs-tls": true, "kbs-vault": true}
+
+	for name, manifest := range manifests {
+		for _, document := range strings.Split(manifest, "\n---\n") {
+			var object struct {
+				Kind     string `yaml:"kind"`
+				Metadata struct {
+					Name   string            `yaml:"name"`
+					Labels map[string]string `yaml:"labels"`
+				} `yaml:"metadata"`
+			}
+			if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+				t.Fatalf("%s: failed to parse YAML: %v", name, err)
+			}
+			labels := object.Metadata.Labels
+			if labels[ManagedByLabel] != managedByValue {
+				t.Errorf("%s %s: %s = %q", object.Kind, object.Metadata.Name, ManagedByLabel, labels[ManagedByLabel])
+			}
+			if want := data[object.Metadata.Name]; (labels[DataLabel] == "true") != want {
+				t.Errorf("%s %s: %s = %q, want data %v", object.Kind, object.Metadata.Name, DataLabel, labels[DataLabel], want)
+			}
+		}
+	}
+}
+
+func newLifecycleClientset(managed bool) *fake.Clientset {
+	labels := func(data bool) map[string]string {
+		l := map[string]string{}
+		if managed {
+			l[ManagedByLabel] = managedByValue
+		}
+		if data {
+			l[DataLabel] = "true"
+		}
+		return l
+	}
+	meta := func(name string, data bool) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "coco", Labels: labels(data)}
+	}
+	deploymentMeta := meta("trustee-deployment", false)
+	deploymentMeta.Labels["app"] = "kbs"
+
+	objects := []runtime.Object{
+		&appsv1.Deployment{
+			ObjectMeta: deploymentMeta,
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "kbs", Image: "kbs:old"}},
+			}}},
+		},
+		&corev1.Service{ObjectMeta: meta("trustee-kbs", false)},
+		&corev1.ConfigMap{ObjectMeta: meta("kbs-config-cm", false)},
+		&corev1.ConfigMap{ObjectMeta: meta("resource-policy", true)},
+		&corev1.Secret{ObjectMeta: meta("kbs-auth-public-key", true)},
+		&corev1.Secret{ObjectMeta: meta("kbs-tls", true)},
+		&corev1.PersistentVolumeClaim{ObjectMeta: meta("kbs-storage", true)},
+		// Objects of other applications in the namespace are left alone.
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "coco"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "coco"}},
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+func TestUndeploy(t *testing.T) {
+	tests := []struct {
+		name     string
+		managed  bool
+		keepData bool
+		want     []string
+	}{
+		{"all", true, false, []string{
+			"configmap/kbs-config-cm", "configmap/resource-policy", "deployment/trustee-deployment",
+			"persistentvolumeclaim/kbs-storage", "secret/kbs-auth-public-key", "secret/kbs-tls", "service/trustee-kbs",
+		}},
+		{"keep data", true, true, []string{
+			"configmap/kbs-config-cm", "deployment/trustee-deployment", "service/trustee-kbs",
+		}},
+		{"unlabelled", false, false, []string{"deployment/trustee-deployment"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			clientset := newLifecycleClientset(tt.managed)
+
+			deleted, err := Undeploy(ctx, clientset, "coco", tt.keepData)
+			if err != nil {
+				t.Fatalf("Undeploy() error = %v", err)
+			}
+			sort.Strings(deleted)
+			if strings.Join(deleted, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Undeploy() deleted %v, want %v", deleted, tt.want)
+			}
+
+			if _, err := clientset.CoreV1().ConfigMaps("coco").Get(ctx, "other", metav1.GetOptions{}); err != nil {
+				t.Errorf("unrelated ConfigMap deleted: %v", err)
+			}
+			if _, err := clientset.CoreV1().Secrets("coco").Get(ctx, "other", metav1.GetOptions{}); err != nil {
+				t.Errorf("unrelated Secret deleted: %v", err)
+			}
+			_, err = clientset.CoreV1().Secrets("coco").Get(ctx, "kbs-auth-public-key", metav1.GetOptions{})
+			if kept := err == nil; kept != (tt.keepData || !tt.managed) {
+				t.Errorf("auth secret kept = %v", kept)
+			}
+		})
+	}
+}
+
+func TestUpgrade_NoDeployment(t *testing.T) {
+	_, err := Upgrade(context.Background(), fake.NewSimpleClientset(), nil, "coco", "kbs:new", "")
+	if err == nil || !strings.Contains(err.Error(), "no KBS deployment") {
+		t.Errorf("Upgrade() error = %v", err)
+	}
+}
+
+func TestUpgrade_SameImage(t *testing.T) {
+	previous, err := Upgrade(context.Background(), newLifecycleClientset(true), nil, "coco", "kbs:old", "")
+	if err != nil || previous != "kbs:old" {
+		t.Errorf("Upgrade() = %q, %v", previous, err)
+	}
+}
+
+func TestPersistentStorage(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  *Config
+		want bool
+	}{
+		{"in-memory", &Config{Namespace: "coco", KBSImage: "kbs:test"}, false},
+		{"pvc", &Config{Namespace: "coco", KBSImage: "kbs:test", Storage: StoragePVC}, true},
+		{"vault", &Config{Namespace: "coco", KBSImage: "kbs:test", Vault: &VaultConfig{Address: "http://vault:8200", K8sRole: "kbs"}}, true},
+	}
+	for _, tt := range tests {
+		if got := persistentStorage(buildKBSDeployment(tt.cfg)); got != tt.want {
+			t.Errorf("persistentStorage(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreAttestationStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		persistent bool
+		getStatus  int
+		wantSet    bool
+	}{
+		{"in-memory", false, http.StatusOK, true},
+		{"persistent and present", true, http.StatusOK, false},
+		{"persistent and missing", true, http.StatusNotFound, true},
+		{"persistent and not released", true, http.StatusUnauthorized, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/kbs/v0/resource/"+AttestationStatusPath {
+					http.NotFound(w, r)
+					return
+				}
+				if r.Method == http.MethodPost {
+					set = true
+					return
+				}
+				w.WriteHeader(tt.getStatus)
+			}))
+			defer server.Close()
+			_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			client, err := kbsclient.New(server.URL, privateKey, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := restoreAttestationStatus(context.Background(), client, tt.persistent); err != nil {
+				t.Fatalf("restoreAttestationStatus() error = %v", err)
+			}
+			if set != tt.wantSet {
+				t.Errorf("attestation status uploaded = %v, want %v", set, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestSetKBSImage(t *testing.T) {
+	deployment := &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "sidecar", Image: "sidecar:1"}, {Name: "kbs", Image: "kbs:old"}},
+	}}}}
+	previous, err := setKBSImage(deployment, "kbs:new")
+	if err != nil || previous != "kbs:old" {
+		t.Fatalf("setKBSImage() = %q, %v", previous, err)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	if containers[0].Image != "sidecar:1" || containers[1].Image != "kbs:new" {
+		t.Errorf("containers = %+v", containers)
+	}
+
+	if _, err := setKBSImage(&appsv1.Deployment{}, "kbs:new"); err == nil {
+		t.Error("setKBSImage() without kbs container expected error")
+	}
+}
+
+func TestRolloutComplete(t *testing.T) {
+	deployment := func(generation, observed int64, replicas, updated, ready int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Generation: generation},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration: observed,
+				Replicas:           replicas,
+				UpdatedReplicas:    updated,
+				ReadyReplicas:      ready,
+			},
+		}
+	}
+	tests := []struct {
+		name       string
+		deployment *appsv1.Deployment
+		want       bool
+	}{
+		{"complete", deployment(2, 2, 1, 1, 1), true},
+		{"not observed", deployment(2, 1, 1, 1, 1), false},
+		{"old replica left", deployment(2, 2, 2, 1, 1), false},
+		{"not ready", deployment(2, 2, 1, 1, 0), false},
+		{"not updated", deployment(2, 2, 1, 0, 1), false},
+	}
+	for _, tt := range tests {
+		if got := rolloutComplete(tt.deployment); got != tt.want {
+			t.Errorf("%s: rolloutComplete() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package trustee
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/utils/ptr"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// kbsConfigTemplate is kbs-config.toml without the [http_server] TLS settings
+// and the resource plugin, which depend on the deployment.
+const kbsConfigTemplate = `[http_server]
+sockets = ["0.0.0.0:%d"]
+%s
+
+[attestation_token]
+insecure_key = true
+
+[attestation_service]
+type = "coco_as_builtin"
+work_dir = "/opt/confidential-containers/attestation-service"
+policy_engine = "opa"
+
+[attestation_service.attestation_token_broker]
+type = "Ear"
+duration_min = 5
+
+[attestation_service.rvps_config]
+type = "BuiltIn"
+
+[policy_engine]
+policy_path = "/opt/confidential-containers/opa/policy.rego"
+
+[admin]
+type = "InsecureAllowAll"
+
+%s
+`
+
+// defaultResourcePolicy is the resource policy of a freshly deployed KBS.
+const defaultResourcePolicy = `package policy
+import rego.v1
+
+default allow = true
+`
+
+// manifestYAML renders objects as a multi-document YAML manifest for
+// applyManifest.
+func manifestYAML(objects ...runtime.Object) (string, error) {
+	documents := make([]string, 0, len(objects))
+	for _, obj := range objects {
+		data, err := k8syaml.Marshal(obj)
+		if err != nil {
+			return "", fmt.Errorf("failed to render %T: %w", obj, err)
+		}
+		documents = append(documents, string(data))
+	}
+	return strings.Join(documents, "---\n"), nil
+}
+
+// objectMeta returns the metadata of a KBS object, labelled with
+// ManagedByLabel in addition to labels.
+func objectMeta(name, namespace string, labels map[string]string) metav1.ObjectMeta {
+	all := map[string]string{ManagedByLabel: managedByValue}
+	for k, v := range labels {
+		all[k] = v
+	}
+	return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: all}
+}
+
+func configMap(name, namespace string, data map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: objectMeta(name, namespace, nil),
+		Data:       data,
+	}
+}
+
+// dataSecret returns a Secret holding KBS state, labelled DataLabel so that
+// Undeploy can keep it.
+func dataSecret(name, namespace string, secretType corev1.SecretType, data map[string][]byte) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: objectMeta(name, namespace, map[string]string{DataLabel: "true"}),
+		Type:       secretType,
+		Data:       data,
+	}
+}
+
+// restrictedSecurityContext drops all privileges, as required by the
+// restricted Pod Security Standard.
+func restrictedSecurityContext() *corev1.SecurityContext {
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: ptr.To(false),
+		Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+		SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+	}
+}
+
+// kbsHTTPServerConfig returns the [http_server] TLS settings of
+// kbs-config.toml. With tls the KBS serves the certificate mounted from the
+// kbs-tls Secret.
+func kbsHTTPServerConfig(tls bool) string {
+	if !tls {
+		return "insecure_http = true"
+	}
+	return fmt.Sprintf(`insecure_http = false
+certificate = "%s/tls.crt"
+private_key = "%s/tls.key"`, kbsTLSDir, kbsTLSDir)
+}
+
+// kbsConfigTOML returns kbs-config.toml for cfg, with the KBSConfig of
+// cfg.Overrides merged in.
+func kbsConfigTOML(cfg *Config) (string, error) {
+	config := fmt.Sprintf(kbsConfigTemplate, defaultKBSPort, kbsHTTPServerConfig(cfg.TLS != nil), kbsResourcePluginConfig(cfg.Vault))
+	if cfg.Overrides == nil || cfg.Overrides.KBSConfig == "" {
+		return config, nil
+	}
+	return mergeKBSConfig(config, cfg.Overrides.KBSConfig)
+}
+
+func buildConfigMapsManifest(cfg *Config) (string, error) {
+	kbsConfig, err := kbsConfigTOML(cfg)
+	if err != nil {
+		return "", err
+	}
+	return manifestYAML(
+		configMap("kbs-config-cm", cfg.Namespace, map[string]string{"kbs-config.toml": kbsConfig}),
+		configMap("rvps-reference-values", cfg.Namespace, map[string]string{"reference-values.json": "{}\n"}),
+	)
+}
+
+// buildResourcePolicyConfigMap returns the ConfigMap holding the resource
+// policy of a freshly deployed KBS. The policy is KBS state, so it is labelled
+// DataLabel.
+func buildResourcePolicyConfigMap(namespace string) *corev1.ConfigMap {
+	cm := configMap(resourcePolicyConfigMapName, namespace, map[string]string{resourcePolicyKey: defaultResourcePolicy})
+	cm.Labels[DataLabel] = "true"
+	return cm
+}
+
+// deployResourcePolicyConfigMap creates the resource-policy ConfigMap unless
+// it exists, so that redeploying after 'kbs stop --keep-data' keeps the
+// policy set with SetResourcePolicy.
+func deployResourcePolicyConfigMap(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	_, err := clientset.CoreV1().ConfigMaps(namespace).Create(ctx, buildResourcePolicyConfigMap(namespace), metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func deployConfigMaps(ctx context.Context, cfg *Config) error {
+	manifest, err := buildConfigMapsManifest(cfg)
+	if err != nil {
+		return err
+	}
+	return applyManifest(ctx, manifest)
+}
+
+func buildPCCSConfigMapManifest(namespace, pccsURL string) (string, error) {
+	qcnlConfig, err := json.Marshal(map[string]string{"collateral_service": pccsURL})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal PCCS config: %w", err)
+	}
+	return manifestYAML(configMap("dcap-attestation-conf", namespace, map[string]string{"sgx_default_qcnl.conf": string(qcnlConfig)}))
+}
+
+func deployPCCSConfigMap(ctx context.Context, namespace, pccsURL string) error {
+	manifest, err := buildPCCSConfigMapManifest(namespace, pccsURL)
+	if err != nil {
+		return err
+	}
+	return applyManifest(ctx, manifest)
+}
+
+// defaultKBSResources are the compute resources of the kbs container unless
+// Overrides.Resources replaces them.
+func defaultKBSResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1")},
+		Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("2")},
+	}
+}
+
+func buildKBSDeployment(cfg *Config) *appsv1.Deployment {
+	volumeMounts := []corev1.VolumeMount{
+		{Name: "confidential-containers", MountPath: "/opt/confidential-containers"},
+		{Name: "kbs-config", MountPath: "/etc/kbs-config"},
+		{Name: "opa", MountPath: "/opt/confidential-containers/opa"},
+		{Name: "auth-secret", MountPath: "/etc/auth-secret"},
+		{Name: "reference-values", MountPath: "/opt/confidential-containers/rvps/reference-values"},
+	}
+	if cfg.PCCSURL != "" {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name: "qplconf", MountPath: "/etc/sgx_default_qcnl.conf", SubPath: "sgx_default_qcnl.conf",
+		})
+	}
+	if cfg.TLS != nil {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: "kbs-tls", MountPath: kbsTLSDir, ReadOnly: true})
+	}
+
+	storageVolume := corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}
+	// A ReadWriteOnce volume cannot be attached to the old and new pod at
+	// once, so rollouts must stop the old pod first.
+	strategy := appsv1.RollingUpdateDeploymentStrategyType
+	if cfg.Storage == StoragePVC {
+		storageVolume = corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: kbsStoragePVCName}}
+		strategy = appsv1.RecreateDeploymentStrategyType
+	}
+
+	configMapVolume := func(name string) corev1.VolumeSource {
+		return corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}}}
+	}
+	secretVolume := func(name string) corev1.VolumeSource {
+		return corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: name}}
+	}
+
+	volumes := []corev1.Volume{
+		{Name: "confidential-containers", VolumeSource: storageVolume},
+		{Name: "kbs-config", VolumeSource: configMapVolume("kbs-config-cm")},
+	}
+	var initContainers, sidecars []corev1.Container
+	backend := ResourceBackendFile
+	if cfg.Vault != nil {
+		// The init container renders the token into kbs-config.toml, so the
+		// KBS reads its config from an in-memory volume instead.
+		volumes[1].VolumeSource = corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}
+		volumes = append(volumes,
+			corev1.Volume{Name: "kbs-config-template", VolumeSource: configMapVolume("kbs-config-cm")},
+			corev1.Volume{Name: "kbs-vault", VolumeSource: secretVolume(kbsVaultSecretName)},
+			corev1.Volume{Name: "kbs-vault-token", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory}}})
+		initContainers = append(initContainers, vaultInitContainer(cfg.Vault))
+		sidecars = append(sidecars, vaultRenewerContainer(cfg.Vault))
+		backend = ResourceBackendVault
+		if len(cfg.Vault.CACertPEM) > 0 {
+			volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: "kbs-vault", MountPath: kbsVaultDir, ReadOnly: true})
+		}
+	}
+	volumes = append(volumes,
+		corev1.Volume{Name: "opa", VolumeSource: configMapVolume(resourcePolicyConfigMapName)},
+		corev1.Volume{Name: "auth-secret", VolumeSource: secretVolume(kbsAuthSecretName)},
+		corev1.Volume{Name: "reference-values", VolumeSource: configMapVolume("rvps-reference-values")})
+	if cfg.PCCSURL != "" {
+		qplconf := configMapVolume("dcap-attestation-conf")
+		qplconf.ConfigMap.Items = []corev1.KeyToPath{{Key: "sgx_default_qcnl.conf", Path: "sgx_default_qcnl.conf"}}
+		volumes = append(volumes, corev1.Volume{Name: "qplconf", VolumeSource: qplconf})
+	}
+	if cfg.TLS != nil {
+		volumes = append(volumes, corev1.Volume{Name: "kbs-tls", VolumeSource: secretVolume(kbsTLSSecretName)})
+	}
+
+	kbs := corev1.Container{
+		Name:            "kbs",
+		Image:           cfg.KBSImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/usr/local/bin/kbs", "--config-file", "/etc/kbs-config/kbs-config.toml"},
+		Ports:           []corev1.ContainerPort{{ContainerPort: defaultKBSPort, Name: "kbs", Protocol: corev1.ProtocolTCP}},
+		SecurityContext: restrictedSecurityContext(),
+		Resources:       defaultKBSResources(),
+		VolumeMounts:    volumeMounts,
+	}
+	podSpec := corev1.PodSpec{
+		InitContainers: initContainers,
+		Containers:     append([]corev1.Container{kbs}, sidecars...),
+		RestartPolicy:  corev1.RestartPolicyAlways,
+		Volumes:        volumes,
+	}
+	if o := cfg.Overrides; o != nil {
+		if o.Resources != nil {
+			podSpec.Containers[0].Resources = *o.Resources
+		}
+		podSpec.NodeSelector = o.NodeSelector
+		podSpec.Tolerations = o.Tolerations
+		podSpec.ImagePullSecrets = o.ImagePullSecrets
+	}
+
+	podLabels := map[string]string{"app": "kbs"}
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: objectMeta("trustee-deployment", cfg.Namespace, map[string]string{"app": "kbs", ResourceBackendLabel: backend}),
+		Spec: appsv1.DeploymentSpec{
+			Replicas: ptr.To[int32](1),
+			Strategy: appsv1.DeploymentStrategy{Type: strategy},
+			Selector: &metav1.LabelSelector{MatchLabels: podLabels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec:       podSpec,
+			},
+		},
+	}
+}
+
+func buildKBSService(cfg *Config) *corev1.Service {
+	// The Service port is plain TCP; appProtocol tells meshes and ingresses
+	// that the KBS speaks HTTPS.
+	appProtocol := "http"
+	if cfg.TLS != nil {
+		appProtocol = "https"
+	}
+	return &corev1.Service{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: objectMeta(cfg.ServiceName, cfg.Namespace, nil),
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "kbs"},
+			Ports: []corev1.ServicePort{{
+				Port:        defaultKBSPort,
+				TargetPort:  intstr.FromInt32(defaultKBSPort),
+				Protocol:    corev1.ProtocolTCP,
+				AppProtocol: ptr.To(appProtocol),
+			}},
+		},
+	}
+}
+
+func buildKBSManifest(cfg *Config) (string, error) {
+	return manifestYAML(buildKBSDeployment(cfg), buildKBSService(cfg))
+}
+
+func deployKBS(ctx context.Context, cfg *Config) error {
+	manifest, err := buildKBSManifest(cfg)
+	if err != nil {
+		return err
+	}
+	return applyManifest(ctx, manifest)
+}
@@ -0,0 +1,139 @@
+package trustee
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// kbsManifest returns buildKBSManifest(cfg), failing the test on error.
+func kbsManifest(t *testing.T, cfg *Config) string {
+	t.Helper()
+	manifest, err := buildKBSManifest(cfg)
+	if err != nil {
+		t.Fatalf("buildKBSManifest() error = %v", err)
+	}
+	return manifest
+}
+
+// objectsManifest returns manifestYAML(objects...), failing the test on error.
+func objectsManifest(t *testing.T, objects ...runtime.Object) string {
+	t.Helper()
+	manifest, err := manifestYAML(objects...)
+	if err != nil {
+		t.Fatalf("manifestYAML() error = %v", err)
+	}
+	return manifest
+}
+
+// storagePVC returns buildStoragePVC(cfg), failing the test on error.
+func storagePVC(t *testing.T, cfg *Config) *corev1.PersistentVolumeClaim {
+	t.Helper()
+	pvc, err := buildStoragePVC(cfg)
+	if err != nil {
+		t.Fatalf("buildStoragePVC() error = %v", err)
+	}
+	return pvc
+}
+
+// configMapsManifest returns buildConfigMapsManifest(cfg), failing the test on
+// error.
+func configMapsManifest(t *testing.T, cfg *Config) string {
+	t.Helper()
+	manifest, err := buildConfigMapsManifest(cfg)
+	if err != nil {
+		t.Fatalf("buildConfigMapsManifest() error = %v", err)
+	}
+	return manifest
+}
+
+func TestBuildKBSDeployment_Defaults(t *testing.T) {
+	deployment := buildKBSDeployment(&Config{Namespace: "coco", KBSImage: "kbs:test"})
+	pod := deployment.Spec.Template.Spec
+	if len(pod.NodeSelector) != 0 || len(pod.Tolerations) != 0 || len(pod.ImagePullSecrets) != 0 {
+		t.Errorf("pod spec has unexpected scheduling settings: %+v", pod)
+	}
+	resources := pod.Containers[0].Resources
+	if resources.Requests.Cpu().String() != "1" || resources.Limits.Cpu().String() != "2" {
+		t.Errorf("resources = %+v", resources)
+	}
+}
+
+func TestBuildKBSDeployment_Overrides(t *testing.T) {
+	cfg := &Config{
+		Namespace: "coco",
+		KBSImage:  "kbs:test",
+		Overrides: &Overrides{
+			Resources: &corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+			},
+			NodeSelector:     map[string]string{"node-role.kubernetes.io/infra": ""},
+			Tolerations:      []corev1.Toleration{{Key: "infra", Operator: corev1.TolerationOpExists}},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "regcred"}},
+		},
+	}
+	deployment := buildKBSDeployment(cfg)
+	pod := deployment.Spec.Template.Spec
+	if _, ok := pod.NodeSelector["node-role.kubernetes.io/infra"]; !ok {
+		t.Errorf("nodeSelector = %v", pod.NodeSelector)
+	}
+	if len(pod.Tolerations) != 1 || pod.Tolerations[0].Key != "infra" {
+		t.Errorf("tolerations = %+v", pod.Tolerations)
+	}
+	if len(pod.ImagePullSecrets) != 1 || pod.ImagePullSecrets[0].Name != "regcred" {
+		t.Errorf("imagePullSecrets = %+v", pod.ImagePullSecrets)
+	}
+	// Resources replace the defaults rather than being merged into them.
+	resources := pod.Containers[0].Resources
+	if resources.Requests.Memory().String() != "256Mi" || !resources.Requests.Cpu().IsZero() || len(resources.Limits) != 0 {
+		t.Errorf("resources = %+v", resources)
+	}
+	if deployment.Spec.Template.Labels["app"] != "kbs" || *deployment.Spec.Replicas != 1 {
+		t.Errorf("overrides changed managed fields: labels %v replicas %d", deployment.Spec.Template.Labels, *deployment.Spec.Replicas)
+	}
+}
+
+func TestBuildConfigMapsManifest_KBSConfigOverrides(t *testing.T) {
+	cfg := &Config{
+		Namespace: "coco",
+		Overrides: &Overrides{KBSConfig: "[attestation_token]\ninsecure_key = true\n"},
+	}
+	manifest := configMapsManifest(t, cfg)
+	for _, want := range []string{"insecure_key = true", "sockets = ['0.0.0.0:8080']", "insecure_http = true"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("manifest missing %q:\n%s", want, manifest)
+		}
+	}
+}
+
+func TestBuildPCCSConfigMapManifest(t *testing.T) {
+	manifest, err := buildPCCSConfigMapManifest("coco", "https://pccs.example.com/sgx/certification/v4/")
+	if err != nil {
+		t.Fatalf("buildPCCSConfigMapManifest() error = %v", err)
+	}
+	for _, want := range []string{"name: dcap-attestation-conf", "namespace: coco", `{"collateral_service":"https://pccs.example.com/sgx/certification/v4/"}`} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("manifest missing %q:\n%s", want, manifest)
+		}
+	}
+}
+
+func TestBuildStoragePVC_Quoting(t *testing.T) {
+	// A storage class name that looks like a number must stay a string.
+	manifest := objectsManifest(t, storagePVC(t, &Config{Namespace: "coco", Storage: StoragePVC, StorageClass: "0123"}))
+	var pvc corev1.PersistentVolumeClaim
+	if err := k8syaml.UnmarshalStrict([]byte(manifest), &pvc); err != nil {
+		t.Fatalf("PVC manifest does not parse: %v\n%s", err, manifest)
+	}
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != "0123" {
+		t.Errorf("storageClassName = %v", pvc.Spec.StorageClassName)
+	}
+
+	if _, err := buildStoragePVC(&Config{Namespace: "coco", Storage: StoragePVC, StorageSize: "lots"}); err == nil {
+		t.Error("buildStoragePVC() expected error for an invalid size")
+	}
+}
@@ -0,0 +1,132 @@
+package trustee
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	corev1 "k8s.io/api/core/v1"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+// managedKBSConfigKeys are the kbs-config.toml settings cococtl derives from
+// the deployment; Overrides.KBSConfig must not set them.
+var managedKBSConfigKeys = []string{
+	"http_server.sockets",
+	"http_server.insecure_http",
+	"http_server.certificate",
+	"http_server.private_key",
+	"plugins",
+}
+
+// Overrides customizes the KBS deployed by Deploy. It is read from a YAML file
+// whose fields use the Kubernetes spellings, for example:
+//
+//	resources:
+//	  requests: {cpu: 500m, memory: 256Mi}
+//	nodeSelector:
+//	  node-role.kubernetes.io/infra: ""
+//	tolerations:
+//	- {key: infra, operator: Exists, effect: NoSchedule}
+//	imagePullSecrets:
+//	- name: regcred
+//	kbsConfig: |
+//	  [attestation_service.attestation_token_broker]
+//	  duration_min = 10
+type Overrides struct {
+	// Resources replaces the compute resources of the kbs container, which
+	// default to a request of 1 CPU and a limit of 2 CPUs.
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+	// NodeSelector, Tolerations and ImagePullSecrets are set on the KBS pod.
+	NodeSelector     map[string]string             `json:"nodeSelector,omitempty"`
+	Tolerations      []corev1.Toleration           `json:"tolerations,omitempty"`
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+	// KBSConfig is TOML merged into the generated kbs-config.toml. Its tables
+	// are merged with the generated ones and its values take precedence, but
+	// it cannot change the listen address, TLS or resource backend settings.
+	KBSConfig string `json:"kbsConfig,omitempty"`
+}
+
+// LoadOverrides reads and validates an overrides file. Unknown fields are
+// rejected so that typos do not go unnoticed.
+func LoadOverrides(path string) (*Overrides, error) {
+	// #nosec G304 -- path provided by the user via flag
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read overrides file: %w", err)
+	}
+	var o Overrides
+	if err := k8syaml.UnmarshalStrict(data, &o); err != nil {
+		return nil, fmt.Errorf("failed to parse overrides file %s: %w", path, err)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("overrides file %s: %w", path, err)
+	}
+	return &o, nil
+}
+
+// Validate checks that KBSConfig is valid TOML that leaves the settings
+// cococtl manages alone.
+func (o *Overrides) Validate() error {
+	for _, secret := range o.ImagePullSecrets {
+		if secret.Name == "" {
+			return fmt.Errorf("imagePullSecrets entries need a name")
+		}
+	}
+	if o.KBSConfig == "" {
+		return nil
+	}
+	var extra map[string]any
+	if err := toml.Unmarshal([]byte(o.KBSConfig), &extra); err != nil {
+		return fmt.Errorf("invalid kbsConfig TOML: %w", err)
+	}
+	for _, key := range managedKBSConfigKeys {
+		if hasTOMLKey(extra, key) {
+			return fmt.Errorf("kbsConfig cannot set %s: it is managed by 'kbs start'", key)
+		}
+	}
+	return nil
+}
+
+// hasTOMLKey reports whether the dotted key is set in config.
+func hasTOMLKey(config map[string]any, key string) bool {
+	first, rest, nested := strings.Cut(key, ".")
+	value, ok := config[first]
+	if !ok || !nested {
+		return ok
+	}
+	table, ok := value.(map[string]any)
+	return ok && hasTOMLKey(table, rest)
+}
+
+// mergeKBSConfig merges the TOML document extra into base and returns the
+// result. Tables are merged recursively; any other value in extra replaces the
+// one in base.
+func mergeKBSConfig(base, extra string) (string, error) {
+	var merged, overrides map[string]any
+	if err := toml.Unmarshal([]byte(base), &merged); err != nil {
+		return "", fmt.Errorf("failed to parse kbs-config.toml: %w", err)
+	}
+	if err := toml.Unmarshal([]byte(extra), &overrides); err != nil {
+		return "", fmt.Errorf("invalid kbsConfig TOML: %w", err)
+	}
+	mergeTOMLTables(merged, overrides)
+	data, err := toml.Marshal(merged)
+	if err != nil {
+		return "", fmt.Errorf("failed to render kbs-config.toml: %w", err)
+	}
+	return string(data), nil
+}
+
+func mergeTOMLTables(dst, src map[string]any) {
+	for k := range src {
+		srcTable, srcIsTable := src[k].(map[string]any)
+		dstTable, dstIsTable := dst[k].(map[string]any)
+		if srcIsTable && dstIsTable {
+			mergeTOMLTables(dstTable, srcTable)
+			continue
+		}
+		dst[k] = src[k]
+	}
+}
@@ -0,0 +1,128 @@
+package trustee
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+func TestLoadOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.yaml")
+	content := `resources:
+  requests: {cpu: 500m, memory: 256Mi}
+  limits: {memory: 1Gi}
+nodeSelector:
+  node-role.kubernetes.io/infra: ""
+tolerations:
+- {key: infra, operator: Exists, effect: NoSchedule}
+imagePullSecrets:
+- name: regcred
+kbsConfig: |
+  [attestation_service.attestation_token_broker]
+  duration_min = 10
+`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := LoadOverrides(path)
+	if err != nil {
+		t.Fatalf("LoadOverrides() error = %v", err)
+	}
+	if got := o.Resources.Requests.Cpu().String(); got != "500m" {
+		t.Errorf("cpu request = %s", got)
+	}
+	if got := o.Resources.Limits.Memory().String(); got != "1Gi" {
+		t.Errorf("memory limit = %s", got)
+	}
+	if _, ok := o.NodeSelector["node-role.kubernetes.io/infra"]; !ok {
+		t.Errorf("nodeSelector = %v", o.NodeSelector)
+	}
+	if len(o.Tolerations) != 1 || o.Tolerations[0].Key != "infra" || o.Tolerations[0].Effect != "NoSchedule" {
+		t.Errorf("tolerations = %+v", o.Tolerations)
+	}
+	if len(o.ImagePullSecrets) != 1 || o.ImagePullSecrets[0].Name != "regcred" {
+		t.Errorf("imagePullSecrets = %+v", o.ImagePullSecrets)
+	}
+	if !strings.Contains(o.KBSConfig, "duration_min = 10") {
+		t.Errorf("kbsConfig = %q", o.KBSConfig)
+	}
+}
+
+func TestLoadOverrides_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown field", "replicas: 2\n", "unknown field"},
+		{"misspelled field", "nodeSelectors: {a: b}\n", "unknown field"},
+		{"bad quantity", "resources:\n  limits: {cpu: lots}\n", "failed to parse"},
+		{"unnamed pull secret", "imagePullSecrets:\n- {}\n", "need a name"},
+		{"bad toml", "kbsConfig: 'x ='\n", "invalid kbsConfig TOML"},
+		{"sockets", "kbsConfig: |\n  [http_server]\n  sockets = [\"0.0.0.0:9000\"]\n", "cannot set http_server.sockets"},
+		{"certificate", "kbsConfig: \"http_server.certificate = '/tmp/c'\"\n", "cannot set http_server.certificate"},
+		{"plugins", "kbsConfig: |\n  [[plugins]]\n  name = \"resource\"\n", "cannot set plugins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "overrides.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadOverrides(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadOverrides() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeKBSConfig(t *testing.T) {
+	base := `[http_server]
+sockets = ["0.0.0.0:8080"]
+insecure_http = true
+
+[admin]
+insecure_api = false
+`
+	extra := `[http_server]
+worker_count = 4
+
+[admin]
+insecure_api = true
+
+[attestation_token]
+insecure_key = true
+`
+	merged, err := mergeKBSConfig(base, extra)
+	if err != nil {
+		t.Fatalf("mergeKBSConfig() error = %v", err)
+	}
+
+	var got struct {
+		HTTPServer struct {
+			Sockets      []string `toml:"sockets"`
+			InsecureHTTP bool     `toml:"insecure_http"`
+			WorkerCount  int      `toml:"worker_count"`
+		} `toml:"http_server"`
+		Admin struct {
+			InsecureAPI bool `toml:"insecure_api"`
+		} `toml:"admin"`
+		AttestationToken struct {
+			InsecureKey bool `toml:"insecure_key"`
+		} `toml:"attestation_token"`
+	}
+	if err := toml.Unmarshal([]byte(merged), &got); err != nil {
+		t.Fatalf("merged config is not valid TOML: %v\n%s", err, merged)
+	}
+	if len(got.HTTPServer.Sockets) != 1 || !got.HTTPServer.InsecureHTTP {
+		t.Errorf("base http_server settings lost:\n%s", merged)
+	}
+	if got.HTTPServer.WorkerCount != 4 || !got.Admin.InsecureAPI || !got.AttestationToken.InsecureKey {
+		t.Errorf("overrides not applied:\n%s", merged)
+	}
+}
@@ -0,0 +1,261 @@
+package trustee
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/confidential-devhub/cococtl/pkg/initdata"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+)
+
+const (
+	// policyBlockBegin and policyBlockEnd delimit the rules generated for one
+	// workload so later runs can replace them without touching other rules.
+	policyBlockBegin = "# BEGIN cococtl app "
+	policyBlockEnd   = "# END cococtl app "
+
+	// resourcePolicyHeader starts every generated resource policy. Resources are
+	// denied unless a rule explicitly allows them.
+	resourcePolicyHeader = `package policy
+
+import rego.v1
+
+default allow := false
+`
+
+	// resourcePolicyConfigMapName and resourcePolicyKey locate the resource
+	// policy of the in-cluster KBS. The ConfigMap is mounted at the directory
+	// of policy_path in kbs-config.toml.
+	resourcePolicyConfigMapName = "resource-policy"
+	resourcePolicyKey           = "policy.rego"
+
+	// resourcePolicyAnnotation records the SHA-256 digest of the resource
+	// policy on the KBS pod. Changing it makes the kubelet resync the pod, and
+	// with it the ConfigMap volume, without waiting for its periodic sync.
+	resourcePolicyAnnotation = "confidential-devhub.github.io/resource-policy-sha256"
+
+	// resourcePolicySyncTimeout bounds how long SetResourcePolicy waits for
+	// the KBS to read the updated ConfigMap.
+	resourcePolicySyncTimeout = 3 * time.Minute
+
+	// annotatedEvidence is where the EAR attestation token carries the TEE claims.
+	annotatedEvidence = `input["submods"]["cpu0"]["ear.veraison.annotated-evidence"]`
+)
+
+// allowAllRegexp matches a catch-all "default allow = true" rule, such as the
+// one in the resource policy deployed by 'kbs start'.
+var allowAllRegexp = regexp.MustCompile(`(?m)^\s*default\s+allow\s*:?=\s*true\s*$`)
+
+// ResourceBinding ties the KBS resources of one workload to the initdata
+// measurement its TEE is expected to report.
+type ResourceBinding struct {
+	// App identifies the workload as "<namespace>/<name>".
+	App string
+	// Resources are the repository/type/tag paths the workload may read.
+	Resources []string
+	// Measurements maps each accepted TEE to the hex-encoded initdata
+	// measurement (see initdata.ExpectedMeasurement).
+	Measurements map[initdata.TEE]string
+}
+
+// GenerateResourcePolicyRules returns the Rego rules allowing b.App's resources
+// to be released only to a TEE of an accepted type whose attested initdata
+// matches the expected measurement. The rules are wrapped in marker comments
+// so MergeResourcePolicy can replace them later.
+func GenerateResourcePolicyRules(b ResourceBinding) (string, error) {
+	if b.App == "" {
+		return "", fmt.Errorf("resource binding requires an app name")
+	}
+	if len(b.Resources) == 0 {
+		return "", fmt.Errorf("resource binding for %s has no resources", b.App)
+	}
+	if len(b.Measurements) == 0 {
+		return "", fmt.Errorf("resource binding for %s has no initdata measurements", b.App)
+	}
+
+	resources := make([]string, 0, len(b.Resources))
+	seen := make(map[string]bool, len(b.Resources))
+	for _, r := range b.Resources {
+		if _, err := kbsuri.ParsePath(r); err != nil {
+			return "", err
+		}
+		if !seen[r] {
+			seen[r] = true
+			resources = append(resources, fmt.Sprintf("%q", r))
+		}
+	}
+	sort.Strings(resources)
+
+	tees := make([]string, 0, len(b.Measurements))
+	for tee := range b.Measurements {
+		tees = append(tees, string(tee))
+	}
+	sort.Strings(tees)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s%s\n", policyBlockBegin, b.App)
+	for _, tee := range tees {
+		fmt.Fprintf(&sb, "allow if {\n")
+		fmt.Fprintf(&sb, "\tdata[\"resource-path\"] in {%s}\n", strings.Join(resources, ", "))
+		fmt.Fprintf(&sb, "\t%s[%q][\"init_data\"] == %q\n", annotatedEvidence, tee, b.Measurements[initdata.TEE(tee)])
+		fmt.Fprintf(&sb, "}\n")
+	}
+	fmt.Fprintf(&sb, "%s%s\n", policyBlockEnd, b.App)
+	return sb.String(), nil
+}
+
+// MergeResourcePolicy returns existing with the rules for b.App replaced by
+// freshly generated ones. An empty existing policy starts from a default-deny
+// header. A catch-all "default allow = true" in existing would make the
+// generated rules meaningless, so it is turned into default-deny and
+// replacedAllowAll is set so the caller can tell the user.
+func MergeResourcePolicy(existing string, b ResourceBinding) (policy string, replacedAllowAll bool, err error) {
+	rules, err := GenerateResourcePolicyRules(b)
+	if err != nil {
+		return "", false, err
+	}
+
+	base := strings.TrimSpace(removePolicyBlock(existing, b.App))
+	switch {
+	case base == "":
+		base = strings.TrimSpace(resourcePolicyHeader)
+	case allowAllRegexp.MatchString(base):
+		base = allowAllRegexp.ReplaceAllString(base, "default allow := false")
+		replacedAllowAll = true
+	}
+	if !strings.Contains(base, "import rego.v1") {
+		return "", false, fmt.Errorf("existing resource policy does not import rego.v1; update it before binding resources to initdata")
+	}
+
+	return base + "\n\n" + rules, replacedAllowAll, nil
+}
+
+// DescribeResourcePolicy returns the apps whose rules were generated into
+// policy by MergeResourcePolicy, in order of appearance, and whether policy
+// releases every resource through a catch-all allow rule.
+func DescribeResourcePolicy(policy string) (apps []string, allowAll bool) {
+	for _, line := range strings.Split(policy, "\n") {
+		if app, ok := strings.CutPrefix(strings.TrimSpace(line), strings.TrimSpace(policyBlockBegin)+" "); ok {
+			apps = append(apps, app)
+		}
+	}
+	return apps, allowAllRegexp.MatchString(policy)
+}
+
+// removePolicyBlock drops the marker-delimited rules generated for app.
+func removePolicyBlock(policy, app string) string {
+	begin := policyBlockBegin + app + "\n"
+	end := policyBlockEnd + app + "\n"
+	for {
+		start := strings.Index(policy, begin)
+		if start == -1 {
+			return policy
+		}
+		stop := strings.Index(policy[start:], end)
+		if stop == -1 {
+			return policy
+		}
+		policy = policy[:start] + policy[start+stop+len(end):]
+	}
+}
+
+// BindResources merges the rules for b into the resource policy of the KBS
+// deployed by Deploy in namespace and stores the result with
+// SetResourcePolicy. It reports whether a catch-all allow rule was replaced
+// (see MergeResourcePolicy).
+func BindResources(ctx context.Context, clientset kubernetes.Interface, namespace string, client *kbsclient.Client, b ResourceBinding) (bool, error) {
+	existing, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, resourcePolicyConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to read resource policy: %w", err)
+	}
+
+	policy, replacedAllowAll, err := MergeResourcePolicy(existing.Data[resourcePolicyKey], b)
+	if err != nil {
+		return false, err
+	}
+
+	if err := SetResourcePolicy(ctx, clientset, namespace, client, []byte(policy)); err != nil {
+		return false, err
+	}
+	return replacedAllowAll, nil
+}
+
+// SetResourcePolicy replaces the resource policy of the KBS deployed by Deploy
+// in namespace. That KBS reads the policy from the read-only resource-policy
+// ConfigMap volume, so the admin API cannot change it; the ConfigMap is
+// updated instead, which also keeps the policy across pod restarts. Once the
+// KBS pods are annotated with the policy digest, SetResourcePolicy waits until
+// client reports the new policy.
+func SetResourcePolicy(ctx context.Context, clientset kubernetes.Interface, namespace string, client *kbsclient.Client, policy []byte) error {
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(ctx, resourcePolicyConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get the %s ConfigMap: %w", resourcePolicyConfigMapName, err)
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[resourcePolicyKey] = string(policy)
+	if _, err := configMaps.Update(ctx, cm, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update the %s ConfigMap: %w", resourcePolicyConfigMapName, err)
+	}
+
+	digest := sha256.Sum256(policy)
+	if err := annotateKBSPods(ctx, clientset, namespace, resourcePolicyAnnotation, hex.EncodeToString(digest[:])); err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, resourcePolicySyncTimeout)
+	defer cancel()
+	return waitForResourcePolicy(waitCtx, client, policy)
+}
+
+// annotateKBSPods sets the annotation key to value on every KBS pod.
+func annotateKBSPods(ctx context.Context, clientset kubernetes.Interface, namespace, key, value string) error {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: trusteeLabel})
+	if err != nil {
+		return fmt.Errorf("failed to list KBS pods: %w", err)
+	}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": map[string]string{key: value}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod patch: %w", err)
+	}
+	for _, pod := range pods.Items {
+		if _, err := clientset.CoreV1().Pods(namespace).Patch(ctx, pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("failed to annotate KBS pod %s: %w", pod.Name, err)
+		}
+	}
+	return nil
+}
+
+// waitForResourcePolicy polls client until it returns policy.
+func waitForResourcePolicy(ctx context.Context, client *kbsclient.Client, policy []byte) error {
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	want := strings.TrimSpace(string(policy))
+	for {
+		current, err := client.GetResourcePolicy(ctx)
+		if err == nil && strings.TrimSpace(string(current)) == want {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for KBS to load the updated %s ConfigMap: %w", resourcePolicyConfigMapName, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
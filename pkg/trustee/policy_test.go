@@ -0,0 +1,305 @@
+package trustee
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/confidential-devhub/cococtl/pkg/initdata"
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+)
+
+func testBinding(app string) ResourceBinding {
+	return ResourceBinding{
+		App:       app,
+		Resources: []string{"default/db-secret/password", "default/attestation-status/status", "default/db-secret/password"},
+		Measurements: map[initdata.TEE]string{
+			initdata.TEESNP: "aa",
+			initdata.TEETDX: "bb",
+		},
+	}
+}
+
+func TestGenerateResourcePolicyRules(t *testing.T) {
+	rules, err := GenerateResourcePolicyRules(testBinding("default/app"))
+	if err != nil {
+		t.Fatalf("GenerateResourcePolicyRules() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"# BEGIN cococtl app default/app\n",
+		"# END cococtl app default/app\n",
+		`data["resource-path"] in {"default/attestation-status/status", "default/db-secret/password"}`,
+		`["snp"]["init_data"] == "aa"`,
+		`["tdx"]["init_data"] == "bb"`,
+	} {
+		if !strings.Contains(rules, want) {
+			t.Errorf("rules missing %q:\n%s", want, rules)
+		}
+	}
+	if n := strings.Count(rules, "allow if {"); n != 2 {
+		t.Errorf("got %d allow rules, want one per TEE (2)", n)
+	}
+}
+
+func TestGenerateResourcePolicyRules_Invalid(t *testing.T) {
+	tests := map[string]func(*ResourceBinding){
+		"no app":          func(b *ResourceBinding) { b.App = "" },
+		"no resources":    func(b *ResourceBinding) { b.Resources = nil },
+		"no measurements": func(b *ResourceBinding) { b.Measurements = nil },
+		"bad path":        func(b *ResourceBinding) { b.Resources = []string{"../etc/passwd"} },
+	}
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			b := testBinding("default/app")
+			mutate(&b)
+			if _, err := GenerateResourcePolicyRules(b); err == nil {
+				t.Error("GenerateResourcePolicyRules() expected error")
+			}
+		})
+	}
+}
+
+func TestMergeResourcePolicy_ReplacesAllowAll(t *testing.T) {
+	existing := "package policy\nimport rego.v1\n\ndefault allow = true\n"
+	policy, replaced, err := MergeResourcePolicy(existing, testBinding("default/app"))
+	if err != nil {
+		t.Fatalf("MergeResourcePolicy() error = %v", err)
+	}
+	if !replaced {
+		t.Error("expected replacedAllowAll for a catch-all policy")
+	}
+	if strings.Contains(policy, "default allow = true") || !strings.Contains(policy, "default allow := false") {
+		t.Errorf("catch-all rule not replaced:\n%s", policy)
+	}
+}
+
+func TestMergeResourcePolicy_EmptyExisting(t *testing.T) {
+	policy, replaced, err := MergeResourcePolicy("", testBinding("default/app"))
+	if err != nil {
+		t.Fatalf("MergeResourcePolicy() error = %v", err)
+	}
+	if replaced {
+		t.Error("replacedAllowAll should be false for an empty policy")
+	}
+	if !strings.HasPrefix(policy, "package policy") {
+		t.Errorf("policy should start with the default header:\n%s", policy)
+	}
+}
+
+func TestMergeResourcePolicy_KeepsOtherRules(t *testing.T) {
+	first, _, err := MergeResourcePolicy("", testBinding("default/app"))
+	if err != nil {
+		t.Fatalf("MergeResourcePolicy() error = %v", err)
+	}
+	custom := first + "\nallow if {\n\tdata[\"resource-path\"] == \"default/public/banner\"\n}\n"
+
+	other, _, err := MergeResourcePolicy(custom, testBinding("prod/other"))
+	if err != nil {
+		t.Fatalf("MergeResourcePolicy() error = %v", err)
+	}
+
+	b := testBinding("default/app")
+	b.Measurements = map[initdata.TEE]string{initdata.TEETDX: "cc"}
+	updated, _, err := MergeResourcePolicy(other, b)
+	if err != nil {
+		t.Fatalf("MergeResourcePolicy() error = %v", err)
+	}
+
+	if n := strings.Count(updated, "# BEGIN cococtl app default/app"); n != 1 {
+		t.Errorf("got %d blocks for default/app, want 1:\n%s", n, updated)
+	}
+	// prod/other still uses "aa"; only the default/app copy must be gone.
+	if n := strings.Count(updated, `== "aa"`); n != 1 {
+		t.Errorf("stale rules for default/app were kept:\n%s", updated)
+	}
+	for _, want := range []string{`== "cc"`, "# BEGIN cococtl app prod/other", "default/public/banner"} {
+		if !strings.Contains(updated, want) {
+			t.Errorf("merged policy missing %q:\n%s", want, updated)
+		}
+	}
+}
+
+func TestMergeResourcePolicy_RequiresRegoV1(t *testing.T) {
+	if _, _, err := MergeResourcePolicy("package policy\n\ndefault allow = false\n", testBinding("default/app")); err == nil {
+		t.Error("MergeResourcePolicy() expected error for a policy without import rego.v1")
+	}
+}
+
+func TestDescribeResourcePolicy(t *testing.T) {
+	policy, _, err := MergeResourcePolicy("", testBinding("default/app"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, _, err = MergeResourcePolicy(policy, testBinding("prod/other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apps, allowAll := DescribeResourcePolicy(policy)
+	if strings.Join(apps, ",") != "default/app,prod/other" || allowAll {
+		t.Errorf("DescribeResourcePolicy() = %v, %v", apps, allowAll)
+	}
+
+	apps, allowAll = DescribeResourcePolicy("package policy\nimport rego.v1\n\ndefault allow = true\n")
+	if len(apps) != 0 || !allowAll {
+		t.Errorf("DescribeResourcePolicy(allow-all) = %v, %v", apps, allowAll)
+	}
+}
+
+// TestResourcePolicyLayout checks that the policy_path of the deployed KBS is
+// the policy key of the resource-policy ConfigMap volume.
+func TestResourcePolicyLayout(t *testing.T) {
+	cfg := &Config{Namespace: "coco", KBSImage: "kbs:test"}
+	kbsConfig, err := kbsConfigTOML(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		PolicyEngine struct {
+			PolicyPath string `toml:"policy_path"`
+		} `toml:"policy_engine"`
+	}
+	if err := toml.Unmarshal([]byte(kbsConfig), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	policyPath := parsed.PolicyEngine.PolicyPath
+
+	pod := buildKBSDeployment(cfg).Spec.Template.Spec
+	var volume string
+	for _, v := range pod.Volumes {
+		if v.ConfigMap != nil && v.ConfigMap.Name == resourcePolicyConfigMapName {
+			volume = v.Name
+		}
+	}
+	if volume == "" {
+		t.Fatalf("no volume for the %s ConfigMap", resourcePolicyConfigMapName)
+	}
+	var mountPath string
+	for _, m := range pod.Containers[0].VolumeMounts {
+		if m.Name == volume {
+			mountPath = m.MountPath
+		}
+	}
+	if path.Dir(policyPath) != mountPath || path.Base(policyPath) != resourcePolicyKey {
+		t.Errorf("policy_path %s is not %s of the ConfigMap mounted at %q", policyPath, resourcePolicyKey, mountPath)
+	}
+	if _, ok := buildResourcePolicyConfigMap("coco").Data[resourcePolicyKey]; !ok {
+		t.Errorf("%s ConfigMap has no %s", resourcePolicyConfigMapName, resourcePolicyKey)
+	}
+}
+
+// newPolicyKBS returns a client for a fake KBS that serves the resource policy
+// from the resource-policy ConfigMap in clientset, as the deployed KBS reads
+// it from the ConfigMap volume, and rejects policy uploads as the read-only
+// volume does.
+func newPolicyKBS(t *testing.T, clientset kubernetes.Interface) *kbsclient.Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/kbs/v0/resource-policy" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Read-only file system (os error 30)", http.StatusInternalServerError)
+			return
+		}
+		cm, err := clientset.CoreV1().ConfigMaps("coco").Get(r.Context(), resourcePolicyConfigMapName, metav1.GetOptions{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = io.WriteString(w, base64.RawURLEncoding.EncodeToString([]byte(cm.Data[resourcePolicyKey])))
+	}))
+	t.Cleanup(server.Close)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := kbsclient.New(server.URL, privateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestBindResources(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(
+		buildResourcePolicyConfigMap("coco"),
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "kbs-1", Namespace: "coco", Labels: map[string]string{"app": "kbs"}}},
+	)
+	client := newPolicyKBS(t, clientset)
+
+	replacedAllowAll, err := BindResources(ctx, clientset, "coco", client, testBinding("default/app"))
+	if err != nil {
+		t.Fatalf("BindResources() error = %v", err)
+	}
+	if !replacedAllowAll {
+		t.Error("BindResources() did not report replacing the default allow-all policy")
+	}
+
+	cm, err := clientset.CoreV1().ConfigMaps("coco").Get(ctx, resourcePolicyConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := cm.Data[resourcePolicyKey]
+	if !strings.Contains(policy, "default allow := false") || !strings.Contains(policy, "# BEGIN cococtl app default/app") {
+		t.Errorf("stored policy:\n%s", policy)
+	}
+
+	pod, err := clientset.CoreV1().Pods("coco").Get(ctx, "kbs-1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pod.Annotations[resourcePolicyAnnotation]) != 64 {
+		t.Errorf("pod annotations = %v", pod.Annotations)
+	}
+}
+
+func TestSetResourcePolicy_NoConfigMap(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	err := SetResourcePolicy(context.Background(), clientset, "coco", newPolicyKBS(t, clientset), []byte("package policy\n"))
+	if err == nil || !strings.Contains(err.Error(), "resource-policy ConfigMap") {
+		t.Errorf("SetResourcePolicy() error = %v", err)
+	}
+}
+
+func TestDeployResourcePolicyConfigMap_KeepsPolicy(t *testing.T) {
+	ctx := context.Background()
+	existing := buildResourcePolicyConfigMap("coco")
+	existing.Data[resourcePolicyKey] = "package policy\n\ndefault allow := false\n"
+	clientset := fake.NewSimpleClientset(existing)
+
+	if err := deployResourcePolicyConfigMap(ctx, clientset, "coco"); err != nil {
+		t.Fatalf("deployResourcePolicyConfigMap() error = %v", err)
+	}
+	cm, err := clientset.CoreV1().ConfigMaps("coco").Get(ctx, resourcePolicyConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm.Data[resourcePolicyKey] != existing.Data[resourcePolicyKey] {
+		t.Errorf("policy overwritten:\n%s", cm.Data[resourcePolicyKey])
+	}
+
+	if err := deployResourcePolicyConfigMap(ctx, clientset, "other"); err != nil {
+		t.Fatalf("deployResourcePolicyConfigMap() error = %v", err)
+	}
+	if _, err := clientset.CoreV1().ConfigMaps("other").Get(ctx, resourcePolicyConfigMapName, metav1.GetOptions{}); err != nil {
+		t.Errorf("ConfigMap not created: %v", err)
+	}
+}
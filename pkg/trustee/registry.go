@@ -0,0 +1,75 @@
+package trustee
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// RegistryAuthKey is the KBS key under which the combined registry
+// credentials of an application are stored.
+// #nosec G101 - This is a key name constant, not a hardcoded credential
+const RegistryAuthKey = "dockerconfigjson"
+
+// RegistryAuthSource is one key of an imagePullSecret: either a
+// .dockerconfigjson or a legacy .dockercfg document.
+type RegistryAuthSource struct {
+	Secret string
+	Key    string
+	Data   []byte
+}
+
+// RegistryAuthSecretName returns the KBS resource type holding the combined
+// registry credentials for an application.
+func RegistryAuthSecretName(appName string) string {
+	return appName + "-registry-auth"
+}
+
+// MergeDockerConfigs combines the auths of several imagePullSecrets into a
+// single .dockerconfigjson document, since CDH accepts only one
+// authenticated_registry_credentials_uri. When two sources carry credentials
+// for the same registry, the first one wins and a warning is returned.
+func MergeDockerConfigs(sources []RegistryAuthSource) ([]byte, []string, error) {
+	merged := DockerConfig{Auths: make(map[string]DockerAuthEntry)}
+	owners := make(map[string]string)
+	var warnings []string
+
+	for _, src := range sources {
+		var auths map[string]DockerAuthEntry
+		switch src.Key {
+		case ".dockerconfigjson":
+			var cfg DockerConfig
+			if err := json.Unmarshal(src.Data, &cfg); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse %s in secret %s: %w", src.Key, src.Secret, err)
+			}
+			auths = cfg.Auths
+		case ".dockercfg":
+			if err := json.Unmarshal(src.Data, &auths); err != nil {
+				return nil, nil, fmt.Errorf("failed to parse %s in secret %s: %w", src.Key, src.Secret, err)
+			}
+		default:
+			warnings = append(warnings, fmt.Sprintf("ignoring key %q in secret %s: not a registry credential", src.Key, src.Secret))
+			continue
+		}
+
+		for registry, entry := range auths {
+			if owner, exists := owners[registry]; exists {
+				if owner != src.Secret {
+					warnings = append(warnings, fmt.Sprintf("credentials for %s in secret %s ignored; already provided by secret %s", registry, src.Secret, owner))
+				}
+				continue
+			}
+			owners[registry] = src.Secret
+			merged.Auths[registry] = entry
+		}
+	}
+
+	if len(merged.Auths) == 0 {
+		return nil, warnings, fmt.Errorf("no registry credentials found in imagePullSecrets")
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal .dockerconfigjson data: %w", err)
+	}
+	return data, warnings, nil
+}
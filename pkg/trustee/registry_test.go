@@ -0,0 +1,59 @@
+package trustee
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMergeDockerConfigs(t *testing.T) {
+	sources := []RegistryAuthSource{
+		{Secret: "quay-cred", Key: ".dockerconfigjson", Data: []byte(`{"auths":{"quay.io":{"auth":"cXVheQ=="}}}`)},
+		{Secret: "ghcr-cred", Key: ".dockerconfigjson", Data: []byte(`{"auths":{"ghcr.io":{"username":"u","password":"p"},"quay.io":{"auth":"b3RoZXI="}}}`)},
+		{Secret: "legacy-cred", Key: ".dockercfg", Data: []byte(`{"registry.example.com":{"auth":"bGVnYWN5","email":"a@b.c"}}`)},
+	}
+
+	data, warnings, err := MergeDockerConfigs(sources)
+	if err != nil {
+		t.Fatalf("MergeDockerConfigs() error = %v", err)
+	}
+
+	var merged DockerConfig
+	if err := json.Unmarshal(data, &merged); err != nil {
+		t.Fatalf("merged config is not valid JSON: %v", err)
+	}
+	if len(merged.Auths) != 3 {
+		t.Fatalf("got %d registries, want 3: %s", len(merged.Auths), data)
+	}
+	if got := merged.Auths["quay.io"].Auth; got != "cXVheQ==" {
+		t.Errorf("quay.io auth = %q, want the first secret's credentials", got)
+	}
+	if got := merged.Auths["ghcr.io"]; got.Username != "u" || got.Password != "p" {
+		t.Errorf("ghcr.io entry = %+v, want username/password preserved", got)
+	}
+	if got := merged.Auths["registry.example.com"].Email; got != "a@b.c" {
+		t.Errorf("registry.example.com email = %q, want %q", got, "a@b.c")
+	}
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "quay.io") || !strings.Contains(warnings[0], "quay-cred") {
+		t.Errorf("warnings = %v, want one conflict warning for quay.io", warnings)
+	}
+}
+
+func TestMergeDockerConfigs_Errors(t *testing.T) {
+	if _, _, err := MergeDockerConfigs([]RegistryAuthSource{
+		{Secret: "bad", Key: ".dockerconfigjson", Data: []byte("not json")},
+	}); err == nil || !strings.Contains(err.Error(), "bad") {
+		t.Errorf("MergeDockerConfigs() error = %v, want parse error naming the secret", err)
+	}
+
+	_, warnings, err := MergeDockerConfigs([]RegistryAuthSource{
+		{Secret: "opaque", Key: "token", Data: []byte("x")},
+	})
+	if err == nil {
+		t.Error("MergeDockerConfigs() expected error when no credentials are found")
+	}
+	if len(warnings) != 1 {
+		t.Errorf("warnings = %v, want the ignored key reported", warnings)
+	}
+}
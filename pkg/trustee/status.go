@@ -0,0 +1,209 @@
+package trustee
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// kbsAuthSecretName holds the public key KBS verifies admin tokens with.
+	kbsAuthSecretName = "kbs-auth-public-key"
+
+	// kbsAuthSecretKey is the key of the public key in kbsAuthSecretName.
+	kbsAuthSecretKey = "public.pub"
+)
+
+// logErrorRegexp matches KBS log lines reporting an error or a panic.
+var logErrorRegexp = regexp.MustCompile(`\bERROR\b|level=error|panicked at`)
+
+// Status describes the KBS deployed in a namespace.
+type Status struct {
+	Namespace string
+	// Deployed is false when there is no KBS Deployment in Namespace; the
+	// other fields are then unset.
+	Deployed bool
+	// Managed reports whether the Deployment carries ManagedByLabel. KBS
+	// deployed by older versions does not, and Undeploy cannot find its other
+	// objects.
+	Managed bool
+	// Replicas and ReadyReplicas are the desired and ready pod counts.
+	Replicas      int32
+	ReadyReplicas int32
+	// Image is the KBS container image of the Deployment.
+	Image string
+	Pods  []PodStatus
+	// ResourceBackend is ResourceBackendFile or ResourceBackendVault.
+	ResourceBackend string
+	// Storage is StorageMemory or StoragePVC.
+	Storage string
+	// TLS reports whether the KBS serves HTTPS.
+	TLS bool
+	// AuthKeyFingerprint is the KeyFingerprint of the admin public key in the
+	// kbs-auth-public-key Secret, or empty when the Secret is missing.
+	AuthKeyFingerprint string
+}
+
+// PodStatus describes one KBS pod.
+type PodStatus struct {
+	Name     string
+	Phase    corev1.PodPhase
+	Ready    bool
+	Restarts int32
+	// ImageID is the resolved image (usually including its digest) the kbs
+	// container runs.
+	ImageID string
+}
+
+// GetStatus reports the state of the KBS deployed in namespace. A missing
+// Deployment is not an error; Status.Deployed is false instead.
+func GetStatus(ctx context.Context, clientset kubernetes.Interface, namespace string) (*Status, error) {
+	status := &Status{Namespace: namespace}
+
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: trusteeLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get KBS deployment: %w", err)
+	}
+	if len(deployments.Items) == 0 {
+		return status, nil
+	}
+	deployment := deployments.Items[0]
+	status.Deployed = true
+	status.Replicas = 1
+	if deployment.Spec.Replicas != nil {
+		status.Replicas = *deployment.Spec.Replicas
+	}
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	status.Managed = deployment.Labels[ManagedByLabel] == managedByValue
+
+	status.ResourceBackend = deployment.Labels[ResourceBackendLabel]
+	if status.ResourceBackend == "" {
+		status.ResourceBackend = ResourceBackendFile
+	}
+	status.Storage = StorageMemory
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		switch {
+		case volume.Name == "confidential-containers" && volume.PersistentVolumeClaim != nil:
+			status.Storage = StoragePVC
+		case volume.Name == "kbs-tls":
+			status.TLS = true
+		}
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == "kbs" {
+			status.Image = container.Image
+		}
+	}
+
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: trusteeLabel,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list KBS pods: %w", err)
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		podStatus := PodStatus{Name: pod.Name, Phase: pod.Status.Phase, Ready: isPodReady(pod)}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name == "kbs" {
+				podStatus.Restarts = cs.RestartCount
+				podStatus.ImageID = cs.ImageID
+			}
+		}
+		status.Pods = append(status.Pods, podStatus)
+	}
+
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, kbsAuthSecretName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read KBS auth secret: %w", err)
+	default:
+		status.AuthKeyFingerprint, err = KeyFingerprint(secret.Data[kbsAuthSecretKey])
+		if err != nil {
+			return nil, fmt.Errorf("secret %s/%s: %w", namespace, kbsAuthSecretName, err)
+		}
+	}
+
+	return status, nil
+}
+
+// KeyFingerprint returns the SHA-256 fingerprint of the raw bytes of an Ed25519
+// admin key in the form "SHA256:<base64>". pemData holds either the
+// PKIX public key deployed to KBS or the PKCS#8 private key kept in the auth
+// directory, so that the two can be compared.
+func KeyFingerprint(pemData []byte) (string, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return "", fmt.Errorf("no PEM key found")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		var privateKey any
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if priv, ok := privateKey.(ed25519.PrivateKey); ok {
+			key = priv.Public()
+		}
+	default:
+		return "", fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to parse key: %w", err)
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("expected an Ed25519 key")
+	}
+
+	sum := sha256.Sum256(publicKey)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]), nil
+}
+
+// RecentLogErrors returns up to maxErrors of the most recent error lines among
+// the last tailLines lines logged by the kbs container of podName.
+func RecentLogErrors(ctx context.Context, clientset kubernetes.Interface, namespace, podName string, tailLines int64, maxErrors int) ([]string, error) {
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: "kbs",
+		TailLines: &tailLines,
+	}).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KBS logs: %w", err)
+	}
+	defer func() { _ = stream.Close() }()
+
+	var errorLines []string
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if logErrorRegexp.MatchString(line) {
+			errorLines = append(errorLines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read KBS logs: %w", err)
+	}
+	if len(errorLines) > maxErrors {
+		errorLines = errorLines[len(errorLines)-maxErrors:]
+	}
+	return errorLines, nil
+}
@@ -0,0 +1,142 @@
+package trustee
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testAuthKeyPEMs returns a fresh Ed25519 admin key as the PKCS#8 private key
+// PEM kept locally and the PKIX public key PEM deployed to KBS.
+func testAuthKeyPEMs(t *testing.T) (privatePEM, publicPEM []byte) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	privatePEM, publicPEM := testAuthKeyPEMs(t)
+	fromPrivate, err := KeyFingerprint(privatePEM)
+	if err != nil {
+		t.Fatalf("KeyFingerprint(private) error = %v", err)
+	}
+	fromPublic, err := KeyFingerprint(publicPEM)
+	if err != nil {
+		t.Fatalf("KeyFingerprint(public) error = %v", err)
+	}
+	if fromPrivate != fromPublic || !strings.HasPrefix(fromPublic, "SHA256:") {
+		t.Errorf("fingerprints differ: %s vs %s", fromPrivate, fromPublic)
+	}
+
+	otherPEM, _ := testAuthKeyPEMs(t)
+	if other, _ := KeyFingerprint(otherPEM); other == fromPublic {
+		t.Error("different keys have the same fingerprint")
+	}
+	if _, err := KeyFingerprint([]byte("not a key")); err == nil {
+		t.Error("KeyFingerprint() expected error for non-PEM data")
+	}
+	if _, err := KeyFingerprint(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")})); err == nil {
+		t.Error("KeyFingerprint() expected error for a certificate")
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	ctx := context.Background()
+	_, publicPEM := testAuthKeyPEMs(t)
+	replicas := int32(1)
+	clientset := fake.NewSimpleClientset(
+		&appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "trustee-deployment",
+				Namespace: "coco",
+				Labels:    map[string]string{"app": "kbs", ResourceBackendLabel: ResourceBackendVault},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "kbs", Image: "kbs:v1"}},
+					Volumes: []corev1.Volume{
+						{Name: "confidential-containers", VolumeSource: corev1.VolumeSource{
+							PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: kbsStoragePVCName},
+						}},
+						{Name: "kbs-tls", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: kbsTLSSecretName}}},
+					},
+				}},
+			},
+			Status: appsv1.DeploymentStatus{ReadyReplicas: 1},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "trustee-deployment-abc", Namespace: "coco", Labels: map[string]string{"app": "kbs"}},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}},
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "kbs", RestartCount: 2, ImageID: "kbs@sha256:abc"}},
+			},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: kbsAuthSecretName, Namespace: "coco"},
+			Data:       map[string][]byte{kbsAuthSecretKey: publicPEM},
+		},
+	)
+
+	status, err := GetStatus(ctx, clientset, "coco")
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	wantFingerprint, _ := KeyFingerprint(publicPEM)
+	if !status.Deployed || status.Replicas != 1 || status.ReadyReplicas != 1 || status.Image != "kbs:v1" ||
+		status.ResourceBackend != ResourceBackendVault || status.Storage != StoragePVC || !status.TLS ||
+		status.AuthKeyFingerprint != wantFingerprint {
+		t.Errorf("GetStatus() = %+v", status)
+	}
+	if len(status.Pods) != 1 || !status.Pods[0].Ready || status.Pods[0].Restarts != 2 || status.Pods[0].ImageID != "kbs@sha256:abc" {
+		t.Errorf("GetStatus() pods = %+v", status.Pods)
+	}
+
+	status, err = GetStatus(ctx, clientset, "empty")
+	if err != nil || status.Deployed {
+		t.Errorf("GetStatus(empty) = %+v, %v", status, err)
+	}
+}
+
+func TestRecentLogErrors(t *testing.T) {
+	// The fake clientset serves "fake logs" for any pod.
+	clientset := fake.NewSimpleClientset()
+	lines, err := RecentLogErrors(context.Background(), clientset, "coco", "trustee-deployment-abc", 100, 5)
+	if err != nil || len(lines) != 0 {
+		t.Errorf("RecentLogErrors() = %v, %v", lines, err)
+	}
+
+	for line, want := range map[string]bool{
+		"[2025-01-01T00:00:00Z ERROR kbs::api_server] Resource not permitted": true,
+		"thread 'main' panicked at kbs/src/main.rs:10:5":                      true,
+		"time=now level=error msg=boom":                                       true,
+		"[2025-01-01T00:00:00Z INFO  kbs] Starting HTTP server":               false,
+		"[2025-01-01T00:00:00Z WARN  kbs] ERRORS_TOTAL metric":                false,
+	} {
+		if got := logErrorRegexp.MatchString(line); got != want {
+			t.Errorf("logErrorRegexp.MatchString(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
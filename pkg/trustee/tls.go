@@ -0,0 +1,168 @@
+package trustee
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
+)
+
+const (
+	// kbsTLSSecretName is the Secret holding the KBS serving certificate.
+	kbsTLSSecretName = "kbs-tls"
+
+	// kbsTLSDir is where the serving certificate is mounted in the KBS pod.
+	kbsTLSDir = "/etc/kbs-tls"
+)
+
+// TLSConfig is the serving certificate of an HTTPS KBS deployment.
+type TLSConfig struct {
+	// CertPEM is the serving certificate, optionally followed by intermediates.
+	CertPEM []byte
+	// KeyPEM is the private key of CertPEM.
+	KeyPEM []byte
+	// CACertPEM is the CA that issued CertPEM. It is stored alongside the
+	// certificate so clients can verify the KBS; leave it empty for
+	// certificates issued by a publicly trusted CA.
+	CACertPEM []byte
+}
+
+// ServiceDNSNames returns the DNS names under which the KBS Service is
+// reachable in the cluster, most specific last.
+func ServiceDNSNames(namespace, serviceName string) []string {
+	return []string{
+		serviceName,
+		serviceName + "." + namespace,
+		serviceName + "." + namespace + ".svc",
+		serviceName + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// GenerateTLS issues a KBS serving certificate signed by ca for the in-cluster
+// names of the Service. The certificate is valid for localhost as well so that
+// the KBS can also be reached through a port-forward.
+func GenerateTLS(ca *certs.CertificateSet, namespace, serviceName string) (*TLSConfig, error) {
+	dnsNames := append(ServiceDNSNames(namespace, serviceName), "localhost")
+	server, err := certs.GenerateServerCert(ca.CertPEM, ca.KeyPEM, dnsNames[len(dnsNames)-2], certs.SANs{
+		DNSNames:    dnsNames,
+		IPAddresses: []string{"127.0.0.1"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate KBS serving certificate: %w", err)
+	}
+	return &TLSConfig{CertPEM: server.CertPEM, KeyPEM: server.KeyPEM, CACertPEM: ca.CertPEM}, nil
+}
+
+func buildTLSSecret(namespace string, tlsCfg *TLSConfig) *corev1.Secret {
+	return dataSecret(kbsTLSSecretName, namespace, corev1.SecretTypeTLS, map[string][]byte{
+		corev1.TLSCertKey:       tlsCfg.CertPEM,
+		corev1.TLSPrivateKeyKey: tlsCfg.KeyPEM,
+		"ca.crt":                tlsCfg.CACertPEM,
+	})
+}
+
+func deployTLSSecret(ctx context.Context, namespace string, tlsCfg *TLSConfig) error {
+	manifest, err := manifestYAML(buildTLSSecret(namespace, tlsCfg))
+	if err != nil {
+		return err
+	}
+	return applyManifest(ctx, manifest)
+}
+
+func deleteTLSSecret(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	err := clientset.CoreV1().Secrets(namespace).Delete(ctx, kbsTLSSecretName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ServingTLS describes how clients verify an HTTPS KBS deployment.
+type ServingTLS struct {
+	// CACertPEM is the CA that issued the serving certificate (empty when it
+	// is publicly trusted).
+	CACertPEM []byte
+	// ServerName is a name the serving certificate is valid for.
+	ServerName string
+}
+
+// GetServingTLS returns the TLS settings of the KBS deployed in namespace, or
+// nil when the KBS serves plain HTTP.
+func GetServingTLS(ctx context.Context, clientset kubernetes.Interface, namespace string) (*ServingTLS, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, kbsTLSSecretName, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read KBS TLS secret: %w", err)
+	}
+	block, _ := pem.Decode(secret.Data["tls.crt"])
+	if block == nil {
+		return nil, fmt.Errorf("secret %s/%s has no PEM certificate in tls.crt", namespace, kbsTLSSecretName)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KBS serving certificate: %w", err)
+	}
+	serverName := cert.Subject.CommonName
+	if len(cert.DNSNames) > 0 {
+		serverName = cert.DNSNames[0]
+	}
+	return &ServingTLS{CACertPEM: secret.Data["ca.crt"], ServerName: serverName}, nil
+}
+
+// tunnelClient builds a KBS admin client for the KBS in namespace reached
+// through a port-forward on localPort. When the KBS serves HTTPS, the client
+// verifies its serving certificate against the deployment's CA and one of the
+// names the certificate was issued for.
+func tunnelClient(ctx context.Context, clientset kubernetes.Interface, namespace string, localPort uint16, newClient func(baseURL string, caCert []byte) (*kbsclient.Client, error)) (*kbsclient.Client, error) {
+	servingTLS, err := GetServingTLS(ctx, clientset, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if servingTLS == nil {
+		return newClient(fmt.Sprintf("http://127.0.0.1:%d", localPort), nil)
+	}
+	client, err := newClient(fmt.Sprintf("https://127.0.0.1:%d", localPort), servingTLS.CACertPEM)
+	if err != nil {
+		return nil, err
+	}
+	return client.WithServerName(servingTLS.ServerName), nil
+}
+
+// SaveCACert writes the CA of an already deployed HTTPS KBS to
+// <authDir>/tls/ca-cert.pem and returns the path. An existing file is kept
+// if it holds the same CA and is an error otherwise.
+func SaveCACert(authDir string, caPEM []byte) (string, error) {
+	resolvedAuthDir, err := DefaultAuthDir(authDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve auth directory: %w", err)
+	}
+	tlsDir := filepath.Join(resolvedAuthDir, "tls")
+	caPath := filepath.Join(tlsDir, "ca-cert.pem")
+	// #nosec G304 -- path is under the resolved auth directory
+	if existing, err := os.ReadFile(caPath); err == nil {
+		if !bytes.Equal(existing, caPEM) {
+			return "", fmt.Errorf("%s does not hold the CA of the deployed KBS; trustee_ca_cert was not updated", caPath)
+		}
+		return caPath, nil
+	}
+	if err := os.MkdirAll(tlsDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", tlsDir, err)
+	}
+	if err := os.WriteFile(caPath, caPEM, 0600); err != nil {
+		return "", fmt.Errorf("failed to save KBS CA certificate: %w", err)
+	}
+	return caPath, nil
+}
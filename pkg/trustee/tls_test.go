@@ -0,0 +1,149 @@
+package trustee
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/certs"
+)
+
+func TestGenerateTLS_ServiceNames(t *testing.T) {
+	ca, err := certs.GenerateCA("test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, err := GenerateTLS(ca, "coco", "trustee-kbs")
+	if err != nil {
+		t.Fatalf("GenerateTLS() error = %v", err)
+	}
+	block, _ := pem.Decode(tlsCfg.CertPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caBlock, _ := pem.Decode(tlsCfg.CACertPEM)
+	caCert, _ := x509.ParseCertificate(caBlock.Bytes)
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	for _, name := range []string{"trustee-kbs.coco.svc.cluster.local", "trustee-kbs.coco.svc", "localhost", "127.0.0.1"} {
+		if _, err := cert.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("serving certificate not valid for %s: %v", name, err)
+		}
+	}
+}
+
+func TestBuildManifests_TLS(t *testing.T) {
+	tlsCfg := &TLSConfig{CertPEM: []byte("cert"), KeyPEM: []byte("key"), CACertPEM: []byte("ca")}
+
+	configMaps := configMapsManifest(t, &Config{Namespace: "coco", TLS: tlsCfg})
+	for _, want := range []string{"insecure_http = false", `certificate = "/etc/kbs-tls/tls.crt"`, `private_key = "/etc/kbs-tls/tls.key"`} {
+		if !strings.Contains(configMaps, want) {
+			t.Errorf("kbs-config.toml missing %q:\n%s", want, configMaps)
+		}
+	}
+	if plain := configMapsManifest(t, &Config{Namespace: "coco"}); !strings.Contains(plain, "insecure_http = true") || strings.Contains(plain, "private_key") {
+		t.Errorf("plain HTTP kbs-config.toml:\n%s", plain)
+	}
+
+	kbs := kbsManifest(t, &Config{Namespace: "coco", ServiceName: "trustee-kbs", KBSImage: "kbs:test", TLS: tlsCfg})
+	for _, doc := range strings.Split(kbs, "\n---\n") {
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			t.Fatalf("manifest is not valid YAML: %v\n%s", err, doc)
+		}
+	}
+	for _, want := range []string{"mountPath: /etc/kbs-tls", "secretName: kbs-tls", "appProtocol: https"} {
+		if !strings.Contains(kbs, want) {
+			t.Errorf("KBS manifest missing %q", want)
+		}
+	}
+
+	secret := objectsManifest(t, buildTLSSecret("coco", tlsCfg))
+	var obj struct {
+		Type string            `yaml:"type"`
+		Data map[string]string `yaml:"data"`
+	}
+	if err := yaml.Unmarshal([]byte(secret), &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Type != "kubernetes.io/tls" || obj.Data["tls.crt"] != "Y2VydA==" || obj.Data["ca.crt"] != "Y2E=" {
+		t.Errorf("TLS secret = %+v", obj)
+	}
+}
+
+func TestGetServingTLS(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	servingTLS, err := GetServingTLS(ctx, clientset, "coco")
+	if err != nil || servingTLS != nil {
+		t.Fatalf("GetServingTLS() without secret = %v, %v; want nil, nil", servingTLS, err)
+	}
+
+	ca, err := certs.GenerateCA("test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, err := GenerateTLS(ca, "coco", "trustee-kbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = clientset.CoreV1().Secrets("coco").Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: kbsTLSSecretName, Namespace: "coco"},
+		Data:       map[string][]byte{"tls.crt": tlsCfg.CertPEM, "tls.key": tlsCfg.KeyPEM, "ca.crt": tlsCfg.CACertPEM},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	servingTLS, err = GetServingTLS(ctx, clientset, "coco")
+	if err != nil {
+		t.Fatalf("GetServingTLS() error = %v", err)
+	}
+	if servingTLS.ServerName != "trustee-kbs" || string(servingTLS.CACertPEM) != string(ca.CertPEM) {
+		t.Errorf("GetServingTLS() = server name %q, CA match %v", servingTLS.ServerName, string(servingTLS.CACertPEM) == string(ca.CertPEM))
+	}
+
+	if err := deleteTLSSecret(ctx, clientset, "coco"); err != nil {
+		t.Fatalf("deleteTLSSecret() error = %v", err)
+	}
+	if err := deleteTLSSecret(ctx, clientset, "coco"); err != nil {
+		t.Errorf("deleteTLSSecret() on missing secret error = %v", err)
+	}
+}
+
+func TestGetServiceURL(t *testing.T) {
+	if got := GetServiceURL("coco", "trustee-kbs", false); got != "http://trustee-kbs.coco.svc.cluster.local:8080" {
+		t.Errorf("GetServiceURL(http) = %q", got)
+	}
+	if got := GetServiceURL("coco", "trustee-kbs", true); got != "https://trustee-kbs.coco.svc.cluster.local:8080" {
+		t.Errorf("GetServiceURL(https) = %q", got)
+	}
+}
+
+func TestSaveCACert(t *testing.T) {
+	authDir := t.TempDir()
+	caPath, err := SaveCACert(authDir, []byte("CA"))
+	if err != nil {
+		t.Fatalf("SaveCACert() error = %v", err)
+	}
+	if caPath != filepath.Join(authDir, "tls", "ca-cert.pem") {
+		t.Errorf("CA path = %q", caPath)
+	}
+	if _, err := SaveCACert(authDir, []byte("CA")); err != nil {
+		t.Errorf("SaveCACert() with the same CA error = %v", err)
+	}
+	if _, err := SaveCACert(authDir, []byte("other CA")); err == nil {
+		t.Error("SaveCACert() overwrote a different CA")
+	}
+}
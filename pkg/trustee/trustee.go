@@ -21,6 +21,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -28,11 +29,16 @@ import (
 	"k8s.io/client-go/transport/spdy"
 
 	"github.com/confidential-devhub/cococtl/pkg/kbsclient"
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
 )
 
 const (
 	trusteeLabel = "app=kbs"
 
+	// AttestationStatusPath is the resource the attestation init container and
+	// the sidecar read to confirm attestation succeeded.
+	AttestationStatusPath = "default/attestation-status/status"
+
 	// defaultAttestationStatusContent is uploaded to KBS during deploy so the
 	// init container can verify attestation succeeded.
 	defaultAttestationStatusContent = "success"
@@ -47,6 +53,17 @@ const (
 	// kbsAdminTimeout bounds the port-forward handshake and the subsequent
 	// SetResource HTTP call so a network hang cannot block Deploy indefinitely.
 	kbsAdminTimeout = 30 * time.Second
+
+	// kbsStoragePVCName is the PersistentVolumeClaim backing
+	// /opt/confidential-containers with StoragePVC.
+	kbsStoragePVCName = "kbs-storage"
+
+	// DefaultStorageSize is the size requested for the KBS storage PVC.
+	DefaultStorageSize = "1Gi"
+
+	// kbsRepositoryDir is the LocalFs resource repository inside the KBS pod.
+	// It must match dir_path of the resource plugin in kbs-config.toml.
+	kbsRepositoryDir = "/opt/confidential-containers/kbs/repository"
 )
 
 // DockerConfig represents the new .dockerconfigjson format
@@ -56,10 +73,23 @@ type DockerConfig struct {
 
 // DockerAuthEntry represents an auth entry in the Docker config
 type DockerAuthEntry struct {
-	Auth  string `json:"auth,omitempty"`
-	Email string `json:"email,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+	Email         string `json:"email,omitempty"`
 }
 
+// Storage backends for /opt/confidential-containers, which holds the LocalFs
+// resource repository and the attestation service work dir.
+const (
+	// StorageMemory keeps the data in a memory-backed emptyDir; it is lost
+	// whenever the KBS pod restarts.
+	StorageMemory = "memory"
+	// StoragePVC keeps the data on a PersistentVolumeClaim.
+	StoragePVC = "pvc"
+)
+
 // Config holds Trustee deployment configuration
 type Config struct {
 	Namespace   string
@@ -75,6 +105,24 @@ type Config struct {
 	// persisted for later use by 'kbs populate'.  If empty, defaults to
 	// ~/.kube/coco-kbs-auth (resolved via DefaultAuthDir).
 	AuthDir string
+
+	// TLS, if set, is the serving certificate of the KBS, which then serves
+	// HTTPS instead of plain HTTP.
+	TLS *TLSConfig
+
+	// Storage is StorageMemory (the default when empty) or StoragePVC.
+	Storage string
+	// StorageClass is the StorageClass of the PVC; empty uses the cluster default.
+	StorageClass string
+	// StorageSize is the size of the PVC; empty uses DefaultStorageSize.
+	StorageSize string
+
+	// Vault, if set, stores resources in a Vault KV store instead of the
+	// LocalFs repository.
+	Vault *VaultConfig
+
+	// Overrides, if set, customizes the KBS Deployment and kbs-config.toml.
+	Overrides *Overrides
 }
 
 // SecretResource represents a secret to be stored in KBS
@@ -110,6 +158,11 @@ func Deploy(ctx context.Context, clientset kubernetes.Interface, cfg *Config) er
 	if cfg.RESTConfig == nil {
 		return fmt.Errorf("cfg.RESTConfig is required for KBS deployment")
 	}
+	if cfg.Overrides != nil {
+		if err := cfg.Overrides.Validate(); err != nil {
+			return err
+		}
+	}
 
 	// Resolve the auth directory once and write it back so the caller can read
 	// the concrete path without calling DefaultAuthDir themselves.
@@ -128,9 +181,32 @@ func Deploy(ctx context.Context, clientset kubernetes.Interface, cfg *Config) er
 		return fmt.Errorf("failed to create auth secret: %w", err)
 	}
 
-	if err := deployConfigMaps(ctx, cfg.Namespace); err != nil {
+	if cfg.TLS != nil {
+		if err := deployTLSSecret(ctx, cfg.Namespace, cfg.TLS); err != nil {
+			return fmt.Errorf("failed to deploy TLS secret: %w", err)
+		}
+	} else if err := deleteTLSSecret(ctx, clientset, cfg.Namespace); err != nil {
+		// A leftover secret would make clients expect HTTPS from a plain HTTP KBS.
+		return fmt.Errorf("failed to remove stale TLS secret: %w", err)
+	}
+
+	if cfg.Vault != nil {
+		if err := cfg.Vault.Validate(); err != nil {
+			return err
+		}
+		if err := deployVaultSecret(ctx, cfg.Namespace, cfg.Vault); err != nil {
+			return fmt.Errorf("failed to deploy Vault secret: %w", err)
+		}
+	} else if err := deleteVaultSecret(ctx, clientset, cfg.Namespace); err != nil {
+		return fmt.Errorf("failed to remove stale Vault secret: %w", err)
+	}
+
+	if err := deployConfigMaps(ctx, cfg); err != nil {
 		return fmt.Errorf("failed to deploy ConfigMaps: %w", err)
 	}
+	if err := deployResourcePolicyConfigMap(ctx, clientset, cfg.Namespace); err != nil {
+		return fmt.Errorf("failed to deploy resource policy ConfigMap: %w", err)
+	}
 
 	if cfg.PCCSURL != "" {
 		if err := deployPCCSConfigMap(ctx, cfg.Namespace, cfg.PCCSURL); err != nil {
@@ -138,6 +214,12 @@ func Deploy(ctx context.Context, clientset kubernetes.Interface, cfg *Config) er
 		}
 	}
 
+	if cfg.Storage == StoragePVC {
+		if err := deployStoragePVC(ctx, cfg); err != nil {
+			return fmt.Errorf("failed to deploy storage PVC: %w", err)
+		}
+	}
+
 	if err := deployKBS(ctx, cfg); err != nil {
 		return fmt.Errorf("failed to deploy KBS: %w", err)
 	}
@@ -166,23 +248,26 @@ func Deploy(ctx context.Context, clientset kubernetes.Interface, cfg *Config) er
 	}
 	defer stopForward()
 
-	kbsURL := fmt.Sprintf("http://127.0.0.1:%d", localPort)
-	kbsClient, err := kbsclient.New(kbsURL, privateKey, nil)
+	kbsClient, err := tunnelClient(ctx, clientset, cfg.Namespace, localPort, func(baseURL string, caCert []byte) (*kbsclient.Client, error) {
+		return kbsclient.New(baseURL, privateKey, caCert)
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create KBS client: %w", err)
 	}
 
 	// Upload the default attestation status via the KBS admin HTTP API.
 	// This replaces the former kubectl exec approach.
-	if err := kbsClient.SetResource(ctx, "default/attestation-status/status", []byte(defaultAttestationStatusContent)); err != nil {
+	if err := kbsClient.SetResource(ctx, AttestationStatusPath, []byte(defaultAttestationStatusContent)); err != nil {
 		return fmt.Errorf("failed to set default attestation status: %w", err)
 	}
 
 	// Upload any initial secrets using the same port-forward connection.
 	for _, secret := range cfg.Secrets {
-		// Strip "kbs://" and any leading slash to get the bare resource path.
-		resourcePath := strings.TrimPrefix(strings.TrimPrefix(secret.URI, "kbs://"), "/")
-		if err := kbsClient.SetResource(ctx, resourcePath, secret.Data); err != nil {
+		uri, err := kbsuri.Parse(secret.URI)
+		if err != nil {
+			return fmt.Errorf("failed to upload secret: %w", err)
+		}
+		if err := kbsClient.SetResource(ctx, uri.Path(), secret.Data); err != nil {
 			return fmt.Errorf("failed to upload secret %s: %w", secret.URI, err)
 		}
 	}
@@ -190,9 +275,14 @@ func Deploy(ctx context.Context, clientset kubernetes.Interface, cfg *Config) er
 	return nil
 }
 
-// GetServiceURL returns the URL of the deployed Trustee KBS service
-func GetServiceURL(namespace, serviceName string) string {
-	return fmt.Sprintf("http://%s.%s.svc.cluster.local:%d", serviceName, namespace, defaultKBSPort)
+// GetServiceURL returns the URL of the deployed Trustee KBS service, using
+// https when the KBS serves TLS.
+func GetServiceURL(namespace, serviceName string, https bool) string {
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s.%s.svc.cluster.local:%d", scheme, serviceName, namespace, defaultKBSPort)
 }
 
 // DefaultAuthDir returns the resolved, cleaned KBS auth directory.
@@ -333,40 +423,25 @@ func createAuthSecretFromKeys(ctx context.Context, namespace, authDir string) (e
 	}
 	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyBytes})
 
-	// Write only the public key to a temporary directory for the secret.
-	// The private key must never be stored in the cluster.
-	tmpDir, err := os.MkdirTemp("", "trustee-keys-*")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer func() {
-		if err := os.RemoveAll(tmpDir); err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: failed to remove temp directory %s: %v\n", tmpDir, err)
-		}
-	}()
-
-	tmpPubPath := filepath.Join(tmpDir, "public.pub")
-	if err := os.WriteFile(tmpPubPath, publicKeyPEM, 0600); err != nil {
-		return nil, fmt.Errorf("failed to write public key to temp dir: %w", err)
-	}
-
-	// #nosec G204 - namespace is from function parameter (application-controlled), path is from os.MkdirTemp
-	cmd := exec.CommandContext(ctx, "kubectl", "create", "secret", "generic",
-		"kbs-auth-public-key", "-n", namespace,
-		fmt.Sprintf("--from-file=%s", tmpPubPath),
-		"--dry-run=client", "-o", "yaml")
-	secretYAML, err := cmd.CombinedOutput()
+	// Only the public key goes into the cluster; the private key must never
+	// be stored there.
+	manifest, err := manifestYAML(buildAuthSecret(namespace, publicKeyPEM))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create secret YAML: %w\n%s", err, secretYAML)
+		return nil, err
 	}
-
-	if err := applyManifest(ctx, string(secretYAML)); err != nil {
+	if err := applyManifest(ctx, manifest); err != nil {
 		return nil, err
 	}
 
 	return privateKey, nil
 }
 
+// buildAuthSecret returns the Secret holding the admin public key KBS
+// verifies admin tokens with.
+func buildAuthSecret(namespace string, publicKeyPEM []byte) *corev1.Secret {
+	return dataSecret(kbsAuthSecretName, namespace, corev1.SecretTypeOpaque, map[string][]byte{kbsAuthSecretKey: publicKeyPEM})
+}
+
 // loadOrGeneratePrivateKey returns the Ed25519 private key at keyPath.
 // If the file already exists it is parsed and returned — enabling Deploy to be
 // retried after a partial failure without manual cleanup.
@@ -449,204 +524,43 @@ func loadOrGeneratePrivateKey(keyPath string) (ed25519.PrivateKey, error) {
 	return privateKey, nil
 }
 
-func buildConfigMapsManifest(namespace string) string {
-	return fmt.Sprintf(`
-apiVersion: v1
-kind: ConfigMap
-metadata:
-  name: kbs-config-cm
-  namespace: %s
-data:
-  kbs-config.toml: |
-    [http_server]
-    sockets = ["0.0.0.0:%d"]
-    insecure_http = true
-
-    [attestation_token]
-    insecure_key = true
-
-    [attestation_service]
-    type = "coco_as_builtin"
-    work_dir = "/opt/confidential-containers/attestation-service"
-    policy_engine = "opa"
-
-    [attestation_service.attestation_token_broker]
-    type = "Ear"
-    duration_min = 5
-
-    [attestation_service.rvps_config]
-    type = "BuiltIn"
-
-    [policy_engine]
-    policy_path = "/opt/confidential-containers/opa/policy.rego"
-
-    [admin]
-    type = "InsecureAllowAll"
-
-    [[plugins]]
-    name = "resource"
-    type = "LocalFs"
-    dir_path = "/opt/confidential-containers/kbs/repository"
----
-apiVersion: v1
-kind: ConfigMap
-metadata:
-  name: resource-policy
-  namespace: %s
-data:
-  policy.rego: |
-    package policy
-    import rego.v1
-
-    default allow = true
----
-apiVersion: v1
-kind: ConfigMap
-metadata:
-  name: rvps-reference-values
-  namespace: %s
-data:
-  reference-values.json: |
-    {}
-`, namespace, defaultKBSPort, namespace, namespace)
-}
-
-func deployConfigMaps(ctx context.Context, namespace string) error {
-	return applyManifest(ctx, buildConfigMapsManifest(namespace))
+func buildStoragePVC(cfg *Config) (*corev1.PersistentVolumeClaim, error) {
+	size := cfg.StorageSize
+	if size == "" {
+		size = DefaultStorageSize
+	}
+	quantity, err := resource.ParseQuantity(size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage size %q: %w", size, err)
+	}
+	pvc := &corev1.PersistentVolumeClaim{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "PersistentVolumeClaim"},
+		ObjectMeta: objectMeta(kbsStoragePVCName, cfg.Namespace, map[string]string{"app": "kbs", DataLabel: "true"}),
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: quantity},
+			},
+		},
+	}
+	if cfg.StorageClass != "" {
+		pvc.Spec.StorageClassName = &cfg.StorageClass
+	}
+	return pvc, nil
 }
 
-func deployPCCSConfigMap(ctx context.Context, namespace, pccsURL string) error {
-	qcnlConfig := fmt.Sprintf(`{"collateral_service":"%s"}`, pccsURL)
-
-	manifest := fmt.Sprintf(`
-apiVersion: v1
-kind: ConfigMap
-metadata:
-  name: dcap-attestation-conf
-  namespace: %s
-data:
-  sgx_default_qcnl.conf: '%s'
-`, namespace, qcnlConfig)
-
+func deployStoragePVC(ctx context.Context, cfg *Config) error {
+	pvc, err := buildStoragePVC(cfg)
+	if err != nil {
+		return err
+	}
+	manifest, err := manifestYAML(pvc)
+	if err != nil {
+		return err
+	}
 	return applyManifest(ctx, manifest)
 }
 
-func buildKBSManifest(cfg *Config) string {
-	// Build volumeMounts - base mounts
-	volumeMounts := `        - name: confidential-containers
-          mountPath: /opt/confidential-containers
-        - name: kbs-config
-          mountPath: /etc/kbs-config
-        - name: opa
-          mountPath: /opt/confidential-containers/opa
-        - name: auth-secret
-          mountPath: /etc/auth-secret
-        - name: reference-values
-          mountPath: /opt/confidential-containers/rvps/reference-values`
-
-	// Add PCCS volumeMount if configured
-	if cfg.PCCSURL != "" {
-		volumeMounts += `
-        - name: qplconf
-          mountPath: /etc/sgx_default_qcnl.conf
-          subPath: sgx_default_qcnl.conf`
-	}
-
-	// Build volumes - base volumes
-	volumes := `      - name: confidential-containers
-        emptyDir:
-          medium: Memory
-      - name: kbs-config
-        configMap:
-          name: kbs-config-cm
-      - name: opa
-        configMap:
-          name: resource-policy
-      - name: auth-secret
-        secret:
-          secretName: kbs-auth-public-key
-      - name: reference-values
-        configMap:
-          name: rvps-reference-values`
-
-	// Add PCCS volume if configured
-	if cfg.PCCSURL != "" {
-		volumes += `
-      - name: qplconf
-        configMap:
-          name: dcap-attestation-conf
-          items:
-          - key: sgx_default_qcnl.conf
-            path: sgx_default_qcnl.conf`
-	}
-
-	return fmt.Sprintf(`
-apiVersion: apps/v1
-kind: Deployment
-metadata:
-  name: trustee-deployment
-  namespace: %s
-  labels:
-    app: kbs
-spec:
-  replicas: 1
-  selector:
-    matchLabels:
-      app: kbs
-  template:
-    metadata:
-      labels:
-        app: kbs
-    spec:
-      containers:
-      - name: kbs
-        image: %s
-        imagePullPolicy: IfNotPresent
-        command:
-        - /usr/local/bin/kbs
-        - --config-file
-        - /etc/kbs-config/kbs-config.toml
-        ports:
-        - containerPort: %d
-          name: kbs
-          protocol: TCP
-        securityContext:
-          allowPrivilegeEscalation: false
-          capabilities:
-            drop:
-            - ALL
-          seccompProfile:
-            type: RuntimeDefault
-        resources:
-          requests:
-            cpu: "1"
-          limits:
-            cpu: "2"
-        volumeMounts:
-%s
-      restartPolicy: Always
-      volumes:
-%s
----
-apiVersion: v1
-kind: Service
-metadata:
-  name: %s
-  namespace: %s
-spec:
-  selector:
-    app: kbs
-  ports:
-  - port: %d
-    targetPort: %d
-    protocol: TCP
-`, cfg.Namespace, cfg.KBSImage, defaultKBSPort, volumeMounts, volumes, cfg.ServiceName, cfg.Namespace, defaultKBSPort, defaultKBSPort)
-}
-
-func deployKBS(ctx context.Context, cfg *Config) error {
-	return applyManifest(ctx, buildKBSManifest(cfg))
-}
-
 // ParseSecretSpec parses a secret specification and reads the file
 func ParseSecretSpec(spec string) (*SecretResource, error) {
 	parts := strings.SplitN(spec, "::", 2)
@@ -654,11 +568,13 @@ func ParseSecretSpec(spec string) (*SecretResource, error) {
 		return nil, fmt.Errorf("invalid secret format: %s (expected kbs://uri::path)", spec)
 	}
 
-	uri := parts[0]
+	uri, err := kbsuri.Parse(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret format: %s: %w", spec, err)
+	}
 	pathOrData := parts[1]
 
 	var data []byte
-	var err error
 
 	if strings.HasPrefix(pathOrData, "base64:") {
 		encoded := strings.TrimPrefix(pathOrData, "base64:")
@@ -702,7 +618,7 @@ func ParseSecretSpec(spec string) (*SecretResource, error) {
 	}
 
 	return &SecretResource{
-		URI:  uri,
+		URI:  uri.String(),
 		Path: pathOrData,
 		Data: data,
 	}, nil
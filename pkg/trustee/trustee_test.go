@@ -133,7 +133,7 @@ func TestDeployKBS_ResourceLimits(t *testing.T) {
 		KBSImage:    "test-image:latest",
 	}
 
-	manifest := buildKBSManifest(cfg)
+	manifest := kbsManifest(t, cfg)
 
 	// Parse the YAML to verify resource limits are present
 	documents := strings.Split(manifest, "\n---\n")
@@ -212,7 +212,7 @@ func TestDeployKBS_ResourceLimits(t *testing.T) {
 // TestConfigMap_SocketsConfiguration tests that the KBS ConfigMap includes sockets configuration
 func TestConfigMap_SocketsConfiguration(t *testing.T) {
 	namespace := "test-namespace"
-	manifest := buildConfigMapsManifest(namespace)
+	manifest := configMapsManifest(t, &Config{Namespace: namespace})
 
 	// Parse the YAML documents
 	documents := strings.Split(manifest, "\n---\n")
@@ -256,3 +256,77 @@ func TestConfigMap_SocketsConfiguration(t *testing.T) {
 	}
 }
 
+
+func TestBuildKBSDeployment_Storage(t *testing.T) {
+	storageVolume := func(t *testing.T, cfg *Config) (corev1.VolumeSource, appsv1.DeploymentStrategyType) {
+		t.Helper()
+		deployment := buildKBSDeployment(cfg)
+		for _, volume := range deployment.Spec.Template.Spec.Volumes {
+			if volume.Name == "confidential-containers" {
+				return volume.VolumeSource, deployment.Spec.Strategy.Type
+			}
+		}
+		t.Fatal("confidential-containers volume not found")
+		return corev1.VolumeSource{}, ""
+	}
+
+	cfg := &Config{Namespace: "coco", KBSImage: "test-image:latest"}
+	volume, strategy := storageVolume(t, cfg)
+	if volume.EmptyDir == nil || strategy != appsv1.RollingUpdateDeploymentStrategyType {
+		t.Errorf("default storage: volume = %+v, strategy = %q", volume, strategy)
+	}
+
+	cfg.Storage = StoragePVC
+	volume, strategy = storageVolume(t, cfg)
+	if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != kbsStoragePVCName || strategy != appsv1.RecreateDeploymentStrategyType {
+		t.Errorf("pvc storage: volume = %+v, strategy = %q", volume, strategy)
+	}
+}
+
+// pvcYAML is the subset of a PersistentVolumeClaim manifest the tests check.
+type pvcYAML struct {
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		AccessModes      []string `yaml:"accessModes"`
+		StorageClassName *string  `yaml:"storageClassName"`
+		Resources        struct {
+			Requests map[string]string `yaml:"requests"`
+		} `yaml:"resources"`
+	} `yaml:"spec"`
+}
+
+func TestBuildStoragePVC(t *testing.T) {
+	parse := func(t *testing.T, cfg *Config) pvcYAML {
+		t.Helper()
+		var pvc pvcYAML
+		if err := yaml.Unmarshal([]byte(objectsManifest(t, storagePVC(t, cfg))), &pvc); err != nil {
+			t.Fatalf("Failed to parse PVC YAML: %v", err)
+		}
+		return pvc
+	}
+
+	pvc := parse(t, &Config{Namespace: "coco", Storage: StoragePVC})
+	if pvc.Metadata.Name != kbsStoragePVCName || pvc.Metadata.Namespace != "coco" {
+		t.Errorf("metadata = %+v", pvc.Metadata)
+	}
+	if len(pvc.Spec.AccessModes) != 1 || pvc.Spec.AccessModes[0] != "ReadWriteOnce" {
+		t.Errorf("accessModes = %v", pvc.Spec.AccessModes)
+	}
+	if pvc.Spec.StorageClassName != nil || pvc.Spec.Resources.Requests["storage"] != DefaultStorageSize {
+		t.Errorf("defaults: storageClassName = %v, requests = %v", pvc.Spec.StorageClassName, pvc.Spec.Resources.Requests)
+	}
+
+	pvc = parse(t, &Config{Namespace: "coco", Storage: StoragePVC, StorageClass: "fast", StorageSize: "5Gi"})
+	if pvc.Metadata.Name != kbsStoragePVCName || pvc.Metadata.Namespace != "coco" {
+		t.Errorf("metadata = %+v", pvc.Metadata)
+	}
+	if len(pvc.Spec.AccessModes) != 1 || pvc.Spec.AccessModes[0] != "ReadWriteOnce" {
+		t.Errorf("accessModes = %v", pvc.Spec.AccessModes)
+	}
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName != "fast" || pvc.Spec.Resources.Requests["storage"] != "5Gi" {
+		t.Errorf("storageClassName = %v, requests = %v", pvc.Spec.StorageClassName, pvc.Spec.Resources.Requests)
+	}
+}
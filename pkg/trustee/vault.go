@@ -0,0 +1,273 @@
+package trustee
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Resource backends of the KBS resource plugin.
+const (
+	// ResourceBackendFile stores resources in the LocalFs repository inside
+	// the KBS pod.
+	ResourceBackendFile = "file"
+	// ResourceBackendVault stores resources in a HashiCorp Vault KV store.
+	ResourceBackendVault = "vault"
+
+	// ResourceBackendLabel records the resource backend on the KBS Deployment
+	// so that later commands know whether the LocalFs repository is in use.
+	ResourceBackendLabel = "confidential-devhub.github.io/kbs-resource-backend"
+)
+
+const (
+	// DefaultVaultMount is the default mount path of the Vault KV engine.
+	DefaultVaultMount = "secret"
+
+	// DefaultVaultK8sAuthPath is the default mount path of the Vault
+	// Kubernetes auth method.
+	DefaultVaultK8sAuthPath = "kubernetes"
+
+	// VaultImage runs the init container that obtains the Vault token and
+	// renders it into the KBS configuration, and the container that renews
+	// the token.
+	VaultImage = "docker.io/hashicorp/vault:1.20"
+
+	// kbsVaultSecretName is the Secret holding the Vault token and CA.
+	kbsVaultSecretName = "kbs-vault"
+
+	// kbsVaultDir is where the kbs-vault Secret is mounted.
+	kbsVaultDir = "/etc/kbs-vault"
+
+	// kbsConfigTemplateDir is where the init container reads kbs-config.toml
+	// with the token placeholder from.
+	kbsConfigTemplateDir = "/etc/kbs-config-template"
+
+	// kbsVaultTokenDir is the in-memory volume the init container shares the
+	// Vault token and its period with the renewer container through.
+	kbsVaultTokenDir = "/etc/kbs-vault-token"
+
+	// vaultTokenPlaceholder stands in for the Vault token in the kbs-config-cm
+	// ConfigMap, so that the token itself is never stored in a ConfigMap.
+	vaultTokenPlaceholder = "@VAULT_TOKEN@"
+)
+
+// VaultConfig configures the Vault KV resource backend of the KBS. Exactly
+// one of Token and K8sRole must be set.
+type VaultConfig struct {
+	// Address is the URL of the Vault server as reached from the KBS pod.
+	Address string
+	// MountPath is the mount path of the KV secrets engine; empty uses
+	// DefaultVaultMount.
+	MountPath string
+	// Token authenticates the KBS to Vault with a static token.
+	Token string
+	// K8sRole authenticates the KBS to Vault with the Kubernetes auth method,
+	// logging in as this role with the service account of the KBS pod.
+	K8sRole string
+	// K8sAuthPath is the mount path of the Kubernetes auth method; empty uses
+	// DefaultVaultK8sAuthPath.
+	K8sAuthPath string
+	// CACertPEM is the CA that issued the Vault serving certificate; leave it
+	// empty for publicly trusted certificates.
+	CACertPEM []byte
+}
+
+// Validate checks that the Vault address is an http(s) URL and that exactly
+// one authentication method is configured.
+func (v *VaultConfig) Validate() error {
+	u, err := url.Parse(v.Address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid Vault address %q: must be an http:// or https:// URL", v.Address)
+	}
+	if (v.Token == "") == (v.K8sRole == "") {
+		return fmt.Errorf("exactly one of a Vault token and a Kubernetes auth role is required")
+	}
+	if strings.ContainsAny(v.Token, "\"\\\n") {
+		return fmt.Errorf("invalid Vault token: contains reserved characters")
+	}
+	if strings.ContainsAny(v.Address+v.MountPath+v.K8sRole+v.K8sAuthPath, "\"\\\n") {
+		return fmt.Errorf("invalid Vault settings: quotes, backslashes and newlines are not allowed")
+	}
+	return nil
+}
+
+func (v *VaultConfig) mountPath() string {
+	if v.MountPath == "" {
+		return DefaultVaultMount
+	}
+	return strings.Trim(v.MountPath, "/")
+}
+
+func (v *VaultConfig) k8sAuthPath() string {
+	if v.K8sAuthPath == "" {
+		return DefaultVaultK8sAuthPath
+	}
+	return strings.Trim(v.K8sAuthPath, "/")
+}
+
+// kbsResourcePluginConfig returns the [[plugins]] entry of the resource plugin
+// in kbs-config.toml. With a Vault backend the token is left as a placeholder
+// for the init container to fill in.
+func kbsResourcePluginConfig(vault *VaultConfig) string {
+	if vault == nil {
+		return fmt.Sprintf(`[[plugins]]
+name = "resource"
+type = "LocalFs"
+dir_path = "%s"`, kbsRepositoryDir)
+	}
+	plugin := fmt.Sprintf(`[[plugins]]
+name = "resource"
+type = "Vault"
+vault_url = "%s"
+token = "%s"
+mount_path = "%s"
+verify_ssl = true`, vault.Address, vaultTokenPlaceholder, vault.mountPath())
+	if len(vault.CACertPEM) > 0 {
+		plugin += fmt.Sprintf(`
+ca_certs = ["%s/ca.crt"]`, kbsVaultDir)
+	}
+	return plugin
+}
+
+func buildVaultSecret(namespace string, vault *VaultConfig) *corev1.Secret {
+	data := map[string][]byte{}
+	if vault.Token != "" {
+		data["token"] = []byte(vault.Token)
+	}
+	if len(vault.CACertPEM) > 0 {
+		data["ca.crt"] = vault.CACertPEM
+	}
+	return dataSecret(kbsVaultSecretName, namespace, corev1.SecretTypeOpaque, data)
+}
+
+func deployVaultSecret(ctx context.Context, namespace string, vault *VaultConfig) error {
+	manifest, err := manifestYAML(buildVaultSecret(namespace, vault))
+	if err != nil {
+		return err
+	}
+	return applyManifest(ctx, manifest)
+}
+
+func deleteVaultSecret(ctx context.Context, clientset kubernetes.Interface, namespace string) error {
+	err := clientset.CoreV1().Secrets(namespace).Delete(ctx, kbsVaultSecretName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// vaultEnv returns the environment of the Vault containers of the KBS pod.
+func vaultEnv(vault *VaultConfig) []corev1.EnvVar {
+	env := []corev1.EnvVar{{Name: "VAULT_ADDR", Value: vault.Address}}
+	if vault.K8sRole != "" {
+		env = append(env,
+			corev1.EnvVar{Name: "VAULT_K8S_ROLE", Value: vault.K8sRole},
+			corev1.EnvVar{Name: "VAULT_K8S_AUTH_PATH", Value: vault.k8sAuthPath()})
+	}
+	if len(vault.CACertPEM) > 0 {
+		env = append(env, corev1.EnvVar{Name: "VAULT_CACERT", Value: kbsVaultDir + "/ca.crt"})
+	}
+	return env
+}
+
+// vaultInitContainer returns the init container of the KBS pod that obtains
+// the Vault token, either from the kbs-vault Secret or by logging in with the
+// pod's service account token, and writes kbs-config.toml with the token
+// filled in to the kbs-config volume.
+//
+// The KBS reads the token only once, so the init container refuses tokens
+// that would expire: the token must either have no TTL or be periodic, in
+// which case vaultRenewerContainer keeps renewing it.
+func vaultInitContainer(vault *VaultConfig) corev1.Container {
+	script := fmt.Sprintf(`set -e
+if [ -f %[1]s/token ]; then
+  VAULT_TOKEN=$(cat %[1]s/token)
+else
+  VAULT_TOKEN=$(vault write -field=token "auth/$VAULT_K8S_AUTH_PATH/login" role="$VAULT_K8S_ROLE" jwt=@/var/run/secrets/kubernetes.io/serviceaccount/token)
+fi
+export VAULT_TOKEN
+TTL=$(vault token lookup -field=ttl)
+PERIOD=$(vault token lookup -field=period 2>/dev/null || echo 0)
+if [ "$TTL" != "0" ] && [ "$PERIOD" = "0" ]; then
+  echo "The Vault token expires in ${TTL}s and is not periodic: use a periodic token, or a role with token_period set" >&2
+  exit 1
+fi
+printf '%%s' "$VAULT_TOKEN" > %[4]s/token
+printf '%%s' "$PERIOD" > %[4]s/period
+ESCAPED=$(printf '%%s' "$VAULT_TOKEN" | sed 's/[\\&|]/\\&/g')
+sed "s|%[2]s|$ESCAPED|" %[3]s/kbs-config.toml > /etc/kbs-config/kbs-config.toml
+`, kbsVaultDir, vaultTokenPlaceholder, kbsConfigTemplateDir, kbsVaultTokenDir)
+
+	return corev1.Container{
+		Name:            "vault-config",
+		Image:           VaultImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", script},
+		Env:             vaultEnv(vault),
+		SecurityContext: restrictedSecurityContext(),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "kbs-config-template", MountPath: kbsConfigTemplateDir},
+			{Name: "kbs-config", MountPath: "/etc/kbs-config"},
+			{Name: "kbs-vault", MountPath: kbsVaultDir, ReadOnly: true},
+			{Name: "kbs-vault-token", MountPath: kbsVaultTokenDir},
+		},
+	}
+}
+
+// vaultRenewerContainer returns the container of the KBS pod that renews a
+// periodic Vault token every third of its period, so that it never expires
+// while the KBS uses it. Tokens without a TTL need no renewal.
+func vaultRenewerContainer(vault *VaultConfig) corev1.Container {
+	script := fmt.Sprintf(`VAULT_TOKEN=$(cat %[1]s/token)
+PERIOD=$(cat %[1]s/period)
+export VAULT_TOKEN
+while true; do
+  if [ "$PERIOD" = "0" ]; then
+    sleep 3600
+  elif vault token renew > /dev/null; then
+    sleep $((PERIOD / 3 + 1))
+  else
+    echo "Failed to renew the Vault token, retrying" >&2
+    sleep 10
+  fi
+done
+`, kbsVaultTokenDir)
+
+	return corev1.Container{
+		Name:            "vault-token-renewer",
+		Image:           VaultImage,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{"/bin/sh", "-c", script},
+		Env:             vaultEnv(vault),
+		SecurityContext: restrictedSecurityContext(),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "kbs-vault", MountPath: kbsVaultDir, ReadOnly: true},
+			{Name: "kbs-vault-token", MountPath: kbsVaultTokenDir, ReadOnly: true},
+		},
+	}
+}
+
+// GetResourceBackend returns the resource backend of the KBS deployed in
+// namespace, as recorded in ResourceBackendLabel. Deployments without the
+// label use the LocalFs repository.
+func GetResourceBackend(ctx context.Context, clientset kubernetes.Interface, namespace string) (string, error) {
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: trusteeLabel,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get KBS deployment: %w", err)
+	}
+	if len(deployments.Items) == 0 {
+		return "", fmt.Errorf("no KBS deployment found in namespace %s", namespace)
+	}
+	if backend := deployments.Items[0].Labels[ResourceBackendLabel]; backend != "" {
+		return backend, nil
+	}
+	return ResourceBackendFile, nil
+}
@@ -0,0 +1,190 @@
+package trustee
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pelletier/go-toml/v2"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"gopkg.in/yaml.v3"
+	k8syaml "sigs.k8s.io/yaml"
+)
+
+func TestVaultConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name  string
+		vault VaultConfig
+		want  string
+	}{
+		{"token", VaultConfig{Address: "http://vault:8200", Token: "hvs.abc"}, ""},
+		{"k8s auth", VaultConfig{Address: "https://vault.example.com", K8sRole: "kbs"}, ""},
+		{"no scheme", VaultConfig{Address: "vault:8200", Token: "hvs.abc"}, "invalid Vault address"},
+		{"no auth", VaultConfig{Address: "http://vault:8200"}, "exactly one"},
+		{"both auth", VaultConfig{Address: "http://vault:8200", Token: "hvs.abc", K8sRole: "kbs"}, "exactly one"},
+		{"token with sed specials", VaultConfig{Address: "http://vault:8200", Token: "a|b&c"}, ""},
+		{"token with quote", VaultConfig{Address: "http://vault:8200", Token: `a"b`}, "invalid Vault token"},
+		{"quoted mount", VaultConfig{Address: "http://vault:8200", Token: "hvs.abc", MountPath: `kbs"`}, "not allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.vault.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildConfigMapsManifest_Vault(t *testing.T) {
+	vault := &VaultConfig{Address: "https://vault.example.com", Token: "hvs.secret", MountPath: "/kbs/", CACertPEM: []byte("ca")}
+	manifest := configMapsManifest(t, &Config{Namespace: "coco", Vault: vault})
+	if strings.Contains(manifest, "hvs.secret") {
+		t.Fatal("Vault token written to the ConfigMap")
+	}
+
+	var cm struct {
+		Data map[string]string `yaml:"data"`
+	}
+	if err := yaml.Unmarshal([]byte(strings.Split(manifest, "\n---\n")[0]), &cm); err != nil {
+		t.Fatalf("Failed to parse ConfigMap YAML: %v", err)
+	}
+	var kbsConfig struct {
+		Plugins []map[string]interface{} `toml:"plugins"`
+	}
+	if err := toml.Unmarshal([]byte(cm.Data["kbs-config.toml"]), &kbsConfig); err != nil {
+		t.Fatalf("kbs-config.toml is not valid TOML: %v\n%s", err, cm.Data["kbs-config.toml"])
+	}
+	if len(kbsConfig.Plugins) != 1 {
+		t.Fatalf("plugins = %v", kbsConfig.Plugins)
+	}
+	plugin := kbsConfig.Plugins[0]
+	if plugin["type"] != "Vault" || plugin["vault_url"] != vault.Address || plugin["token"] != vaultTokenPlaceholder || plugin["mount_path"] != "kbs" {
+		t.Errorf("resource plugin = %v", plugin)
+	}
+	if caCerts, ok := plugin["ca_certs"].([]interface{}); !ok || len(caCerts) != 1 || caCerts[0] != kbsVaultDir+"/ca.crt" {
+		t.Errorf("ca_certs = %v", plugin["ca_certs"])
+	}
+
+	if local := configMapsManifest(t, &Config{Namespace: "coco"}); !strings.Contains(local, `type = "LocalFs"`) || strings.Contains(local, "Vault") {
+		t.Errorf("LocalFs kbs-config.toml:\n%s", local)
+	}
+}
+
+func TestBuildKBSManifest_Vault(t *testing.T) {
+	var deployment appsv1.Deployment
+	parse := func(t *testing.T, cfg *Config) {
+		t.Helper()
+		deployment = appsv1.Deployment{}
+		documents := strings.Split(kbsManifest(t, cfg), "\n---\n")
+		if err := k8syaml.Unmarshal([]byte(documents[0]), &deployment); err != nil {
+			t.Fatalf("Failed to parse deployment YAML: %v", err)
+		}
+	}
+
+	parse(t, &Config{Namespace: "coco", KBSImage: "kbs:test"})
+	if got := deployment.Labels[ResourceBackendLabel]; got != ResourceBackendFile {
+		t.Errorf("LocalFs backend label = %q", got)
+	}
+	if len(deployment.Spec.Template.Spec.InitContainers) != 0 {
+		t.Error("LocalFs deployment has init containers")
+	}
+
+	parse(t, &Config{Namespace: "coco", KBSImage: "kbs:test", Vault: &VaultConfig{Address: "http://vault:8200", K8sRole: "kbs"}})
+	if got := deployment.Labels[ResourceBackendLabel]; got != ResourceBackendVault {
+		t.Errorf("Vault backend label = %q", got)
+	}
+	podSpec := deployment.Spec.Template.Spec
+	if len(podSpec.InitContainers) != 1 || podSpec.InitContainers[0].Image != VaultImage {
+		t.Fatalf("init containers = %+v", podSpec.InitContainers)
+	}
+	env := map[string]string{}
+	for _, e := range podSpec.InitContainers[0].Env {
+		env[e.Name] = e.Value
+	}
+	if env["VAULT_ADDR"] != "http://vault:8200" || env["VAULT_K8S_ROLE"] != "kbs" || env["VAULT_K8S_AUTH_PATH"] != DefaultVaultK8sAuthPath {
+		t.Errorf("init container env = %v", env)
+	}
+	if len(podSpec.Containers) != 2 || podSpec.Containers[0].Name != "kbs" || podSpec.Containers[1].Name != "vault-token-renewer" {
+		t.Fatalf("containers = %+v", podSpec.Containers)
+	}
+	if script := podSpec.Containers[1].Command[2]; !strings.Contains(script, "vault token renew") {
+		t.Errorf("renewer script does not renew the token:\n%s", script)
+	}
+	if script := podSpec.InitContainers[0].Command[2]; !strings.Contains(script, "not periodic") {
+		t.Errorf("init script does not reject expiring tokens:\n%s", script)
+	}
+	volumes := map[string]bool{}
+	for _, v := range podSpec.Volumes {
+		switch v.Name {
+		case "kbs-config":
+			volumes[v.Name] = v.EmptyDir != nil
+		case "kbs-config-template":
+			volumes[v.Name] = v.ConfigMap != nil && v.ConfigMap.Name == "kbs-config-cm"
+		case "kbs-vault":
+			volumes[v.Name] = v.Secret != nil && v.Secret.SecretName == kbsVaultSecretName
+		case "kbs-vault-token":
+			volumes[v.Name] = v.EmptyDir != nil
+		}
+	}
+	for _, name := range []string{"kbs-config", "kbs-config-template", "kbs-vault", "kbs-vault-token"} {
+		if !volumes[name] {
+			t.Errorf("volume %s missing or wrong: %+v", name, podSpec.Volumes)
+		}
+	}
+}
+
+func TestBuildVaultSecretManifest(t *testing.T) {
+	var secret struct {
+		Data map[string]string `yaml:"data"`
+	}
+	manifest := objectsManifest(t, buildVaultSecret("coco", &VaultConfig{Token: "hvs.abc", CACertPEM: []byte("ca")}))
+	if err := yaml.Unmarshal([]byte(manifest), &secret); err != nil {
+		t.Fatalf("Failed to parse Secret YAML: %v", err)
+	}
+	if secret.Data["token"] != "aHZzLmFiYw==" || secret.Data["ca.crt"] != "Y2E=" {
+		t.Errorf("data = %v", secret.Data)
+	}
+
+	secret.Data = nil
+	if err := yaml.Unmarshal([]byte(objectsManifest(t, buildVaultSecret("coco", &VaultConfig{K8sRole: "kbs"}))), &secret); err != nil {
+		t.Fatalf("Failed to parse Secret YAML: %v", err)
+	}
+	if len(secret.Data) != 0 {
+		t.Errorf("k8s auth data = %v", secret.Data)
+	}
+}
+
+func TestGetResourceBackend(t *testing.T) {
+	ctx := context.Background()
+	deployment := func(ns string, labels map[string]string) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "trustee-deployment", Namespace: ns, Labels: labels}}
+	}
+	clientset := fake.NewSimpleClientset(
+		deployment("legacy", map[string]string{"app": "kbs"}),
+		deployment("vault", map[string]string{"app": "kbs", ResourceBackendLabel: ResourceBackendVault}),
+	)
+
+	if backend, err := GetResourceBackend(ctx, clientset, "legacy"); err != nil || backend != ResourceBackendFile {
+		t.Errorf("GetResourceBackend(legacy) = %q, %v", backend, err)
+	}
+	if backend, err := GetResourceBackend(ctx, clientset, "vault"); err != nil || backend != ResourceBackendVault {
+		t.Errorf("GetResourceBackend(vault) = %q, %v", backend, err)
+	}
+	if _, err := GetResourceBackend(ctx, clientset, "empty"); err == nil {
+		t.Error("GetResourceBackend(empty) expected error")
+	}
+
+	if _, err := ListRepositoryResources(ctx, clientset, "vault", ""); err == nil || !strings.Contains(err.Error(), "stores resources in vault") {
+		t.Errorf("ListRepositoryResources() on Vault backend error = %v", err)
+	}
+}
@@ -1,13 +1,13 @@
 module github.com/confidential-devhub/cococtl/sidecar
 
-go 1.24
+go 1.25.0
 
 require (
+	github.com/confidential-devhub/cococtl v0.0.0-00010101000000-000000000000
 	github.com/go-resty/resty/v2 v2.15.3
-	golang.org/x/crypto v0.29.0
 )
 
-require (
-	golang.org/x/net v0.31.0 // indirect
-	golang.org/x/sys v0.27.0 // indirect
-)
+require golang.org/x/net v0.47.0 // indirect
+
+// The sidecar shares the configuration schema with the CLI.
+replace github.com/confidential-devhub/cococtl => ../
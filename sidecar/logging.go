@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/sidecarconfig"
+)
+
+// Log severities, in increasing order. The sidecar logs through the standard
+// logger and marks severity with "FATAL:", "ERROR:" and "WARNING:" prefixes;
+// every other line is informational. Fatal lines are never filtered.
+const (
+	severityInfo = iota
+	severityWarn
+	severityError
+	severityFatal
+)
+
+// levelWriter drops log lines below a minimum severity.
+type levelWriter struct {
+	out io.Writer
+	min int
+}
+
+func (w *levelWriter) Write(p []byte) (int, error) {
+	if lineSeverity(p) < w.min {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+func lineSeverity(line []byte) int {
+	switch {
+	case bytes.Contains(line, []byte("FATAL:")):
+		return severityFatal
+	case bytes.Contains(line, []byte("ERROR:")):
+		return severityError
+	case bytes.Contains(line, []byte("WARNING:")):
+		return severityWarn
+	default:
+		return severityInfo
+	}
+}
+
+// fatalf logs a FATAL line, which passes any log level, and exits. The
+// sidecar uses it instead of log.Fatalf so that the reason it stopped is
+// always logged.
+func fatalf(format string, v ...any) {
+	_ = log.Output(2, "FATAL: "+fmt.Sprintf(format, v...))
+	os.Exit(1)
+}
+
+// setLogLevel configures the standard logger for the given configuration log
+// level. The sidecar has no debug-only messages, so debug behaves like info.
+func setLogLevel(level string) {
+	minSeverity := severityInfo
+	switch level {
+	case sidecarconfig.LogLevelWarn:
+		minSeverity = severityWarn
+	case sidecarconfig.LogLevelError:
+		minSeverity = severityError
+	}
+	log.SetOutput(&levelWriter{out: os.Stderr, min: minSeverity})
+}
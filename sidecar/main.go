@@ -2,11 +2,15 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/sidecarconfig"
+	"github.com/confidential-devhub/cococtl/sidecar/pkg/cdh"
 	"github.com/confidential-devhub/cococtl/sidecar/pkg/certs"
 	"github.com/confidential-devhub/cococtl/sidecar/pkg/server"
 	"github.com/confidential-devhub/cococtl/sidecar/pkg/status"
@@ -15,97 +19,152 @@ import (
 func main() {
 	log.Println("Starting CoCo Secure Access Sidecar...")
 
-	config := readConfig()
+	// CDH_URL overrides the default CDH endpoint (http://127.0.0.1:8006)
+	cdhClient, err := cdh.NewClientFromEnv()
+	if err != nil {
+		fatalf("Invalid configuration: %v", err)
+	}
+	log.Printf("Configuration: CDH endpoint %s", cdhClient.BaseURL())
+
+	config, err := loadConfig(cdhClient)
+	if err != nil {
+		fatalf("Invalid configuration: %v", err)
+	}
+	setLogLevel(config.LogLevel)
+	log.Printf("Configuration: HTTPS port %d, log level %s, %d route(s), %d auth rule(s)",
+		config.HTTPSPort, config.LogLevel, len(config.Routes), len(config.Auth.Rules))
 
 	// Fetch TLS certificates and Client CA from CDH/KBS
 	log.Println("Fetching certificates from KBS via CDH...")
 	tlsCert, tlsKey, clientCA, err := certs.FetchAllCerts(
-		config.TLSCertURI,
-		config.TLSKeyURI,
-		config.ClientCAURI,
+		cdhClient,
+		config.TLS.CertURI,
+		config.TLS.KeyURI,
+		config.TLS.ClientCAURI,
 	)
 	if err != nil {
-		log.Fatalf("Failed to fetch certificates: %v", err)
+		fatalf("Failed to fetch certificates: %v", err)
 	}
 	log.Println("Successfully fetched all certificates from KBS")
 
 	// Initialize status collector
-	statusCollector := status.NewCollector()
+	statusCollector := status.NewCollector(cdhClient)
+	if interval := config.Refresh.Attestation.Duration; interval > 0 {
+		log.Printf("Configuration: attestation status refreshed every %s", interval)
+		statusCollector.StartRefresh(interval)
+	}
 
 	// Start HTTPS server with mTLS
 	log.Printf("Starting HTTPS server with mTLS on port %d...", config.HTTPSPort)
 	httpsServer := server.NewHTTPSServer(
-		config.HTTPSPort,
+		config,
 		tlsCert,
 		tlsKey,
 		clientCA,
 		statusCollector,
-		config.ForwardPort,
 	)
+	if interval := config.Refresh.Certificates.Duration; interval > 0 {
+		log.Printf("Configuration: certificates refreshed every %s", interval)
+		go refreshCertificates(cdhClient, config, httpsServer, interval)
+	}
 	if err := httpsServer.Start(); err != nil {
-		log.Fatalf("HTTPS server failed: %v", err)
+		fatalf("HTTPS server failed: %v", err)
 	}
 }
 
-// Config represents the sidecar configuration
-type Config struct {
-	HTTPSPort   int
-	TLSCertURI  string
-	TLSKeyURI   string
-	ClientCAURI string
-	ForwardPort int
-}
+// loadConfig loads the sidecar configuration document. Sources are tried in order:
+//  1. CONFIG_FILE: path to a local configuration document
+//  2. CONFIG_URI: KBS URI of the configuration document, fetched via CDH
+//  3. Legacy environment variables (HTTPS_PORT, FORWARD_PORT, TLS_CERT_URI,
+//     TLS_KEY_URI, CLIENT_CA_URI)
+//
+// In every case the resulting configuration is validated strictly.
+func loadConfig(cdhClient *cdh.Client) (*sidecarconfig.Config, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		log.Printf("Configuration: loading from file %s", path)
+		data, err := os.ReadFile(path) // #nosec G304 -- path is set by the pod spec
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CONFIG_FILE: %w", err)
+		}
+		return sidecarconfig.Parse(data)
+	}
 
-func readConfig() *Config {
-	httpsPort, _ := strconv.Atoi(getEnvOrDefault("HTTPS_PORT", "8443"))
-	log.Printf("Configuration: HTTPS port set to %d", httpsPort)
-
-	forwardPort := 0
-	if portStr := os.Getenv("FORWARD_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(strings.TrimSpace(portStr)); err == nil {
-			forwardPort = port
-			log.Printf("Configuration: Forward port configured: %d", forwardPort)
-		} else {
-			log.Printf("WARNING: Invalid FORWARD_PORT value: %s", portStr)
+	if uri := os.Getenv("CONFIG_URI"); uri != "" {
+		log.Printf("Configuration: fetching from KBS URI %s", uri)
+		data, err := cdhClient.GetResource(uri)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch CONFIG_URI: %w", err)
 		}
-	} else {
-		log.Println("Configuration: No forward port configured")
+		return sidecarconfig.Parse(data)
 	}
 
-	tlsCertURI := os.Getenv("TLS_CERT_URI")
-	tlsKeyURI := os.Getenv("TLS_KEY_URI")
-	clientCAURI := os.Getenv("CLIENT_CA_URI")
+	log.Println("Configuration: CONFIG_FILE and CONFIG_URI not set, reading environment variables")
+	return configFromEnv()
+}
 
-	if tlsCertURI != "" {
-		log.Printf("Configuration: TLS_CERT_URI set")
-	} else {
-		log.Println("WARNING: TLS_CERT_URI not set")
+// configFromEnv builds the configuration from the legacy environment variables.
+// Unlike earlier releases, malformed values are rejected instead of ignored.
+func configFromEnv() (*sidecarconfig.Config, error) {
+	cfg := &sidecarconfig.Config{
+		Version: sidecarconfig.Version,
+		TLS: sidecarconfig.TLS{
+			CertURI:     os.Getenv("TLS_CERT_URI"),
+			KeyURI:      os.Getenv("TLS_KEY_URI"),
+			ClientCAURI: os.Getenv("CLIENT_CA_URI"),
+		},
 	}
 
-	if tlsKeyURI != "" {
-		log.Printf("Configuration: TLS_KEY_URI set")
-	} else {
-		log.Println("WARNING: TLS_KEY_URI not set")
+	var err error
+	if cfg.HTTPSPort, err = envPort("HTTPS_PORT"); err != nil {
+		return nil, err
+	}
+	if cfg.ForwardPort, err = envPort("FORWARD_PORT"); err != nil {
+		return nil, err
 	}
 
-	if clientCAURI != "" {
-		log.Printf("Configuration: CLIENT_CA_URI set")
-	} else {
-		log.Println("WARNING: CLIENT_CA_URI not set")
+	cfg.ApplyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
 
-	return &Config{
-		HTTPSPort:   httpsPort,
-		TLSCertURI:  tlsCertURI,
-		TLSKeyURI:   tlsKeyURI,
-		ClientCAURI: clientCAURI,
-		ForwardPort: forwardPort,
+// envPort parses a port from the named environment variable.
+// It returns 0 when the variable is unset.
+func envPort(key string) (int, error) {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return 0, nil
 	}
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s value %q: %w", key, value, err)
+	}
+	return port, nil
 }
 
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// refreshCertificates periodically re-fetches the TLS material from KBS and
+// hands it to the server. Failures keep the current certificates in place.
+func refreshCertificates(cdhClient *cdh.Client, config *sidecarconfig.Config, httpsServer *server.HTTPSServer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		log.Println("Refreshing certificates from KBS...")
+		tlsCert, tlsKey, clientCA, err := certs.FetchAllCerts(
+			cdhClient,
+			config.TLS.CertURI,
+			config.TLS.KeyURI,
+			config.TLS.ClientCAURI,
+		)
+		if err != nil {
+			log.Printf("ERROR: Certificate refresh failed, keeping current certificates: %v", err)
+			continue
+		}
+		if err := httpsServer.UpdateCertificates(tlsCert, tlsKey, clientCA); err != nil {
+			log.Printf("ERROR: Refreshed certificates rejected, keeping current certificates: %v", err)
+			continue
+		}
+		log.Println("Certificates refreshed successfully")
 	}
-	return defaultValue
 }
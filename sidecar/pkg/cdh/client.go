@@ -0,0 +1,83 @@
+// Package cdh provides a client for the Confidential Data Hub resource API
+package cdh
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/confidential-devhub/cococtl/pkg/kbsuri"
+	"github.com/go-resty/resty/v2"
+)
+
+// requestTimeout bounds a single CDH request; CDH may need to attest first.
+const requestTimeout = 60 * time.Second
+
+// Client fetches KBS resources through CDH
+type Client struct {
+	baseURL string
+	http    *resty.Client
+}
+
+// NewClient creates a CDH client for the given base URL (e.g. http://127.0.0.1:8006).
+// An empty baseURL selects kbsuri.DefaultCDHURL.
+func NewClient(baseURL string) (*Client, error) {
+	if baseURL == "" {
+		baseURL = kbsuri.DefaultCDHURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CDH URL %q: %w", baseURL, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid CDH URL %q: must be an http(s) URL with a host", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("invalid CDH URL %q: must not contain a query or fragment", baseURL)
+	}
+
+	return &Client{
+		baseURL: baseURL,
+		http:    resty.New().SetTimeout(requestTimeout),
+	}, nil
+}
+
+// NewClientFromEnv creates a CDH client using the CDH_URL environment variable,
+// falling back to kbsuri.DefaultCDHURL when it is not set.
+func NewClientFromEnv() (*Client, error) {
+	return NewClient(os.Getenv("CDH_URL"))
+}
+
+// BaseURL returns the CDH base URL
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// GetResource retrieves a resource from KBS via CDH. The KBS URI is validated
+// before any request is made.
+func (c *Client) GetResource(kbsURI string) ([]byte, error) {
+	uri, err := kbsuri.Parse(kbsURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// kbs://<host>/repo/type/tag -> <base>/cdh/resource/repo/type/tag
+	resourceURL := uri.CDHURL(c.baseURL)
+	log.Printf("Sending GET request to CDH: %s", resourceURL)
+	resp, err := c.http.R().Get(resourceURL)
+	if err != nil {
+		log.Printf("ERROR: CDH request failed for URL %s: %v", resourceURL, err)
+		return nil, fmt.Errorf("CDH request failed: %w", err)
+	}
+
+	log.Printf("CDH response status: %d", resp.StatusCode())
+	if resp.StatusCode() != 200 {
+		log.Printf("ERROR: CDH returned non-200 status %d for URL %s: %s", resp.StatusCode(), resourceURL, resp.String())
+		return nil, fmt.Errorf("CDH returned status %d: %s", resp.StatusCode(), resp.String())
+	}
+
+	log.Printf("Successfully retrieved resource from CDH (%d bytes)", len(resp.Body()))
+	return resp.Body(), nil
+}
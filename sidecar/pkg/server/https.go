@@ -10,100 +10,125 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/confidential-devhub/cococtl/pkg/sidecar/sidecarconfig"
 	"github.com/confidential-devhub/cococtl/sidecar/pkg/status"
 )
 
 // HTTPSServer represents the HTTPS server with mTLS
 type HTTPSServer struct {
-	port        int
-	serverCert  []byte
-	serverKey   []byte
-	clientCA    []byte
-	collector   *status.Collector
-	forwardPort int
+	config     *sidecarconfig.Config
+	serverCert []byte
+	serverKey  []byte
+	clientCA   []byte
+	collector  *status.Collector
+
+	// tlsMu guards the parsed TLS material, which may be replaced at runtime
+	// by UpdateCertificates.
+	tlsMu        sync.RWMutex
+	certificate  *tls.Certificate
+	clientCAPool *x509.CertPool
 }
 
-// NewHTTPSServer creates a new HTTPS server
-func NewHTTPSServer(port int, serverCert, serverKey, clientCA []byte,
-	collector *status.Collector, forwardPort int) *HTTPSServer {
+// NewHTTPSServer creates a new HTTPS server serving the routes and enforcing the
+// authorization rules of the given configuration.
+func NewHTTPSServer(config *sidecarconfig.Config, serverCert, serverKey, clientCA []byte,
+	collector *status.Collector) *HTTPSServer {
 	return &HTTPSServer{
-		port:        port,
-		serverCert:  serverCert,
-		serverKey:   serverKey,
-		clientCA:    clientCA,
-		collector:   collector,
-		forwardPort: forwardPort,
+		config:     config,
+		serverCert: serverCert,
+		serverKey:  serverKey,
+		clientCA:   clientCA,
+		collector:  collector,
 	}
 }
 
-// Start starts the HTTPS server
-func (s *HTTPSServer) Start() error {
-	log.Println("Initializing HTTPS server...")
-
-	// Load server certificate and key
-	log.Println("Loading server TLS certificate and key...")
-	cert, err := tls.X509KeyPair(s.serverCert, s.serverKey)
+// UpdateCertificates replaces the server certificate, key and client CA used for
+// new TLS connections. Existing connections are not affected.
+func (s *HTTPSServer) UpdateCertificates(serverCert, serverKey, clientCA []byte) error {
+	cert, err := tls.X509KeyPair(serverCert, serverKey)
 	if err != nil {
-		log.Printf("ERROR: Failed to load server certificate: %v", err)
 		return fmt.Errorf("failed to load server certificate: %w", err)
 	}
-	log.Println("Successfully loaded server TLS certificate and key")
 
-	// Create client CA pool
-	log.Println("Setting up client CA certificate pool for mTLS...")
 	clientCAPool := x509.NewCertPool()
-	if !clientCAPool.AppendCertsFromPEM(s.clientCA) {
-		log.Println("ERROR: Failed to parse client CA certificate")
+	if !clientCAPool.AppendCertsFromPEM(clientCA) {
 		return fmt.Errorf("failed to parse client CA certificate")
 	}
-	log.Println("Successfully configured client CA certificate pool")
+
+	s.tlsMu.Lock()
+	defer s.tlsMu.Unlock()
+	s.certificate = &cert
+	s.clientCAPool = clientCAPool
+	return nil
+}
+
+// tlsConfigForClient returns the mTLS configuration built from the current certificates.
+func (s *HTTPSServer) tlsConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	s.tlsMu.RLock()
+	defer s.tlsMu.RUnlock()
+	return &tls.Config{
+		Certificates: []tls.Certificate{*s.certificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    s.clientCAPool,
+		MinVersion:   tls.VersionTLS13,
+	}, nil
+}
+
+// Start starts the HTTPS server
+func (s *HTTPSServer) Start() error {
+	log.Println("Initializing HTTPS server...")
+
+	// Load server certificate, key and client CA pool
+	log.Println("Loading server TLS certificate, key and client CA...")
+	if err := s.UpdateCertificates(s.serverCert, s.serverKey, s.clientCA); err != nil {
+		log.Printf("ERROR: %v", err)
+		return err
+	}
+	log.Println("Successfully loaded server TLS certificate, key and client CA")
 
 	// TLS configuration with mTLS
 	log.Println("Configuring TLS with mTLS (TLS 1.3+)...")
 	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		ClientCAs:    clientCAPool,
-		MinVersion:   tls.VersionTLS13,
+		MinVersion:         tls.VersionTLS13,
+		GetConfigForClient: s.tlsConfigForClient,
 	}
 	log.Println("TLS configuration complete - client certificates will be required and verified")
 
 	// Setup routes
 	log.Println("Registering HTTP routes...")
 	mux := http.NewServeMux()
-
-	// Always register API endpoints
-	mux.HandleFunc("/api/status", s.serveStatusAPI)
-	log.Println("  Registered route: /api/status (Status API)")
-	mux.HandleFunc("/api/attestation", s.serveAttestationAPI)
-	log.Println("  Registered route: /api/attestation (Attestation API)")
-
-	// Setup port forwarding
-	if s.forwardPort > 0 {
-		// Serve application at root for seamless proxying
-		log.Printf("Port forwarding: serving localhost:%d at root /", s.forwardPort)
-		mux.HandleFunc("/dashboard", s.serveDashboard)
-		log.Println("  Registered route: /dashboard (Dashboard)")
-		mux.Handle("/", s.createReverseProxy(s.forwardPort))
-		log.Printf("  Registered route: / (Forward to localhost:%d)", s.forwardPort)
-	} else {
-		// No port forwarding: just dashboard
-		log.Println("No port forwarding configured")
-		mux.HandleFunc("/", s.serveDashboard)
-		log.Println("  Registered route: / (Dashboard)")
+	for _, route := range s.config.Routes {
+		switch route.Handler {
+		case sidecarconfig.HandlerDashboard:
+			mux.HandleFunc(route.Path, s.serveDashboard)
+			log.Printf("  Registered route: %s (Dashboard)", route.Path)
+		case sidecarconfig.HandlerStatus:
+			mux.HandleFunc(route.Path, s.serveStatusAPI)
+			log.Printf("  Registered route: %s (Status API)", route.Path)
+		case sidecarconfig.HandlerAttestation:
+			mux.HandleFunc(route.Path, s.serveAttestationAPI)
+			log.Printf("  Registered route: %s (Attestation API)", route.Path)
+		case sidecarconfig.HandlerProxy:
+			mux.Handle(route.Path, s.createReverseProxy(route.Port))
+			log.Printf("  Registered route: %s (Forward to localhost:%d)", route.Path, route.Port)
+		default:
+			return fmt.Errorf("unknown handler %q for route %s", route.Handler, route.Path)
+		}
 	}
 
 	// Create HTTPS server
 	server := &http.Server{
-		Addr:              fmt.Sprintf(":%d", s.port),
-		Handler:           loggingMiddleware(mux),
+		Addr:              fmt.Sprintf(":%d", s.config.HTTPSPort),
+		Handler:           loggingMiddleware(s.authMiddleware(mux)),
 		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	log.Printf("HTTPS server listening on :%d (mTLS enabled)", s.port)
+	log.Printf("HTTPS server listening on :%d (mTLS enabled)", s.config.HTTPSPort)
 	return server.ListenAndServeTLS("", "")
 }
 
@@ -194,6 +219,29 @@ func (s *HTTPSServer) createReverseProxy(targetPort int) http.Handler {
 	})
 }
 
+// authMiddleware enforces the configured authorization rules: when a rule matches
+// the request path, the client certificate Common Name must be one of its allowed names.
+func (s *HTTPSServer) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := s.config.Auth.AllowedCNs(r.URL.Path)
+		if allowed == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		clientCN := ""
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			clientCN = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		if !slices.Contains(allowed, clientCN) {
+			log.Printf("WARNING: Denied %s %s to client %q: not in allowed CNs", r.Method, r.URL.Path, clientCN)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		clientCN := "unknown"
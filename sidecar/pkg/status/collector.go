@@ -6,14 +6,15 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-resty/resty/v2"
+	"github.com/confidential-devhub/cococtl/sidecar/pkg/cdh"
 )
 
 const (
-	// CDH endpoint for attestation status
-	attestationStatusURL = "http://localhost:8006/cdh/resource/default/attestation-status/status"
+	// KBS resource holding the attestation status, fetched via CDH
+	attestationStatusURI = "kbs:///default/attestation-status/status"
 )
 
 // Status represents the current pod status
@@ -32,6 +33,8 @@ type Attestation struct {
 
 // Collector collects status information
 type Collector struct {
+	mu                sync.RWMutex
+	cdhClient         *cdh.Client
 	podName           string
 	namespace         string
 	attested          bool
@@ -40,8 +43,8 @@ type Collector struct {
 	attestationError  string
 }
 
-// NewCollector creates a new status collector
-func NewCollector() *Collector {
+// NewCollector creates a new status collector that queries CDH through cdhClient
+func NewCollector(cdhClient *cdh.Client) *Collector {
 	log.Println("Initializing status collector...")
 
 	podName := getEnv("POD_NAME", "unknown")
@@ -50,6 +53,7 @@ func NewCollector() *Collector {
 	log.Printf("Pod information: name=%s, namespace=%s", podName, namespace)
 
 	c := &Collector{
+		cdhClient: cdhClient,
 		podName:   podName,
 		namespace: namespace,
 	}
@@ -62,12 +66,27 @@ func NewCollector() *Collector {
 	return c
 }
 
+// StartRefresh re-fetches the attestation status from CDH every interval in the background.
+func (c *Collector) StartRefresh(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			c.fetchAttestationStatus()
+		}
+	}()
+}
+
 // fetchAttestationStatus retrieves attestation status from CDH
 func (c *Collector) fetchAttestationStatus() {
-	log.Printf("Fetching attestation status from CDH: %s", attestationStatusURL)
-	client := resty.New()
+	log.Printf("Fetching attestation status from CDH: %s", attestationStatusURI)
+
+	// Query CDH before taking the lock so that readers are not blocked on the request
+	body, err := c.cdhClient.GetResource(attestationStatusURI)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	resp, err := client.R().Get(attestationStatusURL)
 	if err != nil {
 		log.Printf("ERROR: Failed to fetch attestation status from CDH: %v", err)
 		c.attested = false
@@ -76,17 +95,8 @@ func (c *Collector) fetchAttestationStatus() {
 		return
 	}
 
-	log.Printf("CDH attestation status response: HTTP %d", resp.StatusCode())
-	if resp.StatusCode() != 200 {
-		log.Printf("ERROR: CDH returned non-200 status %d for attestation: %s", resp.StatusCode(), resp.String())
-		c.attested = false
-		c.attestationStatus = "unavailable"
-		c.attestationError = resp.String()
-		return
-	}
-
 	// Check if response contains "success"
-	statusValue := strings.TrimSpace(string(resp.Body()))
+	statusValue := strings.TrimSpace(string(body))
 	c.attestationTime = time.Now()
 	log.Printf("Attestation status value from CDH: '%s'", statusValue)
 
@@ -105,6 +115,9 @@ func (c *Collector) fetchAttestationStatus() {
 
 // Collect gathers current status
 func (c *Collector) Collect() *Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	log.Printf("Collecting status: pod=%s, namespace=%s, attested=%v", c.podName, c.namespace, c.attested)
 	return &Status{
 		PodName:   c.podName,
@@ -115,6 +128,9 @@ func (c *Collector) Collect() *Status {
 
 // GetAttestation returns attestation details
 func (c *Collector) GetAttestation() *Attestation {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	details := "TEE attestation successful"
 	if c.attestationError != "" {
 		details = c.attestationError